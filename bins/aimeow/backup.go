@@ -0,0 +1,736 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mattn/go-sqlite3"
+)
+
+// backupFormat is the version of the backup archive layout
+const backupFormat = 1
+
+// Entries of a backup archive. Media keeps its path relative to the data directory.
+const (
+	backupManifestName = "manifest.json"
+	backupDatabaseName = "aimeow.db"
+	backupMediaDir     = "files"
+)
+
+// Encrypted backups start with backupMagic and a random salt, followed by the gzip-compressed
+// tar archive sealed with AES-256-GCM in chunks of backupChunkSize
+const (
+	backupMagic         = "AIMEOWE1"
+	backupSaltSize      = 16
+	backupChunkSize     = 64 << 10
+	backupKeyIterations = 600000
+	backupFinalChunk    = 1 << 31
+)
+
+// errInvalidBackup marks archives that can't be restored, as opposed to I/O failures
+var errInvalidBackup = errors.New("invalid backup")
+
+// errRestoreDirNotEmpty is returned when a restore targets a data directory that is in use
+var errRestoreDirNotEmpty = errors.New("data directory is not empty")
+
+// BackupManifest describes the contents of a backup archive. It is the last entry of the archive
+// and is checked against the restored files.
+type BackupManifest struct {
+	Format         int            `json:"format"`
+	CreatedAt      time.Time      `json:"createdAt"`
+	SchemaVersion  int            `json:"schemaVersion"` // Version of the aimeow tables in the database
+	Encrypted      bool           `json:"encrypted"`
+	Clients        []BackupClient `json:"clients"`        // Client ID mappings of the paired devices
+	PendingClients []string       `json:"pendingClients"` // Clients created but not paired yet
+	Database       BackupFile     `json:"database"`
+	Media          []BackupFile   `json:"media"`
+}
+
+// BackupClient is a paired device and its client ID
+type BackupClient struct {
+	ClientID   string `json:"clientId"`
+	WhatsAppID string `json:"whatsappId"`
+}
+
+// BackupFile is a file of a backup archive with its checksum
+type BackupFile struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// backupOptions selects what a backup contains
+type backupOptions struct {
+	Passphrase string // Encrypts the archive when set
+	SkipMedia  bool
+}
+
+// snapshotDatabase copies the database to a temporary file with the SQLite online backup API,
+// so the copy is consistent while clients keep writing. The caller removes the file.
+func snapshotDatabase(ctx context.Context, db *sql.DB) (string, BackupManifest, error) {
+	var manifest BackupManifest
+	if dbDialect != dialectSQLite {
+		return "", manifest, fmt.Errorf("backups of PostgreSQL databases are not supported, back up the database with pg_dump")
+	}
+
+	tmp, err := os.CreateTemp("", "aimeow-backup-*.db")
+	if err != nil {
+		return "", manifest, fmt.Errorf("failed to create database snapshot: %w", err)
+	}
+	snapshotPath := tmp.Name()
+	tmp.Close()
+	if err := backupSQLite(ctx, db, snapshotPath); err != nil {
+		os.Remove(snapshotPath)
+		return "", manifest, fmt.Errorf("failed to snapshot database: %w", err)
+	}
+
+	manifest, err = describeSnapshot(ctx, snapshotPath)
+	if err != nil {
+		os.Remove(snapshotPath)
+		return "", manifest, err
+	}
+	return snapshotPath, manifest, nil
+}
+
+// backupSQLite copies the main database of src into the SQLite file at destPath
+func backupSQLite(ctx context.Context, src *sql.DB, destPath string) error {
+	dest, err := sql.Open(dialectSQLite, destPath)
+	if err != nil {
+		return err
+	}
+	defer dest.Close()
+
+	destConn, err := dest.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer destConn.Close()
+	srcConn, err := src.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer srcConn.Close()
+
+	return destConn.Raw(func(destDriver interface{}) error {
+		return srcConn.Raw(func(srcDriver interface{}) error {
+			backup, err := destDriver.(*sqlite3.SQLiteConn).Backup("main", srcDriver.(*sqlite3.SQLiteConn), "main")
+			if err != nil {
+				return err
+			}
+			if _, err := backup.Step(-1); err != nil {
+				backup.Finish()
+				return err
+			}
+			return backup.Finish()
+		})
+	})
+}
+
+// describeSnapshot reads the schema version and client state of a database snapshot
+func describeSnapshot(ctx context.Context, snapshotPath string) (BackupManifest, error) {
+	manifest := BackupManifest{
+		Format:         backupFormat,
+		CreatedAt:      time.Now().UTC(),
+		Clients:        make([]BackupClient, 0),
+		PendingClients: make([]string, 0),
+		Media:          make([]BackupFile, 0),
+	}
+	db, err := sql.Open(dialectSQLite, "file:"+snapshotPath+"?mode=ro")
+	if err != nil {
+		return manifest, fmt.Errorf("failed to open database snapshot: %w", err)
+	}
+	defer db.Close()
+
+	if err := db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM aimeow_version`).Scan(&manifest.SchemaVersion); err != nil {
+		return manifest, fmt.Errorf("failed to read schema version of snapshot: %w", err)
+	}
+	rows, err := db.QueryContext(ctx, `SELECT client_id, whatsapp_id FROM aimeow_client_mappings ORDER BY client_id`)
+	if err != nil {
+		return manifest, fmt.Errorf("failed to read client mappings of snapshot: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var client BackupClient
+		if err := rows.Scan(&client.ClientID, &client.WhatsAppID); err != nil {
+			return manifest, fmt.Errorf("failed to read client mapping of snapshot: %w", err)
+		}
+		manifest.Clients = append(manifest.Clients, client)
+	}
+	rows.Close()
+
+	rows, err = db.QueryContext(ctx, `SELECT client_id FROM aimeow_pending_clients ORDER BY client_id`)
+	if err != nil {
+		return manifest, fmt.Errorf("failed to read pending clients of snapshot: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var clientID string
+		if err := rows.Scan(&clientID); err != nil {
+			return manifest, fmt.Errorf("failed to read pending client of snapshot: %w", err)
+		}
+		manifest.PendingClients = append(manifest.PendingClients, clientID)
+	}
+	return manifest, rows.Err()
+}
+
+// writeBackupArchive writes the database snapshot, the media of the data directory and the
+// manifest as a gzip-compressed tar archive, encrypted when a passphrase is set
+func writeBackupArchive(w io.Writer, snapshotPath, dir string, manifest BackupManifest, opts backupOptions) (BackupManifest, error) {
+	out := w
+	var encrypter *backupEncrypter
+	if opts.Passphrase != "" {
+		var err error
+		if encrypter, err = newBackupEncrypter(w, opts.Passphrase); err != nil {
+			return manifest, err
+		}
+		out = encrypter
+		manifest.Encrypted = true
+	}
+	gz := gzip.NewWriter(out)
+	archive := tar.NewWriter(gz)
+
+	var err error
+	if manifest.Database, err = addBackupFile(archive, snapshotPath, backupDatabaseName); err != nil {
+		return manifest, err
+	}
+	if !opts.SkipMedia {
+		root := filepath.Join(dir, backupMediaDir)
+		err := filepath.WalkDir(root, func(filePath string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				if filePath == root && errors.Is(err, fs.ErrNotExist) {
+					return nil
+				}
+				return err
+			}
+			if !entry.Type().IsRegular() {
+				return nil
+			}
+			rel, err := filepath.Rel(dir, filePath)
+			if err != nil {
+				return err
+			}
+			file, err := addBackupFile(archive, filePath, filepath.ToSlash(rel))
+			if err != nil {
+				return err
+			}
+			manifest.Media = append(manifest.Media, file)
+			return nil
+		})
+		if err != nil {
+			return manifest, fmt.Errorf("failed to add media: %w", err)
+		}
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return manifest, fmt.Errorf("failed to marshal manifest: %w", err)
+	}
+	header := &tar.Header{Name: backupManifestName, Mode: 0600, Size: int64(len(data)), ModTime: manifest.CreatedAt}
+	if err := archive.WriteHeader(header); err != nil {
+		return manifest, fmt.Errorf("failed to write manifest: %w", err)
+	}
+	if _, err := archive.Write(data); err != nil {
+		return manifest, fmt.Errorf("failed to write manifest: %w", err)
+	}
+	if err := archive.Close(); err != nil {
+		return manifest, fmt.Errorf("failed to finish archive: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return manifest, fmt.Errorf("failed to finish archive: %w", err)
+	}
+	if encrypter != nil {
+		if err := encrypter.Close(); err != nil {
+			return manifest, fmt.Errorf("failed to finish archive: %w", err)
+		}
+	}
+	return manifest, nil
+}
+
+// addBackupFile adds a file to the archive and returns its checksum
+func addBackupFile(archive *tar.Writer, filePath, name string) (BackupFile, error) {
+	entry := BackupFile{Path: name}
+	f, err := os.Open(filePath)
+	if err != nil {
+		return entry, fmt.Errorf("failed to open %s: %w", filePath, err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return entry, fmt.Errorf("failed to stat %s: %w", filePath, err)
+	}
+
+	header := &tar.Header{Name: name, Mode: 0600, Size: info.Size(), ModTime: info.ModTime()}
+	if err := archive.WriteHeader(header); err != nil {
+		return entry, fmt.Errorf("failed to add %s: %w", name, err)
+	}
+	hash := sha256.New()
+	if _, err := io.CopyN(io.MultiWriter(archive, hash), f, info.Size()); err != nil {
+		return entry, fmt.Errorf("failed to add %s: %w", name, err)
+	}
+	entry.Size = info.Size()
+	entry.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	return entry, nil
+}
+
+// restoreBackup unpacks a backup archive into a data directory that doesn't exist yet or is
+// empty. The database and media are checked against the manifest; on any failure the restored
+// files are removed again.
+func restoreBackup(r io.Reader, dir, passphrase string) (BackupManifest, error) {
+	var manifest BackupManifest
+	created, err := prepareRestoreDir(dir)
+	if err != nil {
+		return manifest, err
+	}
+	restored := false
+	defer func() {
+		if restored {
+			return
+		}
+		if created {
+			os.RemoveAll(dir)
+		} else {
+			os.Remove(filepath.Join(dir, backupDatabaseName))
+			os.RemoveAll(filepath.Join(dir, backupMediaDir))
+		}
+	}()
+
+	plain, err := openBackupArchive(r, passphrase)
+	if err != nil {
+		return manifest, err
+	}
+	gz, err := gzip.NewReader(plain)
+	if errors.Is(err, errInvalidBackup) {
+		return manifest, err
+	} else if err != nil {
+		return manifest, fmt.Errorf("%w: not a backup archive: %v", errInvalidBackup, err)
+	}
+	archive := tar.NewReader(gz)
+
+	written := make(map[string]BackupFile)
+	foundManifest := false
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return manifest, fmt.Errorf("%w: %v", errInvalidBackup, err)
+		}
+		if header.Name == backupManifestName {
+			if err := json.NewDecoder(archive).Decode(&manifest); err != nil {
+				return manifest, fmt.Errorf("%w: failed to read manifest: %v", errInvalidBackup, err)
+			}
+			foundManifest = true
+			continue
+		}
+		if header.Typeflag != tar.TypeReg {
+			return manifest, fmt.Errorf("%w: unexpected entry %s", errInvalidBackup, header.Name)
+		}
+		target, err := backupEntryPath(dir, header.Name)
+		if err != nil {
+			return manifest, err
+		}
+		file, err := extractBackupFile(archive, target, header.Name)
+		if err != nil {
+			return manifest, err
+		}
+		written[header.Name] = file
+	}
+	// Read to the end so the gzip checksum and the last encrypted chunk are verified
+	if _, err := io.Copy(io.Discard, gz); err != nil {
+		return manifest, fmt.Errorf("%w: %v", errInvalidBackup, err)
+	}
+	if _, err := io.Copy(io.Discard, plain); err != nil {
+		return manifest, fmt.Errorf("%w: %v", errInvalidBackup, err)
+	}
+
+	if !foundManifest {
+		return manifest, fmt.Errorf("%w: the archive has no manifest", errInvalidBackup)
+	}
+	if manifest.Format != backupFormat {
+		return manifest, fmt.Errorf("%w: unsupported backup format %d", errInvalidBackup, manifest.Format)
+	}
+	if manifest.SchemaVersion > len(aimeowMigrations) {
+		return manifest, fmt.Errorf("%w: the backup has schema version %d, newer than this build supports (%d)",
+			errInvalidBackup, manifest.SchemaVersion, len(aimeowMigrations))
+	}
+	for _, expected := range append([]BackupFile{manifest.Database}, manifest.Media...) {
+		if got, ok := written[expected.Path]; !ok || got != expected {
+			return manifest, fmt.Errorf("%w: %s is missing or damaged", errInvalidBackup, expected.Path)
+		}
+	}
+	restored = true
+	return manifest, nil
+}
+
+// prepareRestoreDir creates the data directory to restore into, or checks that it is empty
+func prepareRestoreDir(dir string) (bool, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return false, fmt.Errorf("failed to create data directory %s: %w", dir, err)
+		}
+		return true, nil
+	} else if err != nil {
+		return false, fmt.Errorf("failed to read data directory %s: %w", dir, err)
+	}
+	if len(entries) > 0 {
+		return false, fmt.Errorf("%w: %s, restore into a fresh data directory", errRestoreDirNotEmpty, dir)
+	}
+	return false, nil
+}
+
+// backupEntryPath maps an archive entry to its place in the data directory. Only the database
+// and files under the media directory are accepted.
+func backupEntryPath(dir, name string) (string, error) {
+	clean := path.Clean(name)
+	if clean != name || (clean != backupDatabaseName && !strings.HasPrefix(clean, backupMediaDir+"/")) {
+		return "", fmt.Errorf("%w: unexpected entry %s", errInvalidBackup, name)
+	}
+	return filepath.Join(dir, filepath.FromSlash(clean)), nil
+}
+
+// extractBackupFile writes an archive entry to disk and returns its checksum
+func extractBackupFile(r io.Reader, target, name string) (BackupFile, error) {
+	entry := BackupFile{Path: name}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return entry, fmt.Errorf("failed to create directory for %s: %w", name, err)
+	}
+	f, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return entry, fmt.Errorf("failed to restore %s: %w", name, err)
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(f, hash), r)
+	if err != nil {
+		return entry, fmt.Errorf("failed to restore %s: %w", name, err)
+	}
+	if err := f.Close(); err != nil {
+		return entry, fmt.Errorf("failed to restore %s: %w", name, err)
+	}
+	entry.Size = size
+	entry.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	return entry, nil
+}
+
+// backupCipher derives the archive key from a passphrase
+func backupCipher(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key, err := pbkdf2.Key(sha256.New, passphrase, salt, backupKeyIterations, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// backupNonce is the nonce of the nth chunk of an encrypted archive
+func backupNonce(aead cipher.AEAD, n uint64) []byte {
+	nonce := make([]byte, aead.NonceSize())
+	binary.BigEndian.PutUint64(nonce[len(nonce)-8:], n)
+	return nonce
+}
+
+// backupEncrypter seals an archive in chunks. Each chunk is prefixed by its length, which also
+// marks the final chunk and is authenticated with it, so a truncated archive is detected.
+type backupEncrypter struct {
+	w     io.Writer
+	aead  cipher.AEAD
+	buf   []byte
+	count uint64
+}
+
+func newBackupEncrypter(w io.Writer, passphrase string) (*backupEncrypter, error) {
+	salt := make([]byte, backupSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	aead, err := backupCipher(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(append([]byte(backupMagic), salt...)); err != nil {
+		return nil, err
+	}
+	return &backupEncrypter{w: w, aead: aead, buf: make([]byte, 0, backupChunkSize)}, nil
+}
+
+func (e *backupEncrypter) Write(p []byte) (int, error) {
+	written := len(p)
+	for len(p) > 0 {
+		n := copy(e.buf[len(e.buf):cap(e.buf)], p)
+		e.buf = e.buf[:len(e.buf)+n]
+		p = p[n:]
+		if len(e.buf) == cap(e.buf) {
+			if err := e.seal(false); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return written, nil
+}
+
+// Close seals the final chunk; it doesn't close the underlying writer
+func (e *backupEncrypter) Close() error {
+	return e.seal(true)
+}
+
+func (e *backupEncrypter) seal(final bool) error {
+	header := make([]byte, 4)
+	length := uint32(len(e.buf))
+	if final {
+		length |= backupFinalChunk
+	}
+	binary.BigEndian.PutUint32(header, length)
+	sealed := e.aead.Seal(nil, backupNonce(e.aead, e.count), e.buf, header)
+	e.count++
+	e.buf = e.buf[:0]
+	if _, err := e.w.Write(header); err != nil {
+		return err
+	}
+	_, err := e.w.Write(sealed)
+	return err
+}
+
+// backupDecrypter opens the chunks written by backupEncrypter
+type backupDecrypter struct {
+	r     io.Reader
+	aead  cipher.AEAD
+	buf   []byte
+	count uint64
+	done  bool
+}
+
+func (d *backupDecrypter) Read(p []byte) (int, error) {
+	for len(d.buf) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+		header := make([]byte, 4)
+		if _, err := io.ReadFull(d.r, header); err != nil {
+			return 0, fmt.Errorf("%w: the archive is truncated", errInvalidBackup)
+		}
+		length := binary.BigEndian.Uint32(header)
+		d.done = length&backupFinalChunk != 0
+		length &^= backupFinalChunk
+		if length > backupChunkSize {
+			return 0, fmt.Errorf("%w: the archive is damaged", errInvalidBackup)
+		}
+		sealed := make([]byte, int(length)+d.aead.Overhead())
+		if _, err := io.ReadFull(d.r, sealed); err != nil {
+			return 0, fmt.Errorf("%w: the archive is truncated", errInvalidBackup)
+		}
+		plain, err := d.aead.Open(sealed[:0], backupNonce(d.aead, d.count), sealed, header)
+		if err != nil {
+			return 0, fmt.Errorf("%w: wrong passphrase or damaged archive", errInvalidBackup)
+		}
+		d.count++
+		d.buf = plain
+	}
+	n := copy(p, d.buf)
+	d.buf = d.buf[n:]
+	return n, nil
+}
+
+// openBackupArchive returns the gzip stream of a backup, decrypting it if it is encrypted
+func openBackupArchive(r io.Reader, passphrase string) (io.Reader, error) {
+	buffered := bufio.NewReader(r)
+	magic, err := buffered.Peek(len(backupMagic))
+	if err != nil || string(magic) != backupMagic {
+		return buffered, nil
+	}
+	if passphrase == "" {
+		return nil, fmt.Errorf("%w: the archive is encrypted, a passphrase is required", errInvalidBackup)
+	}
+	header := make([]byte, len(backupMagic)+backupSaltSize)
+	if _, err := io.ReadFull(buffered, header); err != nil {
+		return nil, fmt.Errorf("%w: the archive is truncated", errInvalidBackup)
+	}
+	aead, err := backupCipher(passphrase, header[len(backupMagic):])
+	if err != nil {
+		return nil, err
+	}
+	return &backupDecrypter{r: buffered, aead: aead}, nil
+}
+
+// backupFileName is the suggested name of a backup archive created now
+func backupFileName(encrypted bool) string {
+	name := "aimeow-backup-" + time.Now().Format("20060102-150405") + ".tar.gz"
+	if encrypted {
+		name += ".enc"
+	}
+	return name
+}
+
+// requireAdminToken rejects requests that don't carry the configured admin token as a bearer
+// token. The backup and restore routes are only registered when a token is set.
+func requireAdminToken(c *gin.Context) {
+	token := appConfig().Storage.AdminToken
+	given, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if token == "" || !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "a valid admin token is required"})
+		return
+	}
+	c.Next()
+}
+
+// BackupRequest selects what an API backup contains
+type BackupRequest struct {
+	Passphrase string `json:"passphrase"`          // Encrypts the archive with AES-256-GCM, required as backups hold the session keys
+	SkipMedia  bool   `json:"skipMedia,omitempty"` // Leave downloaded media out of the archive
+}
+
+// RestoreResponse describes a restored backup
+type RestoreResponse struct {
+	DataDir  string         `json:"dataDir"` // Path of the restored data directory on the server
+	Manifest BackupManifest `json:"manifest"`
+}
+
+// @Summary Create a backup
+// @Description Streams a consistent backup of the WhatsApp sessions, client mappings, chat history and other aimeow tables (taken with the SQLite online backup API) together with the downloaded media and a manifest with their checksums. The archive is a gzip-compressed tar file encrypted with the passphrase. Only served when storage.adminToken (ADMIN_TOKEN) is set. Not available with PostgreSQL.
+// @Tags admin
+// @Accept json
+// @Produce application/octet-stream
+// @Param Authorization header string true "Bearer admin token"
+// @Param request body BackupRequest true "Backup options"
+// @Success 200 {file} binary
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Failure 501 {object} map[string]string
+// @Router /admin/backup [post]
+func createBackup(c *gin.Context) {
+	var req BackupRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if req.Passphrase == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "passphrase is required, unencrypted backups are only available with aimeow backup"})
+		return
+	}
+	if dbDialect != dialectSQLite {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "backups of PostgreSQL databases are not supported, back up the database with pg_dump"})
+		return
+	}
+
+	snapshotPath, manifest, err := snapshotDatabase(c.Request.Context(), manager.db)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer os.Remove(snapshotPath)
+
+	// From here on the backup is streamed, so errors can only be logged
+	c.Header("Content-Type", "application/octet-stream")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, backupFileName(true)))
+	manifest, err = writeBackupArchive(c.Writer, snapshotPath, dataDir, manifest, backupOptions{Passphrase: req.Passphrase, SkipMedia: req.SkipMedia})
+	if err != nil {
+		fmt.Printf("[Backup] Failed to write backup: %v\n", err)
+		return
+	}
+	fmt.Printf("[Backup] Backup with %d client(s) and %d media file(s) downloaded\n", len(manifest.Clients), len(manifest.Media))
+}
+
+// restoreTargetDir resolves the data directory of a restore through the API, which must stay
+// inside the restore root: a relative path without "..", and no symlinks below the root
+func restoreTargetDir(root string, name string) (string, error) {
+	if !filepath.IsLocal(name) {
+		return "", fmt.Errorf("dataDir must be a relative path inside the restore directory %s", root)
+	}
+	dir := root
+	for _, part := range strings.Split(filepath.Clean(name), string(filepath.Separator)) {
+		dir = filepath.Join(dir, part)
+		info, err := os.Lstat(dir)
+		if errors.Is(err, fs.ErrNotExist) {
+			break
+		} else if err != nil {
+			return "", err
+		}
+		if info.Mode()&fs.ModeSymlink != 0 {
+			return "", fmt.Errorf("dataDir must not go through a symlink")
+		}
+	}
+	return filepath.Join(root, name), nil
+}
+
+// @Summary Restore a backup
+// @Description Unpacks a backup archive into a new data directory on the server, checking every file against the manifest. The directory is a relative path inside storage.restoreDir (RESTORE_DIR) and must not exist or be empty, so the running instance is never overwritten; start an instance with DATA_DIR pointing at the returned dataDir to use the restored sessions. Only served when storage.adminToken (ADMIN_TOKEN) is set.
+// @Tags admin
+// @Accept multipart/form-data
+// @Produce json
+// @Param Authorization header string true "Bearer admin token"
+// @Param archive formData file true "Backup archive"
+// @Param dataDir formData string true "Data directory to restore into, relative to the restore directory"
+// @Param passphrase formData string false "Passphrase of an encrypted archive"
+// @Success 200 {object} RestoreResponse
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/restore [post]
+func restoreBackupHandler(c *gin.Context) {
+	name := c.PostForm("dataDir")
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "dataDir is required"})
+		return
+	}
+	targetDir, err := restoreTargetDir(appConfig().Storage.restoreRoot(), name)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	upload, err := c.FormFile("archive")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "archive file is required"})
+		return
+	}
+	archive, err := upload.Open()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to read archive: %v", err)})
+		return
+	}
+	defer archive.Close()
+
+	manifest, err := restoreBackup(archive, targetDir, c.PostForm("passphrase"))
+	if errors.Is(err, errRestoreDirNotEmpty) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	} else if errors.Is(err, errInvalidBackup) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	fmt.Printf("[Backup] Restored %d client(s) and %d media file(s) into %s\n", len(manifest.Clients), len(manifest.Media), targetDir)
+	c.JSON(http.StatusOK, RestoreResponse{DataDir: targetDir, Manifest: manifest})
+}
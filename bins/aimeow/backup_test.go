@@ -0,0 +1,298 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testBackupMedia is larger than a chunk and random, so encrypted archives of it span several
+// full chunks after compression
+var testBackupMedia = func() []byte {
+	data := make([]byte, 3*backupChunkSize)
+	rand.Read(data)
+	return data
+}()
+
+// writeTestBackup creates a data directory with a database and a media file and returns its
+// backup archive
+func writeTestBackup(t *testing.T, passphrase string) []byte {
+	t.Helper()
+	dir := t.TempDir()
+	snapshotPath := filepath.Join(dir, backupDatabaseName)
+	if err := os.WriteFile(snapshotPath, []byte("SQLite format 3\x00 test database"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	mediaPath := filepath.Join(dir, backupMediaDir, "c1", "3EB0IMAGE")
+	if err := os.MkdirAll(filepath.Dir(mediaPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(mediaPath, testBackupMedia, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	manifest := BackupManifest{
+		Format:        backupFormat,
+		CreatedAt:     time.Now().UTC(),
+		SchemaVersion: len(aimeowMigrations),
+		Clients:       []BackupClient{{ClientID: "c1", WhatsAppID: "6281111111111.0:3@s.whatsapp.net"}},
+	}
+	var buf bytes.Buffer
+	if _, err := writeBackupArchive(&buf, snapshotPath, dir, manifest, backupOptions{Passphrase: passphrase}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// testArchiveEntry is a file of a hand-made backup archive
+type testArchiveEntry struct {
+	name string
+	body []byte
+}
+
+// writeTestArchive builds an unencrypted archive from entries, for archives the backup code
+// would never write
+func writeTestArchive(t *testing.T, entries ...testArchiveEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	archive := tar.NewWriter(gz)
+	for _, entry := range entries {
+		if err := archive.WriteHeader(&tar.Header{Name: entry.name, Mode: 0600, Size: int64(len(entry.body))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := archive.Write(entry.body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// testManifest returns a manifest entry describing files
+func testManifest(t *testing.T, database BackupFile, media ...BackupFile) testArchiveEntry {
+	t.Helper()
+	data, err := json.Marshal(BackupManifest{Format: backupFormat, SchemaVersion: 1, Database: database, Media: media})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testArchiveEntry{name: backupManifestName, body: data}
+}
+
+// testBackupFile returns the manifest entry of a file with the given contents
+func testBackupFile(name string, body []byte) BackupFile {
+	sum := sha256.Sum256(body)
+	return BackupFile{Path: name, Size: int64(len(body)), SHA256: hex.EncodeToString(sum[:])}
+}
+
+// encryptedChunk returns the start and end offsets of the nth full chunk of an encrypted
+// archive: a 4 byte length, the chunk and the 16 byte GCM tag
+func encryptedChunk(n int) (int, int) {
+	fullChunk := 4 + backupChunkSize + 16
+	start := len(backupMagic) + backupSaltSize + n*fullChunk
+	return start, start + fullChunk
+}
+
+func TestBackupRoundTrip(t *testing.T) {
+	for _, passphrase := range []string{"", "correct horse battery staple"} {
+		archive := writeTestBackup(t, passphrase)
+		if encrypted := bytes.HasPrefix(archive, []byte(backupMagic)); encrypted != (passphrase != "") {
+			t.Fatalf("archive with passphrase %q encrypted = %v", passphrase, encrypted)
+		}
+
+		dir := filepath.Join(t.TempDir(), "restored")
+		manifest, err := restoreBackup(bytes.NewReader(archive), dir, passphrase)
+		if err != nil {
+			t.Fatalf("restore with passphrase %q: %v", passphrase, err)
+		}
+		if manifest.Encrypted != (passphrase != "") || len(manifest.Clients) != 1 || len(manifest.Media) != 1 {
+			t.Errorf("unexpected manifest %+v", manifest)
+		}
+		media, err := os.ReadFile(filepath.Join(dir, backupMediaDir, "c1", "3EB0IMAGE"))
+		if err != nil || !bytes.Equal(media, testBackupMedia) {
+			t.Errorf("restored media differs from the original (err %v)", err)
+		}
+		if _, err := os.Stat(filepath.Join(dir, backupDatabaseName)); err != nil {
+			t.Errorf("database was not restored: %v", err)
+		}
+	}
+}
+
+func TestRestoreRejectsDamagedArchives(t *testing.T) {
+	const passphrase = "correct horse battery staple"
+	encrypted := writeTestBackup(t, passphrase)
+	if _, end := encryptedChunk(1); len(encrypted) <= end {
+		t.Fatalf("archive of %d bytes has fewer than 3 chunks", len(encrypted))
+	}
+
+	database := []byte("SQLite format 3\x00")
+	damagedMedia := []byte("not the original")
+
+	tests := []struct {
+		name       string
+		archive    func() []byte
+		passphrase string
+		wantErr    string
+	}{
+		{
+			name:       "wrong passphrase",
+			archive:    func() []byte { return encrypted },
+			passphrase: "wrong passphrase",
+			wantErr:    "wrong passphrase or damaged archive",
+		},
+		{
+			name:    "missing passphrase",
+			archive: func() []byte { return encrypted },
+			wantErr: "a passphrase is required",
+		},
+		{
+			name:       "truncated inside a chunk",
+			archive:    func() []byte { return encrypted[:len(encrypted)-10] },
+			passphrase: passphrase,
+			wantErr:    "truncated",
+		},
+		{
+			name: "truncated at a chunk boundary",
+			archive: func() []byte {
+				_, end := encryptedChunk(1)
+				return encrypted[:end]
+			},
+			passphrase: passphrase,
+			wantErr:    "truncated",
+		},
+		{
+			name: "reordered chunks",
+			archive: func() []byte {
+				start, mid := encryptedChunk(0)
+				_, end := encryptedChunk(1)
+				swapped := append([]byte{}, encrypted[:start]...)
+				swapped = append(swapped, encrypted[mid:end]...)
+				swapped = append(swapped, encrypted[start:mid]...)
+				return append(swapped, encrypted[end:]...)
+			},
+			passphrase: passphrase,
+			wantErr:    "wrong passphrase or damaged archive",
+		},
+		{
+			name: "tampered chunk",
+			archive: func() []byte {
+				tampered := append([]byte{}, encrypted...)
+				start, _ := encryptedChunk(1)
+				tampered[start+100] ^= 1
+				return tampered
+			},
+			passphrase: passphrase,
+			wantErr:    "wrong passphrase or damaged archive",
+		},
+		{
+			name: "checksum mismatch",
+			archive: func() []byte {
+				return writeTestArchive(t,
+					testArchiveEntry{backupDatabaseName, database},
+					testArchiveEntry{"files/c1/3EB0IMAGE", damagedMedia},
+					testManifest(t, testBackupFile(backupDatabaseName, database), testBackupFile("files/c1/3EB0IMAGE", []byte("original"))))
+			},
+			wantErr: "files/c1/3EB0IMAGE is missing or damaged",
+		},
+		{
+			name: "file missing",
+			archive: func() []byte {
+				return writeTestArchive(t,
+					testArchiveEntry{backupDatabaseName, database},
+					testManifest(t, testBackupFile(backupDatabaseName, database), testBackupFile("files/c1/3EB0IMAGE", damagedMedia)))
+			},
+			wantErr: "files/c1/3EB0IMAGE is missing or damaged",
+		},
+		{
+			name: "no manifest",
+			archive: func() []byte {
+				return writeTestArchive(t, testArchiveEntry{backupDatabaseName, database})
+			},
+			wantErr: "no manifest",
+		},
+		{
+			name: "entry outside the data directory",
+			archive: func() []byte {
+				return writeTestArchive(t, testArchiveEntry{"files/../../escape", database})
+			},
+			wantErr: "unexpected entry",
+		},
+		{
+			name:    "not an archive",
+			archive: func() []byte { return []byte("hello") },
+			wantErr: "not a backup archive",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), "restored")
+			_, err := restoreBackup(bytes.NewReader(tt.archive()), dir, tt.passphrase)
+			if !errors.Is(err, errInvalidBackup) || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("restore error = %v, want invalid backup containing %q", err, tt.wantErr)
+			}
+			if _, err := os.Stat(dir); !errors.Is(err, fs.ErrNotExist) {
+				t.Errorf("failed restore left %s behind (stat error %v)", dir, err)
+			}
+		})
+	}
+}
+
+func TestRestoreTargetDir(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, "existing"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(root, "link")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(root, "existing", "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		want    string // Empty if the name is rejected
+		wantErr string
+	}{
+		{name: "restore1", want: filepath.Join(root, "restore1")},
+		{name: "existing/restore2", want: filepath.Join(root, "existing", "restore2")},
+		{name: "new/deeper/restore3", want: filepath.Join(root, "new", "deeper", "restore3")},
+		{name: "../escape", wantErr: "relative path inside"},
+		{name: "a/../../escape", wantErr: "relative path inside"},
+		{name: "..", wantErr: "relative path inside"},
+		{name: "/tmp/escape", wantErr: "relative path inside"},
+		{name: "", wantErr: "relative path inside"},
+		{name: "link", wantErr: "symlink"},
+		{name: "link/restore4", wantErr: "symlink"},
+		{name: "existing/link/restore5", wantErr: "symlink"},
+	}
+	for _, tt := range tests {
+		got, err := restoreTargetDir(root, tt.name)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("restoreTargetDir(%q) = %q, %v; want error containing %q", tt.name, got, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("restoreTargetDir(%q) = %q, %v; want %q", tt.name, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,728 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// Throttling limits for broadcast jobs. The default interval is rateLimit.broadcastInterval.
+const (
+	minBroadcastInterval      = 250 * time.Millisecond
+	broadcastDisconnectedWait = 5 * time.Second
+)
+
+// Broadcast job states
+const (
+	broadcastStatusRunning   = "running"
+	broadcastStatusPaused    = "paused"
+	broadcastStatusCompleted = "completed"
+	broadcastStatusCancelled = "cancelled"
+	broadcastStatusFailed    = "failed"
+)
+
+// Broadcast recipient states
+const (
+	recipientStatusPending       = "pending"
+	recipientStatusSending       = "sending" // Claimed by the worker, failed on startup if a restart interrupted the send
+	recipientStatusSent          = "sent"
+	recipientStatusFailed        = "failed"
+	recipientStatusNotOnWhatsApp = "not_on_whatsapp"
+)
+
+type BroadcastRecipient struct {
+	Phone     string            `json:"phone" binding:"required"`
+	Variables map[string]string `json:"variables,omitempty"` // Values for {{name}} placeholders in the payload
+}
+
+type CreateBroadcastRequest struct {
+	Type              string               `json:"type,omitempty" binding:"omitempty,oneof=message image images document document-base64"`
+	Payload           json.RawMessage      `json:"payload" binding:"required"` // Send payload without phone; string fields may contain {{name}} placeholders
+	Recipients        []BroadcastRecipient `json:"recipients" binding:"required,min=1,dive"`
+	IntervalMs        int                  `json:"intervalMs,omitempty" binding:"omitempty,min=250"` // Delay between recipients
+	SkipWhatsAppCheck bool                 `json:"skipWhatsAppCheck,omitempty"`                      // Send without checking IsOnWhatsApp first
+}
+
+type BroadcastRecipientResponse struct {
+	Phone     string            `json:"phone"`
+	Variables map[string]string `json:"variables,omitempty"`
+	Status    string            `json:"status"`
+	MessageID string            `json:"messageId,omitempty"`
+	Error     string            `json:"error,omitempty"`
+	SentAt    *time.Time        `json:"sentAt,omitempty"`
+}
+
+type BroadcastResponse struct {
+	ID                string                       `json:"id"`
+	ClientID          string                       `json:"clientId"`
+	Type              string                       `json:"type"`
+	Payload           json.RawMessage              `json:"payload"`
+	Status            string                       `json:"status"`
+	IntervalMs        int                          `json:"intervalMs"`
+	SkipWhatsAppCheck bool                         `json:"skipWhatsAppCheck"`
+	Total             int                          `json:"total"`
+	Pending           int                          `json:"pending"`
+	Sent              int                          `json:"sent"`
+	Failed            int                          `json:"failed"`
+	NotOnWhatsApp     int                          `json:"notOnWhatsApp"`
+	CreatedAt         time.Time                    `json:"createdAt"`
+	StartedAt         *time.Time                   `json:"startedAt,omitempty"`
+	FinishedAt        *time.Time                   `json:"finishedAt,omitempty"`
+	Recipients        []BroadcastRecipientResponse `json:"recipients,omitempty"`
+}
+
+// templatePlaceholder matches a {{name}} placeholder in a broadcast payload
+var templatePlaceholder = regexp.MustCompile(`\{\{([^{}]+)\}\}`)
+
+// maxReportedRecipients caps how many bad recipient positions an error lists
+const maxReportedRecipients = 10
+
+// renderBroadcastPayload fills {{name}} placeholders from the recipient variables and sets the
+// recipient phone. A placeholder without a variable is an error.
+func renderBroadcastPayload(payload json.RawMessage, recipient BroadcastRecipient) ([]byte, error) {
+	var fields map[string]interface{}
+	if err := json.Unmarshal(payload, &fields); err != nil {
+		return nil, fmt.Errorf("payload must be a JSON object: %w", err)
+	}
+	if fields == nil {
+		// null decodes without an error but leaves no object to fill in
+		return nil, fmt.Errorf("payload must be a JSON object")
+	}
+
+	vars := map[string]string{"phone": recipient.Phone}
+	for k, v := range recipient.Variables {
+		vars[k] = v
+	}
+
+	missing := make(map[string]bool)
+	rendered := renderTemplateValue(fields, vars, missing).(map[string]interface{})
+	if len(missing) > 0 {
+		names := make([]string, 0, len(missing))
+		for name := range missing {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("missing variable(s) %s", strings.Join(names, ", "))
+	}
+	rendered["phone"] = recipient.Phone
+	return json.Marshal(rendered)
+}
+
+// renderTemplateValue fills the placeholders in the strings of a decoded JSON value and adds the
+// names without a variable to missing
+func renderTemplateValue(value interface{}, vars map[string]string, missing map[string]bool) interface{} {
+	switch v := value.(type) {
+	case string:
+		for _, match := range templatePlaceholder.FindAllStringSubmatch(v, -1) {
+			if _, ok := vars[match[1]]; !ok {
+				missing[match[1]] = true
+			}
+		}
+		for name, replacement := range vars {
+			v = strings.ReplaceAll(v, "{{"+name+"}}", replacement)
+		}
+		return v
+	case map[string]interface{}:
+		for k, item := range v {
+			v[k] = renderTemplateValue(item, vars, missing)
+		}
+		return v
+	case []interface{}:
+		for i, item := range v {
+			v[i] = renderTemplateValue(item, vars, missing)
+		}
+		return v
+	}
+	return value
+}
+
+func unixPtr(ts sql.NullInt64) *time.Time {
+	if !ts.Valid {
+		return nil
+	}
+	t := time.Unix(ts.Int64, 0).UTC()
+	return &t
+}
+
+// getBroadcast loads a broadcast job with its delivery counters, optionally including every recipient
+func (cm *ClientManager) getBroadcast(broadcastID string, withRecipients bool) (BroadcastResponse, error) {
+	var job BroadcastResponse
+	var payload string
+	var createdAt int64
+	var startedAt, finishedAt sql.NullInt64
+	err := cm.db.QueryRow(`SELECT id, client_id, type, payload, status, interval_ms, skip_whatsapp_check, created_at, started_at, finished_at
+		FROM aimeow_broadcasts WHERE id=$1`, broadcastID).Scan(&job.ID, &job.ClientID, &job.Type, &payload, &job.Status,
+		&job.IntervalMs, &job.SkipWhatsAppCheck, &createdAt, &startedAt, &finishedAt)
+	if err != nil {
+		return job, err
+	}
+	job.Payload = json.RawMessage(payload)
+	job.CreatedAt = time.Unix(createdAt, 0).UTC()
+	job.StartedAt = unixPtr(startedAt)
+	job.FinishedAt = unixPtr(finishedAt)
+
+	rows, err := cm.db.Query(`SELECT status, COUNT(*) FROM aimeow_broadcast_recipients WHERE broadcast_id=$1 GROUP BY status`, broadcastID)
+	if err != nil {
+		return job, err
+	}
+	for rows.Next() {
+		var status string
+		var count int
+		if err := rows.Scan(&status, &count); err != nil {
+			rows.Close()
+			return job, err
+		}
+		job.Total += count
+		switch status {
+		case recipientStatusPending, recipientStatusSending:
+			job.Pending += count
+		case recipientStatusSent:
+			job.Sent = count
+		case recipientStatusFailed:
+			job.Failed = count
+		case recipientStatusNotOnWhatsApp:
+			job.NotOnWhatsApp = count
+		}
+	}
+	rows.Close()
+
+	if !withRecipients {
+		return job, nil
+	}
+
+	rows, err = cm.db.Query(`SELECT phone, variables, status, message_id, error, sent_at
+		FROM aimeow_broadcast_recipients WHERE broadcast_id=$1 ORDER BY position`, broadcastID)
+	if err != nil {
+		return job, err
+	}
+	defer rows.Close()
+
+	job.Recipients = make([]BroadcastRecipientResponse, 0, job.Total)
+	for rows.Next() {
+		var recipient BroadcastRecipientResponse
+		var variables string
+		var sentAt sql.NullInt64
+		if err := rows.Scan(&recipient.Phone, &variables, &recipient.Status, &recipient.MessageID, &recipient.Error, &sentAt); err != nil {
+			return job, err
+		}
+		if err := json.Unmarshal([]byte(variables), &recipient.Variables); err != nil {
+			return job, fmt.Errorf("invalid variables for recipient %s: %w", recipient.Phone, err)
+		}
+		recipient.SentAt = unixPtr(sentAt)
+		job.Recipients = append(job.Recipients, recipient)
+	}
+	return job, nil
+}
+
+// startBroadcastRunner starts the worker for a broadcast unless one is already running
+func (cm *ClientManager) startBroadcastRunner(broadcastID string) {
+	cm.mutex.Lock()
+	if cm.broadcastRunners[broadcastID] {
+		cm.mutex.Unlock()
+		return
+	}
+	cm.broadcastRunners[broadcastID] = true
+	cm.mutex.Unlock()
+
+	go cm.runBroadcast(broadcastID)
+}
+
+// stopBroadcastRunner unregisters the worker of a broadcast. It returns false when the broadcast
+// was resumed in the meantime, in which case the worker has to keep going.
+func (cm *ClientManager) stopBroadcastRunner(broadcastID string) bool {
+	cm.mutex.Lock()
+	defer cm.mutex.Unlock()
+
+	var status string
+	err := cm.db.QueryRow(`SELECT status FROM aimeow_broadcasts WHERE id=$1`, broadcastID).Scan(&status)
+	if err == nil && status == broadcastStatusRunning {
+		return false
+	}
+	delete(cm.broadcastRunners, broadcastID)
+	return true
+}
+
+// resumeBroadcasts restarts the workers of broadcasts that were running when the service stopped
+func (cm *ClientManager) resumeBroadcasts() {
+	// A recipient still sending was interrupted by a restart and may have got the message, so it
+	// is failed rather than sent again
+	if _, err := cm.db.Exec(`UPDATE aimeow_broadcast_recipients SET status=$1, error=$2, sent_at=$3 WHERE status=$4`,
+		recipientStatusFailed, "interrupted while sending", time.Now().Unix(), recipientStatusSending); err != nil {
+		fmt.Printf("[Broadcast] Failed to fail interrupted recipients: %v\n", err)
+	}
+
+	rows, err := cm.db.Query(`SELECT id, client_id FROM aimeow_broadcasts WHERE status=$1`, broadcastStatusRunning)
+	if err != nil {
+		fmt.Printf("[Broadcast] Failed to query running broadcasts: %v\n", err)
+		return
+	}
+	var ids []string
+	for rows.Next() {
+		var id, clientID string
+		if err := rows.Scan(&id, &clientID); err == nil && !cm.isSkippedClient(clientID) {
+			ids = append(ids, id)
+		}
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		fmt.Printf("[Broadcast] Resuming broadcast %s\n", id)
+		cm.startBroadcastRunner(id)
+	}
+}
+
+// runBroadcast sends to the pending recipients one at a time until the job is done, paused or cancelled
+func (cm *ClientManager) runBroadcast(broadcastID string) {
+	for {
+		if !cm.runBroadcastStep(broadcastID) && cm.stopBroadcastRunner(broadcastID) {
+			fmt.Printf("[Broadcast] Worker for broadcast %s stopped\n", broadcastID)
+			return
+		}
+	}
+}
+
+// runBroadcastStep handles the next pending recipient and returns false once the job is no longer running
+func (cm *ClientManager) runBroadcastStep(broadcastID string) bool {
+	// Re-read the job every round so pause and cancel take effect before the next recipient
+	job, err := cm.getBroadcast(broadcastID, false)
+	if err == sql.ErrNoRows {
+		return false
+	} else if err != nil {
+		fmt.Printf("[Broadcast] Failed to load broadcast %s: %v\n", broadcastID, err)
+		time.Sleep(broadcastDisconnectedWait)
+		return true
+	}
+	if job.Status != broadcastStatusRunning {
+		return false
+	}
+
+	waClient, err := cm.getClient(job.ClientID)
+	if err != nil {
+		if !cm.isSkippedClient(job.ClientID) {
+			cm.finishBroadcast(job, broadcastStatusFailed)
+		}
+		return false
+	}
+
+	isConnected := waClient.connected()
+	if !isConnected {
+		time.Sleep(broadcastDisconnectedWait)
+		return true
+	}
+
+	var position int
+	var recipient BroadcastRecipient
+	var variables string
+	err = cm.db.QueryRow(`SELECT position, phone, variables FROM aimeow_broadcast_recipients
+		WHERE broadcast_id=$1 AND status=$2 ORDER BY position LIMIT 1`, broadcastID, recipientStatusPending).
+		Scan(&position, &recipient.Phone, &variables)
+	if err == sql.ErrNoRows {
+		cm.finishBroadcast(job, broadcastStatusCompleted)
+		return false
+	} else if err != nil {
+		fmt.Printf("[Broadcast] Failed to load next recipient of %s: %v\n", broadcastID, err)
+		time.Sleep(broadcastDisconnectedWait)
+		return true
+	}
+	if err := json.Unmarshal([]byte(variables), &recipient.Variables); err != nil {
+		fmt.Printf("[Broadcast] Invalid variables for recipient %s: %v\n", recipient.Phone, err)
+	}
+
+	// Claim the recipient so a restart during the send doesn't send to it again
+	result, err := cm.db.Exec(`UPDATE aimeow_broadcast_recipients SET status=$1 WHERE broadcast_id=$2 AND position=$3 AND status=$4`,
+		recipientStatusSending, broadcastID, position, recipientStatusPending)
+	if err != nil {
+		fmt.Printf("[Broadcast] Failed to claim recipient %s: %v\n", recipient.Phone, err)
+		time.Sleep(broadcastDisconnectedWait)
+		return true
+	}
+	if n, err := result.RowsAffected(); err != nil || n != 1 {
+		return true
+	}
+
+	status, messageID, errMsg := cm.sendBroadcastRecipient(waClient, job, recipient)
+	_, err = cm.db.Exec(`UPDATE aimeow_broadcast_recipients SET status=$1, message_id=$2, error=$3, sent_at=$4
+		WHERE broadcast_id=$5 AND position=$6 AND status=$7`,
+		status, messageID, errMsg, time.Now().Unix(), broadcastID, position, recipientStatusSending)
+	if err != nil {
+		fmt.Printf("[Broadcast] Failed to record result for %s: %v\n", recipient.Phone, err)
+	}
+	fmt.Printf("[Broadcast] %s -> %s: %s %s\n", broadcastID, recipient.Phone, status, errMsg)
+
+	time.Sleep(time.Duration(job.IntervalMs) * time.Millisecond)
+	return true
+}
+
+// sendBroadcastRecipient checks and sends to a single recipient and returns the recipient state to store
+func (cm *ClientManager) sendBroadcastRecipient(waClient *WhatsAppClient, job BroadcastResponse, recipient BroadcastRecipient) (string, string, string) {
+	targetJID, phone, err := waClient.parseRecipient(recipient.Phone)
+	if err != nil {
+		return recipientStatusFailed, "", fmt.Sprintf("Invalid phone number: %v", err)
+	}
+
+	if !job.SkipWhatsAppCheck && targetJID.Server == types.DefaultUserServer {
+		result, err := waClient.client.IsOnWhatsApp(context.Background(), []string{phone})
+		if err != nil {
+			return recipientStatusFailed, "", fmt.Sprintf("Failed to check: %v", err)
+		}
+		if len(result) == 0 || !result[0].IsIn {
+			return recipientStatusNotOnWhatsApp, "", ""
+		}
+	}
+
+	payload, err := renderBroadcastPayload(job.Payload, recipient)
+	if err != nil {
+		return recipientStatusFailed, "", err.Error()
+	}
+
+	resp, _ := cm.dispatchSend(waClient, job.Type, payload)
+	if !resp.Success {
+		return recipientStatusFailed, "", resp.Error
+	}
+	return recipientStatusSent, resp.MessageID, resp.Error
+}
+
+// finishBroadcast stores the final state of a broadcast and sends the delivery report to the backend
+func (cm *ClientManager) finishBroadcast(job BroadcastResponse, status string) {
+	// Only a running broadcast is finished, so a pause or cancel that just landed wins
+	result, err := cm.db.Exec(`UPDATE aimeow_broadcasts SET status=$1, finished_at=$2 WHERE id=$3 AND status=$4`,
+		status, time.Now().Unix(), job.ID, broadcastStatusRunning)
+	if err != nil {
+		fmt.Printf("[Broadcast] Failed to finish broadcast %s: %v\n", job.ID, err)
+		return
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		fmt.Printf("[Broadcast] Broadcast %s was no longer running, not marking it %s\n", job.ID, status)
+		return
+	}
+
+	report, err := cm.getBroadcast(job.ID, false)
+	if err != nil {
+		fmt.Printf("[Broadcast] Failed to load report for %s: %v\n", job.ID, err)
+		return
+	}
+	fmt.Printf("[Broadcast] Broadcast %s %s: %d sent, %d failed, %d not on WhatsApp\n",
+		job.ID, status, report.Sent, report.Failed, report.NotOnWhatsApp)
+
+	go cm.sendConnectionStatusWebhook(job.ClientID, "broadcast_"+status, map[string]interface{}{
+		"broadcastId":   report.ID,
+		"total":         report.Total,
+		"sent":          report.Sent,
+		"failed":        report.Failed,
+		"notOnWhatsApp": report.NotOnWhatsApp,
+		"pending":       report.Pending,
+	})
+}
+
+// validateBroadcastPayloads renders and decodes the payload of every recipient. The error names
+// the positions (from 1) of the recipients whose payload is invalid and the first problem.
+func validateBroadcastPayloads(msgType string, payload json.RawMessage, recipients []BroadcastRecipient) error {
+	var bad []string
+	var firstErr error
+	for i, recipient := range recipients {
+		rendered, err := renderBroadcastPayload(payload, recipient)
+		if err == nil {
+			_, err = decodeSendPayload(msgType, rendered)
+		}
+		if err == nil {
+			continue
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+		if len(bad) < maxReportedRecipients {
+			bad = append(bad, strconv.Itoa(i+1))
+		} else if len(bad) == maxReportedRecipients {
+			bad = append(bad, "...")
+		}
+	}
+	if firstErr == nil {
+		return nil
+	}
+	return fmt.Errorf("invalid payload for recipient(s) %s: %v", strings.Join(bad, ", "), firstErr)
+}
+
+// getClientBroadcast loads a broadcast and writes the error response if it doesn't belong to the client
+func getClientBroadcast(c *gin.Context, withRecipients bool) (BroadcastResponse, bool) {
+	job, err := manager.getBroadcast(c.Param("broadcast_id"), withRecipients)
+	if err == sql.ErrNoRows || (err == nil && job.ClientID != c.Param("id")) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "broadcast not found"})
+		return job, false
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return job, false
+	}
+	return job, true
+}
+
+// @Summary Create a broadcast
+// @Description Sends one message to many recipients with throttling. String fields of the payload may use {{name}} placeholders filled from each recipient's variables. The payload is rendered and checked for every recipient before the broadcast starts; the error names the positions of recipients with a missing variable or invalid payload.
+// @Tags broadcasts
+// @Accept json
+// @Produce json
+// @Param id path string true "Client ID"
+// @Param broadcast body CreateBroadcastRequest true "Broadcast details"
+// @Param Idempotency-Key header string false "Key that makes retries return the original response"
+// @Success 200 {object} BroadcastResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /clients/{id}/broadcasts [post]
+func createBroadcast(c *gin.Context) {
+	clientID := c.Param("id")
+
+	waClient, err := manager.getClient(clientID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	var req CreateBroadcastRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Type == "" {
+		req.Type = "message"
+	}
+	if req.IntervalMs == 0 {
+		req.IntervalMs = int(time.Duration(appConfig().RateLimit.BroadcastInterval) / time.Millisecond)
+	}
+
+	// Recipients are stored normalized, so the {{phone}} variable and the results show E.164 numbers
+	for i := range req.Recipients {
+		_, phone, err := waClient.parseRecipient(req.Recipients[i].Phone)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("recipient %d: invalid phone number: %v", i+1, err)})
+			return
+		}
+		req.Recipients[i].Phone = phone
+	}
+
+	// Render the payload for every recipient to catch invalid payloads before queueing
+	if err := validateBroadcastPayloads(req.Type, req.Payload, req.Recipients); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	broadcastID := uuid.New().String()
+	now := time.Now().Unix()
+
+	tx, err := manager.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`INSERT INTO aimeow_broadcasts (id, client_id, type, payload, status, interval_ms, skip_whatsapp_check, created_at, started_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		broadcastID, clientID, req.Type, string(req.Payload), broadcastStatusRunning, req.IntervalMs, req.SkipWhatsAppCheck, now, now)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to store broadcast: %v", err)})
+		return
+	}
+	for i, recipient := range req.Recipients {
+		variables, _ := json.Marshal(recipient.Variables)
+		_, err = tx.Exec(`INSERT INTO aimeow_broadcast_recipients (broadcast_id, position, phone, variables, status) VALUES ($1, $2, $3, $4, $5)`,
+			broadcastID, i, recipient.Phone, string(variables), recipientStatusPending)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to store recipient: %v", err)})
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	fmt.Printf("[Broadcast] Created broadcast %s for client %s with %d recipient(s)\n", broadcastID, clientID, len(req.Recipients))
+	manager.startBroadcastRunner(broadcastID)
+
+	job, err := manager.getBroadcast(broadcastID, false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+// @Summary List broadcasts
+// @Description Returns the broadcasts of a client with their delivery counters, newest first
+// @Tags broadcasts
+// @Accept json
+// @Produce json
+// @Param id path string true "Client ID"
+// @Success 200 {array} BroadcastResponse
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /clients/{id}/broadcasts [get]
+func listBroadcasts(c *gin.Context) {
+	clientID := c.Param("id")
+
+	if _, err := manager.getClient(clientID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	rows, err := manager.db.Query(`SELECT id FROM aimeow_broadcasts WHERE client_id=$1 ORDER BY created_at DESC`, clientID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	rows.Close()
+
+	response := make([]BroadcastResponse, 0, len(ids))
+	for _, id := range ids {
+		job, err := manager.getBroadcast(id, false)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		response = append(response, job)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// @Summary Get broadcast report
+// @Description Returns a broadcast with its delivery report for every recipient
+// @Tags broadcasts
+// @Accept json
+// @Produce json
+// @Param id path string true "Client ID"
+// @Param broadcast_id path string true "Broadcast ID"
+// @Success 200 {object} BroadcastResponse
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /clients/{id}/broadcasts/{broadcast_id} [get]
+func getBroadcast(c *gin.Context) {
+	job, ok := getClientBroadcast(c, true)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+// setBroadcastStatus moves a broadcast from one of the given states to a new one
+func setBroadcastStatus(c *gin.Context, status string, from ...string) {
+	job, ok := getClientBroadcast(c, false)
+	if !ok {
+		return
+	}
+
+	allowed := false
+	for _, s := range from {
+		if job.Status == s {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("broadcast is %s", job.Status)})
+		return
+	}
+
+	var finishedAt sql.NullInt64
+	if status == broadcastStatusCancelled {
+		finishedAt = sql.NullInt64{Int64: time.Now().Unix(), Valid: true}
+	}
+	// The source states are checked again in the update, as the runner may have finished the
+	// broadcast since it was read
+	args := []interface{}{status, finishedAt, job.ID}
+	for _, s := range from {
+		args = append(args, s)
+	}
+	result, err := manager.db.Exec(`UPDATE aimeow_broadcasts SET status=$1, finished_at=$2
+		WHERE id=$3 AND status IN (`+inPlaceholders(4, len(from))+`)`, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	} else if n == 0 {
+		current, err := manager.getBroadcast(job.ID, false)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("broadcast is %s", current.Status)})
+		return
+	}
+
+	if status == broadcastStatusRunning {
+		manager.startBroadcastRunner(job.ID)
+	}
+
+	job, err = manager.getBroadcast(job.ID, false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+// @Summary Pause a broadcast
+// @Description Pauses a running broadcast after the recipient currently being sent
+// @Tags broadcasts
+// @Accept json
+// @Produce json
+// @Param id path string true "Client ID"
+// @Param broadcast_id path string true "Broadcast ID"
+// @Success 200 {object} BroadcastResponse
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /clients/{id}/broadcasts/{broadcast_id}/pause [post]
+func pauseBroadcast(c *gin.Context) {
+	setBroadcastStatus(c, broadcastStatusPaused, broadcastStatusRunning)
+}
+
+// @Summary Resume a broadcast
+// @Description Resumes a paused broadcast with the next pending recipient
+// @Tags broadcasts
+// @Accept json
+// @Produce json
+// @Param id path string true "Client ID"
+// @Param broadcast_id path string true "Broadcast ID"
+// @Success 200 {object} BroadcastResponse
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /clients/{id}/broadcasts/{broadcast_id}/resume [post]
+func resumeBroadcast(c *gin.Context) {
+	setBroadcastStatus(c, broadcastStatusRunning, broadcastStatusPaused)
+}
+
+// @Summary Cancel a broadcast
+// @Description Cancels a running or paused broadcast; recipients not yet sent stay pending in the report
+// @Tags broadcasts
+// @Accept json
+// @Produce json
+// @Param id path string true "Client ID"
+// @Param broadcast_id path string true "Broadcast ID"
+// @Success 200 {object} BroadcastResponse
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /clients/{id}/broadcasts/{broadcast_id}/cancel [post]
+func cancelBroadcast(c *gin.Context) {
+	setBroadcastStatus(c, broadcastStatusCancelled, broadcastStatusRunning, broadcastStatusPaused)
+}
@@ -11,13 +11,13 @@ AIMEOW_DIR="$(dirname "$0")"
 # Build with stripped symbols for all platforms
 echo "→ Building Windows binary..."
 cd "$AIMEOW_DIR"
-GOOS=windows GOARCH=amd64 go build -ldflags="-s -w" -o "aimeow.exe"
+GOOS=windows GOARCH=amd64 go build -tags sqlite_fts5 -ldflags="-s -w" -o "aimeow.exe"
 
 echo "→ Building Linux binary..."
-GOOS=linux GOARCH=amd64 go build -ldflags="-s -w" -o "aimeow.linux"
+GOOS=linux GOARCH=amd64 go build -tags sqlite_fts5 -ldflags="-s -w" -o "aimeow.linux"
 
 echo "→ Building macOS binary..."
-GOOS=darwin GOARCH=arm64 go build -ldflags="-s -w" -o "aimeow.macos"
+GOOS=darwin GOARCH=arm64 go build -tags sqlite_fts5 -ldflags="-s -w" -o "aimeow.macos"
 
 echo ""
 echo "✓ Build complete!"
@@ -0,0 +1,678 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/proto/waHistorySync"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// Where a stored message came from
+const (
+	messageSourceLive    = "live"    // Received or sent from another device while connected
+	messageSourceHistory = "history" // Delivered by history sync after linking
+	messageSourceSent    = "sent"    // Sent through the API
+)
+
+// Page size limits for the chat and message lists
+const (
+	defaultChatsPageSize    = 100
+	maxChatsPageSize        = 1000
+	defaultMessagesPageSize = 50
+	maxMessagesPageSize     = 500
+)
+
+// StoredMessage is a message in the persistent message store
+type StoredMessage struct {
+	ID          string    `json:"id"`
+	ChatJID     string    `json:"chatJid"`
+	SenderJID   string    `json:"senderJid,omitempty"`
+	SenderPhone string    `json:"senderPhone,omitempty"` // Sender in E.164, if known
+	SenderName  string    `json:"senderName,omitempty"`  // Push name at the time of the message
+	FromMe      bool      `json:"fromMe"`
+	Timestamp   time.Time `json:"timestamp"`
+	Type        string    `json:"type"` // text, image, video, audio, document, sticker, location, live_location, contact, poll, revoked or other
+	Text        string    `json:"text,omitempty"`
+	Caption     string    `json:"caption,omitempty"`
+	FileName    string    `json:"fileName,omitempty"`
+	MimeType    string    `json:"mimeType,omitempty"`
+	FileURL     string    `json:"fileUrl,omitempty"` // Set when the media was downloaded
+	Edited      bool      `json:"edited,omitempty"`
+	Source      string    `json:"source"` // live, history or sent
+
+	mediaPath string
+}
+
+// Chat is a conversation in the persistent message store
+type Chat struct {
+	JID           string         `json:"jid"`
+	Name          string         `json:"name,omitempty"`
+	Phone         string         `json:"phone,omitempty"` // E.164, for individual chats whose number is known
+	IsGroup       bool           `json:"isGroup"`
+	UnreadCount   int            `json:"unreadCount"`
+	Archived      bool           `json:"archived"`
+	Pinned        bool           `json:"pinned"`
+	MutedUntil    *time.Time     `json:"mutedUntil,omitempty"`
+	LastMessageAt *time.Time     `json:"lastMessageAt,omitempty"`
+	LastMessage   *StoredMessage `json:"lastMessage,omitempty"`
+}
+
+// messageContent extracts what is stored about a message. It reports false for messages that
+// carry no content of their own, such as reactions and protocol messages.
+func messageContent(msg *waE2E.Message) (StoredMessage, bool) {
+	var m StoredMessage
+	switch {
+	case msg == nil:
+		return m, false
+	case msg.GetConversation() != "":
+		m.Type = "text"
+		m.Text = msg.GetConversation()
+	case msg.GetExtendedTextMessage() != nil:
+		m.Type = "text"
+		m.Text = msg.GetExtendedTextMessage().GetText()
+	case msg.GetImageMessage() != nil:
+		m.Type = "image"
+		m.Caption = msg.GetImageMessage().GetCaption()
+		m.MimeType = msg.GetImageMessage().GetMimetype()
+	case msg.GetVideoMessage() != nil:
+		m.Type = "video"
+		m.Caption = msg.GetVideoMessage().GetCaption()
+		m.MimeType = msg.GetVideoMessage().GetMimetype()
+	case msg.GetAudioMessage() != nil:
+		m.Type = "audio"
+		m.MimeType = msg.GetAudioMessage().GetMimetype()
+	case msg.GetDocumentMessage() != nil:
+		m.Type = "document"
+		m.Caption = msg.GetDocumentMessage().GetCaption()
+		m.FileName = msg.GetDocumentMessage().GetFileName()
+		m.MimeType = msg.GetDocumentMessage().GetMimetype()
+	case msg.GetStickerMessage() != nil:
+		m.Type = "sticker"
+		m.MimeType = msg.GetStickerMessage().GetMimetype()
+	case msg.GetLiveLocationMessage() != nil:
+		m.Type = "live_location"
+		m.Caption = msg.GetLiveLocationMessage().GetCaption()
+	case msg.GetLocationMessage() != nil:
+		m.Type = "location"
+		m.Text = strings.TrimSpace(msg.GetLocationMessage().GetName() + "\n" + msg.GetLocationMessage().GetAddress())
+	case msg.GetContactMessage() != nil:
+		m.Type = "contact"
+		m.Text = msg.GetContactMessage().GetDisplayName()
+	case msg.GetContactsArrayMessage() != nil:
+		m.Type = "contact"
+		m.Text = msg.GetContactsArrayMessage().GetDisplayName()
+	case msg.GetPollCreationMessage() != nil:
+		m.Type = "poll"
+		m.Text = msg.GetPollCreationMessage().GetName()
+	case msg.GetPollCreationMessageV3() != nil:
+		m.Type = "poll"
+		m.Text = msg.GetPollCreationMessageV3().GetName()
+	case msg.GetProtocolMessage() != nil, msg.GetReactionMessage() != nil, msg.GetEncReactionMessage() != nil,
+		msg.GetPollUpdateMessage() != nil, msg.GetKeepInChatMessage() != nil, msg.GetPinInChatMessage() != nil,
+		msg.GetSenderKeyDistributionMessage() != nil:
+		return m, false
+	default:
+		m.Type = "other"
+	}
+	return m, true
+}
+
+// newStoredMessage builds the stored form of a received or history sync message
+func newStoredMessage(evt *events.Message, source string) (StoredMessage, bool) {
+	m, ok := messageContent(evt.Message)
+	if !ok {
+		return m, false
+	}
+	m.ID = evt.Info.ID
+	m.ChatJID = evt.Info.Chat.ToNonAD().String()
+	m.SenderJID = evt.Info.Sender.ToNonAD().String()
+	if evt.Info.Sender.Server == types.DefaultUserServer {
+		m.SenderPhone = "+" + evt.Info.Sender.User
+	} else if evt.Info.SenderAlt.Server == types.DefaultUserServer {
+		m.SenderPhone = "+" + evt.Info.SenderAlt.User
+	}
+	m.SenderName = evt.Info.PushName
+	m.FromMe = evt.Info.IsFromMe
+	m.Timestamp = evt.Info.Timestamp
+	m.Edited = evt.IsEdit
+	m.Source = source
+	return m, true
+}
+
+// sqlExecer is implemented by both *sql.DB and *sql.Tx
+type sqlExecer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// storeMessage saves a message and moves its chat's last message time forward. Incoming
+// messages count as unread; a message sent from this account marks the chat as read.
+func storeMessage(ctx context.Context, exec sqlExecer, clientID string, m StoredMessage, countUnread bool) error {
+	_, err := exec.ExecContext(ctx, `INSERT INTO aimeow_messages (client_id, chat_jid, id, sender_jid, sender_phone, sender_name,
+		from_me, timestamp, type, text, caption, file_name, mime_type, media_path, edited, source)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
+		ON CONFLICT (client_id, chat_jid, id) DO UPDATE SET media_path=excluded.media_path WHERE excluded.media_path != ''`,
+		clientID, m.ChatJID, m.ID, m.SenderJID, m.SenderPhone, m.SenderName, m.FromMe, m.Timestamp.Unix(),
+		m.Type, m.Text, m.Caption, m.FileName, m.MimeType, m.mediaPath, m.Edited, m.Source)
+	if err != nil {
+		return fmt.Errorf("failed to store message %s: %w", m.ID, err)
+	}
+
+	unread := 0
+	if countUnread && !m.FromMe {
+		unread = 1
+	}
+	_, err = exec.ExecContext(ctx, `INSERT INTO aimeow_chats (client_id, jid, unread_count, last_message_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (client_id, jid) DO UPDATE SET
+		unread_count=CASE WHEN $6 THEN 0 ELSE aimeow_chats.unread_count + excluded.unread_count END,
+		last_message_at=CASE WHEN excluded.last_message_at > aimeow_chats.last_message_at THEN excluded.last_message_at ELSE aimeow_chats.last_message_at END,
+		updated_at=excluded.updated_at`,
+		clientID, m.ChatJID, unread, m.Timestamp.Unix(), time.Now().Unix(), countUnread && m.FromMe)
+	if err != nil {
+		return fmt.Errorf("failed to update chat %s: %w", m.ChatJID, err)
+	}
+	return nil
+}
+
+// canonicalChatJID returns the JID a chat is stored under. Individual chats that WhatsApp
+// delivers by LID are kept under the phone number once it is known, so a contact doesn't end
+// up with two chats.
+func (cm *ClientManager) canonicalChatJID(ctx context.Context, client *WhatsAppClient, jid types.JID) types.JID {
+	jid = jid.ToNonAD()
+	if jid.Server != types.HiddenUserServer {
+		return jid
+	}
+	if result, ok := cm.lookupLID(ctx, client, jid); ok && result.Phone != "" {
+		return types.NewJID(result.Phone, types.DefaultUserServer)
+	}
+	return jid
+}
+
+// recordLiveMessage stores a message received while connected. Revokes and edits update the
+// message they refer to instead of being stored themselves. The caller must hold the client's lock.
+func (cm *ClientManager) recordLiveMessage(client *WhatsAppClient, evt *events.Message) {
+	ctx := context.Background()
+
+	if protocol := evt.Message.GetProtocolMessage(); protocol != nil {
+		var err error
+		switch protocol.GetType() {
+		case waE2E.ProtocolMessage_REVOKE:
+			err = cm.revokeStoredMessage(client.id, protocol.GetKey().GetID())
+		case waE2E.ProtocolMessage_MESSAGE_EDIT:
+			if edited, ok := messageContent(protocol.GetEditedMessage()); ok {
+				_, err = cm.db.ExecContext(ctx, `UPDATE aimeow_messages SET text=$1, caption=$2, edited=$3 WHERE client_id=$4 AND id=$5`,
+					edited.Text, edited.Caption, true, client.id, protocol.GetKey().GetID())
+			}
+		}
+		if err != nil {
+			fmt.Printf("[History] Failed to apply %s to message %s: %v\n", protocol.GetType(), protocol.GetKey().GetID(), err)
+		}
+		return
+	}
+
+	m, ok := newStoredMessage(evt, messageSourceLive)
+	if !ok {
+		return
+	}
+	m.ChatJID = cm.canonicalChatJID(ctx, client, evt.Info.Chat).String()
+	m.mediaPath = client.images[evt.Info.ID]
+	if err := storeMessage(ctx, cm.db, client.id, m, true); err != nil {
+		fmt.Printf("[History] %v\n", err)
+	}
+}
+
+// revokeStoredMessage blanks a message that was deleted for everyone
+func (cm *ClientManager) revokeStoredMessage(clientID string, messageID string) error {
+	_, err := cm.db.Exec(`UPDATE aimeow_messages SET type='revoked', text='', caption='' WHERE client_id=$1 AND id=$2`,
+		clientID, messageID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke stored message %s: %w", messageID, err)
+	}
+	return nil
+}
+
+// recordSentMessage stores a message sent through the API
+func (cm *ClientManager) recordSentMessage(client *WhatsAppClient, chat types.JID, resp whatsmeow.SendResponse, msg *waE2E.Message) {
+	m, ok := messageContent(msg)
+	if !ok {
+		return
+	}
+	m.ID = resp.ID
+	m.ChatJID = cm.canonicalChatJID(context.Background(), client, chat).String()
+	if client.deviceStore.ID != nil {
+		m.SenderJID = client.deviceStore.ID.ToNonAD().String()
+		m.SenderPhone = "+" + client.deviceStore.ID.User
+	}
+	m.FromMe = true
+	m.Timestamp = resp.Timestamp
+	if m.Timestamp.IsZero() {
+		m.Timestamp = time.Now()
+	}
+	m.Source = messageSourceSent
+	if err := storeMessage(context.Background(), cm.db, client.id, m, true); err != nil {
+		fmt.Printf("[History] %v\n", err)
+	}
+}
+
+// ingestHistorySync stores the conversations and messages of a history sync blob
+func (cm *ClientManager) ingestHistorySync(client *WhatsAppClient, data *waHistorySync.HistorySync) {
+	ctx := context.Background()
+
+	// Resolve the chats before the transaction starts: a LID lookup may cache the mapping through
+	// cm.db, which on SQLite would wait for the write lock the transaction holds
+	type historyChat struct {
+		conv      *waHistorySync.Conversation
+		chatJID   types.JID
+		storedJID types.JID
+	}
+	var chats []historyChat
+	for _, conv := range data.GetConversations() {
+		chatJID, err := types.ParseJID(conv.GetID())
+		if err != nil {
+			fmt.Printf("[History] Skipping conversation with invalid JID %q: %v\n", conv.GetID(), err)
+			continue
+		}
+		chatJID = chatJID.ToNonAD()
+		storedJID := chatJID
+		if chatJID.Server == types.HiddenUserServer {
+			if pn, err := types.ParseJID(conv.GetPnJID()); err == nil && pn.Server == types.DefaultUserServer {
+				storedJID = pn.ToNonAD()
+			} else {
+				storedJID = cm.canonicalChatJID(ctx, client, chatJID)
+			}
+		}
+		chats = append(chats, historyChat{conv: conv, chatJID: chatJID, storedJID: storedJID})
+	}
+
+	tx, err := cm.db.BeginTx(ctx, nil)
+	if err != nil {
+		fmt.Printf("[History] Failed to start transaction for client %s: %v\n", client.id, err)
+		return
+	}
+	defer tx.Rollback()
+
+	now := time.Now().Unix()
+	conversations, messages := 0, 0
+	var pairs [][2]types.JID
+	for _, chat := range chats {
+		conv, chatJID, storedJID := chat.conv, chat.chatJID, chat.storedJID
+
+		name := conv.GetName()
+		if name == "" {
+			name = conv.GetDisplayName()
+		}
+		unread := int(conv.GetUnreadCount())
+		if unread == 0 && conv.GetMarkedAsUnread() {
+			unread = 1
+		}
+		_, err = tx.ExecContext(ctx, `INSERT INTO aimeow_chats (client_id, jid, name, unread_count, archived, pinned, muted_until, last_message_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+			ON CONFLICT (client_id, jid) DO UPDATE SET
+			name=CASE WHEN excluded.name != '' THEN excluded.name ELSE aimeow_chats.name END,
+			unread_count=excluded.unread_count, archived=excluded.archived, pinned=excluded.pinned, muted_until=excluded.muted_until,
+			last_message_at=CASE WHEN excluded.last_message_at > aimeow_chats.last_message_at THEN excluded.last_message_at ELSE aimeow_chats.last_message_at END,
+			updated_at=excluded.updated_at`,
+			client.id, storedJID.String(), name, unread, conv.GetArchived(), conv.GetPinned() > 0,
+			int64(conv.GetMuteEndTime()), int64(conv.GetConversationTimestamp()), now)
+		if err != nil {
+			fmt.Printf("[History] Failed to store chat %s: %v\n", chatJID, err)
+			continue
+		}
+		conversations++
+
+		if lid, err := types.ParseJID(conv.GetLidJID()); err == nil && conv.GetLidJID() != "" {
+			if pn, err := types.ParseJID(conv.GetPnJID()); err == nil && conv.GetPnJID() != "" {
+				if lid, pn, ok := lidPNPair(lid, pn); ok {
+					pairs = append(pairs, [2]types.JID{lid, pn})
+				}
+			}
+		}
+
+		for _, item := range conv.GetMessages() {
+			evt, err := client.client.ParseWebMessage(chatJID, item.GetMessage())
+			if err != nil {
+				continue
+			}
+			m, ok := newStoredMessage(evt, messageSourceHistory)
+			if !ok {
+				continue
+			}
+			m.ChatJID = storedJID.String()
+			// Unread counts come with the conversation, so messages don't add to them
+			if err := storeMessage(ctx, tx, client.id, m, false); err != nil {
+				fmt.Printf("[History] %v\n", err)
+				continue
+			}
+			messages++
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		fmt.Printf("[History] Failed to commit history sync for client %s: %v\n", client.id, err)
+		return
+	}
+	for _, pair := range pairs {
+		cm.cacheLIDMapping(ctx, pair[0], pair[1], lidSourceHistory)
+	}
+
+	fmt.Printf("[History] Client %s: stored %d conversation(s) and %d message(s) from %s sync (progress %d%%)\n",
+		client.id, conversations, messages, data.GetSyncType(), data.GetProgress())
+	cm.sendConnectionStatusWebhook(client.id, "history_synced", map[string]interface{}{
+		"syncType":      data.GetSyncType().String(),
+		"conversations": conversations,
+		"messages":      messages,
+		"progress":      data.GetProgress(),
+	})
+}
+
+// updateChatFlag sets a flag of a chat from an app state event, creating the chat if needed
+func (cm *ClientManager) updateChatFlag(client *WhatsAppClient, chat types.JID, column string, value interface{}) {
+	_, err := cm.db.Exec(`INSERT INTO aimeow_chats (client_id, jid, `+column+`, updated_at) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (client_id, jid) DO UPDATE SET `+column+`=excluded.`+column+`, updated_at=excluded.updated_at`,
+		client.id, cm.canonicalChatJID(context.Background(), client, chat).String(), value, time.Now().Unix())
+	if err != nil {
+		fmt.Printf("[History] Failed to update %s of chat %s: %v\n", column, chat, err)
+	}
+}
+
+// chatJIDCandidates returns the JIDs a chat may be stored under. Individual chats can be keyed
+// by the phone number or the LID, depending on how WhatsApp delivered them.
+func (cm *ClientManager) chatJIDCandidates(ctx context.Context, client *WhatsAppClient, jid types.JID) []string {
+	candidates := []string{jid.String()}
+	if jid.Server != types.DefaultUserServer && jid.Server != types.HiddenUserServer {
+		return candidates
+	}
+	result := cm.resolveJID(ctx, client, jid, false)
+	if !result.Resolved {
+		return candidates
+	}
+	if jid.Server == types.HiddenUserServer {
+		return append(candidates, result.Phone+"@"+types.DefaultUserServer)
+	}
+	return append(candidates, result.LID)
+}
+
+// inPlaceholders returns "$n, $n+1, ..." for count query parameters starting at n
+func inPlaceholders(n int, count int) string {
+	placeholders := make([]string, count)
+	for i := range placeholders {
+		placeholders[i] = "$" + strconv.Itoa(n+i)
+	}
+	return strings.Join(placeholders, ", ")
+}
+
+const storedMessageColumns = `chat_jid, id, sender_jid, sender_phone, sender_name, from_me, timestamp, type, text, caption, file_name, mime_type, media_path, edited, source`
+
+// scanStoredMessage reads a message row and sets its file URL if the media was downloaded
+func scanStoredMessage(row interface{ Scan(...interface{}) error }, clientID string) (StoredMessage, error) {
+	var m StoredMessage
+	var timestamp int64
+	err := row.Scan(&m.ChatJID, &m.ID, &m.SenderJID, &m.SenderPhone, &m.SenderName, &m.FromMe, &timestamp,
+		&m.Type, &m.Text, &m.Caption, &m.FileName, &m.MimeType, &m.mediaPath, &m.Edited, &m.Source)
+	if err != nil {
+		return m, err
+	}
+	m.Timestamp = time.Unix(timestamp, 0).UTC()
+	if m.mediaPath != "" {
+		m.FileURL = fmt.Sprintf("%s/files/%s/%s", baseURL, clientID, m.ID)
+	}
+	return m, nil
+}
+
+// storedMediaPath returns the downloaded media file of a stored message
+func (cm *ClientManager) storedMediaPath(clientID string, messageID string) (string, bool) {
+	var path string
+	err := cm.db.QueryRow(`SELECT media_path FROM aimeow_messages WHERE client_id=$1 AND id=$2 AND media_path != '' LIMIT 1`,
+		clientID, messageID).Scan(&path)
+	return path, err == nil
+}
+
+// parseTimeParam parses a query parameter given as RFC3339 or Unix seconds
+func parseTimeParam(c *gin.Context, name string) (*time.Time, error) {
+	value := c.Query(name)
+	if value == "" {
+		return nil, nil
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		t := time.Unix(seconds, 0).UTC()
+		return &t, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be RFC3339 or Unix seconds", name)
+	}
+	return &t, nil
+}
+
+// parseBoolParam parses an optional boolean query parameter
+func parseBoolParam(c *gin.Context, name string) (*bool, error) {
+	value := c.Query(name)
+	if value == "" {
+		return nil, nil
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be true or false", name)
+	}
+	return &parsed, nil
+}
+
+// @Summary List chats
+// @Description Returns the chats in the message store, filled from history sync after linking and from live messages, pinned chats first and then by last activity. The total number of matching chats is returned in the X-Total-Count header.
+// @Tags chats
+// @Accept json
+// @Produce json
+// @Param id path string true "Client ID"
+// @Param archived query bool false "Only archived (true) or unarchived (false) chats"
+// @Param pinned query bool false "Only pinned (true) or unpinned (false) chats"
+// @Param unread query bool false "Only chats with (true) or without (false) unread messages"
+// @Param limit query int false "Maximum number of chats to return (1-1000)" default(100)
+// @Param offset query int false "Number of chats to skip" default(0)
+// @Success 200 {array} Chat
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /clients/{id}/chats [get]
+func getChats(c *gin.Context) {
+	clientID := c.Param("id")
+	waClient, err := manager.getClient(clientID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	limit, offset, err := parsePageParams(c, defaultChatsPageSize, maxChatsPageSize)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	where := []string{"client_id=$1"}
+	args := []interface{}{clientID}
+	for _, filter := range []struct{ param, condition string }{
+		{"archived", "archived=$%d"},
+		{"pinned", "pinned=$%d"},
+		{"unread", "(unread_count > 0)=$%d"},
+	} {
+		value, err := parseBoolParam(c, filter.param)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if value != nil {
+			args = append(args, *value)
+			where = append(where, fmt.Sprintf(filter.condition, len(args)))
+		}
+	}
+	condition := strings.Join(where, " AND ")
+
+	ctx := c.Request.Context()
+	var total int
+	if err := manager.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM aimeow_chats WHERE `+condition, args...).Scan(&total); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to count chats: %v", err)})
+		return
+	}
+
+	rows, err := manager.db.QueryContext(ctx, fmt.Sprintf(`SELECT jid, name, unread_count, archived, pinned, muted_until, last_message_at
+		FROM aimeow_chats WHERE %s ORDER BY pinned DESC, last_message_at DESC, jid LIMIT %d OFFSET %d`, condition, limit, offset), args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to list chats: %v", err)})
+		return
+	}
+	chats := make([]Chat, 0)
+	for rows.Next() {
+		var chat Chat
+		var mutedUntil, lastMessageAt int64
+		if err := rows.Scan(&chat.JID, &chat.Name, &chat.UnreadCount, &chat.Archived, &chat.Pinned, &mutedUntil, &lastMessageAt); err != nil {
+			rows.Close()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to read chat: %v", err)})
+			return
+		}
+		if mutedUntil > time.Now().Unix() {
+			t := time.Unix(mutedUntil, 0).UTC()
+			chat.MutedUntil = &t
+		}
+		if lastMessageAt > 0 {
+			t := time.Unix(lastMessageAt, 0).UTC()
+			chat.LastMessageAt = &t
+		}
+		chats = append(chats, chat)
+	}
+	rows.Close()
+
+	for i := range chats {
+		manager.fillChatDetails(ctx, waClient, clientID, &chats[i])
+	}
+
+	c.Header("X-Total-Count", strconv.Itoa(total))
+	c.JSON(http.StatusOK, chats)
+}
+
+// fillChatDetails adds the last message, the phone number and a name from the contact store
+func (cm *ClientManager) fillChatDetails(ctx context.Context, client *WhatsAppClient, clientID string, chat *Chat) {
+	jid, err := types.ParseJID(chat.JID)
+	if err != nil {
+		return
+	}
+	chat.IsGroup = jid.Server == types.GroupServer
+
+	row := cm.db.QueryRowContext(ctx, `SELECT `+storedMessageColumns+` FROM aimeow_messages
+		WHERE client_id=$1 AND chat_jid=$2 ORDER BY timestamp DESC LIMIT 1`, clientID, chat.JID)
+	if last, err := scanStoredMessage(row, clientID); err == nil {
+		chat.LastMessage = &last
+	}
+
+	if jid.Server == types.DefaultUserServer {
+		chat.Phone = "+" + jid.User
+	} else if jid.Server == types.HiddenUserServer {
+		if result, ok := cm.lookupLID(ctx, client, jid); ok && result.Phone != "" {
+			chat.Phone = "+" + result.Phone
+		}
+	}
+	if chat.Name == "" && client.deviceStore.Contacts != nil {
+		if info, err := client.deviceStore.Contacts.GetContact(ctx, jid); err == nil && info.Found {
+			chat.Name = newContact(jid, info).Name
+		}
+	}
+}
+
+// @Summary List chat messages
+// @Description Returns stored messages of a chat, newest first unless order=asc. Individual chats can be addressed by phone number, phone JID or LID. The total number of matching messages is returned in the X-Total-Count header.
+// @Tags chats
+// @Accept json
+// @Produce json
+// @Param id path string true "Client ID"
+// @Param jid path string true "Chat JID (group or user), LID or phone number"
+// @Param before query string false "Only messages before this time (RFC3339 or Unix seconds)"
+// @Param after query string false "Only messages after this time (RFC3339 or Unix seconds)"
+// @Param order query string false "Sort order" Enums(desc, asc) default(desc)
+// @Param limit query int false "Maximum number of messages to return (1-500)" default(50)
+// @Param offset query int false "Number of messages to skip" default(0)
+// @Success 200 {array} StoredMessage
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /clients/{id}/chats/{jid}/messages [get]
+func getChatMessages(c *gin.Context) {
+	clientID := c.Param("id")
+	waClient, err := manager.getClient(clientID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	jid, _, err := waClient.parseRecipient(c.Param("jid"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	limit, offset, err := parsePageParams(c, defaultMessagesPageSize, maxMessagesPageSize)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	order := strings.ToLower(c.DefaultQuery("order", "desc"))
+	if order != "desc" && order != "asc" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "order must be asc or desc"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	candidates := manager.chatJIDCandidates(ctx, waClient, jid.ToNonAD())
+	args := []interface{}{clientID}
+	for _, candidate := range candidates {
+		args = append(args, candidate)
+	}
+	condition := `client_id=$1 AND chat_jid IN (` + inPlaceholders(2, len(candidates)) + `)`
+	for _, bound := range []struct{ param, condition string }{
+		{"before", "timestamp < $%d"},
+		{"after", "timestamp > $%d"},
+	} {
+		t, err := parseTimeParam(c, bound.param)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if t != nil {
+			args = append(args, t.Unix())
+			condition += " AND " + fmt.Sprintf(bound.condition, len(args))
+		}
+	}
+
+	var total int
+	if err := manager.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM aimeow_messages WHERE `+condition, args...).Scan(&total); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to count messages: %v", err)})
+		return
+	}
+
+	rows, err := manager.db.QueryContext(ctx, fmt.Sprintf(`SELECT %s FROM aimeow_messages WHERE %s
+		ORDER BY timestamp %s, id %s LIMIT %d OFFSET %d`, storedMessageColumns, condition, order, order, limit, offset), args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to list messages: %v", err)})
+		return
+	}
+	defer rows.Close()
+
+	messages := make([]StoredMessage, 0)
+	for rows.Next() {
+		m, err := scanStoredMessage(rows, clientID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to read message: %v", err)})
+			return
+		}
+		messages = append(messages, m)
+	}
+
+	c.Header("X-Total-Count", strconv.Itoa(total))
+	c.JSON(http.StatusOK, messages)
+}
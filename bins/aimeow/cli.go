@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+// command is an aimeow subcommand. Without a subcommand, or with serve, aimeow runs the server.
+type command struct {
+	name  string
+	usage string // Arguments and purpose, shown by aimeow help
+	run   func(args []string) error
+}
+
+// commands lists the subcommands in the order aimeow help shows them
+func commands() []command {
+	return []command{
+		{"serve", "[-sandbox]  Run the API server (the default); -sandbox simulates WhatsApp", nil},
+		{"clients", "list | pair [-id ID]  List the clients, or pair one with a QR code in the terminal", runClientsCommand},
+		{"send", "-client ID -to PHONE -text TEXT  Send a text message", runSendCommand},
+		{"logout", "-client ID  Unlink a client and remove its session", runLogoutCommand},
+		{"webhook", "test [-url URL]  Send a test event to the status webhook", runWebhookCommand},
+		{"doctor", "Check the configuration, data directory, database, webhook and server", runDoctorCommand},
+		{"backup", "[-o FILE] [-no-media] [-passphrase-file FILE]  Back up sessions, client state and media", runBackupCommand},
+		{"restore", "[-data-dir DIR] [-passphrase-file FILE] ARCHIVE  Restore a backup into a fresh data directory", runRestoreCommand},
+		{"help", "Show this help", nil},
+	}
+}
+
+// errUsage is returned by commands called with invalid arguments; the flag package has already
+// explained the problem
+var errUsage = errors.New("invalid arguments")
+
+// runCommand runs a subcommand and returns the exit code of the process
+func runCommand(name string, args []string) int {
+	for _, cmd := range commands() {
+		if cmd.name != name || cmd.run == nil {
+			continue
+		}
+		if err := cmd.run(args); errors.Is(err, errUsage) {
+			return 2
+		} else if err != nil {
+			fmt.Fprintf(os.Stderr, "aimeow %s: %v\n", name, err)
+			return 1
+		}
+		return 0
+	}
+
+	out := os.Stdout
+	code := 0
+	if name != "help" && name != "-h" && name != "--help" {
+		out = os.Stderr
+		code = 2
+		fmt.Fprintf(out, "aimeow: unknown command %q\n\n", name)
+	}
+	fmt.Fprintf(out, "Usage: aimeow [command] [arguments]\n\nCommands:\n")
+	for _, cmd := range commands() {
+		fmt.Fprintf(out, "  %-8s %s\n", cmd.name, cmd.usage)
+	}
+	fmt.Fprintf(out, "\nCommands read the same configuration file and environment variables as the server.\n")
+	fmt.Fprintf(out, "clients pair, send and logout use the running instance (-server URL, AIMEOW_SERVER or\n")
+	fmt.Fprintf(out, "http://localhost:<port>); clients list reads the data directory when it isn't running.\n")
+	fmt.Fprintf(out, "Pass -json for JSON output. Run aimeow COMMAND -h for the flags of a command.\n")
+	return code
+}
+
+// newFlagSet returns a flag set for a subcommand that reports errors instead of exiting
+func newFlagSet(name string) *flag.FlagSet {
+	flags := flag.NewFlagSet("aimeow "+name, flag.ContinueOnError)
+	flags.SetOutput(os.Stderr)
+	return flags
+}
+
+// parseFlags parses the arguments of a subcommand
+func parseFlags(flags *flag.FlagSet, args []string) error {
+	if err := flags.Parse(args); err != nil {
+		return errUsage
+	}
+	return nil
+}
+
+// parseServeFlags parses the flags of the server, given with or without the serve command
+func parseServeFlags(args []string) error {
+	flags := newFlagSet("serve")
+	flags.BoolVar(&sandboxFlag, "sandbox", false, "simulate WhatsApp instead of connecting to it, for development and tests")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "aimeow serve: unexpected argument %q\n", flags.Arg(0))
+		return errUsage
+	}
+	return nil
+}
+
+// loadCommandConfig loads the configuration for a subcommand and makes it active
+func loadCommandConfig() (AppConfig, error) {
+	cfg, err := loadAppConfig()
+	if err != nil {
+		return cfg, fmt.Errorf("invalid configuration: %w", err)
+	}
+	currentAppConfig.Store(&cfg)
+	dataDir = cfg.Storage.DataDir
+	return cfg, nil
+}
+
+// readPassphrase returns the backup passphrase from a file, or from BACKUP_PASSPHRASE
+func readPassphrase(file string) (string, error) {
+	if file == "" {
+		return os.Getenv("BACKUP_PASSPHRASE"), nil
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return "", fmt.Errorf("failed to read passphrase: %w", err)
+	}
+	passphrase := string(data)
+	for len(passphrase) > 0 && (passphrase[len(passphrase)-1] == '\n' || passphrase[len(passphrase)-1] == '\r') {
+		passphrase = passphrase[:len(passphrase)-1]
+	}
+	if passphrase == "" {
+		return "", fmt.Errorf("passphrase file %s is empty", file)
+	}
+	return passphrase, nil
+}
+
+// runBackupCommand writes a backup of the data directory. It reads the database with the
+// SQLite online backup API, so it is safe to run while the server is running.
+func runBackupCommand(args []string) error {
+	flags := newFlagSet("backup")
+	output := flags.String("o", "", "archive to write, - for standard output (default aimeow-backup-<time>.tar.gz)")
+	noMedia := flags.Bool("no-media", false, "leave downloaded media out of the archive")
+	passphraseFile := flags.String("passphrase-file", "", "file holding the passphrase to encrypt with (default BACKUP_PASSPHRASE)")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	cfg, err := loadCommandConfig()
+	if err != nil {
+		return err
+	}
+	if cfg.Storage.DatabaseURL != "" {
+		return fmt.Errorf("backups of PostgreSQL databases are not supported, back up the database with pg_dump")
+	}
+	passphrase, err := readPassphrase(*passphraseFile)
+	if err != nil {
+		return err
+	}
+
+	db, err := openCommandDatabase(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	snapshotPath, manifest, err := snapshotDatabase(ctx, db)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(snapshotPath)
+
+	name := *output
+	if name == "" {
+		name = backupFileName(passphrase != "")
+	}
+	var out io.Writer = os.Stdout
+	if name != "-" {
+		f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err != nil {
+			return fmt.Errorf("failed to create archive: %w", err)
+		}
+		defer f.Close()
+		out = f
+	}
+
+	manifest, err = writeBackupArchive(out, snapshotPath, cfg.Storage.DataDir, manifest, backupOptions{Passphrase: passphrase, SkipMedia: *noMedia})
+	if err != nil {
+		if name != "-" {
+			os.Remove(name)
+		}
+		return err
+	}
+	if f, ok := out.(*os.File); ok && name != "-" {
+		if err := f.Close(); err != nil {
+			os.Remove(name)
+			return fmt.Errorf("failed to write archive: %w", err)
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Backed up %d client(s), %d pending client(s) and %d media file(s) to %s\n",
+		len(manifest.Clients), len(manifest.PendingClients), len(manifest.Media), name)
+	return nil
+}
+
+// runRestoreCommand unpacks a backup into a fresh data directory
+func runRestoreCommand(args []string) error {
+	flags := newFlagSet("restore")
+	targetDir := flags.String("data-dir", "", "data directory to restore into, must not exist or be empty (default storage.dataDir)")
+	passphraseFile := flags.String("passphrase-file", "", "file holding the passphrase of an encrypted archive (default BACKUP_PASSPHRASE)")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "Usage: aimeow restore [-data-dir DIR] [-passphrase-file FILE] ARCHIVE\n")
+		return errUsage
+	}
+	cfg, err := loadCommandConfig()
+	if err != nil {
+		return err
+	}
+	if *targetDir == "" {
+		*targetDir = cfg.Storage.DataDir
+	}
+	passphrase, err := readPassphrase(*passphraseFile)
+	if err != nil {
+		return err
+	}
+
+	var in io.Reader = os.Stdin
+	if archive := flags.Arg(0); archive != "-" {
+		f, err := os.Open(archive)
+		if err != nil {
+			return fmt.Errorf("failed to open archive: %w", err)
+		}
+		defer f.Close()
+		in = f
+	}
+
+	manifest, err := restoreBackup(in, *targetDir, passphrase)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Restored backup from %s: %d client(s), %d pending client(s) and %d media file(s) into %s\n",
+		manifest.CreatedAt.Local().Format("2006-01-02 15:04:05"), len(manifest.Clients), len(manifest.PendingClients), len(manifest.Media), *targetDir)
+	if cfg.Storage.DatabaseURL != "" {
+		fmt.Printf("DATABASE_URL is set; the restored SQLite database is only used when it is unset\n")
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+)
+
+// GetConfig returns the webhook URL and the active configuration of the server
+func (c *Client) GetConfig(ctx context.Context) (*ConfigResponse, error) {
+	return call[ConfigResponse](ctx, c, request{method: http.MethodGet, path: apiPath("config")})
+}
+
+// UpdateConfig sets the webhook URL or reloads the configuration of the server
+func (c *Client) UpdateConfig(ctx context.Context, req ConfigRequest) (*ConfigResponse, error) {
+	return call[ConfigResponse](ctx, c, request{method: http.MethodPost, path: apiPath("config"), jsonBody: req})
+}
+
+// WebhookSchema returns the JSON Schema of a webhook payload version; 0 returns the latest
+func (c *Client) WebhookSchema(ctx context.Context, version int) (json.RawMessage, error) {
+	query := url.Values{}
+	setInt(query, "version", version)
+	var schema json.RawMessage
+	if _, err := c.doJSON(ctx, request{method: http.MethodGet, path: apiPath("webhooks", "schema"), query: query}, &schema); err != nil {
+		return nil, err
+	}
+	return schema, nil
+}
+
+// Health reports whether the server is up
+func (c *Client) Health(ctx context.Context) error {
+	_, err := c.doJSON(ctx, request{method: http.MethodGet, path: "/health"}, nil)
+	return err
+}
+
+// File streams a media file of a client, as linked by the fileUrl of messages. The caller closes
+// the reader.
+func (c *Client) File(ctx context.Context, clientID string, fileID string) (io.ReadCloser, string, error) {
+	resp, err := c.do(ctx, request{method: http.MethodGet, path: escapePath("files", clientID, fileID)})
+	if err != nil {
+		return nil, "", err
+	}
+	return resp.Body, resp.Header.Get("Content-Type"), nil
+}
+
+// Backup streams an encrypted backup archive of the sessions, client state and media. The
+// server only serves it with an admin token, sent with WithHeader("Authorization", "Bearer "+token).
+// The caller closes the reader.
+func (c *Client) Backup(ctx context.Context, req BackupRequest) (io.ReadCloser, error) {
+	resp, err := c.do(ctx, request{method: http.MethodPost, path: apiPath("admin", "backup"), jsonBody: req})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// Restore unpacks a backup archive into a fresh data directory on the server, given relative to
+// its restore directory (storage.restoreDir). Like Backup it needs the admin token. The passphrase
+// is only needed for encrypted archives. The request is not retried, as the archive is streamed.
+func (c *Client) Restore(ctx context.Context, archive io.Reader, dataDir string, passphrase string) (*RestoreResponse, error) {
+	body, writer := io.Pipe()
+	form := multipart.NewWriter(writer)
+	go func() {
+		writer.CloseWithError(writeRestoreForm(form, archive, dataDir, passphrase))
+	}()
+
+	defer body.Close()
+	return call[RestoreResponse](ctx, c, request{method: http.MethodPost, path: apiPath("admin", "restore"), body: body, contentType: form.FormDataContentType()})
+}
+
+func writeRestoreForm(form *multipart.Writer, archive io.Reader, dataDir string, passphrase string) error {
+	if err := form.WriteField("dataDir", dataDir); err != nil {
+		return err
+	}
+	if passphrase != "" {
+		if err := form.WriteField("passphrase", passphrase); err != nil {
+			return err
+		}
+	}
+	part, err := form.CreateFormFile("archive", "aimeow-backup.tar.gz")
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(part, archive); err != nil {
+		return err
+	}
+	return form.Close()
+}
+
+// InjectSandboxEvent injects an incoming message, receipt, disconnect or logout into a client of
+// a server running in sandbox mode
+func (c *Client) InjectSandboxEvent(ctx context.Context, clientID string, req SandboxEventRequest) (*SandboxEventResponse, error) {
+	return call[SandboxEventResponse](ctx, c, request{method: http.MethodPost, path: apiPath("admin", "sandbox", "clients", clientID, "events"), jsonBody: req})
+}
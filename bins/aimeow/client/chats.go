@@ -0,0 +1,148 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// ListChats returns the stored chats of a client, pinned chats first and then by last activity,
+// and the number of matching chats
+func (c *Client) ListChats(ctx context.Context, clientID string, opts ListChatsOptions) ([]Chat, int, error) {
+	query := url.Values{}
+	setBool(query, "archived", opts.Archived)
+	setBool(query, "pinned", opts.Pinned)
+	setBool(query, "unread", opts.Unread)
+	setInt(query, "limit", opts.Limit)
+	setInt(query, "offset", opts.Offset)
+
+	var chats []Chat
+	header, err := c.doJSON(ctx, request{method: http.MethodGet, path: apiPath("clients", clientID, "chats"), query: query}, &chats)
+	if err != nil {
+		return nil, 0, err
+	}
+	return chats, totalCount(header, len(chats)), nil
+}
+
+// ChatMessages returns the stored messages of a chat, given as JID, LID or phone number, and the
+// number of matching messages
+func (c *Client) ChatMessages(ctx context.Context, clientID string, chat string, opts ChatMessagesOptions) ([]StoredMessage, int, error) {
+	query := url.Values{}
+	setTime(query, "before", opts.Before)
+	setTime(query, "after", opts.After)
+	if opts.Ascending {
+		query.Set("order", "asc")
+	}
+	setInt(query, "limit", opts.Limit)
+	setInt(query, "offset", opts.Offset)
+
+	var messages []StoredMessage
+	header, err := c.doJSON(ctx, request{method: http.MethodGet, path: apiPath("clients", clientID, "chats", chat, "messages"), query: query}, &messages)
+	if err != nil {
+		return nil, 0, err
+	}
+	return messages, totalCount(header, len(messages)), nil
+}
+
+// ExportChat streams the transcript of a chat, or a zip archive with its media. The caller
+// closes the reader.
+func (c *Client) ExportChat(ctx context.Context, clientID string, chat string, opts ExportChatOptions) (io.ReadCloser, error) {
+	query := url.Values{}
+	setString(query, "format", opts.Format)
+	if opts.Media {
+		query.Set("media", "true")
+	}
+	setString(query, "timezone", opts.Timezone)
+	setTime(query, "before", opts.Before)
+	setTime(query, "after", opts.After)
+
+	resp, err := c.do(ctx, request{method: http.MethodGet, path: apiPath("clients", clientID, "chats", chat, "export"), query: query})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// Search runs a full-text search over the stored messages of a client and returns the results
+// and the number of matching messages
+func (c *Client) Search(ctx context.Context, clientID string, q string, opts SearchOptions) ([]SearchResult, int, error) {
+	query := url.Values{"q": {q}}
+	setString(query, "chat", opts.Chat)
+	setString(query, "sender", opts.Sender)
+	setBool(query, "fromMe", opts.FromMe)
+	setString(query, "type", opts.Type)
+	setTime(query, "before", opts.Before)
+	setTime(query, "after", opts.After)
+	setString(query, "order", opts.Order)
+	setString(query, "highlightStart", opts.HighlightStart)
+	setString(query, "highlightEnd", opts.HighlightEnd)
+	setInt(query, "limit", opts.Limit)
+	setInt(query, "offset", opts.Offset)
+
+	var results []SearchResult
+	header, err := c.doJSON(ctx, request{method: http.MethodGet, path: apiPath("clients", clientID, "search"), query: query}, &results)
+	if err != nil {
+		return nil, 0, err
+	}
+	return results, totalCount(header, len(results)), nil
+}
+
+// ListContacts returns the contacts of a client sorted by name, and the number of matching
+// contacts
+func (c *Client) ListContacts(ctx context.Context, clientID string, opts ListContactsOptions) ([]Contact, int, error) {
+	query := url.Values{}
+	setString(query, "search", opts.Search)
+	if opts.Details {
+		query.Set("details", "true")
+	}
+	setInt(query, "limit", opts.Limit)
+	setInt(query, "offset", opts.Offset)
+
+	var contacts []Contact
+	header, err := c.doJSON(ctx, request{method: http.MethodGet, path: apiPath("clients", clientID, "contacts"), query: query}, &contacts)
+	if err != nil {
+		return nil, 0, err
+	}
+	return contacts, totalCount(header, len(contacts)), nil
+}
+
+// GetContact returns a contact, given as LID, phone JID or phone number, with its details
+func (c *Client) GetContact(ctx context.Context, clientID string, jid string) (*Contact, error) {
+	return call[Contact](ctx, c, request{method: http.MethodGet, path: apiPath("clients", clientID, "contacts", jid)})
+}
+
+// Resolve maps a LID to its phone number or a phone number to its LID
+func (c *Client) Resolve(ctx context.Context, clientID string, jid string) (*ResolveResult, error) {
+	return call[ResolveResult](ctx, c, request{method: http.MethodGet, path: apiPath("clients", clientID, "resolve", jid)})
+}
+
+// ResolveMany resolves several LIDs or phone numbers at once
+func (c *Client) ResolveMany(ctx context.Context, clientID string, jids []string) ([]ResolveResult, error) {
+	var resp struct {
+		Results []ResolveResult `json:"results"`
+	}
+	body := map[string][]string{"jids": jids}
+	if _, err := c.doJSON(ctx, request{method: http.MethodPost, path: apiPath("clients", clientID, "resolve"), jsonBody: body}, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Results, nil
+}
+
+// ProfilePicture returns the profile picture URL of a phone number
+func (c *Client) ProfilePicture(ctx context.Context, clientID string, phone string) (*ProfilePictureResponse, error) {
+	return call[ProfilePictureResponse](ctx, c, request{method: http.MethodGet, path: apiPath("clients", clientID, "profile-picture", phone)})
+}
+
+// CheckWhatsApp reports whether a phone number is registered on WhatsApp
+func (c *Client) CheckWhatsApp(ctx context.Context, clientID string, phone string) (*CheckWhatsAppResponse, error) {
+	return call[CheckWhatsAppResponse](ctx, c, request{method: http.MethodGet, path: apiPath("clients", clientID, "check-whatsapp", phone)})
+}
+
+func setTime(query url.Values, name string, value time.Time) {
+	if !value.IsZero() {
+		query.Set(name, strconv.FormatInt(value.Unix(), 10))
+	}
+}
@@ -0,0 +1,317 @@
+// Package client is a Go client for the aimeow REST API.
+//
+//	c, err := client.New("http://localhost:7030")
+//	if err != nil {
+//		return err
+//	}
+//	resp, err := c.SendMessage(ctx, clientID, client.SendMessageRequest{Phone: "+6281234567890", Message: "Hello"})
+//
+// Requests that are safe to repeat are retried on network errors and on 429, 502, 503 and 504
+// responses. Sends are made safe to repeat with an Idempotency-Key that is generated for every
+// call, or taken from WithIdempotencyKey. Failed requests return an *APIError.
+//
+// Webhook receivers can use WebhookHandler, which checks the signature aimeow adds when
+// webhook.secret is set and decodes the payloads.
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	mathrand "math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Client calls the API of one aimeow server. It is safe for concurrent use.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	header     http.Header
+	maxRetries int
+	minBackoff time.Duration
+	maxBackoff time.Duration
+}
+
+// Option changes a setting of a Client
+type Option func(*Client)
+
+// WithHTTPClient sets the HTTP client requests are sent with. The default has a 60s timeout.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) { c.httpClient = httpClient }
+}
+
+// WithHeader adds a header to every request, e.g. the credentials of a proxy in front of aimeow
+func WithHeader(key, value string) Option {
+	return func(c *Client) { c.header.Add(key, value) }
+}
+
+// WithRetries sets how often a failed request is retried (default 3, 0 disables retries) and
+// the bounds of the exponential backoff between attempts (default 500ms to 10s)
+func WithRetries(maxRetries int, minBackoff, maxBackoff time.Duration) Option {
+	return func(c *Client) {
+		c.maxRetries = maxRetries
+		c.minBackoff = minBackoff
+		c.maxBackoff = maxBackoff
+	}
+}
+
+// New returns a client for the aimeow server at baseURL, e.g. http://localhost:7030
+func New(baseURL string, opts ...Option) (*Client, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("aimeow: base URL must be an absolute URL, got %q", baseURL)
+	}
+	c := &Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		httpClient: &http.Client{Timeout: time.Minute},
+		header:     make(http.Header),
+		maxRetries: 3,
+		minBackoff: 500 * time.Millisecond,
+		maxBackoff: 10 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.maxRetries < 0 || c.minBackoff < 0 || c.maxBackoff < c.minBackoff {
+		return nil, errors.New("aimeow: invalid retry settings")
+	}
+	return c, nil
+}
+
+// APIError is returned when aimeow answers with an error status
+type APIError struct {
+	StatusCode int
+	Message    string // The error field of the response, or the status text
+	Body       []byte // Raw response body
+
+	retryAfter time.Duration
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("aimeow: %d %s", e.StatusCode, e.Message)
+}
+
+// Temporary reports whether the request may succeed when retried later
+func (e *APIError) Temporary() bool {
+	return retryableStatus(e.StatusCode)
+}
+
+// IsNotFound reports whether err is a 404 response, e.g. for an unknown client
+func IsNotFound(err error) bool {
+	return hasStatus(err, http.StatusNotFound)
+}
+
+// IsBadRequest reports whether err is a 400 response, e.g. for invalid input or a client that
+// is not connected
+func IsBadRequest(err error) bool {
+	return hasStatus(err, http.StatusBadRequest)
+}
+
+// IsConflict reports whether err is a 409 response, e.g. for a request with an Idempotency-Key
+// that is still in progress
+func IsConflict(err error) bool {
+	return hasStatus(err, http.StatusConflict)
+}
+
+func hasStatus(err error, status int) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == status
+}
+
+type idempotencyKeyContextKey struct{}
+
+// WithIdempotencyKey returns a context that makes the next send use key as its Idempotency-Key,
+// so it can be repeated across process restarts without sending twice
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKeyContextKey{}, key)
+}
+
+// idempotencyKey returns the key set on ctx, or a new random one
+func idempotencyKey(ctx context.Context) string {
+	if key, ok := ctx.Value(idempotencyKeyContextKey{}).(string); ok && key != "" {
+		return key
+	}
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// request describes one API call
+type request struct {
+	method      string
+	path        string // Below the base URL, with path parameters escaped
+	query       url.Values
+	body        io.Reader // Sent as is; set either body or jsonBody
+	jsonBody    interface{}
+	contentType string
+	idempotent  bool // Send with an Idempotency-Key so the request can be retried
+}
+
+// call sends a request and returns its decoded JSON response
+func call[T any](ctx context.Context, c *Client, req request) (*T, error) {
+	var resp T
+	if _, err := c.doJSON(ctx, req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// doJSON sends a request and decodes the JSON response into out, if out is not nil
+func (c *Client) doJSON(ctx context.Context, req request, out interface{}) (http.Header, error) {
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if out == nil {
+		io.Copy(io.Discard, resp.Body)
+		return resp.Header, nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return nil, fmt.Errorf("aimeow: failed to decode response of %s %s: %w", req.method, req.path, err)
+	}
+	return resp.Header, nil
+}
+
+// do sends a request, retrying it when that is safe, and returns the response of a successful
+// attempt. The caller closes the body.
+func (c *Client) do(ctx context.Context, req request) (*http.Response, error) {
+	var body []byte
+	if req.jsonBody != nil {
+		var err error
+		if body, err = json.Marshal(req.jsonBody); err != nil {
+			return nil, fmt.Errorf("aimeow: failed to encode request: %w", err)
+		}
+		req.contentType = "application/json"
+	} else if req.body != nil {
+		// Streamed bodies can't be sent twice
+		return c.attempt(ctx, req, req.body, "")
+	}
+
+	key := ""
+	if req.idempotent {
+		key = idempotencyKey(ctx)
+	}
+	retryable := req.method == http.MethodGet || key != ""
+
+	for attempt := 0; ; attempt++ {
+		var reader io.Reader
+		if body != nil {
+			reader = bytes.NewReader(body)
+		}
+		resp, err := c.attempt(ctx, req, reader, key)
+		if err == nil || !retryable || attempt >= c.maxRetries || ctx.Err() != nil {
+			return resp, err
+		}
+		var apiErr *APIError
+		retryAfter := time.Duration(0)
+		if errors.As(err, &apiErr) {
+			if !apiErr.Temporary() {
+				return nil, err
+			}
+			retryAfter = apiErr.retryAfter
+		}
+
+		timer := time.NewTimer(max(c.backoff(attempt), retryAfter))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, err
+		case <-timer.C:
+		}
+	}
+}
+
+// attempt sends a request once. Error statuses are returned as an *APIError.
+func (c *Client) attempt(ctx context.Context, req request, body io.Reader, key string) (*http.Response, error) {
+	u := c.baseURL + req.path
+	if len(req.query) > 0 {
+		u += "?" + req.query.Encode()
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, req.method, u, body)
+	if err != nil {
+		return nil, fmt.Errorf("aimeow: %w", err)
+	}
+	for name, values := range c.header {
+		httpReq.Header[name] = values
+	}
+	if req.contentType != "" {
+		httpReq.Header.Set("Content-Type", req.contentType)
+	}
+	if key != "" {
+		httpReq.Header.Set("Idempotency-Key", key)
+	}
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("aimeow: %s %s: %w", req.method, req.path, err)
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	return nil, newAPIError(resp)
+}
+
+// newAPIError reads an error response
+func newAPIError(resp *http.Response) *APIError {
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	apiErr := &APIError{StatusCode: resp.StatusCode, Message: http.StatusText(resp.StatusCode), Body: data}
+	var body struct {
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(data, &body) == nil && body.Error != "" {
+		apiErr.Message = body.Error
+	}
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+		apiErr.retryAfter = time.Duration(seconds) * time.Second
+	}
+	return apiErr
+}
+
+// retryableStatus reports whether a status is worth retrying
+func retryableStatus(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// backoff returns the delay before retry attempt+1: exponential from minBackoff up to
+// maxBackoff, with jitter so clients don't retry in lockstep
+func (c *Client) backoff(attempt int) time.Duration {
+	delay := c.minBackoff << min(attempt, 30)
+	if delay > c.maxBackoff || delay <= 0 {
+		delay = c.maxBackoff
+	}
+	if delay <= 0 {
+		return 0
+	}
+	return delay/2 + mathrand.N(delay/2+1)
+}
+
+// apiPath returns the path of an API endpoint, escaping path parameters such as client IDs and
+// JIDs
+func apiPath(segments ...string) string {
+	return "/api/v1" + escapePath(segments...)
+}
+
+// escapePath joins path segments, escaping each of them
+func escapePath(segments ...string) string {
+	var b strings.Builder
+	for _, s := range segments {
+		b.WriteByte('/')
+		b.WriteString(url.PathEscape(s))
+	}
+	return b.String()
+}
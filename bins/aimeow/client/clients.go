@@ -0,0 +1,157 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// CreateClient creates a WhatsApp client that waits to be paired. req may be nil.
+func (c *Client) CreateClient(ctx context.Context, req *CreateClientRequest) (*CreateClientResponse, error) {
+	var body interface{} = struct{}{}
+	if req != nil {
+		body = req
+	}
+	return call[CreateClientResponse](ctx, c, request{method: http.MethodPost, path: apiPath("clients", "new"), jsonBody: body})
+}
+
+// ListClients returns the clients matching opts and the number of matching clients
+func (c *Client) ListClients(ctx context.Context, opts ListClientsOptions) ([]ClientResponse, int, error) {
+	query := url.Values{}
+	setString(query, "tenant", opts.TenantID)
+	for _, label := range opts.Labels {
+		query.Add("label", label)
+	}
+	setString(query, "state", string(opts.State))
+	setInt(query, "limit", opts.Limit)
+	setInt(query, "offset", opts.Offset)
+
+	var clients []ClientResponse
+	header, err := c.doJSON(ctx, request{method: http.MethodGet, path: apiPath("clients"), query: query}, &clients)
+	if err != nil {
+		return nil, 0, err
+	}
+	return clients, totalCount(header, len(clients)), nil
+}
+
+// GetClient returns a client with its current QR code
+func (c *Client) GetClient(ctx context.Context, clientID string) (*ClientResponse, error) {
+	return call[ClientResponse](ctx, c, request{method: http.MethodGet, path: apiPath("clients", clientID)})
+}
+
+// UpdateClientMetadata changes the tenant, labels or metadata of a client. Nil fields are kept.
+func (c *Client) UpdateClientMetadata(ctx context.Context, clientID string, req UpdateClientMetadataRequest) (*ClientResponse, error) {
+	return call[ClientResponse](ctx, c, request{method: http.MethodPatch, path: apiPath("clients", clientID), jsonBody: req})
+}
+
+// DeleteClient unlinks a client from the phone and removes it
+func (c *Client) DeleteClient(ctx context.Context, clientID string) (*RemoveClientResponse, error) {
+	return call[RemoveClientResponse](ctx, c, request{method: http.MethodDelete, path: apiPath("clients", clientID)})
+}
+
+// Logout unlinks a client from the phone and removes its session
+func (c *Client) Logout(ctx context.Context, clientID string) (*RemoveClientResponse, error) {
+	return call[RemoveClientResponse](ctx, c, request{method: http.MethodPost, path: apiPath("clients", clientID, "logout")})
+}
+
+// Disconnect closes the connection of a client and stops reconnecting it
+func (c *Client) Disconnect(ctx context.Context, clientID string) error {
+	_, err := c.doJSON(ctx, request{method: http.MethodPost, path: apiPath("clients", clientID, "disconnect")}, nil)
+	return err
+}
+
+// Reconnect connects a paired client again
+func (c *Client) Reconnect(ctx context.Context, clientID string) error {
+	_, err := c.doJSON(ctx, request{method: http.MethodPost, path: apiPath("clients", clientID, "reconnect")}, nil)
+	return err
+}
+
+// PairPhone returns a pairing code to link a client by phone number instead of a QR scan. The
+// client is created if it doesn't exist.
+func (c *Client) PairPhone(ctx context.Context, clientID string, req PairPhoneRequest) (*PairPhoneResponse, error) {
+	return call[PairPhoneResponse](ctx, c, request{method: http.MethodPost, path: apiPath("clients", clientID, "pair-phone"), jsonBody: req})
+}
+
+// QRCode returns the current QR code of an unpaired client rendered for a terminal
+func (c *Client) QRCode(ctx context.Context, clientID string) (string, error) {
+	data, err := c.getBytes(ctx, request{method: http.MethodGet, path: apiPath("clients", clientID, "qr")})
+	return string(data), err
+}
+
+// QRCodePNG returns the current QR code of an unpaired client as a PNG image
+func (c *Client) QRCodePNG(ctx context.Context, clientID string, opts QROptions) ([]byte, error) {
+	return c.getBytes(ctx, request{method: http.MethodGet, path: apiPath("clients", clientID, "qr.png"), query: opts.query()})
+}
+
+// QRCodeSVG returns the current QR code of an unpaired client as an SVG image
+func (c *Client) QRCodeSVG(ctx context.Context, clientID string, opts QROptions) ([]byte, error) {
+	return c.getBytes(ctx, request{method: http.MethodGet, path: apiPath("clients", clientID, "qr.svg"), query: opts.query()})
+}
+
+func (opts QROptions) query() url.Values {
+	query := url.Values{}
+	setInt(query, "size", opts.Size)
+	if opts.Margin != nil {
+		query.Set("margin", strconv.Itoa(*opts.Margin))
+	}
+	return query
+}
+
+// GetSettings returns the settings of a client
+func (c *Client) GetSettings(ctx context.Context, clientID string) (*ClientSettings, error) {
+	return call[ClientSettings](ctx, c, request{method: http.MethodGet, path: apiPath("clients", clientID, "settings")})
+}
+
+// UpdateSettings changes the settings of a client. Nil fields are kept.
+func (c *Client) UpdateSettings(ctx context.Context, clientID string, req UpdateClientSettingsRequest) (*ClientSettings, error) {
+	return call[ClientSettings](ctx, c, request{method: http.MethodPatch, path: apiPath("clients", clientID, "settings"), jsonBody: req})
+}
+
+// Messages returns the last messages a client received, as logged by the server
+func (c *Client) Messages(ctx context.Context, clientID string, limit int) ([]string, error) {
+	query := url.Values{}
+	setInt(query, "limit", limit)
+	resp, err := call[MessageResponse](ctx, c, request{method: http.MethodGet, path: apiPath("clients", clientID, "messages"), query: query})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Messages, nil
+}
+
+// getBytes sends a request and returns the whole response body
+func (c *Client) getBytes(ctx context.Context, req request) ([]byte, error) {
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(resp.Body)
+}
+
+// totalCount returns the X-Total-Count header of a list response, or fallback without it
+func totalCount(header http.Header, fallback int) int {
+	if total, err := strconv.Atoi(header.Get("X-Total-Count")); err == nil {
+		return total
+	}
+	return fallback
+}
+
+func setString(query url.Values, name string, value string) {
+	if value != "" {
+		query.Set(name, value)
+	}
+}
+
+func setInt(query url.Values, name string, value int) {
+	if value > 0 {
+		query.Set(name, strconv.Itoa(value))
+	}
+}
+
+func setBool(query url.Values, name string, value *bool) {
+	if value != nil {
+		query.Set(name, strconv.FormatBool(*value))
+	}
+}
@@ -0,0 +1,138 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// SendMessage sends a text message
+func (c *Client) SendMessage(ctx context.Context, clientID string, req SendMessageRequest) (*SendMessageResponse, error) {
+	return c.send(ctx, clientID, "send-message", req)
+}
+
+// SendImage sends an image downloaded from a URL
+func (c *Client) SendImage(ctx context.Context, clientID string, req SendImageRequest) (*SendMessageResponse, error) {
+	return c.send(ctx, clientID, "send-image", req)
+}
+
+// SendImages sends several images downloaded from URLs
+func (c *Client) SendImages(ctx context.Context, clientID string, req SendMultipleImagesRequest) (*SendMessageResponse, error) {
+	return c.send(ctx, clientID, "send-images", req)
+}
+
+// SendDocument sends a document downloaded from a URL
+func (c *Client) SendDocument(ctx context.Context, clientID string, req SendDocumentRequest) (*SendMessageResponse, error) {
+	return c.send(ctx, clientID, "send-document", req)
+}
+
+// SendDocumentBase64 sends a document given as base64 data
+func (c *Client) SendDocumentBase64(ctx context.Context, clientID string, req SendDocumentBase64Request) (*SendMessageResponse, error) {
+	return c.send(ctx, clientID, "send-document-base64", req)
+}
+
+// DeleteMessage revokes a sent message for everyone
+func (c *Client) DeleteMessage(ctx context.Context, clientID string, req DeleteMessageRequest) (*SendMessageResponse, error) {
+	return c.send(ctx, clientID, "delete-message", req)
+}
+
+func (c *Client) send(ctx context.Context, clientID string, endpoint string, req interface{}) (*SendMessageResponse, error) {
+	return call[SendMessageResponse](ctx, c, request{method: http.MethodPost, path: apiPath("clients", clientID, endpoint), jsonBody: req, idempotent: true})
+}
+
+// StartTyping shows the client as typing in a chat until StopTyping, a sent message or the
+// typing timeout
+func (c *Client) StartTyping(ctx context.Context, clientID string, phone string) (*TypingResponse, error) {
+	return c.typing(ctx, clientID, "start-typing", phone)
+}
+
+// StopTyping stops showing the client as typing in a chat
+func (c *Client) StopTyping(ctx context.Context, clientID string, phone string) (*TypingResponse, error) {
+	return c.typing(ctx, clientID, "stop-typing", phone)
+}
+
+func (c *Client) typing(ctx context.Context, clientID string, endpoint string, phone string) (*TypingResponse, error) {
+	body := map[string]string{"phone": phone}
+	return call[TypingResponse](ctx, c, request{method: http.MethodPost, path: apiPath("clients", clientID, endpoint), jsonBody: body})
+}
+
+// ScheduleMessage schedules a send for later
+func (c *Client) ScheduleMessage(ctx context.Context, clientID string, req ScheduleMessageRequest) (*ScheduledMessageResponse, error) {
+	// The server reads the envelope and the send payload from the same object
+	body := map[string]interface{}{}
+	if req.Payload != nil {
+		data, err := json.Marshal(req.Payload)
+		if err != nil {
+			return nil, fmt.Errorf("aimeow: failed to encode payload: %w", err)
+		}
+		if err := json.Unmarshal(data, &body); err != nil {
+			return nil, fmt.Errorf("aimeow: payload must be a JSON object: %w", err)
+		}
+	}
+	if req.Type != "" {
+		body["type"] = req.Type
+	}
+	body["sendAt"] = req.SendAt
+	if req.Timezone != "" {
+		body["timezone"] = req.Timezone
+	}
+
+	return call[ScheduledMessageResponse](ctx, c, request{method: http.MethodPost, path: apiPath("clients", clientID, "scheduled"), jsonBody: body, idempotent: true})
+}
+
+// ListScheduledMessages returns the scheduled messages of a client, optionally only those with
+// a status (pending, sent, failed or cancelled)
+func (c *Client) ListScheduledMessages(ctx context.Context, clientID string, status string) ([]ScheduledMessageResponse, error) {
+	query := url.Values{}
+	setString(query, "status", status)
+	var resp []ScheduledMessageResponse
+	if _, err := c.doJSON(ctx, request{method: http.MethodGet, path: apiPath("clients", clientID, "scheduled"), query: query}, &resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// CancelScheduledMessage cancels a pending scheduled message
+func (c *Client) CancelScheduledMessage(ctx context.Context, clientID string, scheduledID string) (*ScheduledMessageResponse, error) {
+	return call[ScheduledMessageResponse](ctx, c, request{method: http.MethodDelete, path: apiPath("clients", clientID, "scheduled", scheduledID)})
+}
+
+// CreateBroadcast starts sending a payload to many recipients
+func (c *Client) CreateBroadcast(ctx context.Context, clientID string, req CreateBroadcastRequest) (*BroadcastResponse, error) {
+	return call[BroadcastResponse](ctx, c, request{method: http.MethodPost, path: apiPath("clients", clientID, "broadcasts"), jsonBody: req, idempotent: true})
+}
+
+// ListBroadcasts returns the broadcasts of a client without their recipients
+func (c *Client) ListBroadcasts(ctx context.Context, clientID string) ([]BroadcastResponse, error) {
+	var resp []BroadcastResponse
+	if _, err := c.doJSON(ctx, request{method: http.MethodGet, path: apiPath("clients", clientID, "broadcasts")}, &resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// GetBroadcast returns a broadcast with the status of every recipient
+func (c *Client) GetBroadcast(ctx context.Context, clientID string, broadcastID string) (*BroadcastResponse, error) {
+	return call[BroadcastResponse](ctx, c, request{method: http.MethodGet, path: apiPath("clients", clientID, "broadcasts", broadcastID)})
+}
+
+// PauseBroadcast stops sending a running broadcast until it is resumed
+func (c *Client) PauseBroadcast(ctx context.Context, clientID string, broadcastID string) (*BroadcastResponse, error) {
+	return c.broadcastAction(ctx, clientID, broadcastID, "pause")
+}
+
+// ResumeBroadcast continues a paused broadcast
+func (c *Client) ResumeBroadcast(ctx context.Context, clientID string, broadcastID string) (*BroadcastResponse, error) {
+	return c.broadcastAction(ctx, clientID, broadcastID, "resume")
+}
+
+// CancelBroadcast stops a broadcast for good
+func (c *Client) CancelBroadcast(ctx context.Context, clientID string, broadcastID string) (*BroadcastResponse, error) {
+	return c.broadcastAction(ctx, clientID, broadcastID, "cancel")
+}
+
+func (c *Client) broadcastAction(ctx context.Context, clientID string, broadcastID string, action string) (*BroadcastResponse, error) {
+	return call[BroadcastResponse](ctx, c, request{method: http.MethodPost, path: apiPath("clients", clientID, "broadcasts", broadcastID, action)})
+}
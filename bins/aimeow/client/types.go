@@ -0,0 +1,472 @@
+package client
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// ConnectionState is the state of a WhatsApp client
+type ConnectionState string
+
+const (
+	StatePairing           ConnectionState = "pairing"            // Not linked yet, waiting for a QR scan or pairing code
+	StateConnecting        ConnectionState = "connecting"         // Linked, connection being established
+	StateConnected         ConnectionState = "connected"          // Connected and able to send
+	StateDisconnected      ConnectionState = "disconnected"       // Not connected and not retrying
+	StateReconnecting      ConnectionState = "reconnecting"       // Connection lost, retrying
+	StateLoggedOut         ConnectionState = "logged_out"         // Unlinked from the phone, must be paired again
+	StateTemporarilyBanned ConnectionState = "temporarily_banned" // Rejected by WhatsApp for a while
+	StateStreamReplaced    ConnectionState = "stream_replaced"    // Another connection with the same session took over
+)
+
+type ClientResponse struct {
+	ID           string            `json:"id"`
+	Phone        string            `json:"phone,omitempty"`
+	IsConnected  bool              `json:"isConnected"`
+	State        ConnectionState   `json:"state"`
+	StateSince   time.Time         `json:"stateSince"`            // When the current state was entered
+	StateReason  string            `json:"stateReason,omitempty"` // Why the current state was entered
+	Reconnect    ReconnectStats    `json:"reconnect"`             // Automatic reconnect counters
+	QRCode       string            `json:"qrCode,omitempty"`
+	QRDataURI    string            `json:"qrDataUri,omitempty"` // Current QR code as a PNG data URI, only from GetClient
+	ConnectedAt  *time.Time        `json:"connectedAt,omitempty"`
+	MessageCount int               `json:"messageCount"`
+	OSName       string            `json:"osName,omitempty"`
+	Device       DeviceIdentity    `json:"device"`
+	TenantID     string            `json:"tenantId,omitempty"`
+	Labels       []string          `json:"labels,omitempty"`
+	Metadata     map[string]string `json:"metadata,omitempty"`
+}
+
+type ReconnectStats struct {
+	Attempts        int        `json:"attempts"`        // Failed attempts since the connection was lost
+	TotalReconnects int        `json:"totalReconnects"` // Connections restored automatically
+	TotalFailures   int        `json:"totalFailures"`   // Reconnect attempts that failed
+	GiveUps         int        `json:"giveUps"`         // Times the supervisor stopped retrying
+	LastError       string     `json:"lastError,omitempty"`
+	LastAttemptAt   *time.Time `json:"lastAttemptAt,omitempty"`
+	NextAttemptAt   *time.Time `json:"nextAttemptAt,omitempty"`
+}
+
+type DeviceIdentity struct {
+	OSName       string `json:"osName,omitempty"`       // Name shown in the phone's linked devices list
+	PlatformType string `json:"platformType,omitempty"` // chrome, firefox, safari, edge, desktop, ipad, ...; decides the icon
+	BrowserLabel string `json:"browserLabel,omitempty"` // Browser name in the pairing code notification, e.g. Chrome
+}
+
+type CreateClientRequest struct {
+	ID           string                       `json:"id,omitempty"`           // Optional custom client ID
+	OSName       string                       `json:"osName,omitempty"`       // Name shown in the phone's linked devices list
+	PlatformType string                       `json:"platformType,omitempty"` // chrome, firefox, safari, edge, desktop, ipad, ...
+	BrowserLabel string                       `json:"browserLabel,omitempty"` // Browser name used for pairing codes, defaults from platformType
+	Settings     *UpdateClientSettingsRequest `json:"settings,omitempty"`     // Optional initial client settings
+	TenantID     string                       `json:"tenantId,omitempty"`     // Optional tenant or project that owns the client
+	Labels       []string                     `json:"labels,omitempty"`
+	Metadata     map[string]string            `json:"metadata,omitempty"`
+}
+
+type CreateClientResponse struct {
+	ID    string `json:"id"`
+	QRURL string `json:"qrUrl"`
+}
+
+// ListClientsOptions filters ListClients. Zero values don't filter.
+type ListClientsOptions struct {
+	TenantID string
+	Labels   []string // Clients with all of these labels
+	State    ConnectionState
+	Limit    int // 1-500
+	Offset   int
+}
+
+type UpdateClientMetadataRequest struct {
+	TenantID *string            `json:"tenantId,omitempty"`
+	Labels   *[]string          `json:"labels,omitempty"`
+	Metadata *map[string]string `json:"metadata,omitempty"`
+}
+
+type RemoveClientResponse struct {
+	Message  string `json:"message"`
+	Unlinked bool   `json:"unlinked"` // The phone was told to unlink this device
+	Error    string `json:"error,omitempty"`
+}
+
+type PairPhoneRequest struct {
+	Phone        string `json:"phone"`                  // Phone number of the account, international or national format
+	OSName       string `json:"osName,omitempty"`       // Used when the client has to be created
+	PlatformType string `json:"platformType,omitempty"` // Used when the client has to be created
+	BrowserLabel string `json:"browserLabel,omitempty"` // Used when the client has to be created
+}
+
+type PairPhoneResponse struct {
+	ID          string `json:"id"`
+	Phone       string `json:"phone"`       // Normalized to E.164
+	PairingCode string `json:"pairingCode"` // 8 character code to enter on the phone
+}
+
+// QROptions sets the size of QR code images. Zero values use the server defaults.
+type QROptions struct {
+	Size   int  // Width and height in pixels (64-2048)
+	Margin *int // Quiet zone in modules (0-16)
+}
+
+type ClientSettings struct {
+	AutoRead             string   `json:"autoRead"`             // off, immediate or delayed
+	AutoReadDelaySeconds int      `json:"autoReadDelaySeconds"` // Delay before marking read in delayed mode
+	AutoTyping           bool     `json:"autoTyping"`           // Show typing after an inbound message
+	TypingTimeoutSeconds int      `json:"typingTimeoutSeconds"` // Typing is stopped after this long without a reply
+	ChatFilter           string   `json:"chatFilter"`           // all, dms, groups or allowlist
+	Allowlist            []string `json:"allowlist"`            // Phone numbers or JIDs used by the allowlist filter
+	DefaultCountry       string   `json:"defaultCountry"`       // ISO country code used for phone numbers in national format
+	WebhookVersion       int      `json:"webhookVersion"`       // Webhook payload version of this client, 0 follows webhook.payloadVersion
+}
+
+type UpdateClientSettingsRequest struct {
+	AutoRead             *string   `json:"autoRead,omitempty"`
+	AutoReadDelaySeconds *int      `json:"autoReadDelaySeconds,omitempty"`
+	AutoTyping           *bool     `json:"autoTyping,omitempty"`
+	TypingTimeoutSeconds *int      `json:"typingTimeoutSeconds,omitempty"`
+	ChatFilter           *string   `json:"chatFilter,omitempty"`
+	Allowlist            *[]string `json:"allowlist,omitempty"`
+	DefaultCountry       *string   `json:"defaultCountry,omitempty"` // Empty restores the server default (clients.defaultCountry)
+	WebhookVersion       *int      `json:"webhookVersion,omitempty"` // WebhookSchemaV1 or WebhookSchemaV2; 0 restores the server default (webhook.payloadVersion)
+}
+
+type SendMessageRequest struct {
+	Phone   string `json:"phone"`
+	Message string `json:"message"`
+}
+
+type SendImageRequest struct {
+	Phone    string `json:"phone"`
+	ImageURL string `json:"imageUrl"`
+	Caption  string `json:"caption,omitempty"`
+}
+
+type SendMultipleImagesRequest struct {
+	Phone  string      `json:"phone"`
+	Images []ImageItem `json:"images"`
+}
+
+type ImageItem struct {
+	ImageURL string `json:"imageUrl"`
+	Caption  string `json:"caption,omitempty"`
+}
+
+type SendDocumentRequest struct {
+	Phone       string `json:"phone"`
+	DocumentURL string `json:"documentUrl"`
+	Filename    string `json:"filename,omitempty"`
+	Caption     string `json:"caption,omitempty"`
+}
+
+type SendDocumentBase64Request struct {
+	Phone      string `json:"phone"`
+	Base64Data string `json:"base64Data"`
+	Filename   string `json:"filename"`
+	MimeType   string `json:"mimeType,omitempty"`
+	Caption    string `json:"caption,omitempty"`
+}
+
+type DeleteMessageRequest struct {
+	Phone     string `json:"phone"`
+	MessageID string `json:"messageId"`
+}
+
+type SendMessageResponse struct {
+	Success   bool   `json:"success"`
+	MessageID string `json:"messageId,omitempty"`
+	Phone     string `json:"phone,omitempty"` // Recipient in E.164, or the JID for groups and other non-phone chats
+	Error     string `json:"error,omitempty"`
+}
+
+type TypingResponse struct {
+	Success bool   `json:"success"`
+	Phone   string `json:"phone,omitempty"` // Normalized recipient
+}
+
+type MessageResponse struct {
+	Messages []string `json:"messages"`
+}
+
+// ScheduleMessageRequest schedules a send. Payload is the request of the send selected by Type,
+// e.g. SendMessageRequest for message.
+type ScheduleMessageRequest struct {
+	Type     string      `json:"type,omitempty"` // message (default), image, images, document or document-base64
+	SendAt   string      `json:"sendAt"`         // RFC3339, or YYYY-MM-DDTHH:MM[:SS] in Timezone
+	Timezone string      `json:"timezone,omitempty"`
+	Payload  interface{} `json:"-"`
+}
+
+type ScheduledMessageResponse struct {
+	ID        string          `json:"id"`
+	ClientID  string          `json:"clientId"`
+	Type      string          `json:"type"`
+	Payload   json.RawMessage `json:"payload"`
+	SendAt    time.Time       `json:"sendAt"`
+	Timezone  string          `json:"timezone,omitempty"`
+	Status    string          `json:"status"` // pending, sending, sent, failed or cancelled
+	MessageID string          `json:"messageId,omitempty"`
+	Error     string          `json:"error,omitempty"`
+	Attempts  int             `json:"attempts"`
+	CreatedAt time.Time       `json:"createdAt"`
+	SentAt    *time.Time      `json:"sentAt,omitempty"`
+}
+
+type BroadcastRecipient struct {
+	Phone     string            `json:"phone"`
+	Variables map[string]string `json:"variables,omitempty"` // Values for {{name}} placeholders in the payload
+}
+
+// CreateBroadcastRequest sends one payload to many recipients. Payload is a send request
+// without the phone, e.g. SendMessageRequest{Message: "Hi {{name}}"}.
+type CreateBroadcastRequest struct {
+	Type              string               `json:"type,omitempty"` // message (default), image, images, document or document-base64
+	Payload           interface{}          `json:"payload"`
+	Recipients        []BroadcastRecipient `json:"recipients"`
+	IntervalMs        int                  `json:"intervalMs,omitempty"` // Delay between recipients, at least 250
+	SkipWhatsAppCheck bool                 `json:"skipWhatsAppCheck,omitempty"`
+}
+
+type BroadcastRecipientResponse struct {
+	Phone     string            `json:"phone"`
+	Variables map[string]string `json:"variables,omitempty"`
+	Status    string            `json:"status"` // pending, sending, sent, failed or not_on_whatsapp
+	MessageID string            `json:"messageId,omitempty"`
+	Error     string            `json:"error,omitempty"`
+	SentAt    *time.Time        `json:"sentAt,omitempty"`
+}
+
+type BroadcastResponse struct {
+	ID                string                       `json:"id"`
+	ClientID          string                       `json:"clientId"`
+	Type              string                       `json:"type"`
+	Payload           json.RawMessage              `json:"payload"`
+	Status            string                       `json:"status"`
+	IntervalMs        int                          `json:"intervalMs"`
+	SkipWhatsAppCheck bool                         `json:"skipWhatsAppCheck"`
+	Total             int                          `json:"total"`
+	Pending           int                          `json:"pending"`
+	Sent              int                          `json:"sent"`
+	Failed            int                          `json:"failed"`
+	NotOnWhatsApp     int                          `json:"notOnWhatsApp"`
+	CreatedAt         time.Time                    `json:"createdAt"`
+	StartedAt         *time.Time                   `json:"startedAt,omitempty"`
+	FinishedAt        *time.Time                   `json:"finishedAt,omitempty"`
+	Recipients        []BroadcastRecipientResponse `json:"recipients,omitempty"`
+}
+
+type ProfilePictureResponse struct {
+	Phone      string `json:"phone"`
+	PictureURL string `json:"pictureUrl,omitempty"`
+	HasPicture bool   `json:"hasPicture"`
+	Error      string `json:"error,omitempty"`
+}
+
+type CheckWhatsAppResponse struct {
+	Phone        string `json:"phone"`
+	IsRegistered bool   `json:"isRegistered"`
+	JID          string `json:"jid,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
+
+type ResolveResult struct {
+	JID      string `json:"jid"`              // The JID that was resolved
+	LID      string `json:"lid,omitempty"`    // Hidden user JID, e.g. 123456789@lid
+	Phone    string `json:"phone,omitempty"`  // Phone number without +
+	Resolved bool   `json:"resolved"`         // Both the LID and the phone number are known
+	Source   string `json:"source,omitempty"` // cache, store, usync or message
+	Error    string `json:"error,omitempty"`
+}
+
+type Contact struct {
+	JID          string `json:"jid"`
+	Phone        string `json:"phone,omitempty"` // E.164, if known
+	LID          string `json:"lid,omitempty"`   // Hidden user JID, if known
+	Name         string `json:"name,omitempty"`  // Best available name: saved, push, business or verified name
+	FirstName    string `json:"firstName,omitempty"`
+	FullName     string `json:"fullName,omitempty"`     // Name saved in the phone's address book
+	PushName     string `json:"pushName,omitempty"`     // Name the user set for themselves
+	BusinessName string `json:"businessName,omitempty"` // Name the business set for itself
+	VerifiedName string `json:"verifiedName,omitempty"` // Name on the business's verified certificate
+	IsBusiness   bool   `json:"isBusiness"`
+	InStore      bool   `json:"inStore"` // Whether the contact store has an entry for this user
+
+	// Only filled when details are requested and the client is connected
+	About           string                  `json:"about,omitempty"`
+	HasPicture      *bool                   `json:"hasPicture,omitempty"`
+	PictureID       string                  `json:"pictureId,omitempty"`
+	BusinessProfile *ContactBusinessProfile `json:"businessProfile,omitempty"`
+	DetailsError    string                  `json:"detailsError,omitempty"`
+}
+
+type ContactBusinessProfile struct {
+	Address       string                 `json:"address,omitempty"`
+	Email         string                 `json:"email,omitempty"`
+	Categories    []string               `json:"categories,omitempty"`
+	Options       map[string]string      `json:"options,omitempty"` // Other profile fields such as websites
+	HoursTimeZone string                 `json:"hoursTimeZone,omitempty"`
+	Hours         []ContactBusinessHours `json:"hours,omitempty"`
+}
+
+type ContactBusinessHours struct {
+	DayOfWeek string `json:"dayOfWeek"`
+	Mode      string `json:"mode"` // open_24h, appointment_only or specific_hours
+	OpenTime  string `json:"openTime,omitempty"`
+	CloseTime string `json:"closeTime,omitempty"`
+}
+
+// ListContactsOptions filters ListContacts
+type ListContactsOptions struct {
+	Search  string // Name, phone number or JID contains this text
+	Details bool   // Fetch about text, picture and verified name from WhatsApp
+	Limit   int    // 1-1000, default 100
+	Offset  int
+}
+
+type StoredMessage struct {
+	ID          string    `json:"id"`
+	ChatJID     string    `json:"chatJid"`
+	SenderJID   string    `json:"senderJid,omitempty"`
+	SenderPhone string    `json:"senderPhone,omitempty"` // Sender in E.164, if known
+	SenderName  string    `json:"senderName,omitempty"`  // Push name at the time of the message
+	FromMe      bool      `json:"fromMe"`
+	Timestamp   time.Time `json:"timestamp"`
+	Type        string    `json:"type"` // text, image, video, audio, document, sticker, location, live_location, contact, poll, revoked or other
+	Text        string    `json:"text,omitempty"`
+	Caption     string    `json:"caption,omitempty"`
+	FileName    string    `json:"fileName,omitempty"`
+	MimeType    string    `json:"mimeType,omitempty"`
+	FileURL     string    `json:"fileUrl,omitempty"` // Set when the media was downloaded
+	Edited      bool      `json:"edited,omitempty"`
+	Source      string    `json:"source"` // live, history or sent
+}
+
+type Chat struct {
+	JID           string         `json:"jid"`
+	Name          string         `json:"name,omitempty"`
+	Phone         string         `json:"phone,omitempty"` // E.164, for individual chats whose number is known
+	IsGroup       bool           `json:"isGroup"`
+	UnreadCount   int            `json:"unreadCount"`
+	Archived      bool           `json:"archived"`
+	Pinned        bool           `json:"pinned"`
+	MutedUntil    *time.Time     `json:"mutedUntil,omitempty"`
+	LastMessageAt *time.Time     `json:"lastMessageAt,omitempty"`
+	LastMessage   *StoredMessage `json:"lastMessage,omitempty"`
+}
+
+// ListChatsOptions filters ListChats. Nil filters match all chats.
+type ListChatsOptions struct {
+	Archived *bool
+	Pinned   *bool
+	Unread   *bool
+	Limit    int // 1-1000, default 100
+	Offset   int
+}
+
+// ChatMessagesOptions filters ChatMessages
+type ChatMessagesOptions struct {
+	Before    time.Time
+	After     time.Time
+	Ascending bool // Oldest first instead of newest first
+	Limit     int  // 1-500, default 50
+	Offset    int
+}
+
+// ExportChatOptions selects the format of ExportChat
+type ExportChatOptions struct {
+	Format   string // json (default), csv or txt
+	Media    bool   // Zip archive with the transcript and media files
+	Timezone string // IANA timezone of csv and txt timestamps
+	Before   time.Time
+	After    time.Time
+}
+
+type SearchResult struct {
+	StoredMessage
+	Snippet string `json:"snippet"` // Best matching part of the text, caption or file name with the matched terms highlighted
+}
+
+// SearchOptions filters Search
+type SearchOptions struct {
+	Chat           string // Group JID, phone number or LID
+	Sender         string // Phone number, phone JID or LID
+	FromMe         *bool
+	Type           string // e.g. text, image or document
+	Before         time.Time
+	After          time.Time
+	Order          string // relevance (default), desc or asc
+	HighlightStart string
+	HighlightEnd   string
+	Limit          int // 1-200, default 20
+	Offset         int
+}
+
+// ConfigResponse is the webhook URL and the active configuration of the server
+type ConfigResponse struct {
+	CallbackURL     string          `json:"callbackUrl"`
+	Config          json.RawMessage `json:"config"`                    // Active configuration, with secrets hidden
+	RestartRequired []string        `json:"restartRequired,omitempty"` // Changed settings that only apply after a restart
+}
+
+type ConfigRequest struct {
+	CallbackURL string `json:"callbackUrl,omitempty"`
+	Reload      bool   `json:"reload,omitempty"` // Reload the config file and environment overrides
+}
+
+type BackupRequest struct {
+	Passphrase string `json:"passphrase"`          // Encrypts the archive with AES-256-GCM, required
+	SkipMedia  bool   `json:"skipMedia,omitempty"` // Leave downloaded media out of the archive
+}
+
+type RestoreResponse struct {
+	DataDir  string         `json:"dataDir"` // Path of the restored data directory on the server
+	Manifest BackupManifest `json:"manifest"`
+}
+
+type BackupManifest struct {
+	Format         int            `json:"format"`
+	CreatedAt      time.Time      `json:"createdAt"`
+	SchemaVersion  int            `json:"schemaVersion"` // Version of the aimeow tables in the database
+	Encrypted      bool           `json:"encrypted"`
+	Clients        []BackupClient `json:"clients"`        // Client ID mappings of the paired devices
+	PendingClients []string       `json:"pendingClients"` // Clients created but not paired yet
+	Database       BackupFile     `json:"database"`
+	Media          []BackupFile   `json:"media"`
+}
+
+type BackupClient struct {
+	ClientID   string `json:"clientId"`
+	WhatsAppID string `json:"whatsappId"`
+}
+
+type BackupFile struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// SandboxEventRequest is an incoming event injected into a client of a server in sandbox mode
+type SandboxEventRequest struct {
+	Type       string        `json:"type"`                 // message, receipt, disconnect or logged_out
+	From       string        `json:"from,omitempty"`       // Sender phone number of messages and receipts
+	Group      string        `json:"group,omitempty"`      // Group JID, for group messages and receipts
+	PushName   string        `json:"pushName,omitempty"`   // Sender name of messages
+	Text       string        `json:"text,omitempty"`       // Text of a message
+	Media      *SandboxMedia `json:"media,omitempty"`      // Media of a message
+	MessageIDs []string      `json:"messageIds,omitempty"` // Messages a receipt is for
+	Receipt    string        `json:"receipt,omitempty"`    // delivered, read or played
+}
+
+type SandboxMedia struct {
+	Type     string `json:"type"` // image, video, audio or document
+	Data     []byte `json:"data"`
+	MimeType string `json:"mimeType,omitempty"`
+	FileName string `json:"fileName,omitempty"`
+	Caption  string `json:"caption,omitempty"`
+}
+
+type SandboxEventResponse struct {
+	Type      string `json:"type"`
+	MessageID string `json:"messageId,omitempty"`
+}
@@ -0,0 +1,384 @@
+package client
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Headers of signed webhook requests, see VerifySignature
+const (
+	TimestampHeader = "X-Aimeow-Timestamp"
+	SignatureHeader = "X-Aimeow-Signature"
+)
+
+// DefaultSignatureTolerance is how old a signed webhook may be before it is rejected as a replay
+const DefaultSignatureTolerance = 5 * time.Minute
+
+// Signature check failures
+var (
+	ErrMissingSignature = errors.New("aimeow: webhook is not signed")
+	ErrInvalidSignature = errors.New("aimeow: webhook signature does not match")
+	ErrExpiredSignature = errors.New("aimeow: webhook timestamp is outside the tolerance")
+)
+
+// Webhook payload versions, chosen on the server with webhook.payloadVersion or per client with
+// the webhookVersion setting. Version 1 is the original format, version 2 adds event and
+// schemaVersion to every body, uses RFC 3339 times and always sends every field.
+const (
+	WebhookSchemaV1 = 1
+	WebhookSchemaV2 = 2
+)
+
+// MessageWebhook is the version 1 body aimeow posts to the callback URL for an incoming or own
+// message
+type MessageWebhook struct {
+	ClientID  string         `json:"clientId"`
+	Message   WebhookMessage `json:"message"`
+	Timestamp int64          `json:"timestamp"` // Unix seconds the webhook was sent at
+}
+
+// WebhookMessage is a message in version 1. Type specific fields are only set for their types.
+type WebhookMessage struct {
+	ID           string    `json:"id"`
+	From         string    `json:"from"` // Phone number of the sender, or the LID when IsLID is set
+	Timestamp    time.Time `json:"timestamp"`
+	PushName     string    `json:"pushName"`
+	FromMe       bool      `json:"fromMe"`
+	IsGroup      bool      `json:"isGroup"`
+	MyPhone      string    `json:"myPhone,omitempty"` // Phone number of the receiving account
+	RawChat      string    `json:"rawChat"`           // Chat JID, to reply to individual chats
+	RawSender    string    `json:"rawSender"`         // Sender JID, to reply in groups
+	RawSenderAlt string    `json:"rawSenderAlt,omitempty"`
+	IsLID        bool      `json:"isLID,omitempty"` // The sender's phone number is not known yet
+	Type         string    `json:"type"`            // text, image, video, location, live_location or other
+	Text         string    `json:"text,omitempty"`
+	Caption      string    `json:"caption,omitempty"`
+	Mentions     []string  `json:"mentions,omitempty"`
+
+	// Media
+	MimeType string `json:"mimeType,omitempty"`
+	Width    uint32 `json:"width,omitempty"`
+	Height   uint32 `json:"height,omitempty"`
+	FileSize uint64 `json:"fileSize,omitempty"`
+	FileURL  string `json:"fileUrl,omitempty"` // Set when the media was downloaded
+
+	// Locations
+	Latitude  float64 `json:"latitude,omitempty"`
+	Longitude float64 `json:"longitude,omitempty"`
+	Accuracy  uint32  `json:"accuracy,omitempty"` // Live locations, in meters
+	Speed     float32 `json:"speed,omitempty"`    // Live locations, in m/s
+	Bearing   uint32  `json:"bearing,omitempty"`  // Live locations, degrees clockwise from magnetic north
+	Name      string  `json:"name,omitempty"`
+	Address   string  `json:"address,omitempty"`
+	URL       string  `json:"url,omitempty"`
+}
+
+// StatusWebhook is the version 1 body aimeow posts to the callback URL with /status appended for
+// client and job events. Decode Data with DecodeData into the struct of the event, e.g.
+// StateChangedData for state_changed.
+type StatusWebhook struct {
+	ClientID  string          `json:"clientId"`
+	Event     string          `json:"event"`
+	Data      json.RawMessage `json:"data"`
+	Timestamp int64           `json:"timestamp"` // Unix seconds the webhook was sent at
+}
+
+// DecodeData decodes the event data into v
+func (w *StatusWebhook) DecodeData(v interface{}) error {
+	return json.Unmarshal(w.Data, v)
+}
+
+// MessageWebhookV2 is the version 2 body aimeow posts to the callback URL for an incoming or own
+// message
+type MessageWebhookV2 struct {
+	SchemaVersion int              `json:"schemaVersion"` // WebhookSchemaV2
+	Event         string           `json:"event"`         // message
+	ClientID      string           `json:"clientId"`
+	Timestamp     time.Time        `json:"timestamp"` // When the webhook was sent
+	Message       WebhookMessageV2 `json:"message"`
+}
+
+// WebhookMessageV2 is a message in version 2
+type WebhookMessageV2 struct {
+	ID        string             `json:"id"`
+	Type      string             `json:"type"` // text, image, video, audio, document, location, live_location or other
+	Timestamp time.Time          `json:"timestamp"`
+	Chat      string             `json:"chat"`      // Chat JID, to reply to individual chats
+	Sender    string             `json:"sender"`    // Sender JID, to reply in groups
+	SenderAlt string             `json:"senderAlt"` // Alternate sender JID (phone number or LID), empty if unknown
+	From      string             `json:"from"`      // Phone number of the sender, or the LID user when FromLID is set
+	FromLID   bool               `json:"fromLid"`   // The sender's phone number is not known yet
+	PushName  string             `json:"pushName"`
+	FromMe    bool               `json:"fromMe"`
+	IsGroup   bool               `json:"isGroup"`
+	MyPhone   string             `json:"myPhone"` // Phone number of the receiving account
+	Text      string             `json:"text"`
+	Caption   string             `json:"caption"`
+	Mentions  []string           `json:"mentions"`
+	Media     *WebhookMediaV2    `json:"media"`    // Set for image, video, audio and document
+	Location  *WebhookLocationV2 `json:"location"` // Set for location and live_location
+}
+
+// WebhookMediaV2 is the attachment of a media message in version 2
+type WebhookMediaV2 struct {
+	MimeType string  `json:"mimeType"`
+	FileSize *uint64 `json:"fileSize"` // Bytes, nil if unknown
+	Width    *uint32 `json:"width"`    // Pixels of images and videos, nil if unknown
+	Height   *uint32 `json:"height"`
+	FileName string  `json:"fileName"` // Name of a document
+	FileURL  *string `json:"fileUrl"`  // Set when the media was downloaded, see Client.File
+}
+
+// WebhookLocationV2 is the location of a location message in version 2
+type WebhookLocationV2 struct {
+	Latitude  float64  `json:"latitude"`
+	Longitude float64  `json:"longitude"`
+	Name      string   `json:"name"`
+	Address   string   `json:"address"`
+	URL       string   `json:"url"`
+	Accuracy  *uint32  `json:"accuracy"` // Live locations, in meters
+	Speed     *float32 `json:"speed"`    // Live locations, in m/s
+	Bearing   *uint32  `json:"bearing"`  // Live locations, degrees clockwise from magnetic north
+}
+
+// StatusWebhookV2 is the version 2 body aimeow posts to the callback URL with /status appended.
+// The data of an event is the same as in version 1, except that times are RFC 3339, so
+// message_receipt decodes into MessageReceiptDataV2.
+type StatusWebhookV2 struct {
+	SchemaVersion int             `json:"schemaVersion"` // WebhookSchemaV2
+	Event         string          `json:"event"`
+	ClientID      string          `json:"clientId"`
+	Timestamp     time.Time       `json:"timestamp"` // When the webhook was sent
+	Data          json.RawMessage `json:"data"`
+}
+
+// DecodeData decodes the event data into v
+func (w *StatusWebhookV2) DecodeData(v interface{}) error {
+	return json.Unmarshal(w.Data, v)
+}
+
+// StateChangedData is the data of state_changed
+type StateChangedData struct {
+	State         ConnectionState `json:"state"`
+	PreviousState ConnectionState `json:"previousState"`
+	Reason        string          `json:"reason"`
+	Since         time.Time       `json:"since"`
+}
+
+// ConnectedData is the data of connected
+type ConnectedData struct {
+	OSName      string    `json:"osName"`
+	ConnectedAt time.Time `json:"connectedAt"`
+	Phone       string    `json:"phone"`
+}
+
+// QRCodeData is the data of qr_code
+type QRCodeData struct {
+	QRCode string `json:"qrCode"`
+}
+
+// PairCodeData is the data of pair_code
+type PairCodeData struct {
+	Phone       string `json:"phone"`
+	PairingCode string `json:"pairingCode"`
+}
+
+// ErrorData is the data of pair_failed and reconnect_failed
+type ErrorData struct {
+	Error string `json:"error"`
+}
+
+// MessageReceiptData is the data of message_receipt
+type MessageReceiptData struct {
+	MessageIDs []string `json:"messageIds"`
+	Chat       string   `json:"chat"`
+	Sender     string   `json:"sender"`
+	Receipt    string   `json:"receipt"`   // delivered, read or played
+	Timestamp  int64    `json:"timestamp"` // Unix seconds
+}
+
+// MessageReceiptDataV2 is the data of message_receipt in version 2
+type MessageReceiptDataV2 struct {
+	MessageIDs []string  `json:"messageIds"`
+	Chat       string    `json:"chat"`
+	Sender     string    `json:"sender"`
+	Receipt    string    `json:"receipt"` // delivered, read or played
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+// ReconnectGaveUpData is the data of reconnect_gave_up
+type ReconnectGaveUpData struct {
+	Attempts  int    `json:"attempts"`
+	LastError string `json:"lastError"`
+}
+
+// LIDResolvedData is the data of lid_resolved
+type LIDResolvedData struct {
+	LID    string `json:"lid"`
+	Phone  string `json:"phone"`
+	Source string `json:"source"`
+}
+
+// HistorySyncedData is the data of history_synced
+type HistorySyncedData struct {
+	SyncType      string `json:"syncType"`
+	Conversations int    `json:"conversations"`
+	Messages      int    `json:"messages"`
+	Progress      uint32 `json:"progress"`
+}
+
+// BroadcastData is the data of broadcast_completed, broadcast_cancelled and the other
+// broadcast_<status> events
+type BroadcastData struct {
+	BroadcastID   string `json:"broadcastId"`
+	Total         int    `json:"total"`
+	Sent          int    `json:"sent"`
+	Failed        int    `json:"failed"`
+	NotOnWhatsApp int    `json:"notOnWhatsApp"`
+	Pending       int    `json:"pending"`
+}
+
+// ScheduledData is the data of scheduled_sent and scheduled_failed
+type ScheduledData struct {
+	ScheduledID string    `json:"scheduledId"`
+	Type        string    `json:"type"`
+	MessageID   string    `json:"messageId"`
+	Error       string    `json:"error"`
+	SendAt      time.Time `json:"sendAt"`
+}
+
+// VerifySignature checks the signature headers of a webhook request against its body. Requests
+// older or newer than tolerance are rejected; a tolerance of 0 uses DefaultSignatureTolerance.
+func VerifySignature(secret string, header http.Header, body []byte, tolerance time.Duration) error {
+	if tolerance == 0 {
+		tolerance = DefaultSignatureTolerance
+	}
+	timestamp := header.Get(TimestampHeader)
+	signature := header.Get(SignatureHeader)
+	if timestamp == "" || signature == "" {
+		return ErrMissingSignature
+	}
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	if age := time.Since(time.Unix(unix, 0)); age > tolerance || age < -tolerance {
+		return ErrExpiredSignature
+	}
+
+	expected, err := hex.DecodeString(strings.TrimPrefix(signature, "sha256="))
+	if err != nil || !strings.HasPrefix(signature, "sha256=") {
+		return ErrInvalidSignature
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	if !hmac.Equal(mac.Sum(nil), expected) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// WebhookHandler is an http.Handler for aimeow webhooks. Serve it at the callback URL and at the
+// callback URL with /status appended; it tells messages and status events and payload versions
+// apart by their body, so a backend can take both versions while clients are moved over.
+// Requests with a bad signature get 401, and a callback error gets 500.
+type WebhookHandler struct {
+	Secret    string        // webhook.secret of the server; when empty, signatures are not checked
+	Tolerance time.Duration // Maximum age of a signed request, default DefaultSignatureTolerance
+
+	// Version 1 callbacks
+	OnMessage func(ctx context.Context, webhook *MessageWebhook) error
+	OnStatus  func(ctx context.Context, webhook *StatusWebhook) error
+
+	// Version 2 callbacks
+	OnMessageV2 func(ctx context.Context, webhook *MessageWebhookV2) error
+	OnStatusV2  func(ctx context.Context, webhook *StatusWebhookV2) error
+}
+
+// maxWebhookSize limits the webhook bodies the handler reads
+const maxWebhookSize = 10 << 20
+
+func (h *WebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookSize))
+	if err != nil {
+		http.Error(w, "failed to read body", http.StatusBadRequest)
+		return
+	}
+	if h.Secret != "" {
+		if err := VerifySignature(h.Secret, r.Header, body, h.Tolerance); err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+	}
+
+	var kind struct {
+		SchemaVersion int             `json:"schemaVersion"`
+		Event         string          `json:"event"`
+		Message       json.RawMessage `json:"message"`
+	}
+	if err := json.Unmarshal(body, &kind); err != nil {
+		http.Error(w, "invalid JSON body", http.StatusBadRequest)
+		return
+	}
+
+	switch {
+	case kind.SchemaVersion > WebhookSchemaV2:
+		http.Error(w, "unsupported webhook schema version", http.StatusBadRequest)
+		return
+	case kind.SchemaVersion == WebhookSchemaV2 && kind.Event == "message":
+		var webhook MessageWebhookV2
+		if err := json.Unmarshal(body, &webhook); err != nil {
+			http.Error(w, "invalid message webhook", http.StatusBadRequest)
+			return
+		}
+		if h.OnMessageV2 != nil {
+			err = h.OnMessageV2(r.Context(), &webhook)
+		}
+	case kind.SchemaVersion == WebhookSchemaV2:
+		var webhook StatusWebhookV2
+		if err := json.Unmarshal(body, &webhook); err != nil {
+			http.Error(w, "invalid status webhook", http.StatusBadRequest)
+			return
+		}
+		if h.OnStatusV2 != nil {
+			err = h.OnStatusV2(r.Context(), &webhook)
+		}
+	case kind.Event == "" && kind.Message != nil:
+		var webhook MessageWebhook
+		if err := json.Unmarshal(body, &webhook); err != nil {
+			http.Error(w, "invalid message webhook", http.StatusBadRequest)
+			return
+		}
+		if h.OnMessage != nil {
+			err = h.OnMessage(r.Context(), &webhook)
+		}
+	default:
+		var webhook StatusWebhook
+		if err := json.Unmarshal(body, &webhook); err != nil {
+			http.Error(w, "invalid status webhook", http.StatusBadRequest)
+			return
+		}
+		if h.OnStatus != nil {
+			err = h.OnStatus(r.Context(), &webhook)
+		}
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
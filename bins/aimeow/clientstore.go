@@ -0,0 +1,368 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// clientStateTables hold the client ID mappings, client metadata, pending clients and the
+// configuration saved through the API. Before schema version 2 they were JSON files in the data
+// directory; importLegacyClientState moves those files into the tables once. A mapping belongs to
+// a paired device of the whatsmeow store and goes away with it.
+var clientStateTables = []string{
+	`CREATE TABLE aimeow_client_mappings (
+		whatsapp_id TEXT PRIMARY KEY REFERENCES whatsmeow_device(jid) ON DELETE CASCADE,
+		client_id   TEXT NOT NULL,
+		updated_at  BIGINT NOT NULL
+	)`,
+	`CREATE INDEX aimeow_client_mappings_client_idx ON aimeow_client_mappings (client_id)`,
+	`CREATE TABLE aimeow_client_metadata (
+		client_id  TEXT PRIMARY KEY,
+		tenant_id  TEXT NOT NULL DEFAULT '',
+		labels     TEXT NOT NULL DEFAULT '[]',
+		metadata   TEXT NOT NULL DEFAULT '{}',
+		updated_at BIGINT NOT NULL
+	)`,
+	`CREATE TABLE aimeow_pending_clients (
+		client_id  TEXT PRIMARY KEY,
+		os_name    TEXT NOT NULL DEFAULT '',
+		created_at BIGINT NOT NULL
+	)`,
+	`CREATE TABLE aimeow_config (
+		name       TEXT PRIMARY KEY,
+		value      TEXT NOT NULL,
+		updated_at BIGINT NOT NULL
+	)`,
+}
+
+// configCallbackURL is the aimeow_config entry holding the webhook URL set through the API
+const configCallbackURL = "callbackUrl"
+
+// Files the client state was kept in before it moved to the database
+const (
+	legacyConfigFile         = "config.json"
+	legacyClientMappingsFile = "client_mappings.json"
+	legacyPendingClientsFile = "pending_clients.json"
+)
+
+// ClientIDMapping is the format of the legacy client_mappings.json file
+type ClientIDMapping struct {
+	Mappings map[string]string         `json:"mappings"`           // WhatsApp device ID -> UUID
+	Metadata map[string]ClientMetadata `json:"metadata,omitempty"` // UUID -> tenant, labels and metadata
+}
+
+// PendingClients is the format of the legacy pending_clients.json file
+type PendingClients struct {
+	Clients map[string]PendingClient `json:"clients"` // clientID -> PendingClient
+}
+
+// readConfig reads the configuration saved through the API
+func (cm *ClientManager) readConfig() (Config, error) {
+	var config Config
+	err := cm.db.QueryRow(`SELECT value FROM aimeow_config WHERE name=$1`, configCallbackURL).Scan(&config.CallbackURL)
+	if err != nil && err != sql.ErrNoRows {
+		return config, fmt.Errorf("failed to read saved configuration: %w", err)
+	}
+	return config, nil
+}
+
+// loadConfig loads the configuration saved through the API
+func (cm *ClientManager) loadConfig() error {
+	config, err := cm.readConfig()
+	if err != nil {
+		return err
+	}
+
+	cm.mutex.Lock()
+	cm.callbackURL = config.CallbackURL
+	cm.mutex.Unlock()
+
+	fmt.Printf("Configuration loaded: callbackURL=%s\n", config.CallbackURL)
+	return nil
+}
+
+// saveConfig saves the configuration set through the API
+func (cm *ClientManager) saveConfig() error {
+	cm.mutex.RLock()
+	callbackURL := cm.callbackURL
+	cm.mutex.RUnlock()
+
+	_, err := cm.db.Exec(`INSERT INTO aimeow_config (name, value, updated_at) VALUES ($1, $2, $3)
+		ON CONFLICT (name) DO UPDATE SET value=excluded.value, updated_at=excluded.updated_at`,
+		configCallbackURL, callbackURL, time.Now().Unix())
+	if err != nil {
+		return fmt.Errorf("failed to save configuration: %w", err)
+	}
+	fmt.Printf("Configuration saved: callbackURL=%s\n", callbackURL)
+	return nil
+}
+
+// loadClientState loads the client ID mappings, client metadata and pending clients
+func (cm *ClientManager) loadClientState(ctx context.Context) error {
+	mappings := make(map[string]string)
+	rows, err := cm.db.QueryContext(ctx, `SELECT whatsapp_id, client_id FROM aimeow_client_mappings`)
+	if err != nil {
+		return fmt.Errorf("failed to load client mappings: %w", err)
+	}
+	for rows.Next() {
+		var whatsappID, clientID string
+		if err := rows.Scan(&whatsappID, &clientID); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to read client mapping: %w", err)
+		}
+		mappings[whatsappID] = clientID
+	}
+	rows.Close()
+
+	metadata := make(map[string]ClientMetadata)
+	rows, err = cm.db.QueryContext(ctx, `SELECT client_id, tenant_id, labels, metadata FROM aimeow_client_metadata`)
+	if err != nil {
+		return fmt.Errorf("failed to load client metadata: %w", err)
+	}
+	for rows.Next() {
+		var clientID, labels, values string
+		var meta ClientMetadata
+		if err := rows.Scan(&clientID, &meta.TenantID, &labels, &values); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to read client metadata: %w", err)
+		}
+		if err := json.Unmarshal([]byte(labels), &meta.Labels); err != nil {
+			fmt.Printf("Warning: Ignoring invalid labels of client %s: %v\n", clientID, err)
+		}
+		if err := json.Unmarshal([]byte(values), &meta.Metadata); err != nil {
+			fmt.Printf("Warning: Ignoring invalid metadata of client %s: %v\n", clientID, err)
+		}
+		metadata[clientID] = meta
+	}
+	rows.Close()
+
+	pending := make(map[string]PendingClient)
+	rows, err = cm.db.QueryContext(ctx, `SELECT client_id, os_name, created_at FROM aimeow_pending_clients`)
+	if err != nil {
+		return fmt.Errorf("failed to load pending clients: %w", err)
+	}
+	for rows.Next() {
+		var pc PendingClient
+		if err := rows.Scan(&pc.ClientID, &pc.OSName, &pc.Created); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to read pending client: %w", err)
+		}
+		pending[pc.ClientID] = pc
+	}
+	rows.Close()
+
+	cm.mutex.Lock()
+	cm.clientIDMap = mappings
+	cm.clientMetadata = metadata
+	cm.pendingClients = pending
+	cm.mutex.Unlock()
+
+	fmt.Printf("Client state loaded: %d mappings, %d with metadata, %d pending clients\n", len(mappings), len(metadata), len(pending))
+	return nil
+}
+
+// storeClientMapping saves the mapping of a paired device to its client ID. The client stops
+// being pending in the same transaction.
+func (cm *ClientManager) storeClientMapping(whatsappID, clientID string) error {
+	ctx := context.Background()
+	tx, err := cm.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO aimeow_client_mappings (whatsapp_id, client_id, updated_at) VALUES ($1, $2, $3)
+		ON CONFLICT (whatsapp_id) DO UPDATE SET client_id=excluded.client_id, updated_at=excluded.updated_at`,
+		whatsappID, clientID, time.Now().Unix())
+	if err != nil {
+		return fmt.Errorf("failed to save client mapping: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM aimeow_pending_clients WHERE client_id=$1`, clientID); err != nil {
+		return fmt.Errorf("failed to remove pending client: %w", err)
+	}
+	return tx.Commit()
+}
+
+// storePendingClient saves a client that was created with a custom ID but hasn't paired yet
+func (cm *ClientManager) storePendingClient(pc PendingClient) error {
+	_, err := cm.db.Exec(`INSERT INTO aimeow_pending_clients (client_id, os_name, created_at) VALUES ($1, $2, $3)
+		ON CONFLICT (client_id) DO UPDATE SET os_name=excluded.os_name, created_at=excluded.created_at`,
+		pc.ClientID, pc.OSName, pc.Created)
+	if err != nil {
+		return fmt.Errorf("failed to save pending client: %w", err)
+	}
+	return nil
+}
+
+// storeClientMetadata saves the metadata of a client, removing it when it is empty
+func (cm *ClientManager) storeClientMetadata(clientID string, meta ClientMetadata) error {
+	if meta.TenantID == "" && len(meta.Labels) == 0 && len(meta.Metadata) == 0 {
+		if _, err := cm.db.Exec(`DELETE FROM aimeow_client_metadata WHERE client_id=$1`, clientID); err != nil {
+			return fmt.Errorf("failed to remove client metadata: %w", err)
+		}
+		return nil
+	}
+
+	labels, err := json.Marshal(meta.Labels)
+	if err != nil {
+		return fmt.Errorf("failed to marshal labels: %w", err)
+	}
+	values, err := json.Marshal(meta.Metadata)
+	if err != nil {
+		return fmt.Errorf("failed to marshal metadata: %w", err)
+	}
+	_, err = cm.db.Exec(`INSERT INTO aimeow_client_metadata (client_id, tenant_id, labels, metadata, updated_at) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (client_id) DO UPDATE SET tenant_id=excluded.tenant_id, labels=excluded.labels,
+		metadata=excluded.metadata, updated_at=excluded.updated_at`,
+		clientID, meta.TenantID, string(labels), string(values), time.Now().Unix())
+	if err != nil {
+		return fmt.Errorf("failed to save client metadata: %w", err)
+	}
+	return nil
+}
+
+// deleteClientState removes the mappings and pending entry of a client in one transaction, and
+// its metadata too when purging
+func (cm *ClientManager) deleteClientState(clientID string, purge bool) error {
+	ctx := context.Background()
+	tx, err := cm.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmts := []string{
+		`DELETE FROM aimeow_client_mappings WHERE client_id=$1`,
+		`DELETE FROM aimeow_pending_clients WHERE client_id=$1`,
+	}
+	if purge {
+		stmts = append(stmts, `DELETE FROM aimeow_client_metadata WHERE client_id=$1`)
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.ExecContext(ctx, stmt, clientID); err != nil {
+			return fmt.Errorf("failed to remove client state: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// importLegacyClientState moves config.json, client_mappings.json and pending_clients.json from
+// the data directory into the database. Rows already in the database win. Each file is imported
+// in one transaction and renamed to <name>.imported afterwards, so it is imported only once; a
+// file that fails to import is left in place and retried on the next start.
+func importLegacyClientState(ctx context.Context, db *sql.DB, dir string) error {
+	imports := []struct {
+		file string
+		load func(tx *sql.Tx, data []byte) (int, error)
+	}{
+		{legacyConfigFile, importLegacyConfig},
+		{legacyClientMappingsFile, importLegacyClientMappings},
+		{legacyPendingClientsFile, importLegacyPendingClients},
+	}
+	for _, legacy := range imports {
+		path := filepath.Join(dir, legacy.file)
+		data, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return fmt.Errorf("failed to read %s: %w", path, err)
+		}
+
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("failed to start transaction: %w", err)
+		}
+		count, err := legacy.load(tx, data)
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to import %s: %w", path, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to import %s: %w", path, err)
+		}
+		if err := os.Rename(path, path+".imported"); err != nil {
+			return fmt.Errorf("imported %s but failed to rename it: %w", path, err)
+		}
+		fmt.Printf("[Migrate] Imported %d entries from %s into the database, the file is kept as %s.imported\n", count, path, path)
+	}
+	return nil
+}
+
+func importLegacyConfig(tx *sql.Tx, data []byte) (int, error) {
+	var config Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		return 0, err
+	}
+	if config.CallbackURL == "" {
+		return 0, nil
+	}
+	_, err := tx.Exec(`INSERT INTO aimeow_config (name, value, updated_at) VALUES ($1, $2, $3) ON CONFLICT (name) DO NOTHING`,
+		configCallbackURL, config.CallbackURL, time.Now().Unix())
+	if err != nil {
+		return 0, err
+	}
+	return 1, nil
+}
+
+func importLegacyClientMappings(tx *sql.Tx, data []byte) (int, error) {
+	var mapping ClientIDMapping
+	if err := json.Unmarshal(data, &mapping); err != nil {
+		return 0, err
+	}
+	now := time.Now().Unix()
+	count := 0
+	for whatsappID, clientID := range mapping.Mappings {
+		// Mappings of devices that are no longer in the session store are dropped
+		var paired int
+		if err := tx.QueryRow(`SELECT COUNT(*) FROM whatsmeow_device WHERE jid=$1`, whatsappID).Scan(&paired); err != nil {
+			return 0, err
+		}
+		if paired == 0 {
+			fmt.Printf("[Migrate] Skipping mapping %s -> %s, the device is no longer paired\n", whatsappID, clientID)
+			continue
+		}
+		_, err := tx.Exec(`INSERT INTO aimeow_client_mappings (whatsapp_id, client_id, updated_at) VALUES ($1, $2, $3)
+			ON CONFLICT (whatsapp_id) DO NOTHING`, whatsappID, clientID, now)
+		if err != nil {
+			return 0, err
+		}
+		count++
+	}
+	for clientID, meta := range mapping.Metadata {
+		labels, err := json.Marshal(meta.Labels)
+		if err != nil {
+			return 0, err
+		}
+		values, err := json.Marshal(meta.Metadata)
+		if err != nil {
+			return 0, err
+		}
+		_, err = tx.Exec(`INSERT INTO aimeow_client_metadata (client_id, tenant_id, labels, metadata, updated_at) VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT (client_id) DO NOTHING`, clientID, meta.TenantID, string(labels), string(values), now)
+		if err != nil {
+			return 0, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+func importLegacyPendingClients(tx *sql.Tx, data []byte) (int, error) {
+	var pending PendingClients
+	if err := json.Unmarshal(data, &pending); err != nil {
+		return 0, err
+	}
+	for clientID, pc := range pending.Clients {
+		_, err := tx.Exec(`INSERT INTO aimeow_pending_clients (client_id, os_name, created_at) VALUES ($1, $2, $3)
+			ON CONFLICT (client_id) DO NOTHING`, clientID, pc.OSName, pc.Created)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(pending.Clients), nil
+}
@@ -0,0 +1,688 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mdp/qrterminal/v3"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// Operator commands. Those that need a live WhatsApp connection (pairing, sending, logging out)
+// go through the API of a running instance, because a session can only be connected from one
+// process at a time. The others read the data directory and database directly.
+
+// errServerUnreachable is returned when no aimeow instance answers at the server URL
+var errServerUnreachable = errors.New("aimeow is not running")
+
+// commandFlags holds the flags shared by the operator commands
+type commandFlags struct {
+	json   *bool
+	server *string
+}
+
+// addCommandFlags adds -json and -server to the flags of a command
+func addCommandFlags(flags *flag.FlagSet) commandFlags {
+	return commandFlags{
+		json:   flags.Bool("json", false, "print JSON instead of text"),
+		server: flags.String("server", "", "URL of the running instance (default AIMEOW_SERVER or http://localhost:<port>)"),
+	}
+}
+
+// api returns a client for the running instance the flags point at
+func (f commandFlags) api(cfg AppConfig) apiClient {
+	server := firstNonEmpty(*f.server, os.Getenv("AIMEOW_SERVER"))
+	if server == "" {
+		server = "http://localhost:" + strconv.Itoa(cfg.Server.Port)
+	}
+	return apiClient{server: strings.TrimSuffix(server, "/"), http: &http.Client{Timeout: 2 * time.Minute}}
+}
+
+// apiClient calls the API of a running aimeow instance
+type apiClient struct {
+	server string
+	http   *http.Client
+}
+
+// apiError is an error response of the API
+type apiError struct {
+	Status  int
+	Message string
+}
+
+func (e *apiError) Error() string {
+	return e.Message
+}
+
+// do sends a request with an optional JSON body and decodes the JSON response into out
+func (api apiClient) do(method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, api.server+"/api/v1"+path, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := api.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w at %s: %v", errServerUnreachable, api.server, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode >= 400 {
+		var body struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(data, &body) != nil || body.Error == "" {
+			body.Error = fmt.Sprintf("%s %s returned %s", method, path, resp.Status)
+		}
+		return &apiError{Status: resp.StatusCode, Message: body.Error}
+	}
+	if out != nil {
+		if err := json.Unmarshal(data, out); err != nil {
+			return fmt.Errorf("failed to parse response: %w", err)
+		}
+	}
+	return nil
+}
+
+// openCommandDatabase opens the database of the configuration for a command. A SQLite database
+// is opened read-only and must exist already.
+func openCommandDatabase(cfg AppConfig) (*sql.DB, error) {
+	if cfg.Storage.DatabaseURL != "" {
+		db, err := sql.Open(dialectPostgres, cfg.Storage.DatabaseURL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open PostgreSQL database: %w", err)
+		}
+		if err := db.Ping(); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to connect to PostgreSQL at %s: %w", redactDatabaseURL(cfg.Storage.DatabaseURL), err)
+		}
+		dbDialect = dialectPostgres
+		return db, nil
+	}
+
+	dbPath := filepath.Join(cfg.Storage.DataDir, backupDatabaseName)
+	if _, err := os.Stat(dbPath); err != nil {
+		return nil, fmt.Errorf("no database at %s: %w", dbPath, err)
+	}
+	db, err := sql.Open(dialectSQLite, fmt.Sprintf("file:%s?mode=ro&_busy_timeout=5000", dbPath))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	dbDialect = dialectSQLite
+	return db, nil
+}
+
+// printJSON writes a value as indented JSON to standard output
+func printJSON(v interface{}) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// runClientsCommand dispatches aimeow clients list and aimeow clients pair
+func runClientsCommand(args []string) error {
+	if len(args) > 0 {
+		switch args[0] {
+		case "list":
+			return runClientsListCommand(args[1:])
+		case "pair":
+			return runClientsPairCommand(args[1:])
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Usage: aimeow clients list [-offline] [-json] [-server URL]\n       aimeow clients pair [-id ID] [-os-name NAME] [-timeout 5m] [-json] [-server URL]\n")
+	return errUsage
+}
+
+// runClientsListCommand lists the clients of the running instance, or of the data directory
+// when the instance isn't running
+func runClientsListCommand(args []string) error {
+	flags := newFlagSet("clients list")
+	common := addCommandFlags(flags)
+	offline := flags.Bool("offline", false, "read the data directory even if the instance is running")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	cfg, err := loadCommandConfig()
+	if err != nil {
+		return err
+	}
+
+	var clients []ClientResponse
+	if !*offline {
+		api := common.api(cfg)
+		err = api.do(http.MethodGet, "/clients", nil, &clients)
+		if errors.Is(err, errServerUnreachable) {
+			fmt.Fprintf(os.Stderr, "aimeow is not running at %s, listing the clients stored in the data directory\n", api.server)
+		} else if err != nil {
+			return err
+		}
+	}
+	if *offline || err != nil {
+		if clients, err = listStoredClients(cfg); err != nil {
+			return err
+		}
+	}
+
+	if *common.json {
+		return printJSON(clients)
+	}
+	if len(clients) == 0 {
+		fmt.Println("No clients")
+		return nil
+	}
+	table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "ID\tSTATE\tPHONE\tDEVICE\tTENANT\tLABELS")
+	for _, client := range clients {
+		device := client.Device.OSName
+		if device == "" {
+			device = client.Device.BrowserLabel
+		}
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\t%s\n", client.ID, client.State, dashIfEmpty(client.Phone),
+			dashIfEmpty(device), dashIfEmpty(client.TenantID), dashIfEmpty(strings.Join(client.Labels, ",")))
+	}
+	return table.Flush()
+}
+
+// listStoredClients reads the paired devices and pending clients from the database. Without a
+// running instance nothing is connected, so paired clients are reported as disconnected.
+func listStoredClients(cfg AppConfig) ([]ClientResponse, error) {
+	db, err := openCommandDatabase(cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	ctx := context.Background()
+
+	clients := make([]ClientResponse, 0)
+	rows, err := db.QueryContext(ctx, `SELECT d.jid, COALESCE(m.client_id, ''), COALESCE(dev.os_name, ''), COALESCE(dev.platform_type, ''), COALESCE(dev.browser_label, ''),
+		COALESCE(meta.tenant_id, ''), COALESCE(meta.labels, '[]'), COALESCE(meta.metadata, '{}')
+		FROM whatsmeow_device d
+		LEFT JOIN aimeow_client_mappings m ON m.whatsapp_id = d.jid
+		LEFT JOIN aimeow_client_devices dev ON dev.client_id = m.client_id
+		LEFT JOIN aimeow_client_metadata meta ON meta.client_id = m.client_id
+		UNION ALL
+		SELECT '', p.client_id, COALESCE(dev.os_name, p.os_name), COALESCE(dev.platform_type, ''), COALESCE(dev.browser_label, ''),
+		COALESCE(meta.tenant_id, ''), COALESCE(meta.labels, '[]'), COALESCE(meta.metadata, '{}')
+		FROM aimeow_pending_clients p
+		LEFT JOIN aimeow_client_devices dev ON dev.client_id = p.client_id
+		LEFT JOIN aimeow_client_metadata meta ON meta.client_id = p.client_id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list clients: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var whatsappID, labels, metadata string
+		var client ClientResponse
+		err := rows.Scan(&whatsappID, &client.ID, &client.Device.OSName, &client.Device.PlatformType, &client.Device.BrowserLabel,
+			&client.TenantID, &labels, &metadata)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client: %w", err)
+		}
+		json.Unmarshal([]byte(labels), &client.Labels)
+		json.Unmarshal([]byte(metadata), &client.Metadata)
+		client.Device = client.Device.normalize()
+		client.OSName = client.Device.OSName
+		client.State = StatePairing
+		if whatsappID != "" {
+			client.State = StateDisconnected
+			if jid, err := types.ParseJID(whatsappID); err == nil {
+				client.Phone = jid.User
+			}
+			if client.ID == "" {
+				client.ID = "(unmapped " + whatsappID + ")"
+			}
+		}
+		clients = append(clients, client)
+	}
+	return clients, rows.Err()
+}
+
+// dashIfEmpty fills empty table cells
+func dashIfEmpty(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// runClientsPairCommand creates a client on the running instance if needed and shows its QR
+// codes in the terminal until the phone has linked it
+func runClientsPairCommand(args []string) error {
+	flags := newFlagSet("clients pair")
+	common := addCommandFlags(flags)
+	clientID := flags.String("id", "", "client ID to pair, created if it doesn't exist (default a new UUID)")
+	osName := flags.String("os-name", "", "name shown in the phone's linked devices list for a new client")
+	timeout := flags.Duration("timeout", 5*time.Minute, "how long to wait for the QR code to be scanned")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	cfg, err := loadCommandConfig()
+	if err != nil {
+		return err
+	}
+	api := common.api(cfg)
+
+	// QR codes go to standard error when standard output is JSON
+	out := os.Stdout
+	if *common.json {
+		out = os.Stderr
+	}
+
+	var client ClientResponse
+	create := *clientID == ""
+	if !create {
+		err := api.do(http.MethodGet, "/clients/"+url.PathEscape(*clientID), nil, &client)
+		var notFound *apiError
+		if errors.As(err, &notFound) && notFound.Status == http.StatusNotFound {
+			create = true
+		} else if err != nil {
+			return err
+		}
+	}
+	if create {
+		var created CreateClientResponse
+		if err := api.do(http.MethodPost, "/clients/new", CreateClientRequest{ID: *clientID, OSName: *osName}, &created); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Created client %s\n", created.ID)
+		*clientID = created.ID
+		client = ClientResponse{ID: created.ID}
+	}
+
+	deadline := time.Now().Add(*timeout)
+	shownQR := ""
+	for {
+		if client.State == StateConnected {
+			break
+		}
+		if client.State == StateLoggedOut {
+			return fmt.Errorf("client %s is logged out, log it out completely with aimeow logout and pair again", *clientID)
+		}
+		if client.QRCode != "" && client.QRCode != "not_available" && client.QRCode != shownQR {
+			fmt.Fprintf(out, "\nScan with WhatsApp on the phone: Settings > Linked devices > Link a device\n\n")
+			qrterminal.GenerateHalfBlock(client.QRCode, qrterminal.L, out)
+			shownQR = client.QRCode
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("client %s was not paired within %s", *clientID, *timeout)
+		}
+		time.Sleep(time.Second)
+		if err := api.do(http.MethodGet, "/clients/"+url.PathEscape(*clientID), nil, &client); err != nil {
+			return err
+		}
+	}
+
+	if *common.json {
+		return printJSON(client)
+	}
+	if shownQR == "" {
+		fmt.Printf("Client %s is already paired with +%s\n", client.ID, client.Phone)
+	} else {
+		fmt.Printf("Paired client %s with +%s\n", client.ID, client.Phone)
+	}
+	return nil
+}
+
+// runSendCommand sends a text message through the running instance
+func runSendCommand(args []string) error {
+	flags := newFlagSet("send")
+	common := addCommandFlags(flags)
+	clientID := flags.String("client", "", "client ID to send from")
+	to := flags.String("to", "", "recipient phone number or group JID")
+	text := flags.String("text", "", "message text")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	if *clientID == "" || *to == "" || *text == "" {
+		fmt.Fprintf(os.Stderr, "Usage: aimeow send -client ID -to PHONE -text TEXT [-json] [-server URL]\n")
+		return errUsage
+	}
+	cfg, err := loadCommandConfig()
+	if err != nil {
+		return err
+	}
+
+	var resp SendMessageResponse
+	err = common.api(cfg).do(http.MethodPost, "/clients/"+url.PathEscape(*clientID)+"/send-message",
+		SendMessageRequest{Phone: *to, Message: *text}, &resp)
+	if err != nil {
+		return err
+	}
+	if *common.json {
+		return printJSON(resp)
+	}
+	fmt.Printf("Sent message %s to %s\n", resp.MessageID, resp.Phone)
+	return nil
+}
+
+// runLogoutCommand logs a client out through the running instance
+func runLogoutCommand(args []string) error {
+	flags := newFlagSet("logout")
+	common := addCommandFlags(flags)
+	clientID := flags.String("client", "", "client ID to log out")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	if *clientID == "" {
+		fmt.Fprintf(os.Stderr, "Usage: aimeow logout -client ID [-json] [-server URL]\n")
+		return errUsage
+	}
+	cfg, err := loadCommandConfig()
+	if err != nil {
+		return err
+	}
+
+	var resp RemoveClientResponse
+	if err := common.api(cfg).do(http.MethodPost, "/clients/"+url.PathEscape(*clientID)+"/logout", nil, &resp); err != nil {
+		return err
+	}
+	if *common.json {
+		return printJSON(resp)
+	}
+	fmt.Printf("Client %s: %s\n", *clientID, resp.Message)
+	if resp.Error != "" {
+		fmt.Printf("Warning: %s\n", resp.Error)
+	}
+	if !resp.Unlinked {
+		fmt.Printf("The phone was not told to unlink the device, remove it under Linked devices\n")
+	}
+	return nil
+}
+
+// WebhookTestResult is the outcome of aimeow webhook test
+type WebhookTestResult struct {
+	URL        string `json:"url"`
+	StatusCode int    `json:"statusCode,omitempty"`
+	DurationMs int64  `json:"durationMs"`
+	Error      string `json:"error,omitempty"`
+}
+
+// runWebhookCommand dispatches aimeow webhook test
+func runWebhookCommand(args []string) error {
+	if len(args) == 0 || args[0] != "test" {
+		fmt.Fprintf(os.Stderr, "Usage: aimeow webhook test [-url URL] [-version N] [-json]\n")
+		return errUsage
+	}
+	flags := newFlagSet("webhook test")
+	common := addCommandFlags(flags)
+	callbackURL := flags.String("url", "", "webhook URL to test (default the configured callback URL)")
+	version := flags.Int("version", 0, "webhook payload version (default webhook.payloadVersion)")
+	if err := parseFlags(flags, args[1:]); err != nil {
+		return err
+	}
+	cfg, err := loadCommandConfig()
+	if err != nil {
+		return err
+	}
+	if *callbackURL == "" {
+		*callbackURL = commandCallbackURL(cfg)
+	}
+	if *callbackURL == "" {
+		return fmt.Errorf("no webhook URL is configured, set CALLBACK_URL or pass -url")
+	}
+
+	if *version == 0 {
+		*version = cfg.Webhook.PayloadVersion
+	}
+	if *version < webhookSchemaV1 || *version > latestWebhookSchemaVersion {
+		return fmt.Errorf("-version must be between %d and %d", webhookSchemaV1, latestWebhookSchemaVersion)
+	}
+
+	result := sendTestWebhook(*callbackURL, *version)
+	if *common.json {
+		if err := printJSON(result); err != nil {
+			return err
+		}
+	} else if result.Error == "" {
+		fmt.Printf("Webhook %s answered %d in %dms\n", result.URL, result.StatusCode, result.DurationMs)
+	}
+	if result.Error != "" {
+		return fmt.Errorf("webhook %s failed: %s", result.URL, result.Error)
+	}
+	return nil
+}
+
+// commandCallbackURL resolves the webhook URL the server would use: CALLBACK_URL, then the URL
+// saved through the API, then the configuration file
+func commandCallbackURL(cfg AppConfig) string {
+	if env := os.Getenv("CALLBACK_URL"); env != "" {
+		return env
+	}
+	if db, err := openCommandDatabase(cfg); err == nil {
+		defer db.Close()
+		var saved string
+		if db.QueryRow(`SELECT value FROM aimeow_config WHERE name=$1`, configCallbackURL).Scan(&saved) == nil && saved != "" {
+			return saved
+		}
+	}
+	return cfg.Webhook.CallbackURL
+}
+
+// sendTestWebhook posts a webhook_test status event in a payload version to the status webhook
+// of a callback URL
+func sendTestWebhook(callbackURL string, version int) WebhookTestResult {
+	result := WebhookTestResult{URL: statusWebhookURL(callbackURL)}
+	payload, _ := json.Marshal(statusWebhookBody(version, "", "webhook_test", map[string]interface{}{
+		"source": "aimeow webhook test",
+	}, time.Now()))
+	start := time.Now()
+	resp, err := postWebhook(result.URL, payload)
+	result.DurationMs = time.Since(start).Milliseconds()
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	resp.Body.Close()
+	result.StatusCode = resp.StatusCode
+	if resp.StatusCode >= 400 {
+		result.Error = "status " + resp.Status
+	}
+	return result
+}
+
+// Results of doctor checks
+const (
+	doctorOK   = "ok"
+	doctorWarn = "warn"
+	doctorFail = "fail"
+)
+
+// DoctorCheck is one finding of aimeow doctor
+type DoctorCheck struct {
+	Name   string `json:"name"`
+	Status string `json:"status"` // ok, warn or fail
+	Detail string `json:"detail"`
+}
+
+// runDoctorCommand checks the configuration, data directory, database, webhook and server and
+// fails if any check fails
+func runDoctorCommand(args []string) error {
+	flags := newFlagSet("doctor")
+	common := addCommandFlags(flags)
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	var checks []DoctorCheck
+	add := func(name, status, format string, a ...interface{}) {
+		checks = append(checks, DoctorCheck{Name: name, Status: status, Detail: fmt.Sprintf(format, a...)})
+	}
+
+	cfg, err := loadCommandConfig()
+	if err != nil {
+		add("configuration", doctorFail, "%v", err)
+	} else {
+		source := "defaults"
+		if cfg.File != "" {
+			source = cfg.File
+		}
+		if len(cfg.FromEnv) > 0 {
+			source += ", overridden by " + strings.Join(cfg.FromEnv, ", ")
+		}
+		add("configuration", doctorOK, "%s", source)
+		checks = append(checks, doctorChecks(cfg, common)...)
+	}
+
+	failed := 0
+	for _, check := range checks {
+		if check.Status == doctorFail {
+			failed++
+		}
+	}
+	if *common.json {
+		if err := printJSON(checks); err != nil {
+			return err
+		}
+	} else {
+		table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		for _, check := range checks {
+			fmt.Fprintf(table, "[%s]\t%s\t%s\n", check.Status, check.Name, check.Detail)
+		}
+		table.Flush()
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d check(s) failed", failed)
+	}
+	return nil
+}
+
+// doctorChecks runs the checks that need a valid configuration
+func doctorChecks(cfg AppConfig, common commandFlags) []DoctorCheck {
+	var checks []DoctorCheck
+	add := func(name, status, format string, a ...interface{}) {
+		checks = append(checks, DoctorCheck{Name: name, Status: status, Detail: fmt.Sprintf(format, a...)})
+	}
+
+	dir := cfg.Storage.DataDir
+	if info, err := os.Stat(dir); os.IsNotExist(err) {
+		add("data directory", doctorWarn, "%s does not exist yet, it is created on first start", dir)
+	} else if err != nil {
+		add("data directory", doctorFail, "%v", err)
+	} else if !info.IsDir() {
+		add("data directory", doctorFail, "%s is not a directory", dir)
+	} else if probe, err := os.CreateTemp(dir, ".aimeow-doctor-*"); err != nil {
+		add("data directory", doctorFail, "%s is not writable: %v", dir, err)
+	} else {
+		probe.Close()
+		os.Remove(probe.Name())
+		add("data directory", doctorOK, "%s is writable", dir)
+	}
+
+	var legacy []string
+	for _, name := range []string{legacyConfigFile, legacyClientMappingsFile, legacyPendingClientsFile} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			legacy = append(legacy, name)
+		}
+	}
+	if len(legacy) > 0 {
+		add("legacy files", doctorWarn, "%s will be imported into the database on the next start", strings.Join(legacy, ", "))
+	}
+
+	db, err := openCommandDatabase(cfg)
+	if errors.Is(err, os.ErrNotExist) {
+		add("database", doctorWarn, "not created yet, it is created on first start")
+	} else if err != nil {
+		add("database", doctorFail, "%v", err)
+	} else {
+		defer db.Close()
+		checks = append(checks, doctorDatabaseChecks(cfg, db)...)
+	}
+
+	if callbackURL := commandCallbackURL(cfg); callbackURL == "" {
+		add("webhook", doctorWarn, "no callback URL is configured, events are not delivered")
+	} else {
+		add("webhook", doctorOK, "%s (check delivery with aimeow webhook test)", callbackURL)
+	}
+
+	api := common.api(cfg)
+	resp, err := api.http.Get(api.server + "/health")
+	if err != nil {
+		add("server", doctorWarn, "not running at %s", api.server)
+	} else {
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusOK {
+			add("server", doctorOK, "running at %s", api.server)
+		} else {
+			add("server", doctorFail, "%s/health answered %s", api.server, resp.Status)
+		}
+	}
+	return checks
+}
+
+// doctorDatabaseChecks checks the schema version, sessions and search support of the database
+func doctorDatabaseChecks(cfg AppConfig, db *sql.DB) []DoctorCheck {
+	var checks []DoctorCheck
+	add := func(name, status, format string, a ...interface{}) {
+		checks = append(checks, DoctorCheck{Name: name, Status: status, Detail: fmt.Sprintf(format, a...)})
+	}
+
+	location := filepath.Join(cfg.Storage.DataDir, backupDatabaseName)
+	if dbDialect == dialectPostgres {
+		location = redactDatabaseURL(cfg.Storage.DatabaseURL)
+	}
+	var version int
+	if err := db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM aimeow_version`).Scan(&version); err != nil {
+		add("database", doctorWarn, "%s has no aimeow tables yet, they are created on the next start", location)
+		return checks
+	}
+	switch {
+	case version > len(aimeowMigrations):
+		add("database", doctorFail, "%s has schema version %d, newer than this build supports (%d)", location, version, len(aimeowMigrations))
+	case version < len(aimeowMigrations):
+		add("database", doctorWarn, "%s has schema version %d, upgraded to %d on the next start", location, version, len(aimeowMigrations))
+	default:
+		add("database", doctorOK, "%s, schema version %d", location, version)
+	}
+
+	var devices, unmapped, pending int
+	err := db.QueryRow(`SELECT COUNT(*), COUNT(*) - COUNT(m.client_id) FROM whatsmeow_device d
+		LEFT JOIN aimeow_client_mappings m ON m.whatsapp_id = d.jid`).Scan(&devices, &unmapped)
+	if err == nil {
+		err = db.QueryRow(`SELECT COUNT(*) FROM aimeow_pending_clients`).Scan(&pending)
+	}
+	switch {
+	case err != nil:
+		add("clients", doctorFail, "failed to read sessions: %v", err)
+	case unmapped > 0:
+		add("clients", doctorWarn, "%d paired, %d pending; %d session(s) have no client ID and get a new one on the next start", devices, pending, unmapped)
+	default:
+		add("clients", doctorOK, "%d paired, %d pending", devices, pending)
+	}
+
+	if dbDialect == dialectSQLite {
+		if !sqliteHasFTS5(context.Background(), db) {
+			add("message search", doctorFail, "SQLite was built without FTS5, which the schema needs, build aimeow with -tags sqlite_fts5")
+		} else {
+			add("message search", doctorOK, "FTS5 is available")
+		}
+	}
+	return checks
+}
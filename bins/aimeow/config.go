@@ -0,0 +1,470 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/goccy/go-yaml"
+)
+
+// Config file read when CONFIG_FILE is not set. It is optional; without it the defaults and
+// environment variables are used.
+const defaultConfigFile = "aimeow.yaml"
+
+// Log levels understood by the whatsmeow loggers
+var logLevels = []string{"DEBUG", "INFO", "WARN", "ERROR"}
+
+// Duration is a time.Duration written as a Go duration string, e.g. 30s or 24h
+type Duration time.Duration
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return fmt.Errorf("invalid duration %q, use a value such as 30s, 5m or 24h", text)
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// AppConfig is the aimeow configuration. It is read from the config file, then overridden by
+// environment variables. The webhook, rate limit, media, clients and reconnect settings and the
+// sandbox pair delay are reloaded on SIGHUP or POST /config; server, storage and logging changes
+// and turning the sandbox on or off need a restart.
+type AppConfig struct {
+	Server    ServerConfig    `yaml:"server" json:"server"`
+	Storage   StorageConfig   `yaml:"storage" json:"storage"`
+	Webhook   WebhookConfig   `yaml:"webhook" json:"webhook"`
+	RateLimit RateLimitConfig `yaml:"rateLimit" json:"rateLimit"`
+	Media     MediaConfig     `yaml:"media" json:"media"`
+	Logging   LoggingConfig   `yaml:"logging" json:"logging"`
+	Clients   ClientsConfig   `yaml:"clients" json:"clients"`
+	Reconnect ReconnectConfig `yaml:"reconnect" json:"reconnect"`
+	Sandbox   SandboxConfig   `yaml:"sandbox" json:"sandbox"`
+
+	File    string   `yaml:"-" json:"file,omitempty"`    // Config file the settings were read from
+	FromEnv []string `yaml:"-" json:"fromEnv,omitempty"` // Environment variables that overrode the file
+}
+
+type ServerConfig struct {
+	Port    int    `yaml:"port" json:"port"`       // PORT
+	BaseURL string `yaml:"baseUrl" json:"baseUrl"` // BASE_URL, used for file URLs; defaults to http://localhost:<port>
+}
+
+type StorageConfig struct {
+	DataDir     string `yaml:"dataDir" json:"dataDir"`                   // DATA_DIR, holds downloaded media and the SQLite database
+	DatabaseURL string `yaml:"databaseUrl" json:"databaseUrl,omitempty"` // DATABASE_URL, postgres:// URL to use PostgreSQL instead of SQLite
+	RestoreDir  string `yaml:"restoreDir" json:"restoreDir,omitempty"`   // RESTORE_DIR, directory POST /admin/restore writes under, default "restores" next to the data directory
+	AdminToken  string `yaml:"adminToken" json:"adminToken,omitempty"`   // ADMIN_TOKEN, bearer token of POST /admin/backup and /admin/restore, which are only served when it is set
+}
+
+// restoreRoot returns the directory that restores through the API are confined to
+func (s StorageConfig) restoreRoot() string {
+	if s.RestoreDir != "" {
+		return s.RestoreDir
+	}
+	return filepath.Join(filepath.Dir(filepath.Clean(s.DataDir)), "restores")
+}
+
+type WebhookConfig struct {
+	CallbackURL    string   `yaml:"callbackUrl" json:"callbackUrl"`       // CALLBACK_URL
+	Timeout        Duration `yaml:"timeout" json:"timeout"`               // WEBHOOK_TIMEOUT, per webhook request
+	Secret         string   `yaml:"secret" json:"secret,omitempty"`       // WEBHOOK_SECRET, signs webhook requests with HMAC-SHA256 when set
+	PayloadVersion int      `yaml:"payloadVersion" json:"payloadVersion"` // WEBHOOK_PAYLOAD_VERSION, schema of webhook bodies unless a client overrides it
+}
+
+type RateLimitConfig struct {
+	BroadcastInterval Duration `yaml:"broadcastInterval" json:"broadcastInterval"` // BROADCAST_INTERVAL, default delay between broadcast recipients
+}
+
+type MediaConfig struct {
+	DownloadTimeout Duration `yaml:"downloadTimeout" json:"downloadTimeout"` // MEDIA_DOWNLOAD_TIMEOUT, for imageUrl and documentUrl sends
+	MaxDownloadSize int64    `yaml:"maxDownloadSize" json:"maxDownloadSize"` // MEDIA_MAX_DOWNLOAD_SIZE in bytes
+}
+
+type LoggingConfig struct {
+	Level string `yaml:"level" json:"level"` // LOG_LEVEL of the whatsmeow client and database logs
+}
+
+type ClientsConfig struct {
+	DefaultCountry string   `yaml:"defaultCountry" json:"defaultCountry"` // DEFAULT_COUNTRY for numbers in national format
+	TypingTimeout  Duration `yaml:"typingTimeout" json:"typingTimeout"`   // TYPING_TIMEOUT default of new clients
+	IdempotencyTTL Duration `yaml:"idempotencyTtl" json:"idempotencyTtl"` // IDEMPOTENCY_TTL
+	LIDNegativeTTL Duration `yaml:"lidNegativeTtl" json:"lidNegativeTtl"` // LID_NEGATIVE_TTL
+}
+
+type ReconnectConfig struct {
+	MaxAttempts int      `yaml:"maxAttempts" json:"maxAttempts"` // RECONNECT_MAX_ATTEMPTS, 0 retries forever
+	MaxDelay    Duration `yaml:"maxDelay" json:"maxDelay"`       // RECONNECT_MAX_DELAY
+}
+
+type SandboxConfig struct {
+	Enabled   bool     `yaml:"enabled" json:"enabled"`     // SANDBOX or aimeow serve -sandbox, simulates WhatsApp instead of connecting to it
+	PairDelay Duration `yaml:"pairDelay" json:"pairDelay"` // SANDBOX_PAIR_DELAY, time until a new sandbox client is paired
+}
+
+// defaultAppConfig returns the settings used when neither the config file nor the environment
+// sets them
+func defaultAppConfig() AppConfig {
+	return AppConfig{
+		Server:    ServerConfig{Port: 7030},
+		Storage:   StorageConfig{DataDir: "data/aimeow"},
+		Webhook:   WebhookConfig{Timeout: Duration(30 * time.Second), PayloadVersion: webhookSchemaV1},
+		RateLimit: RateLimitConfig{BroadcastInterval: Duration(2 * time.Second)},
+		Media:     MediaConfig{DownloadTimeout: Duration(time.Minute), MaxDownloadSize: 100 << 20},
+		Logging:   LoggingConfig{Level: "DEBUG"},
+		Clients: ClientsConfig{
+			TypingTimeout:  Duration(time.Minute),
+			IdempotencyTTL: Duration(24 * time.Hour),
+			LIDNegativeTTL: Duration(time.Hour),
+		},
+		Reconnect: ReconnectConfig{MaxAttempts: 10, MaxDelay: Duration(5 * time.Minute)},
+		Sandbox:   SandboxConfig{PairDelay: Duration(2 * time.Second)},
+	}
+}
+
+// configEnvOverrides are the environment variables that override the config file
+var configEnvOverrides = []struct {
+	name  string
+	apply func(cfg *AppConfig, value string) error
+}{
+	{"PORT", func(cfg *AppConfig, value string) error { return parseEnvInt(value, &cfg.Server.Port) }},
+	{"BASE_URL", func(cfg *AppConfig, value string) error { cfg.Server.BaseURL = value; return nil }},
+	{"DATA_DIR", func(cfg *AppConfig, value string) error { cfg.Storage.DataDir = value; return nil }},
+	{"DATABASE_URL", func(cfg *AppConfig, value string) error { cfg.Storage.DatabaseURL = value; return nil }},
+	{"RESTORE_DIR", func(cfg *AppConfig, value string) error { cfg.Storage.RestoreDir = value; return nil }},
+	{"ADMIN_TOKEN", func(cfg *AppConfig, value string) error { cfg.Storage.AdminToken = value; return nil }},
+	{"CALLBACK_URL", func(cfg *AppConfig, value string) error { cfg.Webhook.CallbackURL = value; return nil }},
+	{"WEBHOOK_TIMEOUT", func(cfg *AppConfig, value string) error { return cfg.Webhook.Timeout.UnmarshalText([]byte(value)) }},
+	{"WEBHOOK_SECRET", func(cfg *AppConfig, value string) error { cfg.Webhook.Secret = value; return nil }},
+	{"WEBHOOK_PAYLOAD_VERSION", func(cfg *AppConfig, value string) error { return parseEnvInt(value, &cfg.Webhook.PayloadVersion) }},
+	{"BROADCAST_INTERVAL", func(cfg *AppConfig, value string) error {
+		return cfg.RateLimit.BroadcastInterval.UnmarshalText([]byte(value))
+	}},
+	{"MEDIA_DOWNLOAD_TIMEOUT", func(cfg *AppConfig, value string) error {
+		return cfg.Media.DownloadTimeout.UnmarshalText([]byte(value))
+	}},
+	{"MEDIA_MAX_DOWNLOAD_SIZE", func(cfg *AppConfig, value string) error {
+		size, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid size %q, use a number of bytes", value)
+		}
+		cfg.Media.MaxDownloadSize = size
+		return nil
+	}},
+	{"LOG_LEVEL", func(cfg *AppConfig, value string) error { cfg.Logging.Level = value; return nil }},
+	{"DEFAULT_COUNTRY", func(cfg *AppConfig, value string) error { cfg.Clients.DefaultCountry = value; return nil }},
+	{"TYPING_TIMEOUT", func(cfg *AppConfig, value string) error {
+		return cfg.Clients.TypingTimeout.UnmarshalText([]byte(value))
+	}},
+	{"IDEMPOTENCY_TTL", func(cfg *AppConfig, value string) error {
+		return cfg.Clients.IdempotencyTTL.UnmarshalText([]byte(value))
+	}},
+	{"LID_NEGATIVE_TTL", func(cfg *AppConfig, value string) error {
+		return cfg.Clients.LIDNegativeTTL.UnmarshalText([]byte(value))
+	}},
+	{"RECONNECT_MAX_ATTEMPTS", func(cfg *AppConfig, value string) error { return parseEnvInt(value, &cfg.Reconnect.MaxAttempts) }},
+	{"RECONNECT_MAX_DELAY", func(cfg *AppConfig, value string) error { return cfg.Reconnect.MaxDelay.UnmarshalText([]byte(value)) }},
+	{"SANDBOX", func(cfg *AppConfig, value string) error {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid value %q, use true or false", value)
+		}
+		cfg.Sandbox.Enabled = enabled
+		return nil
+	}},
+	{"SANDBOX_PAIR_DELAY", func(cfg *AppConfig, value string) error { return cfg.Sandbox.PairDelay.UnmarshalText([]byte(value)) }},
+}
+
+// sandboxFlag is set by aimeow serve -sandbox and turns on sandbox mode whatever the
+// configuration says
+var sandboxFlag bool
+
+// parseEnvInt parses a whole number from an environment variable
+func parseEnvInt(value string, target *int) error {
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		return fmt.Errorf("invalid number %q", value)
+	}
+	*target = parsed
+	return nil
+}
+
+// loadAppConfig reads the config file named by CONFIG_FILE (default aimeow.yaml), applies the
+// environment overrides and validates the result
+func loadAppConfig() (AppConfig, error) {
+	cfg := defaultAppConfig()
+
+	path := os.Getenv("CONFIG_FILE")
+	data, err := os.ReadFile(firstNonEmpty(path, defaultConfigFile))
+	switch {
+	case err == nil:
+		cfg.File = firstNonEmpty(path, defaultConfigFile)
+		if err := yaml.UnmarshalWithOptions(data, &cfg, yaml.DisallowUnknownField()); err != nil {
+			return cfg, fmt.Errorf("failed to parse config file %s: %w", cfg.File, err)
+		}
+	case path != "" || !os.IsNotExist(err):
+		// A config file that was asked for must exist
+		return cfg, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	for _, override := range configEnvOverrides {
+		value := os.Getenv(override.name)
+		if value == "" {
+			continue
+		}
+		if err := override.apply(&cfg, strings.TrimSpace(value)); err != nil {
+			return cfg, fmt.Errorf("invalid %s: %w", override.name, err)
+		}
+		cfg.FromEnv = append(cfg.FromEnv, override.name)
+	}
+
+	if sandboxFlag {
+		cfg.Sandbox.Enabled = true
+	}
+	if cfg.Server.BaseURL == "" {
+		cfg.Server.BaseURL = fmt.Sprintf("http://localhost:%d", cfg.Server.Port)
+	}
+	cfg.Server.BaseURL = strings.TrimSuffix(cfg.Server.BaseURL, "/")
+	cfg.Clients.DefaultCountry = strings.ToUpper(strings.TrimSpace(cfg.Clients.DefaultCountry))
+	cfg.Logging.Level = strings.ToUpper(strings.TrimSpace(cfg.Logging.Level))
+
+	return cfg, cfg.validate()
+}
+
+// firstNonEmpty returns the first of the values that is not empty
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// validate checks the settings, naming the setting and its environment variable on failure
+func (cfg AppConfig) validate() error {
+	if cfg.Server.Port < 1 || cfg.Server.Port > 65535 {
+		return fmt.Errorf("server.port (PORT) must be between 1 and 65535, got %d", cfg.Server.Port)
+	}
+	if u, err := url.Parse(cfg.Server.BaseURL); err != nil || u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("server.baseUrl (BASE_URL) must be an absolute URL, got %q", cfg.Server.BaseURL)
+	}
+	if cfg.Storage.DataDir == "" {
+		return fmt.Errorf("storage.dataDir (DATA_DIR) must not be empty")
+	}
+	if cfg.Storage.DatabaseURL != "" {
+		if u, err := url.Parse(cfg.Storage.DatabaseURL); err != nil || (u.Scheme != "postgres" && u.Scheme != "postgresql") {
+			return fmt.Errorf("storage.databaseUrl (DATABASE_URL) must be a postgres:// or postgresql:// URL")
+		}
+	}
+	if cfg.Webhook.CallbackURL != "" {
+		if u, err := url.Parse(cfg.Webhook.CallbackURL); err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("webhook.callbackUrl (CALLBACK_URL) must be an absolute URL, got %q", cfg.Webhook.CallbackURL)
+		}
+	}
+	if cfg.Webhook.Timeout <= 0 {
+		return fmt.Errorf("webhook.timeout (WEBHOOK_TIMEOUT) must be positive")
+	}
+	if cfg.Webhook.PayloadVersion < webhookSchemaV1 || cfg.Webhook.PayloadVersion > latestWebhookSchemaVersion {
+		return fmt.Errorf("webhook.payloadVersion (WEBHOOK_PAYLOAD_VERSION) must be between %d and %d, got %d", webhookSchemaV1, latestWebhookSchemaVersion, cfg.Webhook.PayloadVersion)
+	}
+	if cfg.RateLimit.BroadcastInterval < Duration(minBroadcastInterval) {
+		return fmt.Errorf("rateLimit.broadcastInterval (BROADCAST_INTERVAL) must be at least %s", minBroadcastInterval)
+	}
+	if cfg.Media.DownloadTimeout <= 0 {
+		return fmt.Errorf("media.downloadTimeout (MEDIA_DOWNLOAD_TIMEOUT) must be positive")
+	}
+	if cfg.Media.MaxDownloadSize <= 0 {
+		return fmt.Errorf("media.maxDownloadSize (MEDIA_MAX_DOWNLOAD_SIZE) must be positive")
+	}
+	validLevel := false
+	for _, level := range logLevels {
+		validLevel = validLevel || cfg.Logging.Level == level
+	}
+	if !validLevel {
+		return fmt.Errorf("logging.level (LOG_LEVEL) must be one of %s, got %q", strings.Join(logLevels, ", "), cfg.Logging.Level)
+	}
+	if err := validatePhoneCountry(cfg.Clients.DefaultCountry); err != nil {
+		return fmt.Errorf("clients.defaultCountry (DEFAULT_COUNTRY): %w", err)
+	}
+	if cfg.Clients.TypingTimeout < Duration(time.Second) || cfg.Clients.TypingTimeout > Duration(10*time.Minute) {
+		return fmt.Errorf("clients.typingTimeout (TYPING_TIMEOUT) must be between 1s and 10m")
+	}
+	if cfg.Clients.IdempotencyTTL <= 0 {
+		return fmt.Errorf("clients.idempotencyTtl (IDEMPOTENCY_TTL) must be positive")
+	}
+	if cfg.Clients.LIDNegativeTTL <= 0 {
+		return fmt.Errorf("clients.lidNegativeTtl (LID_NEGATIVE_TTL) must be positive")
+	}
+	if cfg.Reconnect.MaxAttempts < 0 {
+		return fmt.Errorf("reconnect.maxAttempts (RECONNECT_MAX_ATTEMPTS) must not be negative")
+	}
+	if cfg.Reconnect.MaxDelay < Duration(reconnectBaseDelay) {
+		return fmt.Errorf("reconnect.maxDelay (RECONNECT_MAX_DELAY) must be at least %s", reconnectBaseDelay)
+	}
+	if cfg.Sandbox.PairDelay < 0 {
+		return fmt.Errorf("sandbox.pairDelay (SANDBOX_PAIR_DELAY) must not be negative")
+	}
+	return nil
+}
+
+// currentAppConfig holds the active configuration. It is replaced as a whole on reload, so
+// readers always see a consistent set of settings.
+var currentAppConfig atomic.Pointer[AppConfig]
+
+// appConfig returns the active configuration
+func appConfig() *AppConfig {
+	if cfg := currentAppConfig.Load(); cfg != nil {
+		return cfg
+	}
+	cfg := defaultAppConfig()
+	currentAppConfig.CompareAndSwap(nil, &cfg)
+	return currentAppConfig.Load()
+}
+
+// redacted returns the configuration with the database password, admin token and webhook secret
+// hidden, for the API
+func (cfg AppConfig) redacted() AppConfig {
+	cfg.Storage.DatabaseURL = redactDatabaseURL(cfg.Storage.DatabaseURL)
+	if cfg.Storage.AdminToken != "" {
+		cfg.Storage.AdminToken = "xxxxx"
+	}
+	if cfg.Webhook.Secret != "" {
+		cfg.Webhook.Secret = "xxxxx"
+	}
+	return cfg
+}
+
+// redactDatabaseURL hides the password in a database URL
+func redactDatabaseURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "invalid URL"
+	}
+	return u.Redacted()
+}
+
+// restartOnlyChanges lists the settings that differ between two configurations but are only
+// read at startup
+func restartOnlyChanges(old *AppConfig, cfg *AppConfig) []string {
+	var changed []string
+	if old.Server.Port != cfg.Server.Port {
+		changed = append(changed, "server.port")
+	}
+	if old.Server.BaseURL != cfg.Server.BaseURL {
+		changed = append(changed, "server.baseUrl")
+	}
+	if old.Storage.DataDir != cfg.Storage.DataDir {
+		changed = append(changed, "storage.dataDir")
+	}
+	if old.Storage.DatabaseURL != cfg.Storage.DatabaseURL {
+		changed = append(changed, "storage.databaseUrl")
+	}
+	if old.Storage.RestoreDir != cfg.Storage.RestoreDir {
+		changed = append(changed, "storage.restoreDir")
+	}
+	if old.Storage.AdminToken != cfg.Storage.AdminToken {
+		changed = append(changed, "storage.adminToken")
+	}
+	if old.Logging.Level != cfg.Logging.Level {
+		changed = append(changed, "logging.level")
+	}
+	if old.Sandbox.Enabled != cfg.Sandbox.Enabled {
+		changed = append(changed, "sandbox.enabled")
+	}
+	return changed
+}
+
+// reloadAppConfig reads the configuration again and applies the settings that can change at
+// runtime. Settings that need a restart keep their running value and are returned.
+func reloadAppConfig() ([]string, error) {
+	cfg, err := loadAppConfig()
+	if err != nil {
+		return nil, err
+	}
+	old := appConfig()
+	restart := restartOnlyChanges(old, &cfg)
+	cfg.Server = old.Server
+	cfg.Storage = old.Storage
+	cfg.Logging = old.Logging
+	cfg.Sandbox.Enabled = old.Sandbox.Enabled
+	currentAppConfig.Store(&cfg)
+
+	if manager != nil {
+		saved, err := manager.readConfig()
+		if err != nil {
+			fmt.Printf("[Config] Failed to load saved callback URL: %v\n", err)
+		}
+		manager.applyCallbackURL(&cfg, saved.CallbackURL)
+	}
+	fmt.Printf("[Config] Reloaded configuration from %s\n", firstNonEmpty(cfg.File, "defaults and environment"))
+	for _, name := range restart {
+		fmt.Printf("[Config] %s changed, restart aimeow to apply it\n", name)
+	}
+	return restart, nil
+}
+
+// watchConfigReload reloads the configuration whenever the process receives SIGHUP
+func watchConfigReload() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	for range signals {
+		fmt.Printf("[Config] SIGHUP received, reloading configuration\n")
+		if _, err := reloadAppConfig(); err != nil {
+			fmt.Printf("[Config] Reload failed, keeping the current configuration: %v\n", err)
+		}
+	}
+}
+
+// applyCallbackURL sets the webhook URL from the configuration. CALLBACK_URL wins, then the URL
+// saved through POST /config, then the config file.
+func (cm *ClientManager) applyCallbackURL(cfg *AppConfig, saved string) {
+	callbackURL := firstNonEmpty(saved, cfg.Webhook.CallbackURL)
+	for _, name := range cfg.FromEnv {
+		if name == "CALLBACK_URL" {
+			callbackURL = cfg.Webhook.CallbackURL
+			fmt.Printf("Callback URL set from environment: %s\n", callbackURL)
+		}
+	}
+
+	cm.mutex.Lock()
+	cm.callbackURL = callbackURL
+	cm.mutex.Unlock()
+}
+
+// webhookHTTPClient returns the HTTP client webhooks are sent with
+func webhookHTTPClient() *http.Client {
+	return &http.Client{Timeout: time.Duration(appConfig().Webhook.Timeout)}
+}
+
+// mediaHTTPClient returns the HTTP client media is downloaded from URLs with
+func mediaHTTPClient() *http.Client {
+	return &http.Client{Timeout: time.Duration(appConfig().Media.DownloadTimeout)}
+}
+
+// readMediaBody reads downloaded media, failing if it is larger than the configured limit
+func readMediaBody(body io.Reader) ([]byte, error) {
+	limit := appConfig().Media.MaxDownloadSize
+	data, err := io.ReadAll(io.LimitReader(body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("media is larger than the %d byte limit", limit)
+	}
+	return data, nil
+}
@@ -0,0 +1,398 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// Contact list page size limits
+const (
+	defaultContactsPageSize = 100
+	maxContactsPageSize     = 1000
+)
+
+// Contact is an entry of a linked number's contact store, optionally enriched with what the
+// server knows about the user
+type Contact struct {
+	JID          string `json:"jid"`
+	Phone        string `json:"phone,omitempty"` // E.164, if known
+	LID          string `json:"lid,omitempty"`   // Hidden user JID, if known
+	Name         string `json:"name,omitempty"`  // Best available name: saved, push, business or verified name
+	FirstName    string `json:"firstName,omitempty"`
+	FullName     string `json:"fullName,omitempty"`     // Name saved in the phone's address book
+	PushName     string `json:"pushName,omitempty"`     // Name the user set for themselves
+	BusinessName string `json:"businessName,omitempty"` // Name the business set for itself
+	VerifiedName string `json:"verifiedName,omitempty"` // Name on the business's verified certificate
+	IsBusiness   bool   `json:"isBusiness"`
+	InStore      bool   `json:"inStore"` // Whether the contact store has an entry for this user
+
+	// Only filled when details are requested and the client is connected
+	About           string                  `json:"about,omitempty"`
+	HasPicture      *bool                   `json:"hasPicture,omitempty"`
+	PictureID       string                  `json:"pictureId,omitempty"`
+	BusinessProfile *ContactBusinessProfile `json:"businessProfile,omitempty"`
+	DetailsError    string                  `json:"detailsError,omitempty"`
+}
+
+type ContactBusinessProfile struct {
+	Address       string                 `json:"address,omitempty"`
+	Email         string                 `json:"email,omitempty"`
+	Categories    []string               `json:"categories,omitempty"`
+	Options       map[string]string      `json:"options,omitempty"` // Other profile fields such as websites
+	HoursTimeZone string                 `json:"hoursTimeZone,omitempty"`
+	Hours         []ContactBusinessHours `json:"hours,omitempty"`
+}
+
+type ContactBusinessHours struct {
+	DayOfWeek string `json:"dayOfWeek"`
+	Mode      string `json:"mode"` // open_24h, appointment_only or specific_hours
+	OpenTime  string `json:"openTime,omitempty"`
+	CloseTime string `json:"closeTime,omitempty"`
+}
+
+// newContact builds a contact from a contact store entry
+func newContact(jid types.JID, info types.ContactInfo) Contact {
+	contact := Contact{
+		JID:          jid.String(),
+		FirstName:    info.FirstName,
+		FullName:     info.FullName,
+		PushName:     info.PushName,
+		BusinessName: info.BusinessName,
+		IsBusiness:   info.BusinessName != "",
+		InStore:      info.Found,
+	}
+	contact.setName()
+	return contact
+}
+
+// setName picks the name to show, preferring the one saved on the phone
+func (contact *Contact) setName() {
+	for _, name := range []string{contact.FullName, contact.FirstName, contact.PushName, contact.BusinessName, contact.VerifiedName} {
+		if name != "" {
+			contact.Name = name
+			return
+		}
+	}
+}
+
+// matches reports whether any name, number or JID of the contact contains the lowercase query
+func (contact Contact) matches(query string) bool {
+	for _, field := range []string{contact.Name, contact.FullName, contact.FirstName, contact.PushName,
+		contact.BusinessName, contact.VerifiedName, contact.JID, contact.Phone, contact.LID} {
+		if strings.Contains(strings.ToLower(field), query) {
+			return true
+		}
+	}
+	return false
+}
+
+// applyPair fills the phone number and LID from a resolve result
+func (contact *Contact) applyPair(result ResolveResult) {
+	if result.Phone != "" {
+		contact.Phone = "+" + result.Phone
+	}
+	contact.LID = result.LID
+}
+
+// applyUserInfo fills the details the server returned for the user
+func (contact *Contact) applyUserInfo(info types.UserInfo) {
+	contact.About = info.Status
+	contact.PictureID = info.PictureID
+	hasPicture := info.PictureID != ""
+	contact.HasPicture = &hasPicture
+	if info.VerifiedName != nil && info.VerifiedName.Details != nil {
+		contact.VerifiedName = info.VerifiedName.Details.GetVerifiedName()
+		contact.IsBusiness = true
+	}
+	if contact.LID == "" && info.LID.Server == types.HiddenUserServer {
+		contact.LID = info.LID.String()
+	}
+	if contact.Name == "" {
+		contact.setName()
+	}
+}
+
+// newContactBusinessProfile converts a whatsmeow business profile for the API
+func newContactBusinessProfile(profile *types.BusinessProfile) *ContactBusinessProfile {
+	result := &ContactBusinessProfile{
+		Address:       profile.Address,
+		Email:         profile.Email,
+		Options:       profile.ProfileOptions,
+		HoursTimeZone: profile.BusinessHoursTimeZone,
+	}
+	for _, category := range profile.Categories {
+		result.Categories = append(result.Categories, category.Name)
+	}
+	for _, hours := range profile.BusinessHours {
+		result.Hours = append(result.Hours, ContactBusinessHours{
+			DayOfWeek: hours.DayOfWeek,
+			Mode:      hours.Mode,
+			OpenTime:  hours.OpenTime,
+			CloseTime: hours.CloseTime,
+		})
+	}
+	return result
+}
+
+// contactQueryJID returns the phone number JID the server can be asked about for a contact
+func contactQueryJID(contact Contact) (types.JID, bool) {
+	if contact.Phone != "" {
+		return types.NewJID(strings.TrimPrefix(contact.Phone, "+"), types.DefaultUserServer), true
+	}
+	jid, err := types.ParseJID(contact.JID)
+	if err != nil || jid.Server != types.DefaultUserServer {
+		return types.JID{}, false
+	}
+	return jid, true
+}
+
+// loadContactDetails asks the server about the about text, profile picture and verified business
+// name of the contacts, in one query
+func (cm *ClientManager) loadContactDetails(ctx context.Context, client *WhatsAppClient, contacts []Contact) {
+	if !client.connected() {
+		for i := range contacts {
+			contacts[i].DetailsError = "client is not connected"
+		}
+		return
+	}
+
+	indexes := make(map[types.JID][]int)
+	var jids []types.JID
+	for i, contact := range contacts {
+		jid, ok := contactQueryJID(contact)
+		if !ok {
+			contacts[i].DetailsError = "phone number is unknown"
+			continue
+		}
+		if _, seen := indexes[jid]; !seen {
+			jids = append(jids, jid)
+		}
+		indexes[jid] = append(indexes[jid], i)
+	}
+	if len(jids) == 0 {
+		return
+	}
+
+	info, err := client.client.GetUserInfo(ctx, jids)
+	if err != nil {
+		for _, list := range indexes {
+			for _, i := range list {
+				contacts[i].DetailsError = fmt.Sprintf("user info query failed: %v", err)
+			}
+		}
+		return
+	}
+	for jid, list := range indexes {
+		user, ok := info[jid]
+		for _, i := range list {
+			if !ok {
+				contacts[i].DetailsError = "not on WhatsApp"
+				continue
+			}
+			contacts[i].applyUserInfo(user)
+		}
+	}
+}
+
+// listContacts returns the contacts in the device's contact store, sorted by name
+func (cm *ClientManager) listContacts(ctx context.Context, client *WhatsAppClient) ([]Contact, error) {
+	if client.deviceStore.Contacts == nil {
+		return nil, fmt.Errorf("client is not paired")
+	}
+	stored, err := client.deviceStore.Contacts.GetAllContacts(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read contact store: %w", err)
+	}
+
+	contacts := make([]Contact, 0, len(stored))
+	for jid, info := range stored {
+		contact := newContact(jid, info)
+		if jid.Server == types.DefaultUserServer {
+			contact.Phone = "+" + jid.User
+		} else if jid.Server == types.HiddenUserServer {
+			contact.LID = jid.String()
+		}
+		contacts = append(contacts, contact)
+	}
+	sort.Slice(contacts, func(i, j int) bool {
+		a, b := strings.ToLower(contacts[i].Name), strings.ToLower(contacts[j].Name)
+		if a != b {
+			// Unnamed contacts go last
+			return b == "" || (a != "" && a < b)
+		}
+		return contacts[i].JID < contacts[j].JID
+	})
+	return contacts, nil
+}
+
+// resolveContactPairs fills in the LID/phone pair of the contacts from local lookups
+func (cm *ClientManager) resolveContactPairs(ctx context.Context, client *WhatsAppClient, contacts []Contact) {
+	jids := make([]types.JID, 0, len(contacts))
+	for _, contact := range contacts {
+		jid, _ := types.ParseJID(contact.JID)
+		jids = append(jids, jid)
+	}
+	for i, result := range cm.resolveJIDs(ctx, client, jids, false) {
+		contacts[i].applyPair(result)
+	}
+}
+
+// @Summary List contacts
+// @Description Returns the contacts in the linked number's contact store with their saved, push and business names, sorted by name. With details=true the about text, profile picture availability and verified business name are fetched from WhatsApp for the returned page. The total number of matching contacts is returned in the X-Total-Count header.
+// @Tags contacts
+// @Accept json
+// @Produce json
+// @Param id path string true "Client ID"
+// @Param search query string false "Only contacts whose name, phone number or JID contains this text (case insensitive)"
+// @Param details query bool false "Fetch about text, picture and verified name from WhatsApp" default(false)
+// @Param limit query int false "Maximum number of contacts to return (1-1000)" default(100)
+// @Param offset query int false "Number of contacts to skip" default(0)
+// @Success 200 {array} Contact
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /clients/{id}/contacts [get]
+func getContacts(c *gin.Context) {
+	waClient, err := manager.getClient(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	limit, offset, err := parsePageParams(c, defaultContactsPageSize, maxContactsPageSize)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	details := false
+	if d := c.Query("details"); d != "" {
+		details, err = strconv.ParseBool(d)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "details must be true or false"})
+			return
+		}
+	}
+
+	if waClient.deviceStore.ID == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "client is not paired"})
+		return
+	}
+	ctx := c.Request.Context()
+	contacts, err := manager.listContacts(ctx, waClient)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if search := strings.ToLower(strings.TrimSpace(c.Query("search"))); search != "" {
+		// Searching by number should work however the number is written
+		digits := strings.TrimLeft(strings.Map(func(r rune) rune {
+			if r >= '0' && r <= '9' {
+				return r
+			}
+			return -1
+		}, search), "0")
+		matched := contacts[:0]
+		for _, contact := range contacts {
+			if contact.matches(search) || (len(digits) >= 4 && strings.Contains(contact.Phone, digits)) {
+				matched = append(matched, contact)
+			}
+		}
+		contacts = matched
+	}
+
+	c.Header("X-Total-Count", strconv.Itoa(len(contacts)))
+	if offset > len(contacts) {
+		offset = len(contacts)
+	}
+	contacts = contacts[offset:]
+	if limit > 0 && limit < len(contacts) {
+		contacts = contacts[:limit]
+	}
+
+	manager.resolveContactPairs(ctx, waClient, contacts)
+	if details {
+		manager.loadContactDetails(ctx, waClient, contacts)
+	}
+
+	c.JSON(http.StatusOK, contacts)
+}
+
+// @Summary Get contact
+// @Description Returns a single contact by LID, phone JID or phone number, with its names, LID/phone pair, about text, profile picture availability and business profile. Users that aren't in the contact store are looked up on WhatsApp.
+// @Tags contacts
+// @Accept json
+// @Produce json
+// @Param id path string true "Client ID"
+// @Param jid path string true "LID (123@lid), phone JID (628...@s.whatsapp.net) or phone number"
+// @Success 200 {object} Contact
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /clients/{id}/contacts/{jid} [get]
+func getContact(c *gin.Context) {
+	waClient, err := manager.getClient(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	jid, err := waClient.parseUserJID(c.Param("jid"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if waClient.deviceStore.ID == nil || waClient.deviceStore.Contacts == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "client is not paired"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	pair := manager.resolveJID(ctx, waClient, jid, true)
+
+	// The store may know the user under its phone number or its LID
+	info, err := waClient.deviceStore.Contacts.GetContact(ctx, jid)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to read contact store: %v", err)})
+		return
+	}
+	if !info.Found && pair.Resolved {
+		other := pair.LID
+		if jid.Server == types.HiddenUserServer {
+			other = pair.Phone + "@" + types.DefaultUserServer
+		}
+		if otherJID, err := types.ParseJID(other); err == nil {
+			if otherInfo, err := waClient.deviceStore.Contacts.GetContact(ctx, otherJID); err == nil && otherInfo.Found {
+				info = otherInfo
+			}
+		}
+	}
+
+	contact := newContact(jid, info)
+	contact.applyPair(pair)
+	contacts := []Contact{contact}
+	manager.loadContactDetails(ctx, waClient, contacts)
+	contact = contacts[0]
+
+	if contact.IsBusiness && contact.DetailsError == "" {
+		if queryJID, ok := contactQueryJID(contact); ok {
+			profile, err := waClient.client.GetBusinessProfile(ctx, queryJID)
+			if err != nil {
+				contact.DetailsError = fmt.Sprintf("business profile query failed: %v", err)
+			} else if profile != nil {
+				contact.BusinessProfile = newContactBusinessProfile(profile)
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, contact)
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	_ "github.com/lib/pq"
+)
+
+// Database dialects, named after their database/sql drivers
+const (
+	dialectSQLite   = "sqlite3"
+	dialectPostgres = "postgres"
+)
+
+// dbDialect is the dialect of the shared database, set when it is opened
+var dbDialect = dialectSQLite
+
+// openDatabase opens the database the whatsmeow session store and the aimeow tables share:
+// PostgreSQL when storage.databaseUrl (DATABASE_URL) is set, otherwise SQLite in the data
+// directory. A database that can't be used is an error; there is no fallback location.
+func openDatabase(cfg AppConfig) (*sql.DB, error) {
+	if cfg.Storage.DatabaseURL != "" {
+		fmt.Printf("Connecting to PostgreSQL at %s\n", redactDatabaseURL(cfg.Storage.DatabaseURL))
+		db, err := sql.Open(dialectPostgres, cfg.Storage.DatabaseURL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open PostgreSQL database: %w", err)
+		}
+		if err := db.Ping(); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to connect to PostgreSQL at %s: %w", redactDatabaseURL(cfg.Storage.DatabaseURL), err)
+		}
+		dbDialect = dialectPostgres
+		return db, nil
+	}
+
+	dbPath := filepath.Join(cfg.Storage.DataDir, "aimeow.db")
+	fmt.Printf("Database path: %s\n", dbPath)
+	if _, err := os.Stat(dbPath); err == nil {
+		fmt.Printf("Database file already exists: %s\n", dbPath)
+	} else {
+		// Database doesn't exist, test if we can create it
+		dbFile, err := os.Create(dbPath)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create database file %s: %w; make storage.dataDir (DATA_DIR) writable or set DATABASE_URL", dbPath, err)
+		}
+		dbFile.Close()
+		os.Remove(dbPath) // Remove empty test file, let sqlstore create it properly
+	}
+
+	fmt.Printf("Initializing database container at: %s\n", dbPath)
+	db, err := sql.Open(dialectSQLite, fmt.Sprintf("file:%s?_foreign_keys=on&_busy_timeout=5000", dbPath))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	dbDialect = dialectSQLite
+	return db, nil
+}
+
+// aimeowTables holds the tables aimeow kept next to the whatsmeow session store before the
+// schema was versioned. They are written for SQLite and PostgreSQL alike; BLOB columns become
+// BYTEA on PostgreSQL.
+var aimeowTables = []string{
+	`CREATE TABLE IF NOT EXISTS aimeow_scheduled_messages (
+		id         TEXT PRIMARY KEY,
+		client_id  TEXT NOT NULL,
+		type       TEXT NOT NULL,
+		payload    TEXT NOT NULL,
+		send_at    BIGINT NOT NULL,
+		timezone   TEXT NOT NULL DEFAULT '',
+		status     TEXT NOT NULL,
+		message_id TEXT NOT NULL DEFAULT '',
+		error      TEXT NOT NULL DEFAULT '',
+		attempts   INTEGER NOT NULL DEFAULT 0,
+		created_at BIGINT NOT NULL,
+		sent_at    BIGINT
+	)`,
+	`CREATE INDEX IF NOT EXISTS aimeow_scheduled_messages_due_idx ON aimeow_scheduled_messages (status, send_at)`,
+	`CREATE TABLE IF NOT EXISTS aimeow_broadcasts (
+		id                  TEXT PRIMARY KEY,
+		client_id           TEXT NOT NULL,
+		type                TEXT NOT NULL,
+		payload             TEXT NOT NULL,
+		status              TEXT NOT NULL,
+		interval_ms         INTEGER NOT NULL,
+		skip_whatsapp_check BOOLEAN NOT NULL DEFAULT false,
+		created_at          BIGINT NOT NULL,
+		started_at          BIGINT,
+		finished_at         BIGINT
+	)`,
+	`CREATE TABLE IF NOT EXISTS aimeow_broadcast_recipients (
+		broadcast_id TEXT NOT NULL REFERENCES aimeow_broadcasts(id) ON DELETE CASCADE,
+		position     INTEGER NOT NULL,
+		phone        TEXT NOT NULL,
+		variables    TEXT NOT NULL DEFAULT '{}',
+		status       TEXT NOT NULL,
+		message_id   TEXT NOT NULL DEFAULT '',
+		error        TEXT NOT NULL DEFAULT '',
+		sent_at      BIGINT,
+		PRIMARY KEY (broadcast_id, position)
+	)`,
+	`CREATE TABLE IF NOT EXISTS aimeow_idempotency_keys (
+		client_id       TEXT NOT NULL,
+		idempotency_key TEXT NOT NULL,
+		request_hash    TEXT NOT NULL,
+		status          INTEGER NOT NULL,
+		response        BLOB NOT NULL,
+		created_at      BIGINT NOT NULL,
+		expires_at      BIGINT NOT NULL,
+		PRIMARY KEY (client_id, idempotency_key)
+	)`,
+	`CREATE INDEX IF NOT EXISTS aimeow_idempotency_keys_expiry_idx ON aimeow_idempotency_keys (expires_at)`,
+	`CREATE TABLE IF NOT EXISTS aimeow_client_settings (
+		client_id  TEXT PRIMARY KEY,
+		settings   TEXT NOT NULL,
+		updated_at BIGINT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS aimeow_client_devices (
+		client_id     TEXT PRIMARY KEY,
+		os_name       TEXT NOT NULL DEFAULT '',
+		platform_type TEXT NOT NULL DEFAULT '',
+		browser_label TEXT NOT NULL DEFAULT '',
+		updated_at    BIGINT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS aimeow_lid_cache (
+		jid        TEXT PRIMARY KEY,
+		alt_jid    TEXT NOT NULL DEFAULT '',
+		source     TEXT NOT NULL DEFAULT '',
+		updated_at BIGINT NOT NULL,
+		expires_at BIGINT
+	)`,
+	`CREATE TABLE IF NOT EXISTS aimeow_chats (
+		client_id       TEXT NOT NULL,
+		jid             TEXT NOT NULL,
+		name            TEXT NOT NULL DEFAULT '',
+		unread_count    INTEGER NOT NULL DEFAULT 0,
+		archived        BOOLEAN NOT NULL DEFAULT false,
+		pinned          BOOLEAN NOT NULL DEFAULT false,
+		muted_until     BIGINT NOT NULL DEFAULT 0,
+		last_message_at BIGINT NOT NULL DEFAULT 0,
+		updated_at      BIGINT NOT NULL,
+		PRIMARY KEY (client_id, jid)
+	)`,
+	`CREATE TABLE IF NOT EXISTS aimeow_messages (
+		client_id    TEXT NOT NULL,
+		chat_jid     TEXT NOT NULL,
+		id           TEXT NOT NULL,
+		sender_jid   TEXT NOT NULL DEFAULT '',
+		sender_phone TEXT NOT NULL DEFAULT '',
+		sender_name  TEXT NOT NULL DEFAULT '',
+		from_me      BOOLEAN NOT NULL DEFAULT false,
+		timestamp    BIGINT NOT NULL,
+		type         TEXT NOT NULL,
+		text         TEXT NOT NULL DEFAULT '',
+		caption      TEXT NOT NULL DEFAULT '',
+		file_name    TEXT NOT NULL DEFAULT '',
+		mime_type    TEXT NOT NULL DEFAULT '',
+		media_path   TEXT NOT NULL DEFAULT '',
+		edited       BOOLEAN NOT NULL DEFAULT false,
+		source       TEXT NOT NULL,
+		PRIMARY KEY (client_id, chat_jid, id)
+	)`,
+	`CREATE INDEX IF NOT EXISTS aimeow_messages_chat_time_idx ON aimeow_messages (client_id, chat_jid, timestamp)`,
+	`CREATE INDEX IF NOT EXISTS aimeow_messages_id_idx ON aimeow_messages (client_id, id)`,
+}
+
+// aimeowMigration is one version of the aimeow schema
+type aimeowMigration struct {
+	stmts    []string
+	postgres []string // Replaces stmts on PostgreSQL if set
+}
+
+// aimeowMigrations are the versions of the aimeow schema, applied in order. Version 1 creates
+// the tables of unversioned databases with IF NOT EXISTS, so they adopt it unchanged. Released
+// versions must not be edited; schema changes go in a new version.
+var aimeowMigrations = []aimeowMigration{
+	{stmts: aimeowTables},
+	{stmts: clientStateTables},
+	{stmts: messageSearchTables, postgres: postgresSearchTables},
+}
+
+// messageSearchVersion is the schema version that adds the message search index
+const messageSearchVersion = 3
+
+// initAimeowTables brings the aimeow tables up to the latest schema version. Each version is
+// applied in its own transaction together with the recorded version number.
+func initAimeowTables(ctx context.Context, db *sql.DB) error {
+	if _, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS aimeow_version (version INTEGER NOT NULL)`); err != nil {
+		return fmt.Errorf("failed to create aimeow version table: %w", err)
+	}
+	var version int
+	if err := db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM aimeow_version`).Scan(&version); err != nil {
+		return fmt.Errorf("failed to read aimeow schema version: %w", err)
+	}
+	if version > len(aimeowMigrations) {
+		return fmt.Errorf("aimeow schema version %d is newer than this build supports (%d)", version, len(aimeowMigrations))
+	}
+	if dbDialect == dialectSQLite && version < messageSearchVersion && !sqliteHasFTS5(ctx, db) {
+		return fmt.Errorf("SQLite was built without FTS5, which the message search index needs; build aimeow with -tags sqlite_fts5")
+	}
+
+	for ; version < len(aimeowMigrations); version++ {
+		if err := applyAimeowMigration(ctx, db, version+1, aimeowMigrations[version]); err != nil {
+			return err
+		}
+		fmt.Printf("[DB] Upgraded aimeow tables to version %d\n", version+1)
+	}
+	return nil
+}
+
+// applyAimeowMigration runs the statements of one schema version and records it
+func applyAimeowMigration(ctx context.Context, db *sql.DB, version int, migration aimeowMigration) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start migration to version %d: %w", version, err)
+	}
+	defer tx.Rollback()
+
+	stmts := migration.stmts
+	if dbDialect == dialectPostgres && migration.postgres != nil {
+		stmts = migration.postgres
+	}
+	for _, stmt := range stmts {
+		if dbDialect == dialectPostgres {
+			stmt = strings.ReplaceAll(stmt, " BLOB ", " BYTEA ")
+		}
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to migrate aimeow tables to version %d: %w", version, err)
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM aimeow_version`); err != nil {
+		return fmt.Errorf("failed to record aimeow schema version: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO aimeow_version (version) VALUES ($1)`, version); err != nil {
+		return fmt.Errorf("failed to record aimeow schema version: %w", err)
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waCompanionReg"
+	"go.mau.fi/whatsmeow/proto/waWa6"
+	"go.mau.fi/whatsmeow/store"
+	"google.golang.org/protobuf/proto"
+)
+
+// DeviceIdentity is how a client presents itself to the phone when it is linked. It is sent
+// during pairing, so changing it only affects clients that are paired afterwards.
+type DeviceIdentity struct {
+	OSName       string `json:"osName,omitempty"`       // Name shown in the phone's linked devices list
+	PlatformType string `json:"platformType,omitempty"` // chrome, firefox, safari, edge, desktop, ipad, ...; decides the icon
+	BrowserLabel string `json:"browserLabel,omitempty"` // Browser name in the pairing code notification, e.g. Chrome
+}
+
+// normalize lowercases the platform type and fills in a browser label that matches it
+func (d DeviceIdentity) normalize() DeviceIdentity {
+	d.PlatformType = strings.ToLower(strings.TrimSpace(d.PlatformType))
+	if d.BrowserLabel == "" {
+		switch d.PlatformType {
+		case "", "unknown", "chrome":
+			d.BrowserLabel = "Chrome"
+		case "ie":
+			d.BrowserLabel = "IE"
+		default:
+			d.BrowserLabel = strings.ToUpper(d.PlatformType[:1]) + strings.ReplaceAll(d.PlatformType[1:], "_", " ")
+		}
+	}
+	return d
+}
+
+// validate checks that the platform type is known to WhatsApp
+func (d DeviceIdentity) validate() error {
+	if d.PlatformType == "" {
+		return nil
+	}
+	if _, ok := waCompanionReg.DeviceProps_PlatformType_value[strings.ToUpper(d.PlatformType)]; !ok {
+		return fmt.Errorf("unknown platformType %q", d.PlatformType)
+	}
+	return nil
+}
+
+// deviceProps returns the device properties sent during pairing, based on whatsmeow's defaults
+func (d DeviceIdentity) deviceProps() *waCompanionReg.DeviceProps {
+	props := proto.Clone(store.DeviceProps).(*waCompanionReg.DeviceProps)
+	if d.OSName != "" {
+		props.Os = proto.String(d.OSName)
+	}
+	if d.PlatformType != "" {
+		platform := waCompanionReg.DeviceProps_PlatformType(waCompanionReg.DeviceProps_PlatformType_value[strings.ToUpper(d.PlatformType)])
+		props.PlatformType = platform.Enum()
+	}
+	return props
+}
+
+// pairClientType returns the client type reported when requesting a pairing code
+func (d DeviceIdentity) pairClientType() whatsmeow.PairClientType {
+	switch d.PlatformType {
+	case "", "unknown", "chrome":
+		return whatsmeow.PairClientChrome
+	case "edge":
+		return whatsmeow.PairClientEdge
+	case "firefox":
+		return whatsmeow.PairClientFirefox
+	case "ie":
+		return whatsmeow.PairClientIE
+	case "opera":
+		return whatsmeow.PairClientOpera
+	case "safari":
+		return whatsmeow.PairClientSafari
+	case "desktop":
+		return whatsmeow.PairClientElectron
+	case "uwp":
+		return whatsmeow.PairClientUWP
+	}
+	return whatsmeow.PairClientOtherWebClient
+}
+
+// pairDisplayName returns the "Browser (OS)" name WhatsApp requires when requesting a pairing code
+func (d DeviceIdentity) pairDisplayName() string {
+	osName := d.OSName
+	if osName == "" {
+		osName = "Linux"
+	}
+	return fmt.Sprintf("%s (%s)", d.BrowserLabel, osName)
+}
+
+// applyDeviceIdentity makes a client send its own device properties when pairing instead of
+// the package-level store.DeviceProps shared by all clients
+func applyDeviceIdentity(client *whatsmeow.Client, identity DeviceIdentity) {
+	client.GetClientPayload = func() *waWa6.ClientPayload {
+		payload := client.Store.GetClientPayload()
+		if payload.DevicePairingData != nil {
+			props, err := proto.Marshal(identity.deviceProps())
+			if err != nil {
+				fmt.Printf("Warning: Failed to marshal device props: %v\n", err)
+				return payload
+			}
+			payload.DevicePairingData.DeviceProps = props
+		}
+		return payload
+	}
+}
+
+// loadDeviceIdentity returns the stored device identity of a client
+func (cm *ClientManager) loadDeviceIdentity(clientID string) (DeviceIdentity, bool) {
+	var identity DeviceIdentity
+	err := cm.db.QueryRow(`SELECT os_name, platform_type, browser_label FROM aimeow_client_devices WHERE client_id=$1`, clientID).
+		Scan(&identity.OSName, &identity.PlatformType, &identity.BrowserLabel)
+	if err == sql.ErrNoRows {
+		return identity.normalize(), false
+	} else if err != nil {
+		fmt.Printf("Warning: Failed to load device identity for client %s: %v\n", clientID, err)
+		return identity.normalize(), false
+	}
+	return identity.normalize(), true
+}
+
+// saveDeviceIdentity persists the device identity of a client
+func (cm *ClientManager) saveDeviceIdentity(clientID string, identity DeviceIdentity) error {
+	_, err := cm.db.Exec(`INSERT INTO aimeow_client_devices (client_id, os_name, platform_type, browser_label, updated_at) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (client_id) DO UPDATE SET os_name=excluded.os_name, platform_type=excluded.platform_type,
+		browser_label=excluded.browser_label, updated_at=excluded.updated_at`,
+		clientID, identity.OSName, identity.PlatformType, identity.BrowserLabel, time.Now().Unix())
+	if err != nil {
+		return fmt.Errorf("failed to save device identity: %w", err)
+	}
+	return nil
+}
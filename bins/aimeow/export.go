@@ -0,0 +1,421 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// Chat export formats
+const (
+	exportFormatJSON = "json"
+	exportFormatCSV  = "csv"
+	exportFormatTXT  = "txt"
+)
+
+// exportMediaDir is the folder of the media files in an export archive
+const exportMediaDir = "media"
+
+// ExportedMessage is a message in a chat export
+type ExportedMessage struct {
+	StoredMessage
+	Sender    string `json:"sender"`              // Saved, push or business name of the sender, or the phone number
+	MediaFile string `json:"mediaFile,omitempty"` // Path of the media file inside the export archive
+}
+
+// ChatExport is the header of a JSON chat export. The messages follow in the same document.
+type ChatExport struct {
+	Chat       Chat      `json:"chat"`
+	ExportedAt time.Time `json:"exportedAt"`
+}
+
+// transcriptWriter writes the messages of a chat export in one format
+type transcriptWriter interface {
+	writeMessage(m ExportedMessage) error
+	close() error
+}
+
+// jsonTranscript writes {"chat": ..., "exportedAt": ..., "messages": [...]} one message at a time
+type jsonTranscript struct {
+	w     io.Writer
+	count int
+}
+
+func newJSONTranscript(w io.Writer, header ChatExport) (*jsonTranscript, error) {
+	data, err := json.Marshal(header)
+	if err != nil {
+		return nil, err
+	}
+	// Open the header object again to append the messages array
+	if _, err := fmt.Fprintf(w, "%s,\"messages\":[", data[:len(data)-1]); err != nil {
+		return nil, err
+	}
+	return &jsonTranscript{w: w}, nil
+}
+
+func (t *jsonTranscript) writeMessage(m ExportedMessage) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	if t.count > 0 {
+		if _, err := io.WriteString(t.w, ","); err != nil {
+			return err
+		}
+	}
+	t.count++
+	_, err = fmt.Fprintf(t.w, "\n%s", data)
+	return err
+}
+
+func (t *jsonTranscript) close() error {
+	_, err := io.WriteString(t.w, "\n]}\n")
+	return err
+}
+
+// csvTranscript writes one row per message with a header row
+type csvTranscript struct {
+	w   *csv.Writer
+	loc *time.Location
+}
+
+func newCSVTranscript(w io.Writer, loc *time.Location) (*csvTranscript, error) {
+	t := &csvTranscript{w: csv.NewWriter(w), loc: loc}
+	err := t.w.Write([]string{"timestamp", "message_id", "sender", "sender_phone", "from_me", "type",
+		"text", "caption", "file_name", "mime_type", "edited", "media_file", "file_url"})
+	return t, err
+}
+
+func (t *csvTranscript) writeMessage(m ExportedMessage) error {
+	err := t.w.Write([]string{m.Timestamp.In(t.loc).Format(time.RFC3339), m.ID, m.Sender, m.SenderPhone,
+		strconv.FormatBool(m.FromMe), m.Type, m.Text, m.Caption, m.FileName, m.MimeType,
+		strconv.FormatBool(m.Edited), m.MediaFile, m.FileURL})
+	if err != nil {
+		return err
+	}
+	// Flush regularly so large exports stream instead of buffering
+	t.w.Flush()
+	return t.w.Error()
+}
+
+func (t *csvTranscript) close() error {
+	t.w.Flush()
+	return t.w.Error()
+}
+
+// txtTranscript writes the chat like WhatsApp's own "Export chat": "[02/01/2006, 15:04:05] Sender: text"
+type txtTranscript struct {
+	w   io.Writer
+	loc *time.Location
+}
+
+func (t *txtTranscript) writeMessage(m ExportedMessage) error {
+	var body string
+	switch m.Type {
+	case "text", "location", "contact", "poll":
+		body = m.Text
+		if m.Type != "text" {
+			body = fmt.Sprintf("<%s: %s>", m.Type, m.Text)
+		}
+	case "revoked":
+		body = "This message was deleted"
+	default:
+		switch {
+		case m.MediaFile != "":
+			body = fmt.Sprintf("<attached: %s>", m.MediaFile)
+		case m.FileName != "":
+			body = fmt.Sprintf("%s <%s omitted>", m.FileName, m.Type)
+		default:
+			body = fmt.Sprintf("<%s omitted>", strings.ReplaceAll(m.Type, "_", " "))
+		}
+		if m.Caption != "" {
+			body += " " + m.Caption
+		}
+	}
+	if m.Edited {
+		body += " <This message was edited>"
+	}
+	_, err := fmt.Fprintf(t.w, "[%s] %s: %s\n", m.Timestamp.In(t.loc).Format("02/01/2006, 15:04:05"), m.Sender, body)
+	return err
+}
+
+func (t *txtTranscript) close() error {
+	return nil
+}
+
+// exportSenders resolves the display names of message senders, once per sender
+type exportSenders struct {
+	client *WhatsAppClient
+	names  map[string]string
+}
+
+// name returns the saved, push or business name of the sender, falling back to the name the
+// sender had when the message was stored and then to the phone number
+func (s *exportSenders) name(ctx context.Context, m StoredMessage) string {
+	if m.FromMe {
+		if s.client.deviceStore.PushName != "" {
+			return s.client.deviceStore.PushName
+		}
+		return "You"
+	}
+	name, ok := s.names[m.SenderJID]
+	if !ok {
+		if jid, err := types.ParseJID(m.SenderJID); err == nil && s.client.deviceStore.Contacts != nil {
+			if info, err := s.client.deviceStore.Contacts.GetContact(ctx, jid); err == nil && info.Found {
+				name = newContact(jid, info).Name
+			}
+		}
+		s.names[m.SenderJID] = name
+	}
+	switch {
+	case name != "":
+		return name
+	case m.SenderName != "":
+		return m.SenderName
+	case m.SenderPhone != "":
+		return m.SenderPhone
+	}
+	return m.SenderJID
+}
+
+// exportMediaPath returns the file of a stored message that can go into an export archive.
+// Only files in the client's own media folder are bundled.
+func exportMediaPath(clientID string, m StoredMessage) (string, bool) {
+	if m.mediaPath == "" || m.Type == "revoked" {
+		return "", false
+	}
+	clientDir, err := filepath.Abs(filepath.Join(dataDir, "files", clientID))
+	if err != nil {
+		return "", false
+	}
+	path, err := filepath.Abs(m.mediaPath)
+	if err != nil || !strings.HasPrefix(path, clientDir+string(filepath.Separator)) {
+		return "", false
+	}
+	if info, err := os.Stat(path); err != nil || !info.Mode().IsRegular() {
+		return "", false
+	}
+	return path, true
+}
+
+// @Summary Export chat
+// @Description Streams the stored messages of a chat, oldest first, with sender names, timestamps and message types. format=json returns the chat and its messages, csv one row per message and txt a transcript like WhatsApp's own chat export. With media=true the transcript and the downloaded media files are returned together as a zip archive.
+// @Tags chats
+// @Produce json
+// @Produce text/csv
+// @Produce plain
+// @Produce application/zip
+// @Param id path string true "Client ID"
+// @Param jid path string true "Chat JID (group or user), LID or phone number"
+// @Param format query string false "Export format" Enums(json, csv, txt) default(json)
+// @Param media query bool false "Bundle the transcript and media files into a zip archive" default(false)
+// @Param timezone query string false "IANA timezone for csv and txt timestamps" default(UTC)
+// @Param before query string false "Only messages before this time (RFC3339 or Unix seconds)"
+// @Param after query string false "Only messages after this time (RFC3339 or Unix seconds)"
+// @Success 200 {file} file "Chat export"
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /clients/{id}/chats/{jid}/export [get]
+func exportChat(c *gin.Context) {
+	clientID := c.Param("id")
+	waClient, err := manager.getClient(clientID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	jid, _, err := waClient.parseRecipient(c.Param("jid"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	format := strings.ToLower(c.DefaultQuery("format", exportFormatJSON))
+	if format != exportFormatJSON && format != exportFormatCSV && format != exportFormatTXT {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be json, csv or txt"})
+		return
+	}
+	withMedia, err := parseBoolParam(c, "media")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	timezone := c.DefaultQuery("timezone", "UTC")
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid timezone %q", timezone)})
+		return
+	}
+
+	ctx := c.Request.Context()
+	candidates := manager.chatJIDCandidates(ctx, waClient, jid.ToNonAD())
+	args := []interface{}{clientID}
+	for _, candidate := range candidates {
+		args = append(args, candidate)
+	}
+	inCandidates := `IN (` + inPlaceholders(2, len(candidates)) + `)`
+
+	chat := Chat{JID: manager.canonicalChatJID(ctx, waClient, jid).String()}
+	var mutedUntil, lastMessageAt int64
+	err = manager.db.QueryRowContext(ctx, `SELECT jid, name, unread_count, archived, pinned, muted_until, last_message_at
+		FROM aimeow_chats WHERE client_id=$1 AND jid `+inCandidates+` ORDER BY last_message_at DESC LIMIT 1`, args...).
+		Scan(&chat.JID, &chat.Name, &chat.UnreadCount, &chat.Archived, &chat.Pinned, &mutedUntil, &lastMessageAt)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "chat not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to load chat: %v", err)})
+		return
+	}
+	if lastMessageAt > 0 {
+		t := time.Unix(lastMessageAt, 0).UTC()
+		chat.LastMessageAt = &t
+	}
+	manager.fillChatDetails(ctx, waClient, clientID, &chat)
+
+	condition := `client_id=$1 AND chat_jid ` + inCandidates
+	for _, bound := range []struct{ param, condition string }{
+		{"before", "timestamp < $%d"},
+		{"after", "timestamp > $%d"},
+	} {
+		t, err := parseTimeParam(c, bound.param)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if t != nil {
+			args = append(args, t.Unix())
+			condition += " AND " + fmt.Sprintf(bound.condition, len(args))
+		}
+	}
+
+	rows, err := manager.db.QueryContext(ctx, `SELECT `+storedMessageColumns+` FROM aimeow_messages WHERE `+condition+`
+		ORDER BY timestamp ASC, id ASC`, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to list messages: %v", err)})
+		return
+	}
+	defer rows.Close()
+
+	// From here on the export is streamed, so errors can only be logged
+	name := fmt.Sprintf("chat-%s-%s", jid.User, time.Now().In(loc).Format("20060102-150405"))
+	out := io.Writer(c.Writer)
+	var archive *zip.Writer
+	if withMedia != nil && *withMedia {
+		c.Header("Content-Type", "application/zip")
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.zip"`, name))
+		archive = zip.NewWriter(c.Writer)
+		out, err = archive.Create("chat." + format)
+		if err != nil {
+			fmt.Printf("[Export] Failed to start archive for chat %s: %v\n", chat.JID, err)
+			return
+		}
+	} else {
+		c.Header("Content-Type", map[string]string{
+			exportFormatJSON: "application/json; charset=utf-8",
+			exportFormatCSV:  "text/csv; charset=utf-8",
+			exportFormatTXT:  "text/plain; charset=utf-8",
+		}[format])
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, name, format))
+	}
+	c.Status(http.StatusOK)
+
+	var transcript transcriptWriter
+	switch format {
+	case exportFormatJSON:
+		transcript, err = newJSONTranscript(out, ChatExport{Chat: chat, ExportedAt: time.Now().UTC()})
+	case exportFormatCSV:
+		transcript, err = newCSVTranscript(out, loc)
+	default:
+		transcript = &txtTranscript{w: out, loc: loc}
+	}
+	if err != nil {
+		fmt.Printf("[Export] Failed to write chat %s: %v\n", chat.JID, err)
+		return
+	}
+
+	senders := &exportSenders{client: waClient, names: make(map[string]string)}
+	media := make(map[string]string) // Archive path -> file on disk
+	count := 0
+	for rows.Next() {
+		m, err := scanStoredMessage(rows, clientID)
+		if err != nil {
+			fmt.Printf("[Export] Failed to read message of chat %s: %v\n", chat.JID, err)
+			return
+		}
+		exported := ExportedMessage{StoredMessage: m, Sender: senders.name(ctx, m)}
+		if archive != nil {
+			if path, ok := exportMediaPath(clientID, m); ok {
+				exported.MediaFile = exportMediaDir + "/" + filepath.Base(path)
+				media[exported.MediaFile] = path
+			}
+		}
+		if err := transcript.writeMessage(exported); err != nil {
+			fmt.Printf("[Export] Failed to write chat %s: %v\n", chat.JID, err)
+			return
+		}
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		fmt.Printf("[Export] Failed to read messages of chat %s: %v\n", chat.JID, err)
+		return
+	}
+	if err := transcript.close(); err != nil {
+		fmt.Printf("[Export] Failed to write chat %s: %v\n", chat.JID, err)
+		return
+	}
+
+	if archive != nil {
+		for archivePath, path := range media {
+			if err := addFileToArchive(archive, archivePath, path); err != nil {
+				fmt.Printf("[Export] Failed to add %s to export of chat %s: %v\n", path, chat.JID, err)
+				return
+			}
+		}
+		if err := archive.Close(); err != nil {
+			fmt.Printf("[Export] Failed to finish archive for chat %s: %v\n", chat.JID, err)
+			return
+		}
+	}
+	fmt.Printf("[Export] Exported %d messages and %d media files of chat %s for client %s as %s\n",
+		count, len(media), chat.JID, clientID, format)
+}
+
+// addFileToArchive copies a file into a zip archive
+func addFileToArchive(archive *zip.Writer, name string, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	header.Method = zip.Deflate
+	w, err := archive.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, file)
+	return err
+}
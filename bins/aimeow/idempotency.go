@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Header carrying the client-chosen key that makes a send request safe to retry
+const idempotencyKeyHeader = "Idempotency-Key"
+
+// Keys whose first request is still being handled, as clientID + key
+var idempotencyInFlight sync.Map
+
+// responseRecorder captures the response body so it can be stored for replays
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// idempotent wraps a send handler so that a repeated Idempotency-Key returns the stored
+// response instead of sending again. Requests without the header are passed through.
+func idempotent(handler gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(idempotencyKeyHeader)
+		if key == "" {
+			handler(c)
+			return
+		}
+		clientID := c.Param("id")
+
+		body, err := c.GetRawData()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		hash := sha256.New()
+		hash.Write([]byte(c.Request.Method + " " + c.FullPath() + "\n"))
+		hash.Write(body)
+		requestHash := hex.EncodeToString(hash.Sum(nil))
+
+		if replayed := replayIdempotentResponse(c, clientID, key, requestHash); replayed {
+			return
+		}
+
+		inFlightKey := clientID + "\x00" + key
+		if _, busy := idempotencyInFlight.LoadOrStore(inFlightKey, true); busy {
+			c.JSON(http.StatusConflict, gin.H{"error": "a request with this Idempotency-Key is still in progress"})
+			return
+		}
+		defer idempotencyInFlight.Delete(inFlightKey)
+
+		// The first request may have finished between the lookup and taking the in-flight slot
+		if replayed := replayIdempotentResponse(c, clientID, key, requestHash); replayed {
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		handler(c)
+
+		// Only successful outcomes are remembered; failed sends may be retried with the same key
+		status := recorder.Status()
+		if status < 200 || status >= 300 {
+			return
+		}
+		if err := manager.storeIdempotentResponse(clientID, key, requestHash, status, recorder.body.Bytes()); err != nil {
+			fmt.Printf("Warning: Failed to store idempotent response for key %s: %v\n", key, err)
+		}
+	}
+}
+
+// replayIdempotentResponse writes the stored response for a key and reports whether it did so
+func replayIdempotentResponse(c *gin.Context, clientID string, key string, requestHash string) bool {
+	var storedHash string
+	var status int
+	var response []byte
+	err := manager.db.QueryRow(`SELECT request_hash, status, response FROM aimeow_idempotency_keys
+		WHERE client_id=$1 AND idempotency_key=$2 AND expires_at>$3`, clientID, key, time.Now().Unix()).
+		Scan(&storedHash, &status, &response)
+	if err == sql.ErrNoRows {
+		return false
+	} else if err != nil {
+		fmt.Printf("Warning: Failed to look up Idempotency-Key %s: %v\n", key, err)
+		return false
+	}
+
+	if storedHash != requestHash {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Idempotency-Key was already used for a different request"})
+		return true
+	}
+
+	fmt.Printf("[Idempotency] Replaying stored response for key %s (client %s)\n", key, clientID)
+	c.Header("Idempotent-Replayed", "true")
+	c.Data(status, "application/json; charset=utf-8", response)
+	return true
+}
+
+// storeIdempotentResponse remembers a response for the idempotency window and drops expired keys
+func (cm *ClientManager) storeIdempotentResponse(clientID string, key string, requestHash string, status int, response []byte) error {
+	now := time.Now()
+	if _, err := cm.db.Exec(`DELETE FROM aimeow_idempotency_keys WHERE expires_at<=$1`, now.Unix()); err != nil {
+		return fmt.Errorf("failed to purge expired keys: %w", err)
+	}
+	_, err := cm.db.Exec(`INSERT INTO aimeow_idempotency_keys (client_id, idempotency_key, request_hash, status, response, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		clientID, key, requestHash, status, response, now.Unix(), now.Add(time.Duration(appConfig().Clients.IdempotencyTTL)).Unix())
+	return err
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// Maximum number of JIDs in one bulk resolve request
+const maxBulkResolve = 500
+
+// Where a LID mapping came from
+const (
+	lidSourceCache   = "cache"
+	lidSourceStore   = "store"
+	lidSourceUsync   = "usync"
+	lidSourceMessage = "message"
+	lidSourceHistory = "history"
+)
+
+// ResolveResult is the outcome of resolving a LID or phone number JID
+type ResolveResult struct {
+	JID      string `json:"jid"`              // The JID that was resolved
+	LID      string `json:"lid,omitempty"`    // Hidden user JID, e.g. 123456789@lid
+	Phone    string `json:"phone,omitempty"`  // Phone number without +
+	Resolved bool   `json:"resolved"`         // Both the LID and the phone number are known
+	Source   string `json:"source,omitempty"` // cache, store, usync or message
+	Error    string `json:"error,omitempty"`
+}
+
+type BulkResolveRequest struct {
+	JIDs []string `json:"jids" binding:"required,min=1"`
+}
+
+type BulkResolveResponse struct {
+	Results []ResolveResult `json:"results"`
+}
+
+// parseUserJID parses a LID or phone number JID. Bare numbers are normalized as phone numbers.
+func (c *WhatsAppClient) parseUserJID(s string) (types.JID, error) {
+	jid, _, err := c.parseRecipient(s)
+	if err != nil {
+		return types.JID{}, err
+	}
+	jid = jid.ToNonAD()
+	if jid.Server != types.HiddenUserServer && jid.Server != types.DefaultUserServer {
+		return types.JID{}, fmt.Errorf("%s is not a user JID", jid)
+	}
+	return jid, nil
+}
+
+// lidPNPair returns the LID and phone number JIDs if a and b are one of each
+func lidPNPair(a, b types.JID) (lid types.JID, pn types.JID, ok bool) {
+	a, b = a.ToNonAD(), b.ToNonAD()
+	switch {
+	case a.Server == types.HiddenUserServer && b.Server == types.DefaultUserServer:
+		return a, b, true
+	case a.Server == types.DefaultUserServer && b.Server == types.HiddenUserServer:
+		return b, a, true
+	}
+	return types.JID{}, types.JID{}, false
+}
+
+// resolvedPair fills a result from a known LID and phone number pair
+func resolvedPair(result ResolveResult, lid types.JID, pn types.JID, source string) ResolveResult {
+	result.LID = lid.String()
+	result.Phone = pn.User
+	result.Resolved = true
+	result.Source = source
+	return result
+}
+
+// lookupLID resolves a JID from the aimeow cache and whatsmeow's LID store. It reports false if
+// nothing is known yet and the miss isn't cached either; a cached miss is rechecked in the store.
+func (cm *ClientManager) lookupLID(ctx context.Context, client *WhatsAppClient, jid types.JID) (ResolveResult, bool) {
+	isLID := jid.Server == types.HiddenUserServer
+	result := ResolveResult{JID: jid.String()}
+	if isLID {
+		result.LID = jid.String()
+	} else {
+		result.Phone = jid.User
+	}
+
+	// aimeow cache. A negative entry only applies once whatsmeow's LID store has been checked,
+	// which may have learned the mapping since.
+	var alt string
+	var expiresAt sql.NullInt64
+	cachedMiss := false
+	err := cm.db.QueryRowContext(ctx, `SELECT alt_jid, expires_at FROM aimeow_lid_cache WHERE jid=$1`, jid.String()).Scan(&alt, &expiresAt)
+	if err == nil {
+		if alt != "" {
+			if altJID, err := types.ParseJID(alt); err == nil {
+				if isLID {
+					return resolvedPair(result, jid, altJID, lidSourceCache), true
+				}
+				return resolvedPair(result, altJID, jid, lidSourceCache), true
+			}
+		} else {
+			cachedMiss = expiresAt.Valid && expiresAt.Int64 > time.Now().Unix()
+		}
+	} else if err != sql.ErrNoRows {
+		fmt.Printf("[LID] Failed to read cache for %s: %v\n", jid, err)
+	}
+	if cachedMiss {
+		result.Source = lidSourceCache
+	}
+
+	// whatsmeow's LID store, which learns mappings from incoming messages, history syncs and
+	// usync queries. Devices that were never paired don't have one yet. A mapping found here
+	// replaces the negative entry in the aimeow cache.
+	if client.deviceStore.LIDs == nil {
+		return result, cachedMiss
+	}
+	var altJID types.JID
+	if isLID {
+		altJID, err = client.deviceStore.LIDs.GetPNForLID(ctx, jid)
+	} else {
+		altJID, err = client.deviceStore.LIDs.GetLIDForPN(ctx, jid)
+	}
+	if err != nil {
+		fmt.Printf("[LID] Failed to look up %s in the LID store: %v\n", jid, err)
+	} else if !altJID.IsEmpty() {
+		if isLID {
+			cm.cacheLIDMapping(ctx, jid, altJID, lidSourceStore)
+			return resolvedPair(result, jid, altJID, lidSourceStore), true
+		}
+		cm.cacheLIDMapping(ctx, altJID, jid, lidSourceStore)
+		return resolvedPair(result, altJID, jid, lidSourceStore), true
+	}
+	return result, cachedMiss
+}
+
+// resolveJIDs finds the other half of LID or phone number JIDs. It checks the aimeow cache, then
+// whatsmeow's LID store and, with allowNetwork set, asks the server about the remaining phone
+// numbers in one query. Lookups that find nothing are cached for clients.lidNegativeTtl.
+func (cm *ClientManager) resolveJIDs(ctx context.Context, client *WhatsAppClient, jids []types.JID, allowNetwork bool) []ResolveResult {
+	results := make([]ResolveResult, len(jids))
+	pending := make(map[types.JID][]int)
+	var queryJIDs []types.JID
+	for i, jid := range jids {
+		jid = jid.ToNonAD()
+		result, done := cm.lookupLID(ctx, client, jid)
+		results[i] = result
+		if done {
+			continue
+		}
+		if _, seen := pending[jid]; !seen && jid.Server == types.DefaultUserServer {
+			queryJIDs = append(queryJIDs, jid)
+		}
+		pending[jid] = append(pending[jid], i)
+	}
+	if len(pending) == 0 {
+		return results
+	}
+
+	// The server only reveals LIDs for phone numbers, not the other way around
+	var queryErr string
+	if allowNetwork && len(queryJIDs) > 0 && !client.connected() {
+		queryErr = "client is not connected"
+	} else if allowNetwork && len(queryJIDs) > 0 {
+		info, err := client.client.GetUserInfo(ctx, queryJIDs)
+		if err != nil {
+			queryErr = fmt.Sprintf("user info query failed: %v", err)
+		}
+		for jid, user := range info {
+			indexes, ok := pending[jid]
+			if !ok || user.LID.Server != types.HiddenUserServer {
+				continue
+			}
+			cm.cacheLIDMapping(ctx, user.LID, jid, lidSourceUsync)
+			for _, i := range indexes {
+				results[i] = resolvedPair(results[i], user.LID, jid, lidSourceUsync)
+			}
+			delete(pending, jid)
+		}
+	}
+
+	// Remember the misses so repeated lookups don't hit the stores or the server. A phone number
+	// the server couldn't be asked about isn't a miss, so it is not cached.
+	now := time.Now()
+	for jid, indexes := range pending {
+		if jid.Server == types.DefaultUserServer && (!allowNetwork || queryErr != "") {
+			for _, i := range indexes {
+				results[i].Error = queryErr
+			}
+			continue
+		}
+		_, err := cm.db.ExecContext(ctx, `INSERT INTO aimeow_lid_cache (jid, alt_jid, source, updated_at, expires_at) VALUES ($1, '', '', $2, $3)
+			ON CONFLICT (jid) DO UPDATE SET alt_jid='', source='', updated_at=excluded.updated_at, expires_at=excluded.expires_at`,
+			jid.String(), now.Unix(), now.Add(time.Duration(appConfig().Clients.LIDNegativeTTL)).Unix())
+		if err != nil {
+			fmt.Printf("[LID] Failed to cache miss for %s: %v\n", jid, err)
+		}
+	}
+	return results
+}
+
+// resolveJID resolves a single JID, see resolveJIDs
+func (cm *ClientManager) resolveJID(ctx context.Context, client *WhatsAppClient, jid types.JID, allowNetwork bool) ResolveResult {
+	return cm.resolveJIDs(ctx, client, []types.JID{jid}, allowNetwork)[0]
+}
+
+// cacheLIDMapping stores a LID and phone number pair in both directions and reports whether
+// either side was previously cached as unresolved
+func (cm *ClientManager) cacheLIDMapping(ctx context.Context, lid types.JID, pn types.JID, source string) bool {
+	var unresolved int
+	err := cm.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM aimeow_lid_cache WHERE jid IN ($1, $2) AND alt_jid=''`,
+		lid.String(), pn.String()).Scan(&unresolved)
+	if err != nil {
+		fmt.Printf("[LID] Failed to read cache for %s: %v\n", lid, err)
+	}
+
+	now := time.Now().Unix()
+	for _, pair := range [][2]string{{lid.String(), pn.String()}, {pn.String(), lid.String()}} {
+		_, err := cm.db.ExecContext(ctx, `INSERT INTO aimeow_lid_cache (jid, alt_jid, source, updated_at, expires_at) VALUES ($1, $2, $3, $4, NULL)
+			ON CONFLICT (jid) DO UPDATE SET alt_jid=excluded.alt_jid, source=excluded.source, updated_at=excluded.updated_at, expires_at=NULL`,
+			pair[0], pair[1], source, now)
+		if err != nil {
+			fmt.Printf("[LID] Failed to cache mapping %s -> %s: %v\n", pair[0], pair[1], err)
+		}
+	}
+	return unresolved > 0
+}
+
+// learnLIDMapping records a mapping seen on an incoming message and sends a lid_resolved
+// webhook if that LID or phone number was looked up before without success
+func (cm *ClientManager) learnLIDMapping(client *WhatsAppClient, lid types.JID, pn types.JID) {
+	ctx := context.Background()
+
+	var known string
+	err := cm.db.QueryRowContext(ctx, `SELECT alt_jid FROM aimeow_lid_cache WHERE jid=$1`, lid.String()).Scan(&known)
+	if err == nil && known == pn.String() {
+		return
+	}
+
+	if cm.cacheLIDMapping(ctx, lid, pn, lidSourceMessage) {
+		fmt.Printf("[LID] Learned previously unresolved mapping %s -> %s\n", lid, pn)
+		cm.sendConnectionStatusWebhook(client.id, "lid_resolved", map[string]interface{}{
+			"lid":    lid.String(),
+			"phone":  pn.User,
+			"source": lidSourceMessage,
+		})
+	}
+}
+
+// @Summary Resolve LID or phone number
+// @Description Resolves a hidden user JID (123@lid) to its phone number, or a phone number to its LID. Results are cached; lookups that find nothing are cached for LID_NEGATIVE_TTL.
+// @Tags contacts
+// @Accept json
+// @Produce json
+// @Param id path string true "Client ID"
+// @Param jid path string true "LID (123@lid), phone JID (628...@s.whatsapp.net) or phone number in international or national format"
+// @Success 200 {object} ResolveResult
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /clients/{id}/resolve/{jid} [get]
+func resolveJID(c *gin.Context) {
+	waClient, err := manager.getClient(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	jid, err := waClient.parseUserJID(c.Param("jid"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, manager.resolveJID(c.Request.Context(), waClient, jid, true))
+}
+
+// @Summary Resolve LIDs and phone numbers in bulk
+// @Description Resolves up to 500 LIDs or phone numbers. Invalid entries get an error in their result instead of failing the request.
+// @Tags contacts
+// @Accept json
+// @Produce json
+// @Param id path string true "Client ID"
+// @Param request body BulkResolveRequest true "JIDs to resolve"
+// @Success 200 {object} BulkResolveResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /clients/{id}/resolve [post]
+func bulkResolveJIDs(c *gin.Context) {
+	waClient, err := manager.getClient(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	var req BulkResolveRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(req.JIDs) > maxBulkResolve {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("at most %d JIDs can be resolved at once", maxBulkResolve)})
+		return
+	}
+
+	// Parse everything first so valid JIDs can be resolved with a single server query
+	response := BulkResolveResponse{Results: make([]ResolveResult, len(req.JIDs))}
+	var jids []types.JID
+	var indexes []int
+	for i, raw := range req.JIDs {
+		jid, err := waClient.parseUserJID(raw)
+		if err != nil {
+			response.Results[i] = ResolveResult{JID: raw, Error: err.Error()}
+			continue
+		}
+		jids = append(jids, jid)
+		indexes = append(indexes, i)
+	}
+	for n, result := range manager.resolveJIDs(c.Request.Context(), waClient, jids, true) {
+		response.Results[indexes[n]] = result
+	}
+
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// statusEvent is a status webhook queued while a lifecycle operation runs
+type statusEvent struct {
+	event string
+	data  map[string]interface{}
+}
+
+// sendStatusEvents delivers queued status webhooks in order, in the webhook schema version the
+// client had before it was removed
+func (cm *ClientManager) sendStatusEvents(clientID string, version int, events []statusEvent) {
+	for _, e := range events {
+		cm.sendStatusWebhook(clientID, version, e.event, e.data)
+	}
+}
+
+// RemoveClientResponse reports what a logout or delete did
+type RemoveClientResponse struct {
+	Message  string `json:"message"`
+	Unlinked bool   `json:"unlinked"` // The phone was told to unlink this device
+	Error    string `json:"error,omitempty"`
+}
+
+// removeClient unlinks the device from the phone and removes the stored session, ID mapping,
+// pending entry and media of a client. With purge set, its metadata, settings, device identity,
+// scheduled messages, broadcasts and idempotency keys are removed as well.
+func (cm *ClientManager) removeClient(clientID string, waClient *WhatsAppClient, purge bool) RemoveClientResponse {
+	events := []statusEvent{{event: "logging_out", data: map[string]interface{}{}}}
+	version := cm.webhookVersion(waClient)
+	result := RemoveClientResponse{}
+
+	// Stop pending typing timers so they don't fire on a removed client
+	waClient.mutex.Lock()
+	for chatID, timer := range waClient.typingTimers {
+		timer.Stop()
+		delete(waClient.typingTimers, chatID)
+	}
+	waClient.mutex.Unlock()
+
+	// Unlink from the phone; if that's impossible (e.g. offline) still drop the local session
+	if waClient.deviceStore.ID != nil {
+		if err := waClient.client.Logout(context.Background()); err != nil {
+			fmt.Printf("Logout request failed for client %s, removing session locally: %v\n", clientID, err)
+			result.Error = fmt.Sprintf("Failed to unlink device from phone: %v", err)
+			waClient.client.Disconnect()
+			if waClient.deviceStore.ID != nil {
+				if err := waClient.deviceStore.Delete(context.Background()); err != nil {
+					fmt.Printf("Warning: Failed to delete session for client %s: %v\n", clientID, err)
+				}
+			}
+		} else {
+			result.Unlinked = true
+		}
+	} else {
+		waClient.client.Disconnect()
+	}
+
+	waClient.mutex.Lock()
+	cm.cancelReconnectLocked(waClient)
+	cm.setStateLocked(waClient, StateLoggedOut, "logout requested")
+	waClient.qrCode = ""
+	waClient.mutex.Unlock()
+
+	events = append(events, statusEvent{event: "logged_out", data: map[string]interface{}{
+		"unlinked": result.Unlinked,
+	}})
+
+	// Remove the ID mapping and pending entry so the client doesn't come back after a restart
+	cm.mutex.Lock()
+	for whatsappID, id := range cm.clientIDMap {
+		if id == clientID {
+			delete(cm.clientIDMap, whatsappID)
+		}
+	}
+	if purge {
+		delete(cm.clientMetadata, clientID)
+	}
+	delete(cm.pendingClients, clientID)
+	delete(cm.clients, clientID)
+	cm.mutex.Unlock()
+
+	if err := cm.deleteClientState(clientID, purge); err != nil {
+		fmt.Printf("Warning: Failed to remove client state: %v\n", err)
+	}
+	events = append(events, statusEvent{event: "session_removed", data: map[string]interface{}{}})
+
+	// Remove downloaded media
+	clientDir := filepath.Join(dataDir, "files", clientID)
+	if err := os.RemoveAll(clientDir); err != nil {
+		fmt.Printf("Warning: Failed to remove media for client %s: %v\n", clientID, err)
+	} else {
+		events = append(events, statusEvent{event: "media_removed", data: map[string]interface{}{}})
+	}
+
+	if purge {
+		for _, table := range []string{"aimeow_client_settings", "aimeow_client_devices", "aimeow_scheduled_messages", "aimeow_broadcasts", "aimeow_idempotency_keys", "aimeow_chats", "aimeow_messages"} {
+			if _, err := cm.db.Exec(`DELETE FROM `+table+` WHERE client_id=$1`, clientID); err != nil {
+				fmt.Printf("Warning: Failed to remove %s rows for client %s: %v\n", table, clientID, err)
+			}
+		}
+		events = append(events, statusEvent{event: "deleted", data: map[string]interface{}{}})
+	}
+
+	fmt.Printf("Removed client %s (unlinked: %v, purge: %v)\n", clientID, result.Unlinked, purge)
+	go cm.sendStatusEvents(clientID, version, events)
+	return result
+}
+
+// @Summary Log out client
+// @Description Unlinks the device from the phone and removes the stored session, ID mapping, pending entry and media. Settings are kept so the client ID can be paired again.
+// @Tags clients
+// @Accept json
+// @Produce json
+// @Param id path string true "Client ID"
+// @Success 200 {object} RemoveClientResponse
+// @Failure 404 {object} map[string]string
+// @Router /clients/{id}/logout [post]
+func logoutClient(c *gin.Context) {
+	clientID := c.Param("id")
+
+	waClient, err := manager.getClient(clientID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	result := manager.removeClient(clientID, waClient, false)
+	result.Message = "client logged out successfully"
+	c.JSON(http.StatusOK, result)
+}
+
+// @Summary Reconnect client
+// @Description Re-establishes the connection of a paired client whose session dropped
+// @Tags clients
+// @Accept json
+// @Produce json
+// @Param id path string true "Client ID"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /clients/{id}/reconnect [post]
+func reconnectClient(c *gin.Context) {
+	clientID := c.Param("id")
+
+	waClient, err := manager.getClient(clientID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	if waClient.deviceStore.ID == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "client is not paired; scan the QR code first"})
+		return
+	}
+
+	go manager.sendConnectionStatusWebhook(clientID, "reconnecting", map[string]interface{}{})
+
+	// Drop the old socket so Connect starts from a clean state
+	waClient.client.Disconnect()
+	waClient.mutex.Lock()
+	manager.cancelReconnectLocked(waClient)
+	now := time.Now()
+	waClient.reconnect.LastAttemptAt = &now
+	manager.setStateLocked(waClient, StateReconnecting, "manual")
+	waClient.mutex.Unlock()
+
+	if err := waClient.client.Connect(); err != nil {
+		manager.setState(waClient, StateDisconnected, fmt.Sprintf("reconnect failed: %v", err))
+		go manager.sendConnectionStatusWebhook(clientID, "reconnect_failed", map[string]interface{}{
+			"error": err.Error(),
+		})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to reconnect: %v", err)})
+		return
+	}
+
+	fmt.Printf("Reconnect started for client %s\n", clientID)
+	c.JSON(http.StatusOK, gin.H{"message": "client reconnecting"})
+}
+
+// @Summary Disconnect client
+// @Description Closes the connection of a client but keeps its session so it can be reconnected later
+// @Tags clients
+// @Accept json
+// @Produce json
+// @Param id path string true "Client ID"
+// @Success 200 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /clients/{id}/disconnect [post]
+func disconnectClient(c *gin.Context) {
+	clientID := c.Param("id")
+
+	waClient, err := manager.getClient(clientID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Disconnect doesn't emit an event, so update the state here
+	waClient.client.Disconnect()
+	waClient.mutex.Lock()
+	manager.cancelReconnectLocked(waClient)
+	manager.setStateLocked(waClient, StateDisconnected, "manual")
+	waClient.mutex.Unlock()
+
+	go manager.sendConnectionStatusWebhook(clientID, "disconnected", map[string]interface{}{
+		"reason": "manual",
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "client disconnected"})
+}
@@ -1,15 +1,18 @@
 package main
 
 import (
-	"bytes"
 	"context"
+	"database/sql"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"html"
 	"io"
 	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -17,6 +20,7 @@ import (
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	"github.com/google/uuid"
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/mdp/qrterminal/v3"
@@ -55,29 +59,34 @@ func getBaseURL(c *gin.Context) string {
 }
 
 type WhatsAppClient struct {
-	client       *whatsmeow.Client
-	deviceStore  *store.Device
-	isConnected  bool
-	qrCode       string
-	connectedAt  *time.Time
-	messages     []string
-	images       map[string]string      // image_id -> file_path
-	osName       string                 // OS name to set after connection
-	typingTimers map[string]*time.Timer // chat_id -> typing timer
-	typingActive map[string]bool        // chat_id -> is currently typing
-	mutex        sync.RWMutex
+	id             string // Client ID used by the API and webhooks
+	client         whatsAppTransport
+	deviceStore    *store.Device
+	status         ConnectionStatus // Connection state with when and why it was entered
+	qrCode         string
+	connectedAt    *time.Time
+	messages       []string
+	images         map[string]string      // image_id -> file_path
+	device         DeviceIdentity         // OS name, platform and browser presented to the phone
+	typingTimers   map[string]*time.Timer // chat_id -> typing timer
+	typingActive   map[string]bool        // chat_id -> is currently typing
+	settings       ClientSettings         // Automatic read receipt and typing behaviour
+	reconnect      ReconnectStats         // Automatic reconnect counters
+	reconnectTimer *time.Timer            // Pending reconnect attempt, if any
+	mutex          sync.RWMutex
 }
 
 type ClientManager struct {
-	clients            map[string]*WhatsAppClient
-	container          *sqlstore.Container
-	callbackURL        string
-	configPath         string                   // Path to configuration file
-	clientIDMap        map[string]string        // Maps WhatsApp device ID -> UUID
-	clientMapPath      string                   // Path to client ID mapping file
-	pendingClients     map[string]PendingClient // Maps clientID -> PendingClient
-	pendingClientsPath string                   // Path to pending clients file
-	mutex              sync.RWMutex
+	clients          map[string]*WhatsAppClient
+	container        *sqlstore.Container
+	db               *sql.DB // Shared database handle for aimeow tables
+	callbackURL      string
+	clientIDMap      map[string]string         // Maps WhatsApp device ID -> UUID
+	pendingClients   map[string]PendingClient  // Maps clientID -> PendingClient
+	broadcastRunners map[string]bool           // Broadcast IDs with an active worker
+	clientMetadata   map[string]ClientMetadata // Maps clientID -> tenant, labels and metadata
+	skippedClients   map[string]bool           // Client IDs of stored sessions of the other mode (sandbox or real), not loaded
+	mutex            sync.RWMutex
 }
 
 // Config represents the persistent configuration
@@ -85,11 +94,6 @@ type Config struct {
 	CallbackURL string `json:"callbackUrl"`
 }
 
-// ClientIDMapping represents the persistent mapping of WhatsApp IDs to UUIDs
-type ClientIDMapping struct {
-	Mappings map[string]string `json:"mappings"` // WhatsApp device ID -> UUID
-}
-
 // PendingClient represents a client that was created but hasn't connected yet
 type PendingClient struct {
 	ClientID string `json:"clientId"` // The custom ID (projectId)
@@ -97,211 +101,41 @@ type PendingClient struct {
 	Created  int64  `json:"created"` // Unix timestamp
 }
 
-// PendingClients represents the persistent storage of pending clients
-type PendingClients struct {
-	Clients map[string]PendingClient `json:"clients"` // clientID -> PendingClient
-}
-
 var manager *ClientManager
 var baseURL string // Base URL for generating file URLs in webhooks
 var dataDir string // Data directory for storing files and database
 
-func NewClientManager(container *sqlstore.Container, configPath string) *ClientManager {
-	// Derive client map path from config path
-	configDir := filepath.Dir(configPath)
-	clientMapPath := filepath.Join(configDir, "client_mappings.json")
-	pendingClientsPath := filepath.Join(configDir, "pending_clients.json")
-
+func NewClientManager(container *sqlstore.Container, db *sql.DB) *ClientManager {
 	cm := &ClientManager{
-		clients:            make(map[string]*WhatsAppClient),
-		container:          container,
-		callbackURL:        "",
-		configPath:         configPath,
-		clientIDMap:        make(map[string]string),
-		clientMapPath:      clientMapPath,
-		pendingClients:     make(map[string]PendingClient),
-		pendingClientsPath: pendingClientsPath,
-	}
-	// Load configuration from file
+		clients:          make(map[string]*WhatsAppClient),
+		container:        container,
+		db:               db,
+		callbackURL:      "",
+		clientIDMap:      make(map[string]string),
+		pendingClients:   make(map[string]PendingClient),
+		broadcastRunners: make(map[string]bool),
+		clientMetadata:   make(map[string]ClientMetadata),
+		skippedClients:   make(map[string]bool),
+	}
+	// Load the configuration saved through the API
 	if err := cm.loadConfig(); err != nil {
 		fmt.Printf("Failed to load config (will use defaults): %v\n", err)
 	}
-	// Override with environment variable if set
-	if envCallbackURL := os.Getenv("CALLBACK_URL"); envCallbackURL != "" {
-		cm.callbackURL = envCallbackURL
-		fmt.Printf("Callback URL set from environment: %s\n", envCallbackURL)
-	}
-	// Load client ID mappings
-	if err := cm.loadClientMappings(); err != nil {
-		fmt.Printf("Failed to load client mappings (will use defaults): %v\n", err)
-	}
-	// Load pending clients
-	if err := cm.loadPendingClients(); err != nil {
-		fmt.Printf("Failed to load pending clients (will use defaults): %v\n", err)
+	// Fall back to the config file, or override with the environment variable if set
+	cm.applyCallbackURL(appConfig(), cm.callbackURL)
+	// Load client ID mappings, metadata and pending clients
+	if err := cm.loadClientState(context.Background()); err != nil {
+		fmt.Printf("Failed to load client state (will use defaults): %v\n", err)
 	}
 	return cm
 }
 
-// loadConfig loads configuration from JSON file
-func (cm *ClientManager) loadConfig() error {
-	data, err := os.ReadFile(cm.configPath)
-	if err != nil {
-		if os.IsNotExist(err) {
-			// Config file doesn't exist yet, that's okay
-			return nil
-		}
-		return fmt.Errorf("failed to read config file: %w", err)
-	}
-
-	var config Config
-	if err := json.Unmarshal(data, &config); err != nil {
-		return fmt.Errorf("failed to parse config file: %w", err)
-	}
-
-	cm.mutex.Lock()
-	cm.callbackURL = config.CallbackURL
-	cm.mutex.Unlock()
-
-	fmt.Printf("Configuration loaded: callbackURL=%s\n", config.CallbackURL)
-	return nil
-}
-
-// saveConfig saves configuration to JSON file
-func (cm *ClientManager) saveConfig() error {
-	cm.mutex.RLock()
-	config := Config{
-		CallbackURL: cm.callbackURL,
-	}
-	cm.mutex.RUnlock()
-
-	data, err := json.MarshalIndent(config, "", "  ")
-	if err != nil {
-		return fmt.Errorf("failed to marshal config: %w", err)
-	}
-
-	// Write to temp file first, then rename for atomic operation
-	tempPath := cm.configPath + ".tmp"
-	if err := os.WriteFile(tempPath, data, 0644); err != nil {
-		return fmt.Errorf("failed to write temp config file: %w", err)
-	}
-
-	if err := os.Rename(tempPath, cm.configPath); err != nil {
-		return fmt.Errorf("failed to rename temp config file: %w", err)
-	}
-
-	fmt.Printf("Configuration saved to %s\n", cm.configPath)
-	return nil
-}
-
-// loadClientMappings loads client ID mappings from JSON file
-func (cm *ClientManager) loadClientMappings() error {
-	data, err := os.ReadFile(cm.clientMapPath)
-	if err != nil {
-		if os.IsNotExist(err) {
-			// Mapping file doesn't exist yet, that's okay
-			return nil
-		}
-		return fmt.Errorf("failed to read client mappings file: %w", err)
-	}
-
-	var mapping ClientIDMapping
-	if err := json.Unmarshal(data, &mapping); err != nil {
-		return fmt.Errorf("failed to parse client mappings file: %w", err)
-	}
-
-	cm.mutex.Lock()
-	cm.clientIDMap = mapping.Mappings
-	if cm.clientIDMap == nil {
-		cm.clientIDMap = make(map[string]string)
-	}
-	cm.mutex.Unlock()
-
-	fmt.Printf("Client mappings loaded: %d mappings\n", len(mapping.Mappings))
-	return nil
-}
-
-// saveClientMappings saves client ID mappings to JSON file
-func (cm *ClientManager) saveClientMappings() error {
-	cm.mutex.RLock()
-	mapping := ClientIDMapping{
-		Mappings: cm.clientIDMap,
-	}
-	cm.mutex.RUnlock()
-
-	data, err := json.MarshalIndent(mapping, "", "  ")
-	if err != nil {
-		return fmt.Errorf("failed to marshal client mappings: %w", err)
-	}
-
-	// Write to temp file first, then rename for atomic operation
-	tempPath := cm.clientMapPath + ".tmp"
-	if err := os.WriteFile(tempPath, data, 0644); err != nil {
-		return fmt.Errorf("failed to write temp client mappings file: %w", err)
-	}
-
-	if err := os.Rename(tempPath, cm.clientMapPath); err != nil {
-		return fmt.Errorf("failed to rename temp client mappings file: %w", err)
-	}
-
-	fmt.Printf("Client mappings saved to %s\n", cm.clientMapPath)
-	return nil
-}
-
-// loadPendingClients loads pending clients from JSON file
-func (cm *ClientManager) loadPendingClients() error {
-	data, err := os.ReadFile(cm.pendingClientsPath)
-	if err != nil {
-		if os.IsNotExist(err) {
-			// Pending clients file doesn't exist yet, that's okay
-			return nil
-		}
-		return fmt.Errorf("failed to read pending clients file: %w", err)
-	}
-
-	var pendingClients PendingClients
-	if err := json.Unmarshal(data, &pendingClients); err != nil {
-		return fmt.Errorf("failed to parse pending clients file: %w", err)
-	}
-
-	cm.mutex.Lock()
-	cm.pendingClients = pendingClients.Clients
-	if cm.pendingClients == nil {
-		cm.pendingClients = make(map[string]PendingClient)
-	}
-	cm.mutex.Unlock()
-
-	fmt.Printf("Pending clients loaded: %d pending clients\n", len(pendingClients.Clients))
-	return nil
-}
-
-// savePendingClients saves pending clients to JSON file
-func (cm *ClientManager) savePendingClients() error {
-	cm.mutex.RLock()
-	pendingClients := PendingClients{
-		Clients: cm.pendingClients,
-	}
-	cm.mutex.RUnlock()
-
-	data, err := json.MarshalIndent(pendingClients, "", "  ")
-	if err != nil {
-		return fmt.Errorf("failed to marshal pending clients: %w", err)
-	}
-
-	// Write to temp file first, then rename for atomic operation
-	tempPath := cm.pendingClientsPath + ".tmp"
-	if err := os.WriteFile(tempPath, data, 0644); err != nil {
-		return fmt.Errorf("failed to write temp pending clients file: %w", err)
+func (cm *ClientManager) createClient(device DeviceIdentity, customID string) (*WhatsAppClient, string, error) {
+	device = device.normalize()
+	if err := device.validate(); err != nil {
+		return nil, "", err
 	}
 
-	if err := os.Rename(tempPath, cm.pendingClientsPath); err != nil {
-		return fmt.Errorf("failed to rename temp pending clients file: %w", err)
-	}
-
-	fmt.Printf("Pending clients saved to %s\n", cm.pendingClientsPath)
-	return nil
-}
-
-func (cm *ClientManager) createClient(osName string, customID string) (*WhatsAppClient, string, error) {
 	// Use custom ID if provided, otherwise generate a UUID
 	var clientID string
 	if customID != "" {
@@ -317,19 +151,24 @@ func (cm *ClientManager) createClient(osName string, customID string) (*WhatsApp
 		return nil, "", fmt.Errorf("failed to create new device: container returned nil")
 	}
 
-	clientLog := waLog.Stdout("Client", "DEBUG", true)
-	client := whatsmeow.NewClient(deviceStore, clientLog)
+	client := cm.newTransport(deviceStore, device)
 	fmt.Printf("Created new client: %s\n", clientID)
 
+	if err := cm.saveDeviceIdentity(clientID, device); err != nil {
+		fmt.Printf("Warning: Failed to save device identity for client %s: %v\n", clientID, err)
+	}
+
 	waClient := &WhatsAppClient{
+		id:           clientID,
 		client:       client,
 		deviceStore:  deviceStore,
-		isConnected:  false,
+		status:       newConnectionStatus(StatePairing, "created"),
 		messages:     make([]string, 0),
 		images:       make(map[string]string),
-		osName:       osName, // Store OS name for later setting
+		device:       device,
 		typingTimers: make(map[string]*time.Timer),
 		typingActive: make(map[string]bool),
+		settings:     cm.loadClientSettings(clientID),
 	}
 
 	client.AddEventHandler(cm.eventHandler(waClient))
@@ -341,15 +180,15 @@ func (cm *ClientManager) createClient(osName string, customID string) (*WhatsApp
 	// Save pending client info for new clients with custom IDs
 	// This allows us to recreate the client if the service restarts
 	if customID != "" {
-		cm.pendingClients[customID] = PendingClient{
+		pending := PendingClient{
 			ClientID: customID,
-			OSName:   osName,
+			OSName:   device.OSName,
 			Created:  time.Now().Unix(),
 		}
+		cm.pendingClients[customID] = pending
 		cm.mutex.Unlock()
 
-		// Save pending clients to disk
-		if err := cm.savePendingClients(); err != nil {
+		if err := cm.storePendingClient(pending); err != nil {
 			fmt.Printf("Warning: Failed to save pending clients: %v\n", err)
 		}
 	} else {
@@ -370,6 +209,14 @@ func (cm *ClientManager) getClient(clientID string) (*WhatsAppClient, error) {
 	return client, nil
 }
 
+// isSkippedClient reports whether a client belongs to a stored session that wasn't loaded because
+// it was paired in the other mode. Its scheduled messages and broadcasts are left untouched.
+func (cm *ClientManager) isSkippedClient(clientID string) bool {
+	cm.mutex.RLock()
+	defer cm.mutex.RUnlock()
+	return cm.skippedClients[clientID]
+}
+
 func (cm *ClientManager) getAllClients() map[string]*WhatsAppClient {
 	cm.mutex.RLock()
 	defer cm.mutex.RUnlock()
@@ -382,6 +229,13 @@ func (cm *ClientManager) getAllClients() map[string]*WhatsAppClient {
 	return result
 }
 
+// receiptNames are the receipt types reported in message_receipt webhooks
+var receiptNames = map[types.ReceiptType]string{
+	types.ReceiptTypeDelivered: "delivered",
+	types.ReceiptTypeRead:      "read",
+	types.ReceiptTypePlayed:    "played",
+}
+
 func (cm *ClientManager) eventHandler(client *WhatsAppClient) func(interface{}) {
 	return func(evt interface{}) {
 		client.mutex.Lock()
@@ -395,42 +249,15 @@ func (cm *ClientManager) eventHandler(client *WhatsAppClient) func(interface{})
 				client.messages = client.messages[1:]
 			}
 
-			// Store LID to phone number mapping using whatsmeow's built-in method
-			if v.Info.SenderAlt.User != "" && (v.Info.Chat.User != "" || v.Info.Sender.User != "") {
-				var lidJID types.JID
-				var phoneJID types.JID
-
-				// Identify LID and phone JIDs
-				if strings.Contains(v.Info.Chat.String(), "@lid") {
-					lidJID = v.Info.Chat
-					phoneJID = v.Info.SenderAlt
-				} else if strings.Contains(v.Info.Sender.String(), "@lid") {
-					lidJID = v.Info.Sender
-					phoneJID = v.Info.SenderAlt
-				}
-
-				if lidJID.User != "" && phoneJID.User != "" {
-					// Use whatsmeow's built-in LID to phone number mapping
-					client.client.StoreLIDPNMapping(context.Background(), lidJID, phoneJID)
-					fmt.Printf("[LID Mapping] Stored mapping using whatsmeow: %s -> %s\n", lidJID.String(), phoneJID.String())
-				}
+			// Learn the LID to phone number mapping when the sender comes with its alternate JID
+			if lidJID, phoneJID, ok := lidPNPair(v.Info.Sender, v.Info.SenderAlt); ok {
+				client.client.StoreLIDPNMapping(context.Background(), lidJID, phoneJID)
+				go cm.learnLIDMapping(client, lidJID, phoneJID)
 			}
 
-			// Mark message as read and start typing
-			if !v.Info.IsFromMe {
-				chatJID := v.Info.Chat
-				go func() {
-					// Mark as read
-					err := client.client.MarkRead(context.Background(), []types.MessageID{v.Info.ID}, v.Info.Timestamp, chatJID, v.Info.Sender)
-					if err != nil {
-						fmt.Printf("Failed to mark message as read: %v\n", err)
-					} else {
-						fmt.Printf("Marked message as read from %s\n", chatJID.String())
-					}
-
-					// Start typing indicator
-					cm.startTyping(client, chatJID)
-				}()
+			// Mark message as read and start typing, as configured in the client settings
+			if !v.Info.IsFromMe && client.settings.appliesTo(v.Info) {
+				go cm.autoReadAndType(client, client.settings, v.Info)
 			}
 
 			// Download media first if message contains media (synchronous to ensure fileUrl is available)
@@ -443,19 +270,29 @@ func (cm *ClientManager) eventHandler(client *WhatsAppClient) func(interface{})
 				client.mutex.Lock()
 			}
 
+			// Keep the message in the message store for the chat APIs
+			cm.recordLiveMessage(client, v)
+
 			// Send webhook callback if configured (now includes fileUrl for media messages)
 			if cm.callbackURL != "" {
 				go cm.sendWebhook(client, v)
 			}
-		case *events.Connected:
-			client.isConnected = true
-			now := time.Now()
-			client.connectedAt = &now
-
-			// Set OS name if provided and device has JID
-			if client.osName != "" && client.deviceStore.ID != nil {
-				store.DeviceProps.Os = &client.osName
+		case *events.HistorySync:
+			go cm.ingestHistorySync(client, v.Data)
+		case *events.Archive:
+			go cm.updateChatFlag(client, v.JID, "archived", v.Action.GetArchived())
+		case *events.Pin:
+			go cm.updateChatFlag(client, v.JID, "pinned", v.Action.GetPinned())
+		case *events.Mute:
+			go cm.updateChatFlag(client, v.JID, "muted_until", v.Action.GetMuteEndTimestamp())
+		case *events.MarkChatAsRead:
+			if v.Action.GetRead() {
+				go cm.updateChatFlag(client, v.JID, "unread_count", 0)
 			}
+		case *events.Connected:
+			cm.reconnectSucceededLocked(client)
+			cm.setStateLocked(client, StateConnected, "")
+			now := *client.connectedAt
 
 			// Save the mapping from WhatsApp device ID to our UUID
 			// Find our UUID for this client by searching through manager.clients
@@ -474,24 +311,17 @@ func (cm *ClientManager) eventHandler(client *WhatsAppClient) func(interface{})
 					cm.clientIDMap[whatsappID] = ourUUID
 
 					// Remove from pending clients since it's now connected
-					if _, exists := cm.pendingClients[ourUUID]; exists {
-						delete(cm.pendingClients, ourUUID)
-						cm.mutex.Unlock()
-						// Save updated pending clients to disk
-						if err := cm.savePendingClients(); err != nil {
-							fmt.Printf("Warning: Failed to save pending clients: %v\n", err)
-						} else {
-							fmt.Printf("Removed client from pending list: %s\n", ourUUID)
-						}
-					} else {
-						cm.mutex.Unlock()
-					}
+					_, wasPending := cm.pendingClients[ourUUID]
+					delete(cm.pendingClients, ourUUID)
+					cm.mutex.Unlock()
 
-					// Save mappings to disk
-					if err := cm.saveClientMappings(); err != nil {
-						fmt.Printf("Warning: Failed to save client mappings: %v\n", err)
+					if err := cm.storeClientMapping(whatsappID, ourUUID); err != nil {
+						fmt.Printf("Warning: Failed to save client mapping: %v\n", err)
 					} else {
 						fmt.Printf("Saved client mapping: %s -> %s\n", whatsappID, ourUUID)
+						if wasPending {
+							fmt.Printf("Removed client from pending list: %s\n", ourUUID)
+						}
 					}
 				} else {
 					cm.mutex.Unlock()
@@ -501,32 +331,53 @@ func (cm *ClientManager) eventHandler(client *WhatsAppClient) func(interface{})
 			// Send connection status webhook after successful connection
 			if ourUUID != "" {
 				go cm.sendConnectionStatusWebhook(ourUUID, "connected", map[string]interface{}{
-					"osName":      client.osName,
+					"osName":      client.device.OSName,
 					"connectedAt": now.Format(time.RFC3339),
 					"phone":       client.deviceStore.ID.User,
 				})
 			}
 		case *events.LoggedOut:
-			client.isConnected = false
-			client.connectedAt = nil
+			reason := "logged out from phone"
+			if v.OnConnect {
+				reason = v.Reason.String()
+			}
+			cm.cancelReconnectLocked(client)
+			cm.setStateLocked(client, StateLoggedOut, reason)
 
 			// Send disconnection status webhook
-			cm.mutex.RLock()
-			whatsappID := client.deviceStore.ID.String()
-			clientID, exists := cm.clientIDMap[whatsappID]
-			if !exists {
-				// Try to find the UUID by searching
-				for uuid, c := range cm.clients {
-					if c == client {
-						clientID = uuid
-						break
-					}
-				}
+			if client.id != "" {
+				go cm.sendConnectionStatusWebhook(client.id, "disconnected", map[string]interface{}{})
 			}
-			cm.mutex.RUnlock()
-
-			if clientID != "" {
-				go cm.sendConnectionStatusWebhook(clientID, "disconnected", map[string]interface{}{})
+		case *events.Disconnected:
+			cm.connectionLostLocked(client, "connection lost")
+		case *events.StreamError:
+			cm.connectionLostLocked(client, fmt.Sprintf("stream error: %s", v.Code))
+		case *events.KeepAliveTimeout:
+			if time.Since(v.LastSuccess) > keepAliveMaxFailTime {
+				cm.connectionLostLocked(client, fmt.Sprintf("keepalive failed %d times", v.ErrorCount))
+			}
+		case *events.StreamReplaced:
+			cm.cancelReconnectLocked(client)
+			cm.setStateLocked(client, StateStreamReplaced, "another connection with this session was opened")
+		case *events.TemporaryBan:
+			cm.cancelReconnectLocked(client)
+			cm.setStateLocked(client, StateTemporarilyBanned, v.String())
+		case *events.ConnectFailure:
+			cm.connectionLostLocked(client, fmt.Sprintf("connect failure: %s %s", v.Reason, v.Message))
+		case *events.ClientOutdated:
+			cm.setStateLocked(client, StateDisconnected, "client outdated")
+		case *events.PairSuccess:
+			cm.setStateLocked(client, StateConnecting, "paired")
+		case *events.Receipt:
+			// Delivery, read and played receipts for messages this client sent
+			if receipt, ok := receiptNames[v.Type]; ok && !v.IsFromMe && client.id != "" {
+				go cm.sendConnectionStatusWebhook(client.id, "message_receipt", map[string]interface{}{
+					"messageIds": v.MessageIDs,
+					"chat":       v.Chat.String(),
+					"sender":     v.Sender.String(),
+					"receipt":    receipt,
+					"timestamp":  v.Timestamp,
+				})
 			}
 		case *events.QR:
 			client.qrCode = v.Codes[0]
@@ -555,11 +406,27 @@ func (cm *ClientManager) eventHandler(client *WhatsAppClient) func(interface{})
 					"qrCode": v.Codes[0],
 				})
 			}
+		case *events.PairError:
+			cm.mutex.RLock()
+			var clientID string
+			for uuid, c := range cm.clients {
+				if c == client {
+					clientID = uuid
+					break
+				}
+			}
+			cm.mutex.RUnlock()
+
+			if clientID != "" {
+				go cm.sendConnectionStatusWebhook(clientID, "pair_failed", map[string]interface{}{
+					"error": v.Error.Error(),
+				})
+			}
 		}
 	}
 }
 
-// startTyping starts the typing indicator for a chat and sets up a 1-minute timeout
+// startTyping starts the typing indicator for a chat and stops it after the configured typing timeout
 func (cm *ClientManager) startTyping(client *WhatsAppClient, chatJID types.JID) {
 	chatID := chatJID.String()
 
@@ -581,8 +448,9 @@ func (cm *ClientManager) startTyping(client *WhatsAppClient, chatJID types.JID)
 	client.typingActive[chatID] = true
 	fmt.Printf("Started typing indicator for %s\n", chatID)
 
-	// Set up timer to stop typing after 1 minute
-	client.typingTimers[chatID] = time.AfterFunc(60*time.Second, func() {
+	// Set up timer to stop typing if no reply is sent in time
+	timeout := time.Duration(client.settings.TypingTimeoutSeconds) * time.Second
+	client.typingTimers[chatID] = time.AfterFunc(timeout, func() {
 		cm.stopTyping(client, chatJID)
 	})
 }
@@ -618,13 +486,22 @@ func (cm *ClientManager) stopTyping(client *WhatsAppClient, chatJID types.JID) {
 
 // Response structs
 type ClientResponse struct {
-	ID           string     `json:"id"`
-	Phone        string     `json:"phone,omitempty"`
-	IsConnected  bool       `json:"isConnected"`
-	QRCode       string     `json:"qrCode,omitempty"`
-	ConnectedAt  *time.Time `json:"connectedAt,omitempty"`
-	MessageCount int        `json:"messageCount"`
-	OSName       string     `json:"osName,omitempty"`
+	ID           string            `json:"id"`
+	Phone        string            `json:"phone,omitempty"`
+	IsConnected  bool              `json:"isConnected"`
+	State        ConnectionState   `json:"state"`                 // pairing, connecting, connected, disconnected, reconnecting, logged_out, temporarily_banned or stream_replaced
+	StateSince   time.Time         `json:"stateSince"`            // When the current state was entered
+	StateReason  string            `json:"stateReason,omitempty"` // Why the current state was entered
+	Reconnect    ReconnectStats    `json:"reconnect"`             // Automatic reconnect counters
+	QRCode       string            `json:"qrCode,omitempty"`
+	QRDataURI    string            `json:"qrDataUri,omitempty"` // Current QR code as a PNG data URI, only on GET /clients/{id}
+	ConnectedAt  *time.Time        `json:"connectedAt,omitempty"`
+	MessageCount int               `json:"messageCount"`
+	OSName       string            `json:"osName,omitempty"`
+	Device       DeviceIdentity    `json:"device"`
+	TenantID     string            `json:"tenantId,omitempty"`
+	Labels       []string          `json:"labels,omitempty"`
+	Metadata     map[string]string `json:"metadata,omitempty"`
 }
 
 type CreateClientResponse struct {
@@ -633,16 +510,25 @@ type CreateClientResponse struct {
 }
 
 type CreateClientRequest struct {
-	ID     string `json:"id,omitempty"` // Optional custom client ID
-	OSName string `json:"osName,omitempty"`
+	ID           string                       `json:"id,omitempty"`           // Optional custom client ID
+	OSName       string                       `json:"osName,omitempty"`       // Name shown in the phone's linked devices list
+	PlatformType string                       `json:"platformType,omitempty"` // chrome, firefox, safari, edge, desktop, ipad, ...
+	BrowserLabel string                       `json:"browserLabel,omitempty"` // Browser name used for pairing codes, defaults from platformType
+	Settings     *UpdateClientSettingsRequest `json:"settings,omitempty"`     // Optional initial client settings
+	TenantID     string                       `json:"tenantId,omitempty"`     // Optional tenant or project that owns the client
+	Labels       []string                     `json:"labels,omitempty"`
+	Metadata     map[string]string            `json:"metadata,omitempty"`
 }
 
 type ConfigRequest struct {
-	CallbackURL string `json:"callbackUrl" binding:"required,url"`
+	CallbackURL string `json:"callbackUrl,omitempty" binding:"omitempty,url"`
+	Reload      bool   `json:"reload,omitempty"` // Reload the config file and environment overrides
 }
 
 type ConfigResponse struct {
-	CallbackURL string `json:"callbackUrl"`
+	CallbackURL     string    `json:"callbackUrl"`
+	Config          AppConfig `json:"config"`                    // Active configuration, with the database password hidden
+	RestartRequired []string  `json:"restartRequired,omitempty"` // Changed settings that only apply after a restart
 }
 
 type MessageResponse struct {
@@ -689,6 +575,7 @@ type ImageItem struct {
 type SendMessageResponse struct {
 	Success   bool   `json:"success"`
 	MessageID string `json:"messageId,omitempty"`
+	Phone     string `json:"phone,omitempty"` // Recipient in E.164, or the JID for groups and other non-phone chats
 	Error     string `json:"error,omitempty"`
 }
 
@@ -724,28 +611,84 @@ func createClient(c *gin.Context) {
 	var req CreateClientRequest
 
 	// Parse request body (empty body is also allowed)
-	if err := c.ShouldBindJSON(&req); err != nil {
-		// If binding fails due to empty body, use empty struct
-		req = CreateClientRequest{}
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	meta := ClientMetadata{TenantID: req.TenantID, Labels: normalizeLabels(req.Labels), Metadata: req.Metadata}
+	if err := meta.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 
-	waClient, clientID, err := manager.createClient(req.OSName, req.ID)
+	device := DeviceIdentity{OSName: req.OSName, PlatformType: req.PlatformType, BrowserLabel: req.BrowserLabel}
+	if err := device.normalize().validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Check the initial settings before anything is created
+	var settings ClientSettings
+	if req.Settings != nil {
+		var err error
+		if settings, err = req.Settings.resolve(manager.loadClientSettings(req.ID)); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if req.ID != "" && manager.isSkippedClient(req.ID) {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("client %s has a session paired in the other mode (sandbox or real) and can't be used in this mode", req.ID)})
+		return
+	}
+
+	waClient, clientID, err := manager.createClient(device, req.ID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
+	// Apply initial settings if provided
+	if req.Settings != nil {
+		waClient.mutex.Lock()
+		waClient.settings = settings
+		waClient.mutex.Unlock()
+		if err := manager.saveClientSettings(clientID, settings); err != nil {
+			fmt.Printf("Warning: Failed to save settings for client %s: %v\n", clientID, err)
+		}
+	}
+
+	if err := manager.setClientMetadata(clientID, meta); err != nil {
+		fmt.Printf("Warning: Failed to save metadata for client %s: %v\n", clientID, err)
+	}
+
 	// Start connection process
+	manager.startPairingConnection(clientID, waClient)
+
+	qrURL := fmt.Sprintf("%s/qr?client_id=%s", getBaseURL(c), clientID)
+
+	c.JSON(http.StatusOK, CreateClientResponse{
+		ID:    clientID,
+		QRURL: qrURL,
+	})
+}
+
+// startPairingConnection connects an unpaired client in the background and keeps its QR code
+// up to date until it is paired or the QR codes run out
+func (cm *ClientManager) startPairingConnection(clientID string, waClient *WhatsAppClient) {
 	go func() {
 		qrChan, err := waClient.client.GetQRChannel(context.Background())
 		if err != nil {
-			fmt.Printf("Failed to get QR channel: %v\n", err)
+			fmt.Printf("Failed to get QR channel for client %s: %v\n", clientID, err)
 			return
 		}
 
+		cm.setState(waClient, StatePairing, "waiting for QR scan")
 		err = waClient.client.Connect()
 		if err != nil {
-			fmt.Printf("Failed to connect client: %v\n", err)
+			cm.setState(waClient, StateDisconnected, fmt.Sprintf("connect failed: %v", err))
+			fmt.Printf("Failed to connect client %s: %v\n", clientID, err)
 			return
 		}
 
@@ -754,62 +697,110 @@ func createClient(c *gin.Context) {
 				waClient.mutex.Lock()
 				waClient.qrCode = evt.Code
 				waClient.mutex.Unlock()
+				fmt.Printf("QR code received for client %s\n", clientID)
 			} else if evt.Event == "timeout" {
 				// QR code expired
 				fmt.Printf("QR code expired for client %s\n", clientID)
 
+				waClient.mutex.Lock()
+				waClient.qrCode = ""
+				cm.setStateLocked(waClient, StateDisconnected, "QR code expired")
+				waClient.mutex.Unlock()
+
 				// Send webhook for timeout
 				// We need to use the clientID (UUID) here
-				go manager.sendConnectionStatusWebhook(clientID, "qr_timeout", map[string]interface{}{})
+				go cm.sendConnectionStatusWebhook(clientID, "qr_timeout", map[string]interface{}{})
 			}
 		}
 	}()
+}
 
-	qrURL := fmt.Sprintf("%s/qr?client_id=%s", getBaseURL(c), clientID)
-
-	c.JSON(http.StatusOK, CreateClientResponse{
-		ID:    clientID,
-		QRURL: qrURL,
-	})
+// parsePageParams reads the limit and offset query parameters. A limit of 0 means no limit.
+func parsePageParams(c *gin.Context, defaultLimit, maxLimit int) (int, int, error) {
+	limit := defaultLimit
+	if l := c.Query("limit"); l != "" {
+		parsed, err := strconv.Atoi(l)
+		if err != nil || parsed < 1 || parsed > maxLimit {
+			return 0, 0, fmt.Errorf("limit must be between 1 and %d", maxLimit)
+		}
+		limit = parsed
+	}
+	offset := 0
+	if o := c.Query("offset"); o != "" {
+		parsed, err := strconv.Atoi(o)
+		if err != nil || parsed < 0 {
+			return 0, 0, fmt.Errorf("offset must be a non-negative number")
+		}
+		offset = parsed
+	}
+	return limit, offset, nil
 }
 
 // @Summary Get all clients
-// @Description Returns list of all WhatsApp clients
+// @Description Returns WhatsApp clients sorted by ID, optionally filtered by tenant, labels and connection state. The total number of matching clients is returned in the X-Total-Count header.
 // @Tags clients
 // @Accept json
 // @Produce json
+// @Param tenant query string false "Only clients of this tenant"
+// @Param label query []string false "Only clients with all of these labels" collectionFormat(multi)
+// @Param state query string false "Only clients in this state" Enums(pairing, connecting, connected, disconnected, reconnecting, logged_out, temporarily_banned, stream_replaced)
+// @Param limit query int false "Maximum number of clients to return (1-500)"
+// @Param offset query int false "Number of clients to skip" default(0)
 // @Success 200 {array} ClientResponse
+// @Failure 400 {object} map[string]string
 // @Router /clients [get]
 func getAllClients(c *gin.Context) {
+	tenant := c.Query("tenant")
+	labels := c.QueryArray("label")
+	state := c.Query("state")
+	if state != "" && !validConnectionState(state) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("state must be one of %v", connectionStates)})
+		return
+	}
+
+	limit, offset, err := parsePageParams(c, 0, maxClientsPageSize)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	clients := manager.getAllClients()
 
 	response := make([]ClientResponse, 0)
 	for id, client := range clients {
-		client.mutex.RLock()
-		resp := ClientResponse{
-			ID:           id,
-			IsConnected:  client.isConnected,
-			QRCode:       client.qrCode,
-			ConnectedAt:  client.connectedAt,
-			MessageCount: len(client.messages),
-			OSName:       client.osName,
+		meta := manager.getClientMetadata(id)
+		if tenant != "" && meta.TenantID != tenant {
+			continue
 		}
-		// Add phone number if device is connected
-		if client.deviceStore != nil && client.deviceStore.ID != nil {
-			resp.Phone = client.deviceStore.ID.User
+		if !meta.hasLabels(labels) {
+			continue
 		}
-		if resp.QRCode == "" {
-			resp.QRCode = "not_available"
+
+		client.mutex.RLock()
+		if state != "" && string(client.status.State) != state {
+			client.mutex.RUnlock()
+			continue
 		}
-		response = append(response, resp)
+		response = append(response, buildClientResponse(id, client, meta))
 		client.mutex.RUnlock()
 	}
 
+	sort.Slice(response, func(i, j int) bool { return response[i].ID < response[j].ID })
+
+	c.Header("X-Total-Count", strconv.Itoa(len(response)))
+	if offset > len(response) {
+		offset = len(response)
+	}
+	response = response[offset:]
+	if limit > 0 && limit < len(response) {
+		response = response[:limit]
+	}
+
 	c.JSON(http.StatusOK, response)
 }
 
-// @Summary Set webhook callback URL
-// @Description Sets the callback URL for receiving message webhooks
+// @Summary Set webhook callback URL or reload configuration
+// @Description Sets the callback URL for receiving message webhooks, and with reload=true reloads the config file and environment overrides like SIGHUP does. Only the webhook, rateLimit, media, clients and reconnect settings are applied at runtime; other changes are listed in restartRequired.
 // @Tags config
 // @Accept json
 // @Produce json
@@ -823,24 +814,46 @@ func setConfig(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if req.CallbackURL == "" && !req.Reload {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "set callbackUrl or reload"})
+		return
+	}
 
-	manager.mutex.Lock()
-	manager.callbackURL = req.CallbackURL
-	manager.mutex.Unlock()
+	var restartRequired []string
+	if req.Reload {
+		var err error
+		restartRequired, err = reloadAppConfig()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Configuration not reloaded: %v", err)})
+			return
+		}
+	}
+
+	if req.CallbackURL != "" {
+		manager.mutex.Lock()
+		manager.callbackURL = req.CallbackURL
+		manager.mutex.Unlock()
 
-	// Save configuration to persistent storage
-	if err := manager.saveConfig(); err != nil {
-		fmt.Printf("Warning: Failed to save config: %v\n", err)
-		// Don't fail the request, just log the warning
+		// Save configuration to persistent storage
+		if err := manager.saveConfig(); err != nil {
+			fmt.Printf("Warning: Failed to save config: %v\n", err)
+			// Don't fail the request, just log the warning
+		}
 	}
 
+	manager.mutex.RLock()
+	callbackURL := manager.callbackURL
+	manager.mutex.RUnlock()
+
 	c.JSON(http.StatusOK, ConfigResponse{
-		CallbackURL: req.CallbackURL,
+		CallbackURL:     callbackURL,
+		Config:          appConfig().redacted(),
+		RestartRequired: restartRequired,
 	})
 }
 
 // @Summary Get current configuration
-// @Description Gets the current callback URL configuration
+// @Description Gets the current callback URL and the active configuration
 // @Tags config
 // @Accept json
 // @Produce json
@@ -853,6 +866,7 @@ func getConfig(c *gin.Context) {
 
 	c.JSON(http.StatusOK, ConfigResponse{
 		CallbackURL: callbackURL,
+		Config:      appConfig().redacted(),
 	})
 }
 
@@ -881,6 +895,11 @@ func getClientFile(c *gin.Context) {
 	filePath, exists := waClient.images[fileID]
 	waClient.mutex.RUnlock()
 
+	// Files downloaded before a restart are found through the message store
+	if !exists {
+		filePath, exists = manager.storedMediaPath(clientID, fileID)
+	}
+
 	if !exists {
 		c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
 		return
@@ -908,23 +927,15 @@ func getClient(c *gin.Context) {
 		return
 	}
 
+	meta := manager.getClientMetadata(clientID)
 	waClient.mutex.RLock()
-	resp := ClientResponse{
-		ID:           clientID,
-		IsConnected:  waClient.isConnected,
-		QRCode:       waClient.qrCode,
-		ConnectedAt:  waClient.connectedAt,
-		MessageCount: len(waClient.messages),
-	}
-	// Add phone number if device is connected
-	if waClient.deviceStore != nil && waClient.deviceStore.ID != nil {
-		resp.Phone = waClient.deviceStore.ID.User
-	}
-	if resp.QRCode == "" {
-		resp.QRCode = "not_available"
-	}
+	resp := buildClientResponse(clientID, waClient, meta)
 	waClient.mutex.RUnlock()
 
+	if resp.QRCode != "not_available" && !resp.IsConnected {
+		resp.QRDataURI = qrDataURI(resp.QRCode)
+	}
+
 	c.JSON(http.StatusOK, resp)
 }
 
@@ -976,137 +987,110 @@ func getQRCodeHTML(c *gin.Context) {
 		return
 	}
 
-	waClient, err := manager.getClient(clientID)
-	if err != nil {
+	if _, err := manager.getClient(clientID); err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
 	}
 
-	waClient.mutex.RLock()
-	qrCode := waClient.qrCode
-	isConnected := waClient.isConnected
-	waClient.mutex.RUnlock()
-
+	// The page polls the client API and swaps the QR image in place, so it never reloads
+	clientIDJSON, _ := json.Marshal(clientID)
 	htmlContent := fmt.Sprintf(`<!DOCTYPE html>
 <html>
 <head>
+    <meta charset="utf-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1">
     <title>WhatsApp QR Code - Client %s</title>
     <style>
         body { font-family: Arial, sans-serif; text-align: center; padding: 20px; }
         .container { max-width: 600px; margin: 0 auto; }
-        .qr-code { 
-            margin: 20px auto; 
-            padding: 20px; 
-            border: 2px solid #ddd; 
-            border-radius: 10px; 
-            background: white;
-            white-space: pre;
-            font-family: monospace;
-            line-height: 1;
-            font-size: 2px;
-        }
-        .info { 
-            margin: 20px 0; 
-            padding: 15px; 
-            background: #f0f8ff; 
-            border-radius: 5px; 
-        }
-        .refresh { 
-            margin: 10px 0; 
-        }
-        .refresh button {
-            padding: 10px 20px;
-            background: #25d366;
-            color: white;
-            border: none;
-            border-radius: 5px;
-            cursor: pointer;
-            font-size: 16px;
-        }
-        .refresh button:hover {
-            background: #128c7e;
-        }
+        .qr-code { margin: 20px auto; padding: 10px; border: 2px solid #ddd; border-radius: 10px; background: white; display: inline-block; }
+        .qr-code img { display: block; width: 280px; height: 280px; image-rendering: pixelated; }
+        .info { margin: 20px 0; padding: 15px; background: #f0f8ff; border-radius: 5px; }
+        .connected { background: #d4edda; color: #155724; }
+        .waiting { background: #fff3cd; color: #856404; }
+        .error { background: #f8d7da; color: #721c24; }
+        [hidden] { display: none !important; }
     </style>
-    <script>
-        function refreshQR() {
-            setTimeout(() => {
-                location.reload();
-            }, 5000);
-        }
-        
-        // Auto-refresh every 10 seconds if not connected
-        setInterval(() => {
-            fetch('/api/v1/clients/%s')
-                .then(response => response.json())
-                .then(data => {
-                    if (data.isConnected) {
-                        location.reload();
-                    }
-                })
-                .catch(() => {});
-        }, 10000);
-    </script>
 </head>
 <body>
     <div class="container">
         <h1>WhatsApp QR Code</h1>
         <div class="info">
             <strong>Client ID:</strong> %s<br>
-            <strong>Status:</strong> %s
-        </div>`, strings.ReplaceAll(clientID, "<", "&lt;"), strings.ReplaceAll(clientID, "<", "&lt;"), strings.ReplaceAll(clientID, "<", "&lt;"), map[bool]string{true: "Connected", false: "Waiting for QR scan"}[isConnected])
-
-	if isConnected {
-		htmlContent += `
-        <div class="info" style="background: #d4edda; color: #155724;">
-            <h2>✅ Connected Successfully!</h2>
-            <p>Your WhatsApp client is now connected and ready to use.</p>
-        </div>`
-	} else if qrCode == "" {
-		htmlContent += `
-        <div class="info" style="background: #fff3cd; color: #856404;">
+            <strong>Status:</strong> <span id="status">Loading...</span>
+        </div>
+        <div id="waiting" class="info waiting" hidden>
             <h2>⏳ Waiting for QR Code...</h2>
             <p>QR code is being generated. Please wait.</p>
         </div>
-        <div class="refresh">
-            <button onclick="refreshQR()">Refresh</button>
-        </div>`
-	} else {
-		// Generate QR code as ASCII art using qrterminal
-		htmlContent += `
-        <div class="info">
-            <h2>📱 Scan this QR code with WhatsApp</h2>
-            <p>Open WhatsApp on your phone → Linked Devices → Link a device</p>
+        <div id="scan" hidden>
+            <div class="info">
+                <h2>📱 Scan this QR code with WhatsApp</h2>
+                <p>Open WhatsApp on your phone → Linked Devices → Link a device</p>
+            </div>
+            <div class="qr-code"><img id="qr" alt="WhatsApp QR code"></div>
         </div>
-        <div class="refresh">
-            <button onclick="refreshQR()">Refresh QR Code</button>
+        <div id="connected" class="info connected" hidden>
+            <h2>✅ Connected Successfully!</h2>
+            <p>Your WhatsApp client is now connected<span id="phone"></span> and ready to use.</p>
         </div>
-        <div class="qr-code">`
-
-		// Capture qrterminal output
-		var qrBuilder strings.Builder
-		qrterminal.GenerateWithConfig(qrCode, qrterminal.Config{
-			Level:     qrterminal.L,
-			Writer:    &qrBuilder,
-			BlackChar: "██",
-			WhiteChar: "  ",
-		})
-
-		// Convert to HTML-safe format
-		qrHTML := strings.ReplaceAll(qrBuilder.String(), " ", "&nbsp;")
-		qrHTML = strings.ReplaceAll(qrHTML, "\n", "<br>")
-		htmlContent += qrHTML
-
-		htmlContent += `</div>`
-	}
-
-	htmlContent += `
+        <div id="error" class="info error" hidden></div>
         <div class="info" style="margin-top: 30px; font-size: 14px;">
-            <p>This page will automatically refresh when the connection status changes.</p>
-            <p><a href="/api/v1/clients/%s">View API details</a></p>
+            <p>The QR code and status update automatically.</p>
+            <p><a id="details">View API details</a></p>
         </div>
     </div>
+    <script>
+        const clientId = %s;
+        const apiURL = '/api/v1/clients/' + encodeURIComponent(clientId);
+        document.getElementById('details').href = apiURL;
+
+        function show(id) {
+            for (const section of ['waiting', 'scan', 'connected', 'error']) {
+                document.getElementById(section).hidden = section !== id;
+            }
+        }
+
+        async function poll() {
+            try {
+                const response = await fetch(apiURL, { cache: 'no-store' });
+                if (response.status === 404) {
+                    document.getElementById('status').textContent = 'Not found';
+                    document.getElementById('error').textContent = 'This client no longer exists.';
+                    show('error');
+                    return;
+                }
+                const data = await response.json();
+                if (data.isConnected) {
+                    document.getElementById('status').textContent = 'Connected';
+                    document.getElementById('phone').textContent = data.phone ? ' as +' + data.phone : '';
+                    show('connected');
+                } else if (data.qrDataUri) {
+                    document.getElementById('status').textContent = 'Waiting for QR scan';
+                    const img = document.getElementById('qr');
+                    if (img.src !== data.qrDataUri) {
+                        img.src = data.qrDataUri;
+                    }
+                    show('scan');
+                } else if (data.state === 'pairing' || data.state === 'connecting') {
+                    document.getElementById('status').textContent = 'Waiting for QR code';
+                    show('waiting');
+                } else {
+                    const state = data.state.replace(/_/g, ' ');
+                    document.getElementById('status').textContent = data.stateReason ? state + ' (' + data.stateReason + ')' : state;
+                    document.getElementById('error').textContent = 'The client is ' + state + '. Reconnect or pair it again through the API.';
+                    show('error');
+                }
+            } catch (e) {
+                document.getElementById('status').textContent = 'Unable to reach server, retrying...';
+            }
+            setTimeout(poll, 2000);
+        }
+
+        poll();
+    </script>
 </body>
-</html>`
+</html>`, html.EscapeString(clientID), html.EscapeString(clientID), clientIDJSON)
 
 	c.Header("Content-Type", "text/html; charset=utf-8")
 	c.String(http.StatusOK, htmlContent)
@@ -1150,13 +1134,13 @@ func getMessages(c *gin.Context) {
 	c.JSON(http.StatusOK, response)
 }
 
-// @Summary Disconnect and delete client
-// @Description Disconnects and removes a WhatsApp client
+// @Summary Delete client
+// @Description Logs out the client (unlinking it from the phone when possible) and removes its session, ID mapping, pending entry, media, settings, scheduled messages and broadcasts
 // @Tags clients
 // @Accept json
 // @Produce json
 // @Param id path string true "Client ID"
-// @Success 200 {object} map[string]string
+// @Success 200 {object} RemoveClientResponse
 // @Failure 404 {object} map[string]string
 // @Router /clients/{id} [delete]
 func deleteClient(c *gin.Context) {
@@ -1168,17 +1152,9 @@ func deleteClient(c *gin.Context) {
 		return
 	}
 
-	// Disconnect if connected
-	if waClient.client.IsConnected() {
-		waClient.client.Disconnect()
-	}
-
-	// Remove from manager
-	manager.mutex.Lock()
-	delete(manager.clients, clientID)
-	manager.mutex.Unlock()
-
-	c.JSON(http.StatusOK, gin.H{"message": "client deleted successfully"})
+	result := manager.removeClient(clientID, waClient, true)
+	result.Message = "client deleted successfully"
+	c.JSON(http.StatusOK, result)
 }
 
 // @Summary Send text message
@@ -1188,6 +1164,7 @@ func deleteClient(c *gin.Context) {
 // @Produce json
 // @Param id path string true "Client ID"
 // @Param message body SendMessageRequest true "Message details"
+// @Param Idempotency-Key header string false "Key that makes retries return the original response"
 // @Success 200 {object} SendMessageResponse
 // @Failure 400 {object} map[string]string
 // @Failure 404 {object} map[string]string
@@ -1202,7 +1179,7 @@ func sendMessage(c *gin.Context) {
 		return
 	}
 
-	if !waClient.isConnected {
+	if !waClient.connected() {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "client is not connected"})
 		return
 	}
@@ -1213,21 +1190,23 @@ func sendMessage(c *gin.Context) {
 		return
 	}
 
-	// Format phone number (remove @s.whatsapp.net if present, add if missing)
-	targetJID := strings.TrimSuffix(req.Phone, "@s.whatsapp.net")
-	if !strings.Contains(targetJID, "@") {
-		targetJID += "@s.whatsapp.net"
-	}
+	resp, status := manager.sendText(waClient, req)
+	c.JSON(status, resp)
+}
 
-	// Parse JID
-	targetJIDParsed, err := types.ParseJID(targetJID)
+// sendText sends a text message and returns the response with the HTTP status to report
+func (cm *ClientManager) sendText(waClient *WhatsAppClient, req SendMessageRequest) (SendMessageResponse, int) {
+	// Normalize the phone number and build the JID
+	targetJIDParsed, normalizedPhone, err := waClient.parseRecipient(req.Phone)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid phone number format: %v", err)})
-		return
+		return SendMessageResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Invalid phone number: %v", err),
+		}, http.StatusBadRequest
 	}
 
 	// Stop typing indicator before sending message
-	manager.stopTyping(waClient, targetJIDParsed)
+	cm.stopTyping(waClient, targetJIDParsed)
 
 	// Send message
 	msg := &waE2E.Message{
@@ -1236,17 +1215,19 @@ func sendMessage(c *gin.Context) {
 
 	resp, err := waClient.client.SendMessage(context.Background(), targetJIDParsed, msg)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, SendMessageResponse{
+		return SendMessageResponse{
 			Success: false,
 			Error:   fmt.Sprintf("Failed to send message: %v", err),
-		})
-		return
+		}, http.StatusInternalServerError
 	}
 
-	c.JSON(http.StatusOK, SendMessageResponse{
+	cm.recordSentMessage(waClient, targetJIDParsed, resp, msg)
+
+	return SendMessageResponse{
 		Success:   true,
 		MessageID: resp.ID,
-	})
+		Phone:     normalizedPhone,
+	}, http.StatusOK
 }
 
 // @Summary Send single image
@@ -1256,6 +1237,7 @@ func sendMessage(c *gin.Context) {
 // @Produce json
 // @Param id path string true "Client ID"
 // @Param image body SendImageRequest true "Image details"
+// @Param Idempotency-Key header string false "Key that makes retries return the original response"
 // @Success 200 {object} SendMessageResponse
 // @Failure 400 {object} map[string]string
 // @Failure 404 {object} map[string]string
@@ -1270,7 +1252,7 @@ func sendImage(c *gin.Context) {
 		return
 	}
 
-	if !waClient.isConnected {
+	if !waClient.connected() {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "client is not connected"})
 		return
 	}
@@ -1281,56 +1263,54 @@ func sendImage(c *gin.Context) {
 		return
 	}
 
-	// Format phone number
-	targetJID := strings.TrimSuffix(req.Phone, "@s.whatsapp.net")
-	if !strings.Contains(targetJID, "@") {
-		targetJID += "@s.whatsapp.net"
-	}
+	resp, status := manager.sendImage(waClient, req)
+	c.JSON(status, resp)
+}
 
-	// Parse JID
-	targetJIDParsed, err := types.ParseJID(targetJID)
+// sendImage downloads and sends a single image and returns the response with the HTTP status to report
+func (cm *ClientManager) sendImage(waClient *WhatsAppClient, req SendImageRequest) (SendMessageResponse, int) {
+	// Normalize the phone number and build the JID
+	targetJIDParsed, normalizedPhone, err := waClient.parseRecipient(req.Phone)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid phone number format: %v", err)})
-		return
+		return SendMessageResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Invalid phone number: %v", err),
+		}, http.StatusBadRequest
 	}
 
 	// Download image from URL
-	resp, err := http.Get(req.ImageURL)
+	resp, err := mediaHTTPClient().Get(req.ImageURL)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, SendMessageResponse{
+		return SendMessageResponse{
 			Success: false,
 			Error:   fmt.Sprintf("Failed to download image: %v", err),
-		})
-		return
+		}, http.StatusBadRequest
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		c.JSON(http.StatusBadRequest, SendMessageResponse{
+		return SendMessageResponse{
 			Success: false,
 			Error:   fmt.Sprintf("Image download failed with status: %d", resp.StatusCode),
-		})
-		return
+		}, http.StatusBadRequest
 	}
 
 	// Read image data
-	imageData, err := io.ReadAll(resp.Body)
+	imageData, err := readMediaBody(resp.Body)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, SendMessageResponse{
+		return SendMessageResponse{
 			Success: false,
 			Error:   fmt.Sprintf("Failed to read image data: %v", err),
-		})
-		return
+		}, http.StatusInternalServerError
 	}
 
 	// Upload image to WhatsApp
 	uploaded, err := waClient.client.Upload(context.Background(), imageData, whatsmeow.MediaImage)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, SendMessageResponse{
+		return SendMessageResponse{
 			Success: false,
 			Error:   fmt.Sprintf("Failed to upload image to WhatsApp: %v", err),
-		})
-		return
+		}, http.StatusInternalServerError
 	}
 
 	// Create image message
@@ -1348,35 +1328,39 @@ func sendImage(c *gin.Context) {
 	}
 
 	// Stop typing indicator before sending image
-	manager.stopTyping(waClient, targetJIDParsed)
+	cm.stopTyping(waClient, targetJIDParsed)
 
 	// Send the image message
 	sendResp, err := waClient.client.SendMessage(context.Background(), targetJIDParsed, imageMsg)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, SendMessageResponse{
+		return SendMessageResponse{
 			Success: false,
 			Error:   fmt.Sprintf("Failed to send image: %v", err),
-		})
-		return
+		}, http.StatusInternalServerError
 	}
 
-	c.JSON(http.StatusOK, SendMessageResponse{
+	cm.recordSentMessage(waClient, targetJIDParsed, sendResp, imageMsg)
+
+	return SendMessageResponse{
 		Success:   true,
 		MessageID: sendResp.ID,
-	})
+		Phone:     normalizedPhone,
+	}, http.StatusOK
 }
 
 // @Summary Send multiple images
-// @Description Sends multiple images to a WhatsApp number
+// @Description Sends multiple images to a WhatsApp number. When no image is sent the status is 400 if every download failed and 502 otherwise, and the request can be retried with the same Idempotency-Key.
 // @Tags messages
 // @Accept json
 // @Produce json
 // @Param id path string true "Client ID"
 // @Param images body SendMultipleImagesRequest true "Multiple image details"
+// @Param Idempotency-Key header string false "Key that makes retries return the original response"
 // @Success 200 {object} SendMessageResponse
 // @Failure 400 {object} map[string]string
 // @Failure 404 {object} map[string]string
 // @Failure 500 {object} map[string]string
+// @Failure 502 {object} SendMessageResponse
 // @Router /clients/{id}/send-images [post]
 func sendMultipleImages(c *gin.Context) {
 	clientID := c.Param("id")
@@ -1387,7 +1371,7 @@ func sendMultipleImages(c *gin.Context) {
 		return
 	}
 
-	if !waClient.isConnected {
+	if !waClient.connected() {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "client is not connected"})
 		return
 	}
@@ -1398,44 +1382,50 @@ func sendMultipleImages(c *gin.Context) {
 		return
 	}
 
-	// Format phone number
-	targetJID := strings.TrimSuffix(req.Phone, "@s.whatsapp.net")
-	if !strings.Contains(targetJID, "@") {
-		targetJID += "@s.whatsapp.net"
-	}
+	resp, status := manager.sendMultipleImages(waClient, req)
+	c.JSON(status, resp)
+}
 
-	// Parse JID
-	targetJIDParsed, err := types.ParseJID(targetJID)
+// sendMultipleImages sends each image in turn and returns the combined response with the HTTP status to report
+func (cm *ClientManager) sendMultipleImages(waClient *WhatsAppClient, req SendMultipleImagesRequest) (SendMessageResponse, int) {
+	// Normalize the phone number and build the JID
+	targetJIDParsed, normalizedPhone, err := waClient.parseRecipient(req.Phone)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid phone number format: %v", err)})
-		return
+		return SendMessageResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Invalid phone number: %v", err),
+		}, http.StatusBadRequest
 	}
 
 	// Stop typing indicator before sending images
-	manager.stopTyping(waClient, targetJIDParsed)
+	cm.stopTyping(waClient, targetJIDParsed)
 
 	var messageIDs []string
 	var errors []string
+	downloadFailures := 0
 
 	// Send each image
 	for i, imageItem := range req.Images {
 		// Download image from URL
-		resp, err := http.Get(imageItem.ImageURL)
+		resp, err := mediaHTTPClient().Get(imageItem.ImageURL)
 		if err != nil {
 			errors = append(errors, fmt.Sprintf("Image %d: Failed to download - %v", i+1, err))
+			downloadFailures++
 			continue
 		}
 		defer resp.Body.Close()
 
 		if resp.StatusCode != http.StatusOK {
 			errors = append(errors, fmt.Sprintf("Image %d: Download failed with status %d", i+1, resp.StatusCode))
+			downloadFailures++
 			continue
 		}
 
 		// Read image data
-		imageData, err := io.ReadAll(resp.Body)
+		imageData, err := readMediaBody(resp.Body)
 		if err != nil {
 			errors = append(errors, fmt.Sprintf("Image %d: Failed to read data - %v", i+1, err))
+			downloadFailures++
 			continue
 		}
 
@@ -1467,12 +1457,15 @@ func sendMultipleImages(c *gin.Context) {
 			continue
 		}
 
+		cm.recordSentMessage(waClient, targetJIDParsed, sendResp, imageMsg)
+
 		messageIDs = append(messageIDs, sendResp.ID)
 	}
 
 	// Prepare response
 	response := SendMessageResponse{
 		Success: len(messageIDs) > 0,
+		Phone:   normalizedPhone,
 	}
 
 	if len(messageIDs) > 0 {
@@ -1487,7 +1480,14 @@ func sendMultipleImages(c *gin.Context) {
 		}
 	}
 
-	c.JSON(http.StatusOK, response)
+	// A failed send must not look successful, or Idempotency-Key retries would replay it
+	if !response.Success {
+		if downloadFailures == len(req.Images) {
+			return response, http.StatusBadRequest
+		}
+		return response, http.StatusBadGateway
+	}
+	return response, http.StatusOK
 }
 
 // @Summary Send a document to a WhatsApp number
@@ -1497,6 +1497,7 @@ func sendMultipleImages(c *gin.Context) {
 // @Produce json
 // @Param id path string true "Client ID"
 // @Param message body SendDocumentRequest true "Document message details"
+// @Param Idempotency-Key header string false "Key that makes retries return the original response"
 // @Success 200 {object} SendMessageResponse
 // @Failure 400 {object} map[string]string
 // @Failure 404 {object} map[string]string
@@ -1511,7 +1512,7 @@ func sendDocument(c *gin.Context) {
 		return
 	}
 
-	if !waClient.isConnected {
+	if !waClient.connected() {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "client is not connected"})
 		return
 	}
@@ -1522,46 +1523,45 @@ func sendDocument(c *gin.Context) {
 		return
 	}
 
-	// Format phone number
-	targetJID := strings.TrimSuffix(req.Phone, "@s.whatsapp.net")
-	if !strings.Contains(targetJID, "@") {
-		targetJID += "@s.whatsapp.net"
-	}
+	resp, status := manager.sendDocument(waClient, req)
+	c.JSON(status, resp)
+}
 
-	// Parse JID
-	targetJIDParsed, err := types.ParseJID(targetJID)
+// sendDocument downloads and sends a document and returns the response with the HTTP status to report
+func (cm *ClientManager) sendDocument(waClient *WhatsAppClient, req SendDocumentRequest) (SendMessageResponse, int) {
+	// Normalize the phone number and build the JID
+	targetJIDParsed, normalizedPhone, err := waClient.parseRecipient(req.Phone)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid phone number format: %v", err)})
-		return
+		return SendMessageResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Invalid phone number: %v", err),
+		}, http.StatusBadRequest
 	}
 
 	// Download document from URL
-	resp, err := http.Get(req.DocumentURL)
+	resp, err := mediaHTTPClient().Get(req.DocumentURL)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, SendMessageResponse{
+		return SendMessageResponse{
 			Success: false,
 			Error:   fmt.Sprintf("Failed to download document: %v", err),
-		})
-		return
+		}, http.StatusBadRequest
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		c.JSON(http.StatusBadRequest, SendMessageResponse{
+		return SendMessageResponse{
 			Success: false,
 			Error:   fmt.Sprintf("Document download failed with status: %d", resp.StatusCode),
-		})
-		return
+		}, http.StatusBadRequest
 	}
 
 	// Read document data
-	documentData, err := io.ReadAll(resp.Body)
+	documentData, err := readMediaBody(resp.Body)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, SendMessageResponse{
+		return SendMessageResponse{
 			Success: false,
 			Error:   fmt.Sprintf("Failed to read document data: %v", err),
-		})
-		return
+		}, http.StatusInternalServerError
 	}
 
 	// Get content type and filename
@@ -1590,11 +1590,10 @@ func sendDocument(c *gin.Context) {
 	// Upload document to WhatsApp
 	uploaded, err := waClient.client.Upload(context.Background(), documentData, whatsmeow.MediaDocument)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, SendMessageResponse{
+		return SendMessageResponse{
 			Success: false,
 			Error:   fmt.Sprintf("Failed to upload document to WhatsApp: %v", err),
-		})
-		return
+		}, http.StatusInternalServerError
 	}
 
 	// Create document message
@@ -1613,22 +1612,24 @@ func sendDocument(c *gin.Context) {
 	}
 
 	// Stop typing indicator before sending document
-	manager.stopTyping(waClient, targetJIDParsed)
+	cm.stopTyping(waClient, targetJIDParsed)
 
 	// Send the document message
 	sendResp, err := waClient.client.SendMessage(context.Background(), targetJIDParsed, documentMsg)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, SendMessageResponse{
+		return SendMessageResponse{
 			Success: false,
 			Error:   fmt.Sprintf("Failed to send document: %v", err),
-		})
-		return
+		}, http.StatusInternalServerError
 	}
 
-	c.JSON(http.StatusOK, SendMessageResponse{
+	cm.recordSentMessage(waClient, targetJIDParsed, sendResp, documentMsg)
+
+	return SendMessageResponse{
 		Success:   true,
 		MessageID: sendResp.ID,
-	})
+		Phone:     normalizedPhone,
+	}, http.StatusOK
 }
 
 // @Summary Send a document via base64 encoded data
@@ -1638,6 +1639,7 @@ func sendDocument(c *gin.Context) {
 // @Produce json
 // @Param id path string true "Client ID"
 // @Param message body SendDocumentBase64Request true "Document message details with base64 data"
+// @Param Idempotency-Key header string false "Key that makes retries return the original response"
 // @Success 200 {object} SendMessageResponse
 // @Failure 400 {object} map[string]string
 // @Failure 404 {object} map[string]string
@@ -1652,7 +1654,7 @@ func sendDocumentBase64(c *gin.Context) {
 		return
 	}
 
-	if !waClient.isConnected {
+	if !waClient.connected() {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "client is not connected"})
 		return
 	}
@@ -1663,29 +1665,30 @@ func sendDocumentBase64(c *gin.Context) {
 		return
 	}
 
+	resp, status := manager.sendDocumentBase64(waClient, req)
+	c.JSON(status, resp)
+}
+
+// sendDocumentBase64 decodes and sends a base64 document and returns the response with the HTTP status to report
+func (cm *ClientManager) sendDocumentBase64(waClient *WhatsAppClient, req SendDocumentBase64Request) (SendMessageResponse, int) {
 	// Decode base64 data
 	documentData, err := base64.StdEncoding.DecodeString(req.Base64Data)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, SendMessageResponse{
+		return SendMessageResponse{
 			Success: false,
 			Error:   fmt.Sprintf("Failed to decode base64 data: %v", err),
-		})
-		return
+		}, http.StatusBadRequest
 	}
 
 	fmt.Printf("[Aimeow Base64] Decoded %d bytes from base64 input\n", len(documentData))
 
-	// Format phone number
-	targetJID := strings.TrimSuffix(req.Phone, "@s.whatsapp.net")
-	if !strings.Contains(targetJID, "@") {
-		targetJID += "@s.whatsapp.net"
-	}
-
-	// Parse JID
-	targetJIDParsed, err := types.ParseJID(targetJID)
+	// Normalize the phone number and build the JID
+	targetJIDParsed, normalizedPhone, err := waClient.parseRecipient(req.Phone)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid phone number format: %v", err)})
-		return
+		return SendMessageResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Invalid phone number: %v", err),
+		}, http.StatusBadRequest
 	}
 
 	// Get content type
@@ -1697,11 +1700,10 @@ func sendDocumentBase64(c *gin.Context) {
 	// Upload document to WhatsApp
 	uploaded, err := waClient.client.Upload(context.Background(), documentData, whatsmeow.MediaDocument)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, SendMessageResponse{
+		return SendMessageResponse{
 			Success: false,
 			Error:   fmt.Sprintf("Failed to upload document to WhatsApp: %v", err),
-		})
-		return
+		}, http.StatusInternalServerError
 	}
 
 	// Create document message
@@ -1720,24 +1722,82 @@ func sendDocumentBase64(c *gin.Context) {
 	}
 
 	// Stop typing indicator before sending document
-	manager.stopTyping(waClient, targetJIDParsed)
+	cm.stopTyping(waClient, targetJIDParsed)
 
 	// Send the document message
 	sendResp, err := waClient.client.SendMessage(context.Background(), targetJIDParsed, documentMsg)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, SendMessageResponse{
+		return SendMessageResponse{
 			Success: false,
 			Error:   fmt.Sprintf("Failed to send document: %v", err),
-		})
-		return
+		}, http.StatusInternalServerError
 	}
 
+	cm.recordSentMessage(waClient, targetJIDParsed, sendResp, documentMsg)
+
 	fmt.Printf("[Aimeow Base64] ✅ Successfully sent document %s (%d bytes) to %s\n", req.Filename, len(documentData), req.Phone)
 
-	c.JSON(http.StatusOK, SendMessageResponse{
+	return SendMessageResponse{
 		Success:   true,
 		MessageID: sendResp.ID,
-	})
+		Phone:     normalizedPhone,
+	}, http.StatusOK
+}
+
+// decodeSendPayload parses and validates a stored send payload for the given send type
+func decodeSendPayload(sendType string, payload []byte) (interface{}, error) {
+	var req interface{}
+	switch sendType {
+	case "", "message":
+		req = &SendMessageRequest{}
+	case "image":
+		req = &SendImageRequest{}
+	case "images":
+		req = &SendMultipleImagesRequest{}
+	case "document":
+		req = &SendDocumentRequest{}
+	case "document-base64":
+		req = &SendDocumentBase64Request{}
+	default:
+		return nil, fmt.Errorf("unsupported send type: %s", sendType)
+	}
+
+	if err := json.Unmarshal(payload, req); err != nil {
+		return nil, fmt.Errorf("invalid %s payload: %w", sendType, err)
+	}
+	if err := binding.Validator.ValidateStruct(req); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// dispatchSend sends a stored payload through the same code path as the matching send endpoint
+func (cm *ClientManager) dispatchSend(waClient *WhatsAppClient, sendType string, payload []byte) (SendMessageResponse, int) {
+	req, err := decodeSendPayload(sendType, payload)
+	if err != nil {
+		return SendMessageResponse{
+			Success: false,
+			Error:   err.Error(),
+		}, http.StatusBadRequest
+	}
+
+	switch r := req.(type) {
+	case *SendMessageRequest:
+		return cm.sendText(waClient, *r)
+	case *SendImageRequest:
+		return cm.sendImage(waClient, *r)
+	case *SendMultipleImagesRequest:
+		return cm.sendMultipleImages(waClient, *r)
+	case *SendDocumentRequest:
+		return cm.sendDocument(waClient, *r)
+	case *SendDocumentBase64Request:
+		return cm.sendDocumentBase64(waClient, *r)
+	}
+
+	return SendMessageResponse{
+		Success: false,
+		Error:   fmt.Sprintf("unsupported send type: %s", sendType),
+	}, http.StatusBadRequest
 }
 
 // @Summary Delete a message
@@ -1747,6 +1807,7 @@ func sendDocumentBase64(c *gin.Context) {
 // @Produce json
 // @Param id path string true "Client ID"
 // @Param message body DeleteMessageRequest true "Delete message details"
+// @Param Idempotency-Key header string false "Key that makes retries return the original response"
 // @Success 200 {object} SendMessageResponse
 // @Failure 400 {object} map[string]string
 // @Failure 404 {object} map[string]string
@@ -1761,7 +1822,7 @@ func deleteMessage(c *gin.Context) {
 		return
 	}
 
-	if !waClient.isConnected {
+	if !waClient.connected() {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "client is not connected"})
 		return
 	}
@@ -1772,16 +1833,10 @@ func deleteMessage(c *gin.Context) {
 		return
 	}
 
-	// Format phone number (remove @s.whatsapp.net if present, add if missing)
-	targetJID := strings.TrimSuffix(req.Phone, "@s.whatsapp.net")
-	if !strings.Contains(targetJID, "@") {
-		targetJID += "@s.whatsapp.net"
-	}
-
-	// Parse JID
-	targetJIDParsed, err := types.ParseJID(targetJID)
+	// Normalize the phone number and build the JID
+	targetJIDParsed, normalizedPhone, err := waClient.parseRecipient(req.Phone)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid phone number format: %v", err)})
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid phone number: %v", err)})
 		return
 	}
 
@@ -1796,11 +1851,15 @@ func deleteMessage(c *gin.Context) {
 		return
 	}
 
-	fmt.Printf("[Aimeow Delete] Message %s deleted from chat %s (revoke ID: %s)\n", req.MessageID, targetJID, resp.ID)
+	fmt.Printf("[Aimeow Delete] Message %s deleted from chat %s (revoke ID: %s)\n", req.MessageID, targetJIDParsed, resp.ID)
+	if err := manager.revokeStoredMessage(waClient.id, req.MessageID); err != nil {
+		fmt.Printf("[History] %v\n", err)
+	}
 
 	c.JSON(http.StatusOK, SendMessageResponse{
 		Success:   true,
 		MessageID: resp.ID,
+		Phone:     normalizedPhone,
 	})
 }
 
@@ -1810,7 +1869,7 @@ func deleteMessage(c *gin.Context) {
 // @Accept json
 // @Produce json
 // @Param id path string true "Client ID"
-// @Param phone path string true "Phone number (without @s.whatsapp.net)"
+// @Param phone path string true "Phone number in international or national format, or a JID"
 // @Success 200 {object} ProfilePictureResponse
 // @Failure 400 {object} map[string]string
 // @Failure 404 {object} map[string]string
@@ -1825,7 +1884,7 @@ func getProfilePicture(c *gin.Context) {
 		return
 	}
 
-	if !waClient.isConnected {
+	if !waClient.connected() {
 		c.JSON(http.StatusBadRequest, ProfilePictureResponse{
 			Phone:      phone,
 			HasPicture: false,
@@ -1834,22 +1893,17 @@ func getProfilePicture(c *gin.Context) {
 		return
 	}
 
-	// Format phone number
-	targetJID := strings.TrimSuffix(phone, "@s.whatsapp.net")
-	if !strings.Contains(targetJID, "@") {
-		targetJID += "@s.whatsapp.net"
-	}
-
-	// Parse JID
-	targetJIDParsed, err := types.ParseJID(targetJID)
+	// Normalize the phone number and build the JID
+	targetJIDParsed, normalizedPhone, err := waClient.parseRecipient(phone)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, ProfilePictureResponse{
 			Phone:      phone,
 			HasPicture: false,
-			Error:      fmt.Sprintf("Invalid phone number format: %v", err),
+			Error:      fmt.Sprintf("Invalid phone number: %v", err),
 		})
 		return
 	}
+	phone = normalizedPhone
 
 	// Get profile picture info
 	// The second parameter is "preview" - false for full quality
@@ -1896,7 +1950,7 @@ func getProfilePicture(c *gin.Context) {
 // @Accept json
 // @Produce json
 // @Param id path string true "Client ID"
-// @Param phone path string true "Phone number (without @s.whatsapp.net)"
+// @Param phone path string true "Phone number in international or national format, or a JID"
 // @Success 200 {object} CheckWhatsAppResponse
 // @Failure 400 {object} map[string]string
 // @Failure 404 {object} map[string]string
@@ -1911,7 +1965,7 @@ func checkWhatsApp(c *gin.Context) {
 		return
 	}
 
-	if !waClient.isConnected {
+	if !waClient.connected() {
 		c.JSON(http.StatusBadRequest, CheckWhatsAppResponse{
 			Phone:        phone,
 			IsRegistered: false,
@@ -1920,14 +1974,23 @@ func checkWhatsApp(c *gin.Context) {
 		return
 	}
 
-	// Clean phone number
-	cleanPhone := strings.TrimSuffix(phone, "@s.whatsapp.net")
-	cleanPhone = strings.ReplaceAll(cleanPhone, "+", "")
-	cleanPhone = strings.ReplaceAll(cleanPhone, "-", "")
-	cleanPhone = strings.ReplaceAll(cleanPhone, " ", "")
+	// Normalize the phone number
+	targetJID, normalizedPhone, err := waClient.parseRecipient(phone)
+	if err == nil && targetJID.Server != types.DefaultUserServer {
+		err = fmt.Errorf("%s is not a phone number", targetJID)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, CheckWhatsAppResponse{
+			Phone:        phone,
+			IsRegistered: false,
+			Error:        fmt.Sprintf("Invalid phone number: %v", err),
+		})
+		return
+	}
+	phone = normalizedPhone
 
 	// Check if phone is on WhatsApp
-	result, err := waClient.client.IsOnWhatsApp(context.Background(), []string{"+" + cleanPhone})
+	result, err := waClient.client.IsOnWhatsApp(context.Background(), []string{phone})
 	if err != nil {
 		c.JSON(http.StatusOK, CheckWhatsAppResponse{
 			Phone:        phone,
@@ -1954,13 +2017,14 @@ func checkWhatsApp(c *gin.Context) {
 	})
 }
 
-func (cm *ClientManager) sendWebhook(client *WhatsAppClient, message interface{}) {
+// sendWebhook posts an incoming or own message to the callback URL
+func (cm *ClientManager) sendWebhook(client *WhatsAppClient, msg *events.Message) {
 	if cm.callbackURL == "" {
 		return
 	}
 
-	// Extract message data from the message interface
-	webhookData := cm.extractMessageData(client, message)
+	clientID, message := cm.extractMessageData(client, msg)
+	webhookData := messageWebhookBody(cm.webhookVersion(client), clientID, message, time.Now())
 
 	jsonData, err := json.Marshal(webhookData)
 	if err != nil {
@@ -1971,7 +2035,7 @@ func (cm *ClientManager) sendWebhook(client *WhatsAppClient, message interface{}
 	// Log the webhook payload for debugging
 	fmt.Printf("[Aimeow Webhook] Payload: %s\n", string(jsonData))
 
-	resp, err := http.Post(cm.callbackURL, "application/json", bytes.NewBuffer(jsonData))
+	resp, err := postWebhook(cm.callbackURL, jsonData)
 	if err != nil {
 		fmt.Printf("Failed to send webhook: %v\n", err)
 		return
@@ -1985,25 +2049,32 @@ func (cm *ClientManager) sendWebhook(client *WhatsAppClient, message interface{}
 	}
 }
 
+// statusWebhookURL is the URL status events are sent to, the callback URL with /status appended
+func statusWebhookURL(callbackURL string) string {
+	if !strings.HasSuffix(callbackURL, "/") {
+		callbackURL += "/"
+	}
+	return callbackURL + "status"
+}
+
 // sendConnectionStatusWebhook sends connection status updates to the backend
 func (cm *ClientManager) sendConnectionStatusWebhook(clientID string, event string, data map[string]interface{}) {
-	if cm.callbackURL == "" {
-		return
+	version := appConfig().Webhook.PayloadVersion
+	if client, err := cm.getClient(clientID); err == nil {
+		version = cm.webhookVersion(client)
 	}
+	cm.sendStatusWebhook(clientID, version, event, data)
+}
 
-	// Construct status webhook URL by appending /status to the callback URL
-	statusURL := cm.callbackURL
-	if !strings.HasSuffix(statusURL, "/") {
-		statusURL += "/"
+// sendStatusWebhook sends a status update in a webhook schema version, for clients that are
+// already removed
+func (cm *ClientManager) sendStatusWebhook(clientID string, version int, event string, data map[string]interface{}) {
+	if cm.callbackURL == "" {
+		return
 	}
-	statusURL += "status"
 
-	webhookData := map[string]interface{}{
-		"clientId":  clientID,
-		"event":     event,
-		"data":      data,
-		"timestamp": time.Now().Unix(),
-	}
+	statusURL := statusWebhookURL(cm.callbackURL)
+	webhookData := statusWebhookBody(version, clientID, event, data, time.Now())
 
 	jsonData, err := json.Marshal(webhookData)
 	if err != nil {
@@ -2013,7 +2084,7 @@ func (cm *ClientManager) sendConnectionStatusWebhook(clientID string, event stri
 
 	fmt.Printf("[Aimeow Status Webhook] Event: %s, Client: %s, Payload: %s\n", event, clientID, string(jsonData))
 
-	resp, err := http.Post(statusURL, "application/json", bytes.NewBuffer(jsonData))
+	resp, err := postWebhook(statusURL, jsonData)
 	if err != nil {
 		fmt.Printf("Failed to send status webhook: %v\n", err)
 		return
@@ -2157,7 +2228,8 @@ func (cm *ClientManager) downloadImage(client *WhatsAppClient, message interface
 	fmt.Printf("%s downloaded for client %s: %s -> %s (%d bytes)\n", strings.Title(mediaType), clientID, mediaID, mediaPath, len(mediaData))
 }
 
-func (cm *ClientManager) extractMessageData(client *WhatsAppClient, message interface{}) map[string]interface{} {
+// extractMessageData returns the client ID and webhook message of an incoming or own message
+func (cm *ClientManager) extractMessageData(client *WhatsAppClient, msg *events.Message) (string, WebhookMessageV2) {
 	// Get the UUID for this client by looking up the WhatsApp ID in our mapping
 	whatsappID := client.deviceStore.ID.String()
 	cm.mutex.RLock()
@@ -2170,300 +2242,151 @@ func (cm *ClientManager) extractMessageData(client *WhatsAppClient, message inte
 		fmt.Printf("Warning: No UUID mapping found for client %s\n", whatsappID)
 	}
 
-	// Type assert to get actual message struct
-	msg, ok := message.(*events.Message)
-	if !ok {
-		return map[string]interface{}{
-			"clientId": clientID,
-			"message": map[string]interface{}{
-				"type": "unknown",
-			},
-			"timestamp": time.Now().Unix(),
-		}
-	}
-
 	// Extract sender - prioritize actual phone number for LID contacts
-	// For LID (Lidded Identity) contacts, SenderAlt contains the actual phone number
-	// while Chat.User and Sender.User contain the LID identifier
+	// For LID (hidden user) contacts the phone number is in the alternate sender JID, or is
+	// looked up by the LID resolver
 	var fromUser string
-
-	// First try to get the actual phone number from SenderAlt
-	if msg.Info.SenderAlt.User != "" {
-		// SenderAlt contains the actual phone number for LID contacts
+	isUnresolvedLID := false
+	if msg.Info.SenderAlt.Server == types.DefaultUserServer {
 		fromUser = msg.Info.SenderAlt.User
 	} else {
-		// SenderAlt is empty, try to lookup LID using whatsmeow's GetUserInfo
-		var potentialLIDs []types.JID
-
-		// Helper to check if a number looks like a LID (not a real phone)
-		isLIDNumber := func(num string) bool {
-			if len(num) < 14 {
-				return false
-			}
-			// Known LID patterns
-			if strings.HasPrefix(num, "100") || strings.HasPrefix(num, "101") || strings.HasPrefix(num, "102") {
-				return true
-			}
-			// Too long for any real phone number
-			if len(num) >= 16 {
-				return true
-			}
-			// Country-specific checks
-			if strings.HasPrefix(num, "1") && len(num) > 11 {
-				return true // US/Canada max 11 digits
-			}
-			if strings.HasPrefix(num, "62") && len(num) > 14 {
-				return true // Indonesia max 14 digits
-			}
-			return false
-		}
-
-		// Collect potential LID JIDs - check both @lid suffix AND suspicious number patterns
-		if strings.Contains(msg.Info.Chat.String(), "@lid") {
-			potentialLIDs = append(potentialLIDs, msg.Info.Chat)
-		} else if isLIDNumber(msg.Info.Chat.User) {
-			// Number looks like LID even without @lid suffix
-			potentialLIDs = append(potentialLIDs, msg.Info.Chat)
-			fmt.Printf("[LID Detection] Chat %s looks like LID based on number pattern\n", msg.Info.Chat.String())
+		// Individual chats are identified by the chat, groups and broadcasts by the sender
+		identity := msg.Info.Sender
+		if msg.Info.Chat.Server == types.DefaultUserServer || msg.Info.Chat.Server == types.HiddenUserServer {
+			identity = msg.Info.Chat
 		}
-		if strings.Contains(msg.Info.Sender.String(), "@lid") && msg.Info.Sender.String() != msg.Info.Chat.String() {
-			potentialLIDs = append(potentialLIDs, msg.Info.Sender)
-		} else if isLIDNumber(msg.Info.Sender.User) && msg.Info.Sender.String() != msg.Info.Chat.String() {
-			potentialLIDs = append(potentialLIDs, msg.Info.Sender)
-			fmt.Printf("[LID Detection] Sender %s looks like LID based on number pattern\n", msg.Info.Sender.String())
-		}
-
-		// Try to resolve LID to phone number using device store
-		// The device store should have persistent LID to phone number mappings
-		if len(potentialLIDs) > 0 {
-			for _, lidJID := range potentialLIDs {
-				// Method 1: Check if device store has this LID mapped using GetAltJID
-				if altJID, err := client.deviceStore.GetAltJID(context.Background(), lidJID); err == nil && altJID.User != "" {
-					fromUser = altJID.User
-					fmt.Printf("[LID Lookup] Found phone via DeviceStore.GetAltJID: %s -> %s\n", lidJID.String(), altJID.String())
-					break
-				}
-
-				// Method 2: Try ResolveContactQRLink to get contact info
-				if contactInfo, err := client.client.ResolveContactQRLink(context.Background(), lidJID.User); err == nil && contactInfo.JID.User != "" {
-					// Check if resolved JID is a phone number (not LID)
-					if !strings.Contains(contactInfo.JID.String(), "@lid") {
-						fromUser = contactInfo.JID.User
-						fmt.Printf("[LID Lookup] Found phone via ResolveContactQRLink: %s -> %s\n", lidJID.String(), fromUser)
-						// Store the mapping for future use
-						client.client.StoreLIDPNMapping(context.Background(), lidJID, contactInfo.JID)
-						break
-					}
-				}
-
-				// Method 3: Try GetUserInfo as fallback
-				userInfoMap, err := client.client.GetUserInfo(context.Background(), []types.JID{lidJID})
-				if err == nil {
-					if userInfo, exists := userInfoMap[lidJID]; exists {
-						// Check if VerifiedName has phone info or try to get from other fields
-						fmt.Printf("[LID Lookup] GetUserInfo result for %s: LID=%s, VerifiedName=%+v\n",
-							lidJID.String(), userInfo.LID.String(), userInfo.VerifiedName)
-						if userInfo.LID.User != "" && userInfo.LID.User != lidJID.User && !strings.Contains(userInfo.LID.String(), "@lid") {
-							fromUser = userInfo.LID.User
-							fmt.Printf("[LID Lookup] Found phone via GetUserInfo.LID: %s -> %s\n", lidJID.String(), fromUser)
-							break
-						}
-					}
-				}
-			}
-		}
-
-		// If still no phone number, fall back to original logic
-		if fromUser == "" {
-			if msg.Info.Chat.Server == types.DefaultUserServer {
-				// Individual chat - use Chat.User (the actual phone number or LID)
-				fromUser = msg.Info.Chat.User
-			} else if msg.Info.Chat.Server == types.GroupServer {
-				// Group chat - use Sender.User to identify who sent the message
-				fromUser = msg.Info.Sender.User
+		fromUser = identity.User
+		if identity.Server == types.HiddenUserServer {
+			if result := cm.resolveJID(context.Background(), client, identity, false); result.Resolved {
+				fromUser = result.Phone
 			} else {
-				// For other cases (e.g., status@broadcast) - use Sender.User
-				fromUser = msg.Info.Sender.User
+				isUnresolvedLID = true
 			}
 		}
 	}
 
-	// Check if fromUser looks like an LID (not a valid phone number)
-	// LIDs are typically 14+ digit numbers that don't match phone patterns
-	isUnresolvedLID := false
-	if len(fromUser) >= 14 {
-		// Check if it starts with known LID patterns or is too long for any country
-		if strings.HasPrefix(fromUser, "100") || strings.HasPrefix(fromUser, "101") ||
-			strings.HasPrefix(fromUser, "102") || len(fromUser) >= 16 {
-			isUnresolvedLID = true
-		}
-		// Also check country-specific max lengths
-		if strings.HasPrefix(fromUser, "1") && len(fromUser) > 11 { // US/Canada max 11
-			isUnresolvedLID = true
-		}
-		if strings.HasPrefix(fromUser, "62") && len(fromUser) > 14 { // Indonesia max 14
-			isUnresolvedLID = true
-		}
-	}
-
 	// Debug logging to help diagnose issues
 	fmt.Printf("[Webhook Debug] Message from Chat=%s Sender=%s SenderAlt=%s Using=%s IsLID=%v\n",
 		msg.Info.Chat.String(), msg.Info.Sender.String(), msg.Info.SenderAlt.String(), fromUser, isUnresolvedLID)
 
-	messageData := map[string]interface{}{
-		"id":        msg.Info.ID,
-		"from":      fromUser,
-		"timestamp": msg.Info.Timestamp,
-		"pushName":  msg.Info.PushName,
-		"fromMe":    msg.Info.IsFromMe,
-	}
-
 	// ALWAYS include raw JID info for reliable reply targeting
-	// The backend can use rawChat (for DM) or rawSender (for Groups) to determine reply destination
-	messageData["rawChat"] = msg.Info.Chat.String()
-	messageData["rawSender"] = msg.Info.Sender.String()
+	// The backend can use chat (for DM) or sender (for Groups) to determine reply destination
+	message := WebhookMessageV2{
+		ID:        msg.Info.ID,
+		Timestamp: msg.Info.Timestamp,
+		Chat:      msg.Info.Chat.String(),
+		Sender:    msg.Info.Sender.String(),
+		From:      fromUser,
+		FromLID:   isUnresolvedLID,
+		PushName:  msg.Info.PushName,
+		FromMe:    msg.Info.IsFromMe,
+		IsGroup:   msg.Info.IsGroup,
+		Mentions:  []string{},
+	}
 	if msg.Info.SenderAlt.User != "" {
-		messageData["rawSenderAlt"] = msg.Info.SenderAlt.String()
+		message.SenderAlt = msg.Info.SenderAlt.String()
+	}
+	if client.deviceStore.ID != nil {
+		message.MyPhone = client.deviceStore.ID.User
 	}
 
 	// Flag unresolved LID for additional handling
 	if isUnresolvedLID {
-		messageData["isLID"] = true
 		fmt.Printf("[Webhook Warning] ⚠️ Unresolved LID detected: %s - SenderAlt was: %s\n", fromUser, msg.Info.SenderAlt.String())
 	}
 
 	// Determine message type and extract content
-	var mentions []string
-
+	var contextInfo *waE2E.ContextInfo
 	switch {
 	case msg.Message.GetConversation() != "":
-		// Text message
-		messageData["type"] = "text"
-		messageData["text"] = msg.Message.GetConversation()
+		message.Type = "text"
+		message.Text = msg.Message.GetConversation()
 
 	case msg.Message.GetExtendedTextMessage() != nil:
 		// Extended text message (reply, mention, etc.)
 		extMsg := msg.Message.GetExtendedTextMessage()
-		messageData["type"] = "text"
-		messageData["text"] = extMsg.GetText()
-
-		// Extract mentions
-		if extMsg.ContextInfo != nil {
-			for _, mentionedJID := range extMsg.ContextInfo.MentionedJID {
-				mentions = append(mentions, mentionedJID)
-			}
-		}
+		message.Type = "text"
+		message.Text = extMsg.GetText()
+		contextInfo = extMsg.GetContextInfo()
 
 	case msg.Message.GetImageMessage() != nil:
-		// Image message
 		imgMsg := msg.Message.GetImageMessage()
-		messageData["type"] = "image"
-		messageData["caption"] = imgMsg.GetCaption()
-		messageData["mimeType"] = imgMsg.GetMimetype()
-		messageData["width"] = imgMsg.GetWidth()
-		messageData["height"] = imgMsg.GetHeight()
-		if imgMsg.GetFileLength() > 0 {
-			messageData["fileSize"] = imgMsg.GetFileLength()
-		}
-
-		// Extract mentions
-		if imgMsg.ContextInfo != nil {
-			for _, mentionedJID := range imgMsg.ContextInfo.MentionedJID {
-				mentions = append(mentions, mentionedJID)
-			}
-		}
+		message.Type = "image"
+		message.Caption = imgMsg.GetCaption()
+		message.Media = newWebhookMedia(imgMsg.GetMimetype(), imgMsg.GetFileLength(), imgMsg.GetWidth(), imgMsg.GetHeight(), "")
+		contextInfo = imgMsg.GetContextInfo()
 
 	case msg.Message.GetVideoMessage() != nil:
-		// Video message
 		vidMsg := msg.Message.GetVideoMessage()
-		messageData["type"] = "video"
-		messageData["caption"] = vidMsg.GetCaption()
-		messageData["mimeType"] = vidMsg.GetMimetype()
-		if vidMsg.GetFileLength() > 0 {
-			messageData["fileSize"] = vidMsg.GetFileLength()
-		}
+		message.Type = "video"
+		message.Caption = vidMsg.GetCaption()
+		message.Media = newWebhookMedia(vidMsg.GetMimetype(), vidMsg.GetFileLength(), vidMsg.GetWidth(), vidMsg.GetHeight(), "")
+		contextInfo = vidMsg.GetContextInfo()
 
-		// Extract mentions
-		if vidMsg.ContextInfo != nil {
-			for _, mentionedJID := range vidMsg.ContextInfo.MentionedJID {
-				mentions = append(mentions, mentionedJID)
-			}
-		}
+	case msg.Message.GetAudioMessage() != nil:
+		audioMsg := msg.Message.GetAudioMessage()
+		message.Type = "audio"
+		message.Media = newWebhookMedia(audioMsg.GetMimetype(), audioMsg.GetFileLength(), 0, 0, "")
+		contextInfo = audioMsg.GetContextInfo()
+
+	case msg.Message.GetDocumentMessage() != nil:
+		docMsg := msg.Message.GetDocumentMessage()
+		message.Type = "document"
+		message.Caption = docMsg.GetCaption()
+		message.Media = newWebhookMedia(docMsg.GetMimetype(), docMsg.GetFileLength(), 0, 0, docMsg.GetFileName())
+		contextInfo = docMsg.GetContextInfo()
 
 	case msg.Message.GetLiveLocationMessage() != nil:
-		// Live location message
 		locMsg := msg.Message.GetLiveLocationMessage()
-		messageData["type"] = "live_location"
-		messageData["latitude"] = locMsg.GetDegreesLatitude()
-		messageData["longitude"] = locMsg.GetDegreesLongitude()
-		messageData["accuracy"] = locMsg.GetAccuracyInMeters()
-		messageData["speed"] = locMsg.GetSpeedInMps()
-		messageData["bearing"] = locMsg.GetDegreesClockwiseFromMagneticNorth()
-		messageData["caption"] = locMsg.GetCaption()
-
-		// Extract mentions
-		if locMsg.ContextInfo != nil {
-			for _, mentionedJID := range locMsg.ContextInfo.MentionedJID {
-				mentions = append(mentions, mentionedJID)
-			}
+		message.Type = "live_location"
+		message.Caption = locMsg.GetCaption()
+		accuracy := locMsg.GetAccuracyInMeters()
+		speed := locMsg.GetSpeedInMps()
+		bearing := locMsg.GetDegreesClockwiseFromMagneticNorth()
+		message.Location = &WebhookLocationV2{
+			Latitude:  locMsg.GetDegreesLatitude(),
+			Longitude: locMsg.GetDegreesLongitude(),
+			Accuracy:  &accuracy,
+			Speed:     &speed,
+			Bearing:   &bearing,
 		}
+		contextInfo = locMsg.GetContextInfo()
 
 		fmt.Printf("[Location] Live location received: lat=%.6f, lng=%.6f, accuracy=%dm\n",
 			locMsg.GetDegreesLatitude(), locMsg.GetDegreesLongitude(), locMsg.GetAccuracyInMeters())
 
 	case msg.Message.GetLocationMessage() != nil:
-		// Static location message
 		locMsg := msg.Message.GetLocationMessage()
-		messageData["type"] = "location"
-		messageData["latitude"] = locMsg.GetDegreesLatitude()
-		messageData["longitude"] = locMsg.GetDegreesLongitude()
-		messageData["name"] = locMsg.GetName()
-		messageData["address"] = locMsg.GetAddress()
-		if locMsg.GetURL() != "" {
-			messageData["url"] = locMsg.GetURL()
-		}
-
-		// Extract mentions
-		if locMsg.ContextInfo != nil {
-			for _, mentionedJID := range locMsg.ContextInfo.MentionedJID {
-				mentions = append(mentions, mentionedJID)
-			}
+		message.Type = "location"
+		message.Location = &WebhookLocationV2{
+			Latitude:  locMsg.GetDegreesLatitude(),
+			Longitude: locMsg.GetDegreesLongitude(),
+			Name:      locMsg.GetName(),
+			Address:   locMsg.GetAddress(),
+			URL:       locMsg.GetURL(),
 		}
+		contextInfo = locMsg.GetContextInfo()
 
 		fmt.Printf("[Location] Static location received: lat=%.6f, lng=%.6f, name=%s\n",
 			locMsg.GetDegreesLatitude(), locMsg.GetDegreesLongitude(), locMsg.GetName())
 
 	default:
-		// Other message types
-		messageData["type"] = "other"
+		message.Type = "other"
 	}
 
-	// Add mentions to message data
-	if len(mentions) > 0 {
-		messageData["mentions"] = mentions
-	}
-
-	// Add isGroup flag and myPhone
-	messageData["isGroup"] = msg.Info.IsGroup
-	if client.deviceStore.ID != nil {
-		messageData["myPhone"] = client.deviceStore.ID.User
+	if contextInfo != nil {
+		message.Mentions = append(message.Mentions, contextInfo.GetMentionedJID()...)
 	}
 
 	// Add file access URL if media file was downloaded
-	if messageData["type"] != "text" {
-		client.mutex.RLock()
-		if _, exists := client.images[msg.Info.ID]; exists {
-			// Use clientID directly (it's already a UUID, no need to sanitize)
-			messageData["fileUrl"] = fmt.Sprintf("%s/files/%s/%s", baseURL, clientID, msg.Info.ID)
-		}
-		client.mutex.RUnlock()
+	client.mutex.RLock()
+	if _, exists := client.images[msg.Info.ID]; exists && message.Media != nil {
+		fileURL := fmt.Sprintf("%s/files/%s/%s", baseURL, clientID, msg.Info.ID)
+		message.Media.FileURL = &fileURL
 	}
+	client.mutex.RUnlock()
 
-	return map[string]interface{}{
-		"clientId":  clientID,
-		"message":   messageData,
-		"timestamp": time.Now().Unix(),
-	}
+	return clientID, message
 }
 
 func loadExistingClients(container *sqlstore.Container) error {
@@ -2477,22 +2400,31 @@ func loadExistingClients(container *sqlstore.Container) error {
 
 	for i, deviceStore := range devices {
 		fmt.Printf("Loading device %d/%d: ID=%v\n", i+1, len(devices), deviceStore.ID)
-		clientLog := waLog.Stdout("Client", "DEBUG", true)
-		client := whatsmeow.NewClient(deviceStore, clientLog)
+		// Sandbox sessions can't connect to WhatsApp, and real sessions must not be driven by the
+		// simulated transport, where scheduled sends and injected logouts would act on them
+		if isSandboxDevice(deviceStore) != appConfig().Sandbox.Enabled {
+			if appConfig().Sandbox.Enabled {
+				fmt.Printf("Skipping device %v, sandbox mode only loads sessions paired in sandbox mode\n", deviceStore.ID)
+			} else {
+				fmt.Printf("Skipping device %v, it was paired in sandbox mode and can't connect to WhatsApp\n", deviceStore.ID)
+			}
+			manager.mutex.Lock()
+			if clientID, ok := manager.clientIDMap[deviceStore.ID.String()]; ok {
+				manager.skippedClients[clientID] = true
+			}
+			manager.mutex.Unlock()
+			continue
+		}
 
 		waClient := &WhatsAppClient{
-			client:       client,
 			deviceStore:  deviceStore,
-			isConnected:  false,
+			status:       newConnectionStatus(StateDisconnected, "startup"),
 			messages:     make([]string, 0),
 			images:       make(map[string]string),
-			osName:       "", // Empty for existing clients
 			typingTimers: make(map[string]*time.Timer),
 			typingActive: make(map[string]bool),
 		}
 
-		client.AddEventHandler(manager.eventHandler(waClient))
-
 		// Use UUID from mapping if available, otherwise generate deterministic UUID from WhatsApp ID
 		whatsappID := deviceStore.ID.String()
 		manager.mutex.Lock()
@@ -2505,23 +2437,34 @@ func loadExistingClients(container *sqlstore.Container) error {
 			fmt.Printf("Generated new UUID for existing client %s: %s\n", whatsappID, clientID)
 			// Save the new mapping
 			manager.mutex.Unlock()
-			if err := manager.saveClientMappings(); err != nil {
-				fmt.Printf("Warning: Failed to save client mappings: %v\n", err)
+			if err := manager.storeClientMapping(whatsappID, clientID); err != nil {
+				fmt.Printf("Warning: Failed to save client mapping: %v\n", err)
 			}
 			manager.mutex.Lock()
 		} else {
 			fmt.Printf("Using existing UUID for client %s: %s\n", whatsappID, clientID)
 		}
+		waClient.id = clientID
+		waClient.settings = manager.loadClientSettings(clientID)
+		waClient.device, _ = manager.loadDeviceIdentity(clientID)
+		client := manager.newTransport(deviceStore, waClient.device)
+		waClient.client = client
+		client.AddEventHandler(manager.eventHandler(waClient))
 		manager.clients[clientID] = waClient
 		manager.mutex.Unlock()
 
 		// Auto-connect if device has existing session
-		if client.Store.ID != nil {
-			fmt.Printf("Attempting to auto-reconnect client %s (Device ID: %s)\n", clientID, client.Store.ID.String())
+		if deviceStore.ID != nil {
+			fmt.Printf("Attempting to auto-reconnect client %s (Device ID: %s)\n", clientID, deviceStore.ID.String())
 			localClientID := clientID // Capture for closure
+			manager.setState(waClient, StateConnecting, "startup")
 			go func() {
 				err := client.Connect()
 				if err != nil {
+					// Let the supervisor retry, e.g. when the network isn't up yet
+					waClient.mutex.Lock()
+					manager.connectionLostLocked(waClient, fmt.Sprintf("connect failed: %v", err))
+					waClient.mutex.Unlock()
 					fmt.Printf("Failed to reconnect client %s: %v\n", localClientID, err)
 				} else {
 					fmt.Printf("Successfully reconnected client %s\n", localClientID)
@@ -2564,18 +2507,25 @@ func recreatePendingClients(container *sqlstore.Container) error {
 			continue
 		}
 
-		clientLog := waLog.Stdout("Client", "DEBUG", true)
-		client := whatsmeow.NewClient(deviceStore, clientLog)
+		// Clients created before device identities were stored only have an OS name
+		device, found := manager.loadDeviceIdentity(clientID)
+		if !found {
+			device = DeviceIdentity{OSName: pendingClient.OSName}.normalize()
+		}
+
+		client := manager.newTransport(deviceStore, device)
 
 		waClient := &WhatsAppClient{
+			id:           clientID,
 			client:       client,
 			deviceStore:  deviceStore,
-			isConnected:  false,
+			status:       newConnectionStatus(StatePairing, "startup"),
 			messages:     make([]string, 0),
 			images:       make(map[string]string),
-			osName:       pendingClient.OSName,
+			device:       device,
 			typingTimers: make(map[string]*time.Timer),
 			typingActive: make(map[string]bool),
+			settings:     manager.loadClientSettings(clientID),
 		}
 
 		client.AddEventHandler(manager.eventHandler(waClient))
@@ -2584,30 +2534,7 @@ func recreatePendingClients(container *sqlstore.Container) error {
 		fmt.Printf("Successfully recreated pending client: %s\n", clientID)
 
 		// Start connection process in background
-		localClientID := clientID
-		localWaClient := waClient
-		go func() {
-			qrChan, err := localWaClient.client.GetQRChannel(context.Background())
-			if err != nil {
-				fmt.Printf("Failed to get QR channel for pending client %s: %v\n", localClientID, err)
-				return
-			}
-
-			err = localWaClient.client.Connect()
-			if err != nil {
-				fmt.Printf("Failed to connect pending client %s: %v\n", localClientID, err)
-				return
-			}
-
-			for evt := range qrChan {
-				if evt.Event == "code" {
-					localWaClient.mutex.Lock()
-					localWaClient.qrCode = evt.Code
-					localWaClient.mutex.Unlock()
-					fmt.Printf("QR code received for pending client %s\n", localClientID)
-				}
-			}
-		}()
+		manager.startPairingConnection(clientID, waClient)
 	}
 
 	fmt.Printf("Finished recreating %d pending client(s)\n", len(manager.pendingClients))
@@ -2633,7 +2560,7 @@ func startTypingHandler(c *gin.Context) {
 		return
 	}
 
-	if !waClient.isConnected {
+	if !waClient.connected() {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "client is not connected"})
 		return
 	}
@@ -2646,22 +2573,16 @@ func startTypingHandler(c *gin.Context) {
 		return
 	}
 
-	// Format phone number
-	targetJID := strings.TrimSuffix(req.Phone, "@s.whatsapp.net")
-	if !strings.Contains(targetJID, "@") {
-		targetJID += "@s.whatsapp.net"
-	}
-
-	// Parse JID
-	targetJIDParsed, err := types.ParseJID(targetJID)
+	// Normalize the phone number and build the JID
+	targetJIDParsed, normalizedPhone, err := waClient.parseRecipient(req.Phone)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid phone number format: %v", err)})
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid phone number: %v", err)})
 		return
 	}
 
 	// Start typing
 	manager.startTyping(waClient, targetJIDParsed)
-	c.JSON(http.StatusOK, gin.H{"success": true})
+	c.JSON(http.StatusOK, gin.H{"success": true, "phone": normalizedPhone})
 }
 
 // @Summary Stop typing indicator
@@ -2683,7 +2604,7 @@ func stopTypingHandler(c *gin.Context) {
 		return
 	}
 
-	if !waClient.isConnected {
+	if !waClient.connected() {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "client is not connected"})
 		return
 	}
@@ -2696,90 +2617,88 @@ func stopTypingHandler(c *gin.Context) {
 		return
 	}
 
-	// Format phone number
-	targetJID := strings.TrimSuffix(req.Phone, "@s.whatsapp.net")
-	if !strings.Contains(targetJID, "@") {
-		targetJID += "@s.whatsapp.net"
-	}
-
-	// Parse JID
-	targetJIDParsed, err := types.ParseJID(targetJID)
+	// Normalize the phone number and build the JID
+	targetJIDParsed, normalizedPhone, err := waClient.parseRecipient(req.Phone)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid phone number format: %v", err)})
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid phone number: %v", err)})
 		return
 	}
 
 	// Stop typing
 	manager.stopTyping(waClient, targetJIDParsed)
-	c.JSON(http.StatusOK, gin.H{"success": true})
+	c.JSON(http.StatusOK, gin.H{"success": true, "phone": normalizedPhone})
 }
 
 func main() {
+	// Subcommands run instead of the server
+	args := os.Args[1:]
+	if len(args) > 0 && args[0] == "serve" {
+		args = args[1:]
+	} else if len(args) > 0 && (!strings.HasPrefix(args[0], "-") || args[0] == "-h" || args[0] == "--help") {
+		os.Exit(runCommand(args[0], args[1:]))
+	}
+	if err := parseServeFlags(args); err != nil {
+		os.Exit(2)
+	}
+
 	fmt.Println("Starting Aimeow WhatsApp API Server...")
 
-	// Initialize base URL from environment variable
-	baseURL = os.Getenv("BASE_URL")
-	if baseURL == "" {
-		baseURL = "http://localhost:7030"
+	// Load the configuration file and environment overrides; invalid settings stop the server
+	cfg, err := loadAppConfig()
+	if err != nil {
+		panic(fmt.Errorf("invalid configuration: %w", err))
+	}
+	currentAppConfig.Store(&cfg)
+	if cfg.File != "" {
+		fmt.Printf("Configuration file: %s\n", cfg.File)
 	}
+	if len(cfg.FromEnv) > 0 {
+		fmt.Printf("Configuration overridden by environment: %s\n", strings.Join(cfg.FromEnv, ", "))
+	}
+
+	baseURL = cfg.Server.BaseURL
 	fmt.Printf("Base URL: %s\n", baseURL)
+	fmt.Printf("Idempotency window: %s\n", time.Duration(cfg.Clients.IdempotencyTTL))
+	fmt.Printf("Reconnect backoff: max %d attempts, max delay %s\n", cfg.Reconnect.MaxAttempts, time.Duration(cfg.Reconnect.MaxDelay))
+	if cfg.Sandbox.Enabled {
+		fmt.Printf("[Sandbox] Sandbox mode: WhatsApp is simulated, nothing is sent to WhatsApp\n")
+	}
 
 	// Initialize database
-	dbLog := waLog.Stdout("Database", "DEBUG", true)
+	dbLog := waLog.Stdout("Database", cfg.Logging.Level, true)
 	ctx := context.Background()
 
-	// Determine data directory - use DATA_DIR env var or default to data/aimeow
-	dataDir = os.Getenv("DATA_DIR")
-	if dataDir == "" {
-		// Default to data/aimeow relative to current working directory
-		dataDir = "data/aimeow"
-	}
+	// Determine data directory - storage.dataDir (DATA_DIR), default data/aimeow
+	dataDir = cfg.Storage.DataDir
 
-	// Create data directory if it does not exist
+	// Create data directory if it does not exist. Media is always stored here, so an unusable
+	// directory stops the server instead of silently losing data.
 	if err := os.MkdirAll(dataDir, 0755); err != nil {
-		fmt.Printf("Warning: Failed to create data directory: %v\n", err)
-		// Try alternative directory
-		dataDir = "/tmp/aimeow"
-		if err := os.MkdirAll(dataDir, 0755); err != nil {
-			panic(fmt.Errorf("failed to create alternative data directory: %w", err))
-		}
-		fmt.Printf("Using alternative data directory: %s\n", dataDir)
+		panic(fmt.Errorf("failed to create data directory %s: %w; set storage.dataDir (DATA_DIR) to a writable directory", dataDir, err))
 	}
 	fmt.Printf("Using data directory: %s\n", dataDir)
 
-	// Create database path
-	dbPath := filepath.Join(dataDir, "aimeow.db")
-	fmt.Printf("Database path: %s\n", dbPath)
-
-	// Check if database file exists
-	if _, err := os.Stat(dbPath); err == nil {
-		fmt.Printf("Database file already exists: %s\n", dbPath)
-	} else {
-		// Database doesn't exist, test if we can create it
-		dbFile, err := os.Create(dbPath)
-		if err != nil {
-			fmt.Printf("Warning: Cannot create database file: %v\n", err)
-			// Try alternative location in /tmp
-			dbPath = "/tmp/aimeow.db"
-			fmt.Printf("Using fallback database path: %s\n", dbPath)
-		} else {
-			dbFile.Close()
-			os.Remove(dbPath) // Remove empty test file, let sqlstore create it properly
-			fmt.Printf("Database file creation test successful\n")
-		}
-	}
-
-	fmt.Printf("Initializing database container at: %s\n", dbPath)
-	container, err := sqlstore.New(ctx, "sqlite3", fmt.Sprintf("file:%s?_foreign_keys=on", dbPath), dbLog)
+	db, err := openDatabase(cfg)
 	if err != nil {
+		panic(err)
+	}
+	container := sqlstore.NewWithDB(db, dbDialect, dbLog)
+	if err := container.Upgrade(ctx); err != nil {
 		panic(fmt.Errorf("failed to initialize database container: %w", err))
 	}
 	fmt.Printf("Database container initialized successfully\n")
 
-	// Initialize client manager with config path
-	configPath := filepath.Join(dataDir, "config.json")
-	fmt.Printf("Configuration file path: %s\n", configPath)
-	manager = NewClientManager(container, configPath)
+	// The aimeow tables share the database with the whatsmeow session store
+	if err := initAimeowTables(ctx, db); err != nil {
+		panic(fmt.Errorf("failed to initialize aimeow tables: %w", err))
+	}
+
+	// Client state used to live in JSON files in the data directory
+	if err := importLegacyClientState(ctx, db, dataDir); err != nil {
+		fmt.Printf("[Migrate] Warning: %v\n", err)
+	}
+
+	manager = NewClientManager(container, db)
 
 	// Load existing clients
 	fmt.Printf("Loading existing clients...\n")
@@ -2796,6 +2715,14 @@ func main() {
 		fmt.Printf("Failed to recreate pending clients: %v\n", err)
 	}
 
+	// Start dispatching scheduled messages, including ones that became due while we were down
+	go manager.runScheduler()
+	go watchConfigReload()
+	go manager.runWatchdog()
+
+	// Continue broadcasts that were running when the service stopped
+	manager.resumeBroadcasts()
+
 	// Setup Gin router
 	fmt.Printf("Setting up Gin router...\n")
 	gin.SetMode(gin.ReleaseMode)
@@ -2805,7 +2732,8 @@ func main() {
 	config := cors.DefaultConfig()
 	config.AllowAllOrigins = true
 	config.AllowMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD", "OPTIONS"}
-	config.AllowHeaders = []string{"Origin", "Content-Length", "Content-Type", "Authorization"}
+	config.AllowHeaders = []string{"Origin", "Content-Length", "Content-Type", "Authorization", idempotencyKeyHeader}
+	config.ExposeHeaders = []string{"X-Total-Count", "Idempotent-Replayed"}
 	r.Use(cors.New(config))
 	fmt.Printf("CORS configured\n")
 
@@ -2817,17 +2745,44 @@ func main() {
 			clients.POST("/new", createClient)
 			clients.GET("", getAllClients)
 			clients.GET("/:id", getClient)
+			clients.PATCH("/:id", updateClientMetadata)
 			clients.GET("/:id/qr", getQRCode)
+			clients.GET("/:id/qr.png", getQRCodePNG)
+			clients.GET("/:id/qr.svg", getQRCodeSVG)
 			clients.GET("/:id/messages", getMessages)
 			clients.DELETE("/:id", deleteClient)
 
+			// Connection lifecycle endpoints
+			clients.POST("/:id/disconnect", disconnectClient)
+			clients.POST("/:id/reconnect", reconnectClient)
+			clients.POST("/:id/logout", logoutClient)
+			clients.POST("/:id/pair-phone", pairPhone)
+
 			// Send message endpoints
-			clients.POST("/:id/send-message", sendMessage)
-			clients.POST("/:id/send-image", sendImage)
-			clients.POST("/:id/send-images", sendMultipleImages)
-			clients.POST("/:id/send-document", sendDocument)
-			clients.POST("/:id/send-document-base64", sendDocumentBase64)
-			clients.POST("/:id/delete-message", deleteMessage)
+			// Send and delete endpoints accept an Idempotency-Key header for safe retries
+			clients.POST("/:id/send-message", idempotent(sendMessage))
+			clients.POST("/:id/send-image", idempotent(sendImage))
+			clients.POST("/:id/send-images", idempotent(sendMultipleImages))
+			clients.POST("/:id/send-document", idempotent(sendDocument))
+			clients.POST("/:id/send-document-base64", idempotent(sendDocumentBase64))
+			clients.POST("/:id/delete-message", idempotent(deleteMessage))
+
+			// Scheduled message endpoints
+			clients.POST("/:id/scheduled", idempotent(createScheduledMessage))
+			clients.GET("/:id/scheduled", listScheduledMessages)
+			clients.DELETE("/:id/scheduled/:scheduled_id", cancelScheduledMessage)
+
+			// Broadcast endpoints
+			clients.POST("/:id/broadcasts", idempotent(createBroadcast))
+			clients.GET("/:id/broadcasts", listBroadcasts)
+			clients.GET("/:id/broadcasts/:broadcast_id", getBroadcast)
+			clients.POST("/:id/broadcasts/:broadcast_id/pause", pauseBroadcast)
+			clients.POST("/:id/broadcasts/:broadcast_id/resume", resumeBroadcast)
+			clients.POST("/:id/broadcasts/:broadcast_id/cancel", cancelBroadcast)
+
+			// Client settings endpoints
+			clients.GET("/:id/settings", getClientSettings)
+			clients.PATCH("/:id/settings", updateClientSettings)
 
 			// Typing indicator endpoints
 			clients.POST("/:id/start-typing", startTypingHandler)
@@ -2836,11 +2791,35 @@ func main() {
 			// Contact info endpoints
 			clients.GET("/:id/profile-picture/:phone", getProfilePicture)
 			clients.GET("/:id/check-whatsapp/:phone", checkWhatsApp)
+			clients.GET("/:id/resolve/:jid", resolveJID)
+			clients.POST("/:id/resolve", bulkResolveJIDs)
+			clients.GET("/:id/contacts", getContacts)
+			clients.GET("/:id/contacts/:jid", getContact)
+
+			// Chat history endpoints
+			clients.GET("/:id/chats", getChats)
+			clients.GET("/:id/chats/:jid/messages", getChatMessages)
+			clients.GET("/:id/chats/:jid/export", exportChat)
+			clients.GET("/:id/search", searchMessages)
 		}
 
 		// Config endpoints
 		v1.POST("/config", setConfig)
 		v1.GET("/config", getConfig)
+		v1.GET("/webhooks/schema", getWebhookSchema)
+
+		// Admin endpoints
+		admin := v1.Group("/admin")
+		{
+			// Backups hold the session keys, so they are only served with an admin token
+			if cfg.Storage.AdminToken != "" {
+				admin.POST("/backup", requireAdminToken, createBackup)
+				admin.POST("/restore", requireAdminToken, restoreBackupHandler)
+			}
+			if cfg.Sandbox.Enabled {
+				admin.POST("/sandbox/clients/:id/events", injectSandboxEvent)
+			}
+		}
 
 		// QR code HTML endpoint
 		r.GET("/qr", getQRCodeHTML)
@@ -2865,10 +2844,7 @@ func main() {
 	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 	fmt.Printf("Swagger documentation configured\n")
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "7030"
-	}
+	port := strconv.Itoa(cfg.Server.Port)
 	fmt.Printf("Aimeow WhatsApp API Server starting on :%s\n", port)
 	fmt.Printf("Swagger UI: %s/swagger/index.html\n", baseURL)
 	fmt.Printf("API Health: %s/health\n", baseURL)
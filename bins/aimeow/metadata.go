@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Limits for client labels and metadata
+const (
+	maxClientLabels        = 50
+	maxClientLabelLength   = 64
+	maxClientMetadataKeys  = 50
+	maxClientMetadataValue = 1024
+)
+
+// Client list page size limit
+const maxClientsPageSize = 500
+
+// ClientMetadata holds the ownership and free-form information of a client. It is stored by
+// client ID, apart from the device mapping, so it survives restarts and re-pairing.
+type ClientMetadata struct {
+	TenantID string            `json:"tenantId,omitempty"` // Tenant or project that owns the client
+	Labels   []string          `json:"labels,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// UpdateClientMetadataRequest changes only the fields that are present. Labels and metadata
+// replace the stored values as a whole.
+type UpdateClientMetadataRequest struct {
+	TenantID *string            `json:"tenantId,omitempty"`
+	Labels   *[]string          `json:"labels,omitempty"`
+	Metadata *map[string]string `json:"metadata,omitempty"`
+}
+
+// apply merges the fields present in the request into the metadata
+func (req UpdateClientMetadataRequest) apply(meta ClientMetadata) ClientMetadata {
+	if req.TenantID != nil {
+		meta.TenantID = *req.TenantID
+	}
+	if req.Labels != nil {
+		meta.Labels = normalizeLabels(*req.Labels)
+	}
+	if req.Metadata != nil {
+		meta.Metadata = *req.Metadata
+	}
+	return meta
+}
+
+// normalizeLabels removes empty and duplicate labels and sorts the rest
+func normalizeLabels(labels []string) []string {
+	seen := make(map[string]bool)
+	result := make([]string, 0, len(labels))
+	for _, label := range labels {
+		if label == "" || seen[label] {
+			continue
+		}
+		seen[label] = true
+		result = append(result, label)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// validate checks the metadata against the size limits
+func (meta ClientMetadata) validate() error {
+	if len(meta.Labels) > maxClientLabels {
+		return fmt.Errorf("a client can have at most %d labels", maxClientLabels)
+	}
+	for _, label := range meta.Labels {
+		if len(label) > maxClientLabelLength {
+			return fmt.Errorf("label %q is longer than %d characters", label, maxClientLabelLength)
+		}
+	}
+	if len(meta.Metadata) > maxClientMetadataKeys {
+		return fmt.Errorf("a client can have at most %d metadata keys", maxClientMetadataKeys)
+	}
+	for key, value := range meta.Metadata {
+		if key == "" {
+			return fmt.Errorf("metadata keys must not be empty")
+		}
+		if len(value) > maxClientMetadataValue {
+			return fmt.Errorf("metadata value for %q is longer than %d characters", key, maxClientMetadataValue)
+		}
+	}
+	return nil
+}
+
+// hasLabels reports whether the metadata carries all the given labels
+func (meta ClientMetadata) hasLabels(labels []string) bool {
+	for _, want := range labels {
+		found := false
+		for _, label := range meta.Labels {
+			if label == want {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// getClientMetadata returns the metadata of a client
+func (cm *ClientManager) getClientMetadata(clientID string) ClientMetadata {
+	cm.mutex.RLock()
+	defer cm.mutex.RUnlock()
+	return cm.clientMetadata[clientID]
+}
+
+// setClientMetadata stores the metadata of a client
+func (cm *ClientManager) setClientMetadata(clientID string, meta ClientMetadata) error {
+	cm.mutex.Lock()
+	if meta.TenantID == "" && len(meta.Labels) == 0 && len(meta.Metadata) == 0 {
+		delete(cm.clientMetadata, clientID)
+	} else {
+		cm.clientMetadata[clientID] = meta
+	}
+	cm.mutex.Unlock()
+
+	return cm.storeClientMetadata(clientID, meta)
+}
+
+// buildClientResponse describes a client for the API. The caller must hold the client's read lock.
+func buildClientResponse(clientID string, client *WhatsAppClient, meta ClientMetadata) ClientResponse {
+	resp := ClientResponse{
+		ID:           clientID,
+		IsConnected:  client.status.State == StateConnected,
+		State:        client.status.State,
+		StateSince:   client.status.Since,
+		StateReason:  client.status.Reason,
+		Reconnect:    client.reconnect,
+		QRCode:       client.qrCode,
+		ConnectedAt:  client.connectedAt,
+		MessageCount: len(client.messages),
+		OSName:       client.device.OSName,
+		Device:       client.device,
+		TenantID:     meta.TenantID,
+		Labels:       meta.Labels,
+		Metadata:     meta.Metadata,
+	}
+	// Add phone number if device is connected
+	if client.deviceStore != nil && client.deviceStore.ID != nil {
+		resp.Phone = client.deviceStore.ID.User
+	}
+	if resp.QRCode == "" {
+		resp.QRCode = "not_available"
+	}
+	return resp
+}
+
+// @Summary Update client metadata
+// @Description Updates the tenant, labels and metadata of a client. Only the fields present are changed; labels and metadata are replaced as a whole.
+// @Tags clients
+// @Accept json
+// @Produce json
+// @Param id path string true "Client ID"
+// @Param metadata body UpdateClientMetadataRequest true "Metadata to change"
+// @Success 200 {object} ClientResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /clients/{id} [patch]
+func updateClientMetadata(c *gin.Context) {
+	clientID := c.Param("id")
+
+	waClient, err := manager.getClient(clientID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	var req UpdateClientMetadataRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	meta := req.apply(manager.getClientMetadata(clientID))
+	if err := meta.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := manager.setClientMetadata(clientID, meta); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	waClient.mutex.RLock()
+	resp := buildClientResponse(clientID, waClient, meta)
+	waClient.mutex.RUnlock()
+
+	c.JSON(http.StatusOK, resp)
+}
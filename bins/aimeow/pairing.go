@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// How long pairPhone waits for the connection to be ready for pairing
+const pairReadyTimeout = 20 * time.Second
+
+type PairPhoneRequest struct {
+	Phone        string `json:"phone" binding:"required"` // Phone number of the account, international or national format
+	OSName       string `json:"osName,omitempty"`         // Used when the client has to be created
+	PlatformType string `json:"platformType,omitempty"`   // Used when the client has to be created
+	BrowserLabel string `json:"browserLabel,omitempty"`   // Used when the client has to be created
+}
+
+type PairPhoneResponse struct {
+	ID          string `json:"id"`
+	Phone       string `json:"phone"`       // Normalized to E.164
+	PairingCode string `json:"pairingCode"` // 8 character code to enter on the phone
+}
+
+// waitForPairingReady waits until the client has received its first QR code, which is when
+// whatsmeow accepts pairing code requests
+func waitForPairingReady(waClient *WhatsAppClient, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		waClient.mutex.RLock()
+		ready := waClient.qrCode != ""
+		waClient.mutex.RUnlock()
+		if ready {
+			return true
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+	return false
+}
+
+// @Summary Pair client with phone number
+// @Description Requests an 8 character linking code for a phone number, to be entered on the phone under Linked devices > Link with phone number. The client is created and kept as pending if it doesn't exist yet.
+// @Tags clients
+// @Accept json
+// @Produce json
+// @Param id path string true "Client ID"
+// @Param request body PairPhoneRequest true "Phone number to pair"
+// @Success 200 {object} PairPhoneResponse
+// @Failure 400 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Failure 504 {object} map[string]string
+// @Router /clients/{id}/pair-phone [post]
+func pairPhone(c *gin.Context) {
+	clientID := c.Param("id")
+
+	var req PairPhoneRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// National numbers use the default country of the client, or the server's for new clients
+	country := appConfig().Clients.DefaultCountry
+	waClient, err := manager.getClient(clientID)
+	if err == nil {
+		country = waClient.defaultCountry()
+	}
+	phone, phoneErr := normalizePhone(req.Phone, country)
+	if phoneErr != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid phone number: %v", phoneErr)})
+		return
+	}
+
+	if err != nil && manager.isSkippedClient(clientID) {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("client %s has a session paired in the other mode (sandbox or real) and can't be used in this mode", clientID)})
+		return
+	} else if err != nil {
+		// Unknown IDs are created the same way as POST /clients/new, so they survive restarts
+		device := DeviceIdentity{OSName: req.OSName, PlatformType: req.PlatformType, BrowserLabel: req.BrowserLabel}
+		if err := device.normalize().validate(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		waClient, _, err = manager.createClient(device, clientID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		manager.startPairingConnection(clientID, waClient)
+	} else if waClient.deviceStore.ID != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "client is already paired"})
+		return
+	} else if !waClient.client.IsConnected() {
+		// The QR codes ran out and the socket was closed, start a new pairing connection
+		manager.startPairingConnection(clientID, waClient)
+	}
+
+	if !waitForPairingReady(waClient, pairReadyTimeout) {
+		c.JSON(http.StatusGatewayTimeout, gin.H{"error": "timed out waiting for the connection to be ready for pairing"})
+		return
+	}
+
+	waClient.mutex.RLock()
+	device := waClient.device
+	waClient.mutex.RUnlock()
+
+	code, err := waClient.client.PairPhone(context.Background(), strings.TrimPrefix(phone, "+"), true, device.pairClientType(), device.pairDisplayName())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Failed to request pairing code: %v", err)})
+		return
+	}
+
+	fmt.Printf("Pairing code requested for client %s (phone %s)\n", clientID, phone)
+	go manager.sendConnectionStatusWebhook(clientID, "pair_code", map[string]interface{}{
+		"phone":       phone,
+		"pairingCode": code,
+	})
+
+	c.JSON(http.StatusOK, PairPhoneResponse{
+		ID:          clientID,
+		Phone:       phone,
+		PairingCode: code,
+	})
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+// phoneCountry describes how numbers of a country are written. Lengths are of the national
+// significant number, i.e. without the country code and trunk prefix.
+type phoneCountry struct {
+	ISO         string // ISO 3166-1 alpha-2 code, e.g. ID
+	CallingCode string // Country calling code without +, e.g. 62
+	TrunkPrefix string // Prefix dialled before national numbers, e.g. 0; empty if the country has none
+	MinLength   int
+	MaxLength   int
+}
+
+// phoneCountries lists the countries whose numbers can be validated and converted from the
+// national format. Numbers of other countries are only checked against the E.164 length limits.
+var phoneCountries = []phoneCountry{
+	{"AE", "971", "0", 8, 9},
+	{"AR", "54", "0", 10, 11},
+	{"AT", "43", "0", 4, 13},
+	{"AU", "61", "0", 9, 9},
+	{"BD", "880", "0", 8, 10},
+	{"BE", "32", "0", 8, 9},
+	{"BR", "55", "0", 10, 11},
+	{"CA", "1", "", 10, 10},
+	{"CH", "41", "0", 9, 9},
+	{"CL", "56", "", 9, 9},
+	{"CN", "86", "0", 9, 11},
+	{"CO", "57", "", 10, 10},
+	{"DE", "49", "0", 6, 13},
+	{"DK", "45", "", 8, 8},
+	{"EG", "20", "0", 8, 10},
+	{"ES", "34", "", 9, 9},
+	{"FI", "358", "0", 5, 12},
+	{"FR", "33", "0", 9, 9},
+	{"GB", "44", "0", 9, 10},
+	{"HK", "852", "", 8, 8},
+	{"ID", "62", "0", 8, 12},
+	{"IE", "353", "0", 7, 9},
+	{"IL", "972", "0", 8, 9},
+	{"IN", "91", "0", 10, 10},
+	{"IT", "39", "", 6, 11},
+	{"JP", "81", "0", 9, 10},
+	{"KE", "254", "0", 9, 9},
+	{"KR", "82", "0", 8, 10},
+	{"MX", "52", "", 10, 10},
+	{"MY", "60", "0", 8, 10},
+	{"NG", "234", "0", 8, 10},
+	{"NL", "31", "0", 9, 9},
+	{"NO", "47", "", 8, 8},
+	{"NZ", "64", "0", 8, 10},
+	{"PE", "51", "0", 8, 9},
+	{"PH", "63", "0", 8, 10},
+	{"PK", "92", "0", 9, 10},
+	{"PL", "48", "", 9, 9},
+	{"PT", "351", "", 9, 9},
+	{"RU", "7", "8", 10, 10},
+	{"SA", "966", "0", 8, 9},
+	{"SE", "46", "0", 6, 10},
+	{"SG", "65", "", 8, 8},
+	{"TH", "66", "0", 8, 9},
+	{"TR", "90", "0", 10, 10},
+	{"TW", "886", "0", 8, 9},
+	{"UA", "380", "0", 9, 9},
+	{"US", "1", "", 10, 10},
+	{"VN", "84", "0", 9, 10},
+	{"ZA", "27", "0", 9, 9},
+}
+
+// E.164 allows at most 15 digits including the country code; shorter than 8 is never a real number
+const (
+	minPhoneDigits = 8
+	maxPhoneDigits = 15
+)
+
+// lookupPhoneCountry returns the country with the given ISO code
+func lookupPhoneCountry(iso string) (phoneCountry, bool) {
+	iso = strings.ToUpper(strings.TrimSpace(iso))
+	for _, country := range phoneCountries {
+		if country.ISO == iso {
+			return country, true
+		}
+	}
+	return phoneCountry{}, false
+}
+
+// validatePhoneCountry checks that a default country setting names a supported country
+func validatePhoneCountry(iso string) error {
+	if iso == "" {
+		return nil
+	}
+	if _, ok := lookupPhoneCountry(iso); !ok {
+		return fmt.Errorf("unsupported country %q, use an ISO 3166-1 alpha-2 code such as ID or US", iso)
+	}
+	return nil
+}
+
+// countryForNumber finds the country of an international number by its calling code. Countries
+// sharing a calling code share the number lengths, so the first match is used.
+func countryForNumber(digits string) (phoneCountry, bool) {
+	for length := 3; length >= 1; length-- {
+		if len(digits) <= length {
+			continue
+		}
+		for _, country := range phoneCountries {
+			if country.CallingCode == digits[:length] {
+				return country, true
+			}
+		}
+	}
+	return phoneCountry{}, false
+}
+
+// fitsNational reports whether a national significant number has a valid length for the country
+func (country phoneCountry) fitsNational(nsn string) bool {
+	return len(nsn) >= country.MinLength && len(nsn) <= country.MaxLength
+}
+
+// normalizePhone converts a phone number to E.164, e.g. "0812-3456-789" with default country ID
+// becomes "+628123456789". Spaces, dashes, dots, slashes and parentheses are removed. Numbers
+// starting with + or 00 are international; other numbers are converted from the national format
+// of the default country when they fit it, and taken as international otherwise.
+func normalizePhone(raw string, defaultCountry string) (string, error) {
+	s := strings.TrimSpace(raw)
+	if s == "" {
+		return "", fmt.Errorf("phone number is empty")
+	}
+
+	international := strings.HasPrefix(s, "+")
+	var digits strings.Builder
+	for _, r := range strings.TrimPrefix(s, "+") {
+		switch {
+		case r >= '0' && r <= '9':
+			digits.WriteRune(r)
+		case r == ' ' || r == '-' || r == '.' || r == '/' || r == '(' || r == ')' || r == ' ':
+		default:
+			return "", fmt.Errorf("phone number %q contains invalid character %q", raw, r)
+		}
+	}
+	number := digits.String()
+	if !international && strings.HasPrefix(number, "00") {
+		international = true
+		number = number[2:]
+	}
+
+	if !international {
+		country, hasCountry := lookupPhoneCountry(defaultCountry)
+		switch {
+		case hasCountry && country.TrunkPrefix != "" && strings.HasPrefix(number, country.TrunkPrefix) &&
+			country.fitsNational(number[len(country.TrunkPrefix):]):
+			number = country.CallingCode + number[len(country.TrunkPrefix):]
+		case hasCountry && strings.HasPrefix(number, country.CallingCode) &&
+			country.fitsNational(number[len(country.CallingCode):]):
+			// Already international, just without the +
+		case hasCountry && country.fitsNational(number):
+			number = country.CallingCode + number
+		case strings.HasPrefix(number, "0"):
+			if !hasCountry {
+				return "", fmt.Errorf("phone number %q is in national format, set a default country or use the international format", raw)
+			}
+			return "", fmt.Errorf("phone number %q is not a valid %s number", raw, country.ISO)
+		}
+	}
+
+	if len(number) < minPhoneDigits || len(number) > maxPhoneDigits {
+		return "", fmt.Errorf("phone number %q must have %d to %d digits including the country code", raw, minPhoneDigits, maxPhoneDigits)
+	}
+	if country, ok := countryForNumber(number); ok {
+		nsn := number[len(country.CallingCode):]
+		if !country.fitsNational(nsn) {
+			if country.MinLength == country.MaxLength {
+				return "", fmt.Errorf("phone number %q is not valid: +%s numbers have %d digits after the country code, got %d",
+					raw, country.CallingCode, country.MinLength, len(nsn))
+			}
+			return "", fmt.Errorf("phone number %q is not valid: +%s numbers have %d to %d digits after the country code, got %d",
+				raw, country.CallingCode, country.MinLength, country.MaxLength, len(nsn))
+		}
+	}
+	return "+" + number, nil
+}
+
+// parseRecipient turns a phone number or JID from a request into the JID to send to and the
+// normalized form to report back. Phone numbers and phone number JIDs are normalized to E.164
+// using the client's default country; group, LID and other JIDs are used as they are.
+func (c *WhatsAppClient) parseRecipient(raw string) (types.JID, string, error) {
+	raw = strings.TrimSpace(raw)
+	if strings.Contains(raw, "@") {
+		jid, err := types.ParseJID(raw)
+		if err != nil {
+			return types.JID{}, "", fmt.Errorf("invalid JID %q: %w", raw, err)
+		}
+		if jid.Server != types.DefaultUserServer {
+			return jid, jid.String(), nil
+		}
+		// The user part of a phone number JID is always international
+		phone, err := normalizePhone("+"+jid.User, "")
+		if err != nil {
+			return types.JID{}, "", err
+		}
+		return types.NewJID(phone[1:], types.DefaultUserServer), phone, nil
+	}
+
+	phone, err := normalizePhone(raw, c.defaultCountry())
+	if err != nil {
+		return types.JID{}, "", err
+	}
+	return types.NewJID(phone[1:], types.DefaultUserServer), phone, nil
+}
+
+// defaultCountry returns the country used for phone numbers in national format
+func (c *WhatsAppClient) defaultCountry() string {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.settings.DefaultCountry
+}
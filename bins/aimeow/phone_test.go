@@ -0,0 +1,98 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalizePhone(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		country string
+		want    string
+		wantErr string // Substring of the error, empty if the number is valid
+	}{
+		{name: "ID international", raw: "+62 812-3456-7890", country: "ID", want: "+6281234567890"},
+		{name: "ID 00 prefix", raw: "0062 812 3456 7890", country: "ID", want: "+6281234567890"},
+		{name: "ID trunk prefix", raw: "0812-3456-7890", country: "ID", want: "+6281234567890"},
+		{name: "ID calling code without +", raw: "6281234567890", country: "ID", want: "+6281234567890"},
+		{name: "ID national without trunk prefix", raw: "81234567890", country: "ID", want: "+6281234567890"},
+		{name: "ID lowercase country", raw: "0812.3456.7890", country: "id", want: "+6281234567890"},
+		{name: "ID invalid national", raw: "0123", country: "ID", wantErr: "not a valid ID number"},
+		{name: "GB trunk prefix", raw: "07911 123456", country: "GB", want: "+447911123456"},
+		{name: "GB international with trunk prefix", raw: "+44 (0) 7911 123456", country: "GB", wantErr: "have 9 to 10 digits"},
+		{name: "GB 00 prefix", raw: "0044 7911 123456", country: "ID", want: "+447911123456"},
+		{name: "US national", raw: "(415) 555-2671", country: "US", want: "+14155552671"},
+		{name: "US international", raw: "+1 415 555 2671", country: "ID", want: "+14155552671"},
+		{name: "US wrong length", raw: "+1 415 555 267", country: "US", wantErr: "+1 numbers have 10 digits after the country code, got 9"},
+		{name: "RU trunk prefix 8", raw: "8 (912) 345-67-89", country: "RU", want: "+79123456789"},
+		{name: "DE trunk prefix", raw: "030 123456", country: "DE", want: "+4930123456"},
+		{name: "no default country international", raw: "+62 812 3456 7890", want: "+6281234567890"},
+		{name: "no default country without +", raw: "6281234567890", want: "+6281234567890"},
+		{name: "no default country national", raw: "0812 3456 7890", wantErr: "set a default country"},
+		{name: "unknown default country national", raw: "0812 3456 7890", country: "XX", wantErr: "set a default country"},
+		{name: "unknown default country international", raw: "+44 7911 123456", country: "XX", want: "+447911123456"},
+		{name: "unlisted calling code", raw: "+998 90 123 45 67", country: "ID", want: "+998901234567"},
+		{name: "too short", raw: "+123456", country: "ID", wantErr: "must have 8 to 15 digits"},
+		{name: "too short national", raw: "12345", country: "ID", wantErr: "must have 8 to 15 digits"},
+		{name: "too long", raw: "+998 1234 5678 9012 3", country: "ID", wantErr: "must have 8 to 15 digits"},
+		{name: "too long for country", raw: "+62 8123 4567 8901 2", country: "ID", wantErr: "+62 numbers have 8 to 12 digits after the country code, got 13"},
+		{name: "invalid character", raw: "0812-3456-abcd", country: "ID", wantErr: "invalid character"},
+		{name: "empty", raw: "  ", country: "ID", wantErr: "empty"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := normalizePhone(tt.raw, tt.country)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("normalizePhone(%q, %q) = %q, %v; want error containing %q", tt.raw, tt.country, got, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Fatalf("normalizePhone(%q, %q) = %q, %v; want %q", tt.raw, tt.country, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCountryForNumber(t *testing.T) {
+	tests := []struct {
+		digits      string
+		callingCode string // Empty if no country matches
+	}{
+		{"6281234567890", "62"},
+		{"14155552671", "1"},
+		{"79123456789", "7"},
+		{"4930123456", "49"},
+		{"971501234567", "971"},
+		{"8801712345678", "880"},
+		{"998901234567", ""},
+		{"1", ""},
+	}
+	for _, tt := range tests {
+		country, ok := countryForNumber(tt.digits)
+		if ok != (tt.callingCode != "") || country.CallingCode != tt.callingCode {
+			t.Errorf("countryForNumber(%q) = %+v, %v; want calling code %q", tt.digits, country, ok, tt.callingCode)
+		}
+	}
+}
+
+func TestValidatePhoneCountry(t *testing.T) {
+	tests := []struct {
+		iso     string
+		wantErr bool
+	}{
+		{"", false},
+		{"ID", false},
+		{"us", false},
+		{"XX", true},
+		{"IDN", true},
+	}
+	for _, tt := range tests {
+		if err := validatePhoneCountry(tt.iso); (err != nil) != tt.wantErr {
+			t.Errorf("validatePhoneCountry(%q) = %v, want error %v", tt.iso, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"rsc.io/qr"
+)
+
+// QR image size limits in pixels, and the quiet zone in modules
+const (
+	qrDefaultSize   = 256
+	qrMinSize       = 64
+	qrMaxSize       = 2048
+	qrDefaultMargin = 4
+	qrMaxMargin     = 16
+)
+
+// qrImageOptions controls how a QR code is rendered
+type qrImageOptions struct {
+	size   int // Width and height of the image in pixels
+	margin int // Quiet zone around the code in modules
+}
+
+// parseQRImageOptions reads the size and margin query parameters
+func parseQRImageOptions(c *gin.Context) (qrImageOptions, error) {
+	opts := qrImageOptions{size: qrDefaultSize, margin: qrDefaultMargin}
+
+	if s := c.Query("size"); s != "" {
+		size, err := strconv.Atoi(s)
+		if err != nil || size < qrMinSize || size > qrMaxSize {
+			return opts, fmt.Errorf("size must be between %d and %d", qrMinSize, qrMaxSize)
+		}
+		opts.size = size
+	}
+	if m := c.Query("margin"); m != "" {
+		margin, err := strconv.Atoi(m)
+		if err != nil || margin < 0 || margin > qrMaxMargin {
+			return opts, fmt.Errorf("margin must be between 0 and %d", qrMaxMargin)
+		}
+		opts.margin = margin
+	}
+	return opts, nil
+}
+
+// renderQRPNG renders a QR code as a PNG of the requested size. The modules are scaled by whole
+// pixels so the code stays sharp; the leftover space is added to the quiet zone.
+func renderQRPNG(text string, opts qrImageOptions) ([]byte, error) {
+	code, err := qr.Encode(text, qr.L)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode QR code: %w", err)
+	}
+
+	modules := code.Size + 2*opts.margin
+	scale := opts.size / modules
+	if scale < 1 {
+		scale = 1
+	}
+	size := opts.size
+	if modules*scale > size {
+		size = modules * scale
+	}
+	offset := (size - code.Size*scale) / 2
+
+	img := image.NewGray(image.Rect(0, 0, size, size))
+	for i := range img.Pix {
+		img.Pix[i] = 0xFF
+	}
+	for y := 0; y < code.Size; y++ {
+		for x := 0; x < code.Size; x++ {
+			if !code.Black(x, y) {
+				continue
+			}
+			for dy := 0; dy < scale; dy++ {
+				for dx := 0; dx < scale; dx++ {
+					img.SetGray(offset+x*scale+dx, offset+y*scale+dy, color.Gray{Y: 0})
+				}
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("failed to encode PNG: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// renderQRSVG renders a QR code as an SVG with one path for all dark modules
+func renderQRSVG(text string, opts qrImageOptions) ([]byte, error) {
+	code, err := qr.Encode(text, qr.L)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode QR code: %w", err)
+	}
+
+	modules := code.Size + 2*opts.margin
+	var path strings.Builder
+	for y := 0; y < code.Size; y++ {
+		for x := 0; x < code.Size; x++ {
+			if !code.Black(x, y) {
+				continue
+			}
+			// Merge horizontal runs into a single rectangle
+			run := 1
+			for code.Black(x+run, y) {
+				run++
+			}
+			fmt.Fprintf(&path, "M%d %dh%dv1h-%dz", x+opts.margin, y+opts.margin, run, run)
+			x += run - 1
+		}
+	}
+
+	svg := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">
+<rect width="100%%" height="100%%" fill="#fff"/>
+<path fill="#000" d="%s"/>
+</svg>
+`, opts.size, opts.size, modules, modules, path.String())
+	return []byte(svg), nil
+}
+
+// qrDataURI returns the QR code as a PNG data URI for embedding in an <img> tag
+func qrDataURI(text string) string {
+	data, err := renderQRPNG(text, qrImageOptions{size: qrDefaultSize, margin: qrDefaultMargin})
+	if err != nil {
+		fmt.Printf("Warning: Failed to render QR code: %v\n", err)
+		return ""
+	}
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(data)
+}
+
+// currentQRCode returns the QR code of a client or writes an error response
+func currentQRCode(c *gin.Context) (string, qrImageOptions, bool) {
+	waClient, err := manager.getClient(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return "", qrImageOptions{}, false
+	}
+
+	opts, err := parseQRImageOptions(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return "", qrImageOptions{}, false
+	}
+
+	waClient.mutex.RLock()
+	qrCode := waClient.qrCode
+	waClient.mutex.RUnlock()
+
+	if qrCode == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "QR code not available"})
+		return "", qrImageOptions{}, false
+	}
+	return qrCode, opts, true
+}
+
+// @Summary Get QR code for client (PNG)
+// @Description Returns the current pairing QR code as a PNG image. The code rotates about every 20 seconds.
+// @Tags clients
+// @Produce png
+// @Param id path string true "Client ID"
+// @Param size query int false "Image width and height in pixels (64-2048)" default(256)
+// @Param margin query int false "Quiet zone in modules (0-16)" default(4)
+// @Success 200 {file} binary "QR code image"
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /clients/{id}/qr.png [get]
+func getQRCodePNG(c *gin.Context) {
+	qrCode, opts, ok := currentQRCode(c)
+	if !ok {
+		return
+	}
+
+	data, err := renderQRPNG(qrCode, opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.Data(http.StatusOK, "image/png", data)
+}
+
+// @Summary Get QR code for client (SVG)
+// @Description Returns the current pairing QR code as an SVG image. The code rotates about every 20 seconds.
+// @Tags clients
+// @Produce image/svg+xml
+// @Param id path string true "Client ID"
+// @Param size query int false "Image width and height in pixels (64-2048)" default(256)
+// @Param margin query int false "Quiet zone in modules (0-16)" default(4)
+// @Success 200 {string} string "QR code image"
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /clients/{id}/qr.svg [get]
+func getQRCodeSVG(c *gin.Context) {
+	qrCode, opts, ok := currentQRCode(c)
+	if !ok {
+		return
+	}
+
+	data, err := renderQRSVG(qrCode, opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.Data(http.StatusOK, "image/svg+xml", data)
+}
@@ -0,0 +1,585 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waAdv"
+	"go.mau.fi/whatsmeow/proto/waCommon"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/proto/waWeb"
+	"go.mau.fi/whatsmeow/store"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+// Platform stored with sessions paired in sandbox mode
+const sandboxPlatform = "sandbox"
+
+// Event types accepted by POST /admin/sandbox/clients/{id}/events
+const (
+	sandboxEventMessage    = "message"
+	sandboxEventReceipt    = "receipt"
+	sandboxEventDisconnect = "disconnect"
+	sandboxEventLoggedOut  = "logged_out"
+)
+
+// sandboxTransport simulates the WhatsApp connection of a client, so the API and webhooks can
+// be used without a phone. New clients are paired sandbox.pairDelay after connecting, or as
+// soon as a pairing code is requested. Sends succeed without leaving the machine, and incoming
+// messages, receipts and disconnects are injected through the admin API.
+type sandboxTransport struct {
+	store     *store.Device
+	handlers  []whatsmeow.EventHandler
+	connected bool
+	stop      chan struct{}                // Closed when the connection is dropped
+	qrChan    chan whatsmeow.QRChannelItem // Set by GetQRChannel until pairing ends
+	pairPhone chan string                  // Phone number a pairing code was requested for
+	media     map[string][]byte            // Direct path -> data of injected media
+	mutex     sync.Mutex
+
+	// Handlers run one event at a time, as with whatsmeow
+	dispatchMutex sync.Mutex
+}
+
+func newSandboxTransport(deviceStore *store.Device) *sandboxTransport {
+	return &sandboxTransport{
+		store:     deviceStore,
+		pairPhone: make(chan string, 1),
+		media:     make(map[string][]byte),
+	}
+}
+
+var _ whatsAppTransport = (*sandboxTransport)(nil)
+
+// dispatch passes an event to the event handlers
+func (t *sandboxTransport) dispatch(evt interface{}) {
+	t.dispatchMutex.Lock()
+	defer t.dispatchMutex.Unlock()
+
+	t.mutex.Lock()
+	handlers := append([]whatsmeow.EventHandler(nil), t.handlers...)
+	t.mutex.Unlock()
+	for _, handler := range handlers {
+		handler(evt)
+	}
+}
+
+// ready returns the error whatsmeow gives when a paired, connected client is needed
+func (t *sandboxTransport) ready() error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.store.ID == nil {
+		return whatsmeow.ErrNotLoggedIn
+	}
+	if !t.connected {
+		return whatsmeow.ErrNotConnected
+	}
+	return nil
+}
+
+func (t *sandboxTransport) AddEventHandler(handler whatsmeow.EventHandler) uint32 {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.handlers = append(t.handlers, handler)
+	return uint32(len(t.handlers))
+}
+
+func (t *sandboxTransport) Connect() error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.connected {
+		return whatsmeow.ErrAlreadyConnected
+	}
+	t.connected = true
+	t.stop = make(chan struct{})
+	if t.store.ID != nil {
+		go t.dispatch(&events.Connected{})
+	} else {
+		go t.pair(t.stop)
+	}
+	return nil
+}
+
+func (t *sandboxTransport) Disconnect() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.connected {
+		t.connected = false
+		close(t.stop)
+	}
+}
+
+func (t *sandboxTransport) IsConnected() bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.connected
+}
+
+func (t *sandboxTransport) Logout(ctx context.Context) error {
+	if err := t.ready(); err != nil {
+		return err
+	}
+	t.Disconnect()
+	return t.store.Delete(ctx)
+}
+
+func (t *sandboxTransport) GetQRChannel(ctx context.Context) (<-chan whatsmeow.QRChannelItem, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.connected {
+		return nil, whatsmeow.ErrQRAlreadyConnected
+	} else if t.store.ID != nil {
+		return nil, whatsmeow.ErrQRStoreContainsID
+	}
+	t.qrChan = make(chan whatsmeow.QRChannelItem, 8)
+	return t.qrChan, nil
+}
+
+// pair shows a QR code, then pairs the client with a made-up phone number once the pair delay
+// has passed, or with the number a pairing code was requested for
+func (t *sandboxTransport) pair(stop <-chan struct{}) {
+	delay := time.Duration(appConfig().Sandbox.PairDelay)
+	code := "sandbox@" + hex.EncodeToString(randomBytes(16))
+	t.dispatch(&events.QR{Codes: []string{code}})
+	t.sendQR(whatsmeow.QRChannelItem{Event: whatsmeow.QRChannelEventCode, Code: code, Timeout: delay}, false)
+
+	phone := "1555" + randomDigits(7)
+	select {
+	case <-time.After(delay):
+	case phone = <-t.pairPhone:
+	case <-stop:
+		t.sendQR(whatsmeow.QRChannelItem{}, true)
+		return
+	}
+
+	jid := types.NewADJID(phone, 0, 1)
+	t.mutex.Lock()
+	t.store.ID = &jid
+	t.store.Platform = sandboxPlatform
+	t.store.PushName = "Sandbox " + phone
+	// The session store wants the signed identity a real phone sends when pairing
+	t.store.Account = &waAdv.ADVSignedDeviceIdentity{
+		Details:             randomBytes(32),
+		AccountSignature:    randomBytes(64),
+		AccountSignatureKey: randomBytes(32),
+		DeviceSignature:     randomBytes(64),
+	}
+	t.mutex.Unlock()
+	if err := t.store.Save(context.Background()); err != nil {
+		t.mutex.Lock()
+		t.store.ID = nil
+		t.mutex.Unlock()
+		t.sendQR(whatsmeow.QRChannelItem{Event: whatsmeow.QRChannelEventError, Error: err}, true)
+		t.dispatch(&events.PairError{ID: jid, Platform: sandboxPlatform, Error: err})
+		return
+	}
+	fmt.Printf("[Sandbox] Paired %s\n", jid.String())
+	t.sendQR(whatsmeow.QRChannelSuccess, true)
+	t.dispatch(&events.PairSuccess{ID: jid, Platform: sandboxPlatform})
+	t.dispatch(&events.Connected{})
+}
+
+// sendQR passes an item to the QR channel, if there is one, and closes the channel when pairing
+// has ended. An empty item is not sent.
+func (t *sandboxTransport) sendQR(item whatsmeow.QRChannelItem, last bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.qrChan == nil {
+		return
+	}
+	if item.Event != "" {
+		t.qrChan <- item
+	}
+	if last {
+		close(t.qrChan)
+		t.qrChan = nil
+	}
+}
+
+func (t *sandboxTransport) PairPhone(ctx context.Context, phone string, showPushNotification bool, clientType whatsmeow.PairClientType, clientDisplayName string) (string, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if !t.connected {
+		return "", whatsmeow.ErrNotConnected
+	} else if t.store.ID != nil {
+		return "", fmt.Errorf("client is already paired")
+	}
+	select {
+	case t.pairPhone <- strings.TrimPrefix(phone, "+"):
+	default:
+	}
+	return randomLetters(4) + "-" + randomLetters(4), nil
+}
+
+func (t *sandboxTransport) SendMessage(ctx context.Context, to types.JID, message *waE2E.Message, extra ...whatsmeow.SendRequestExtra) (whatsmeow.SendResponse, error) {
+	if err := t.ready(); err != nil {
+		return whatsmeow.SendResponse{}, err
+	}
+	resp := whatsmeow.SendResponse{ID: whatsmeow.GenerateMessageID(), Timestamp: time.Now(), Sender: t.store.ID.ToNonAD()}
+	if len(extra) > 0 && extra[0].ID != "" {
+		resp.ID = extra[0].ID
+	}
+	fmt.Printf("[Sandbox] %s sent message %s to %s\n", resp.Sender.User, resp.ID, to.String())
+	return resp, nil
+}
+
+func (t *sandboxTransport) BuildRevoke(chat, sender types.JID, id types.MessageID) *waE2E.Message {
+	key := &waCommon.MessageKey{
+		FromMe:    proto.Bool(true),
+		ID:        proto.String(id),
+		RemoteJID: proto.String(chat.String()),
+	}
+	if !sender.IsEmpty() && (t.store.ID == nil || sender.User != t.store.ID.User) {
+		key.FromMe = proto.Bool(false)
+		if chat.Server == types.GroupServer {
+			key.Participant = proto.String(sender.ToNonAD().String())
+		}
+	}
+	return &waE2E.Message{
+		ProtocolMessage: &waE2E.ProtocolMessage{
+			Type: waE2E.ProtocolMessage_REVOKE.Enum(),
+			Key:  key,
+		},
+	}
+}
+
+func (t *sandboxTransport) SendChatPresence(ctx context.Context, jid types.JID, state types.ChatPresence, media types.ChatPresenceMedia) error {
+	return t.ready()
+}
+
+func (t *sandboxTransport) MarkRead(ctx context.Context, ids []types.MessageID, timestamp time.Time, chat, sender types.JID, receiptTypeExtra ...types.ReceiptType) error {
+	return t.ready()
+}
+
+// Upload pretends to upload media. Sent media is not kept, only its checksum is returned.
+func (t *sandboxTransport) Upload(ctx context.Context, plaintext []byte, appInfo whatsmeow.MediaType) (whatsmeow.UploadResponse, error) {
+	if err := t.ready(); err != nil {
+		return whatsmeow.UploadResponse{}, err
+	}
+	sum := sha256.Sum256(plaintext)
+	path := "/sandbox/" + hex.EncodeToString(sum[:16])
+	return whatsmeow.UploadResponse{
+		URL:           "https://sandbox.invalid" + path,
+		DirectPath:    path,
+		MediaKey:      sum[:],
+		FileEncSHA256: sum[:],
+		FileSHA256:    sum[:],
+		FileLength:    uint64(len(plaintext)),
+	}, nil
+}
+
+// Download returns the media of an injected message
+func (t *sandboxTransport) Download(ctx context.Context, msg whatsmeow.DownloadableMessage) ([]byte, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	data, ok := t.media[msg.GetDirectPath()]
+	if !ok {
+		return nil, fmt.Errorf("no sandbox media at %q", msg.GetDirectPath())
+	}
+	return data, nil
+}
+
+// IsOnWhatsApp reports every number as registered
+func (t *sandboxTransport) IsOnWhatsApp(ctx context.Context, phones []string) ([]types.IsOnWhatsAppResponse, error) {
+	if err := t.ready(); err != nil {
+		return nil, err
+	}
+	results := make([]types.IsOnWhatsAppResponse, 0, len(phones))
+	for _, phone := range phones {
+		results = append(results, types.IsOnWhatsAppResponse{
+			Query: phone,
+			JID:   types.NewJID(strings.TrimPrefix(phone, "+"), types.DefaultUserServer),
+			IsIn:  true,
+		})
+	}
+	return results, nil
+}
+
+func (t *sandboxTransport) GetUserInfo(ctx context.Context, jids []types.JID) (map[types.JID]types.UserInfo, error) {
+	if err := t.ready(); err != nil {
+		return nil, err
+	}
+	info := make(map[types.JID]types.UserInfo, len(jids))
+	for _, jid := range jids {
+		info[jid] = types.UserInfo{Devices: []types.JID{jid}}
+	}
+	return info, nil
+}
+
+func (t *sandboxTransport) GetBusinessProfile(ctx context.Context, jid types.JID) (*types.BusinessProfile, error) {
+	return nil, t.ready()
+}
+
+func (t *sandboxTransport) GetProfilePictureInfo(ctx context.Context, jid types.JID, params *whatsmeow.GetProfilePictureParams) (*types.ProfilePictureInfo, error) {
+	return nil, t.ready()
+}
+
+func (t *sandboxTransport) ParseWebMessage(chatJID types.JID, webMsg *waWeb.WebMessageInfo) (*events.Message, error) {
+	return nil, fmt.Errorf("history sync is not simulated in sandbox mode")
+}
+
+func (t *sandboxTransport) StoreLIDPNMapping(ctx context.Context, first, second types.JID) {}
+
+// inject passes an incoming event to the handlers of a connected client
+func (t *sandboxTransport) inject(evt interface{}) error {
+	if err := t.ready(); err != nil {
+		return err
+	}
+	t.dispatch(evt)
+	return nil
+}
+
+// dropConnection closes the connection as if the network went away. The supervisor reconnects
+// the client like it would a real one.
+func (t *sandboxTransport) dropConnection() error {
+	if err := t.ready(); err != nil {
+		return err
+	}
+	t.Disconnect()
+	t.dispatch(&events.Disconnected{})
+	return nil
+}
+
+// logOutFromPhone removes the session as if the device was unlinked on the phone
+func (t *sandboxTransport) logOutFromPhone() error {
+	if err := t.ready(); err != nil {
+		return err
+	}
+	t.Disconnect()
+	if err := t.store.Delete(context.Background()); err != nil {
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+	t.dispatch(&events.LoggedOut{Reason: events.ConnectFailureLoggedOut})
+	return nil
+}
+
+// incomingMessage builds the event of a message injected into a client
+func (t *sandboxTransport) incomingMessage(waClient *WhatsAppClient, req SandboxEventRequest) (*events.Message, error) {
+	sender, _, err := waClient.parseRecipient(req.From)
+	if err != nil {
+		return nil, fmt.Errorf("invalid from: %w", err)
+	}
+	info := types.MessageInfo{
+		MessageSource: types.MessageSource{Chat: sender, Sender: sender},
+		ID:            whatsmeow.GenerateMessageID(),
+		PushName:      req.PushName,
+		Timestamp:     time.Now(),
+		Type:          "text",
+	}
+	if req.Group != "" {
+		group, err := types.ParseJID(req.Group)
+		if err != nil || group.Server != types.GroupServer {
+			return nil, fmt.Errorf("group must be a group JID such as 123456789@g.us")
+		}
+		info.Chat = group
+		info.IsGroup = true
+	}
+
+	msg := &waE2E.Message{}
+	if req.Media == nil {
+		if req.Text == "" {
+			return nil, fmt.Errorf("a message needs text or media")
+		}
+		msg.Conversation = proto.String(req.Text)
+	} else {
+		if err := t.attachMedia(msg, req.Media); err != nil {
+			return nil, err
+		}
+		info.Type = "media"
+		info.MediaType = req.Media.Type
+	}
+	return &events.Message{Info: info, Message: msg, RawMessage: msg}, nil
+}
+
+// attachMedia adds injected media to a message and keeps its data for Download
+func (t *sandboxTransport) attachMedia(msg *waE2E.Message, media *SandboxMedia) error {
+	mimeType := firstNonEmpty(media.MimeType, http.DetectContentType(media.Data))
+	sum := sha256.Sum256(media.Data)
+	path := "/sandbox/" + hex.EncodeToString(sum[:16])
+	url := proto.String("https://sandbox.invalid" + path)
+	length := proto.Uint64(uint64(len(media.Data)))
+	caption := proto.String(media.Caption)
+
+	switch media.Type {
+	case "image":
+		msg.ImageMessage = &waE2E.ImageMessage{URL: url, DirectPath: &path, Mimetype: &mimeType, Caption: caption,
+			MediaKey: sum[:], FileSHA256: sum[:], FileEncSHA256: sum[:], FileLength: length}
+	case "video":
+		msg.VideoMessage = &waE2E.VideoMessage{URL: url, DirectPath: &path, Mimetype: &mimeType, Caption: caption,
+			MediaKey: sum[:], FileSHA256: sum[:], FileEncSHA256: sum[:], FileLength: length}
+	case "audio":
+		msg.AudioMessage = &waE2E.AudioMessage{URL: url, DirectPath: &path, Mimetype: &mimeType,
+			MediaKey: sum[:], FileSHA256: sum[:], FileEncSHA256: sum[:], FileLength: length}
+	case "document":
+		fileName := firstNonEmpty(media.FileName, "document")
+		msg.DocumentMessage = &waE2E.DocumentMessage{URL: url, DirectPath: &path, Mimetype: &mimeType, Caption: caption,
+			FileName: &fileName, Title: &fileName, MediaKey: sum[:], FileSHA256: sum[:], FileEncSHA256: sum[:], FileLength: length}
+	default:
+		return fmt.Errorf("media type must be image, video, audio or document")
+	}
+
+	t.mutex.Lock()
+	t.media[path] = media.Data
+	t.mutex.Unlock()
+	return nil
+}
+
+// incomingReceipt builds the event of a receipt injected into a client
+func incomingReceipt(waClient *WhatsAppClient, req SandboxEventRequest) (*events.Receipt, error) {
+	sender, _, err := waClient.parseRecipient(req.From)
+	if err != nil {
+		return nil, fmt.Errorf("invalid from: %w", err)
+	}
+	if len(req.MessageIDs) == 0 {
+		return nil, fmt.Errorf("a receipt needs messageIds")
+	}
+	receipt := &events.Receipt{
+		MessageSource: types.MessageSource{Chat: sender, Sender: sender},
+		MessageIDs:    req.MessageIDs,
+		Timestamp:     time.Now(),
+	}
+	for receiptType, name := range receiptNames {
+		if name == firstNonEmpty(req.Receipt, "delivered") {
+			receipt.Type = receiptType
+			return receipt, nil
+		}
+	}
+	return nil, fmt.Errorf("receipt must be delivered, read or played")
+}
+
+// randomBytes returns n random bytes
+func randomBytes(n int) []byte {
+	data := make([]byte, n)
+	rand.Read(data)
+	return data
+}
+
+// randomDigits returns n random decimal digits
+func randomDigits(n int) string {
+	var digits strings.Builder
+	for i := 0; i < n; i++ {
+		d, _ := rand.Int(rand.Reader, big.NewInt(10))
+		digits.WriteString(d.String())
+	}
+	return digits.String()
+}
+
+// randomLetters returns n random capital letters
+func randomLetters(n int) string {
+	letters := make([]byte, n)
+	for i := range letters {
+		l, _ := rand.Int(rand.Reader, big.NewInt(26))
+		letters[i] = byte('A' + l.Int64())
+	}
+	return string(letters)
+}
+
+// SandboxEventRequest is an event injected into a sandbox client
+type SandboxEventRequest struct {
+	Type string `json:"type" binding:"required"` // message, receipt, disconnect or logged_out
+
+	From       string        `json:"from"`       // Phone number or JID the message or receipt comes from
+	Group      string        `json:"group"`      // Group JID, for a message sent in a group
+	PushName   string        `json:"pushName"`   // Name of the sender
+	Text       string        `json:"text"`       // Text of a message without media
+	Media      *SandboxMedia `json:"media"`      // Attachment of a media message
+	MessageIDs []string      `json:"messageIds"` // IDs of the sent messages a receipt is for
+	Receipt    string        `json:"receipt"`    // delivered (the default), read or played
+}
+
+// SandboxMedia is the attachment of an injected message
+type SandboxMedia struct {
+	Type     string `json:"type" binding:"required"` // image, video, audio or document
+	Data     []byte `json:"data" binding:"required"` // Base64-encoded file
+	MimeType string `json:"mimeType"`                // Detected from the data if empty
+	FileName string `json:"fileName"`                // Name of a document
+	Caption  string `json:"caption"`
+}
+
+// SandboxEventResponse describes an injected event
+type SandboxEventResponse struct {
+	Type      string `json:"type"`
+	MessageID string `json:"messageId,omitempty"` // ID of an injected message
+}
+
+// @Summary Inject a sandbox event
+// @Description Simulates an incoming message, a delivery or read receipt, a dropped connection or an unlink from the phone for a client, which then goes through the same handling and webhooks as a real event. Only available in sandbox mode.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path string true "Client ID"
+// @Param event body SandboxEventRequest true "Event to inject"
+// @Success 200 {object} SandboxEventResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/sandbox/clients/{id}/events [post]
+func injectSandboxEvent(c *gin.Context) {
+	clientID := c.Param("id")
+	waClient, err := manager.getClient(clientID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	transport, ok := waClient.client.(*sandboxTransport)
+	if !ok {
+		c.JSON(http.StatusConflict, gin.H{"error": "client is not simulated"})
+		return
+	}
+
+	var req SandboxEventRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp := SandboxEventResponse{Type: req.Type}
+	switch req.Type {
+	case sandboxEventMessage:
+		evt, buildErr := transport.incomingMessage(waClient, req)
+		if buildErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": buildErr.Error()})
+			return
+		}
+		resp.MessageID = evt.Info.ID
+		err = transport.inject(evt)
+	case sandboxEventReceipt:
+		evt, buildErr := incomingReceipt(waClient, req)
+		if buildErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": buildErr.Error()})
+			return
+		}
+		err = transport.inject(evt)
+	case sandboxEventDisconnect:
+		err = transport.dropConnection()
+	case sandboxEventLoggedOut:
+		err = transport.logOutFromPhone()
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("type must be %s, %s, %s or %s",
+			sandboxEventMessage, sandboxEventReceipt, sandboxEventDisconnect, sandboxEventLoggedOut)})
+		return
+	}
+
+	switch {
+	case errors.Is(err, whatsmeow.ErrNotLoggedIn) || errors.Is(err, whatsmeow.ErrNotConnected):
+		c.JSON(http.StatusConflict, gin.H{"error": "client is not connected"})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusOK, resp)
+	}
+}
@@ -0,0 +1,391 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+	_ "time/tzdata" // The runtime image ships without zoneinfo
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/google/uuid"
+)
+
+// How often the scheduler looks for due messages
+const scheduledMessagePollInterval = 5 * time.Second
+
+// Scheduled message states
+const (
+	scheduledStatusPending   = "pending"
+	scheduledStatusSending   = "sending" // Claimed by the scheduler, so it can no longer be cancelled
+	scheduledStatusSent      = "sent"
+	scheduledStatusFailed    = "failed"
+	scheduledStatusCancelled = "cancelled"
+)
+
+// Layouts accepted for sendAt values without a UTC offset, interpreted in the request timezone
+var scheduledLocalLayouts = []string{
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04",
+}
+
+// ScheduleMessageRequest is the envelope of a scheduled send. The remaining body fields are
+// the payload of the send endpoint selected by Type (e.g. phone and message for "message").
+type ScheduleMessageRequest struct {
+	Type     string `json:"type,omitempty" binding:"omitempty,oneof=message image images document document-base64"`
+	SendAt   string `json:"sendAt" binding:"required"`
+	Timezone string `json:"timezone,omitempty"` // IANA timezone for sendAt values without an offset
+}
+
+type ScheduledMessageResponse struct {
+	ID        string          `json:"id"`
+	ClientID  string          `json:"clientId"`
+	Type      string          `json:"type"`
+	Payload   json.RawMessage `json:"payload"`
+	SendAt    time.Time       `json:"sendAt"`
+	Timezone  string          `json:"timezone,omitempty"`
+	Status    string          `json:"status"`
+	MessageID string          `json:"messageId,omitempty"`
+	Error     string          `json:"error,omitempty"`
+	Attempts  int             `json:"attempts"`
+	CreatedAt time.Time       `json:"createdAt"`
+	SentAt    *time.Time      `json:"sentAt,omitempty"`
+}
+
+// parseSendAt resolves sendAt to an absolute time, using timezone when sendAt carries no offset
+func parseSendAt(sendAt string, timezone string) (time.Time, error) {
+	loc := time.UTC
+	if timezone != "" {
+		var err error
+		loc, err = time.LoadLocation(timezone)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid timezone %q: %w", timezone, err)
+		}
+	}
+
+	if t, err := time.Parse(time.RFC3339, sendAt); err == nil {
+		return t.In(loc), nil
+	}
+	for _, layout := range scheduledLocalLayouts {
+		if t, err := time.ParseInLocation(layout, sendAt, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid sendAt %q: expected RFC3339 or YYYY-MM-DDTHH:MM[:SS]", sendAt)
+}
+
+const scheduledMessageColumns = `id, client_id, type, payload, send_at, timezone, status, message_id, error, attempts, created_at, sent_at`
+
+func scanScheduledMessage(row interface{ Scan(...interface{}) error }) (ScheduledMessageResponse, error) {
+	var msg ScheduledMessageResponse
+	var payload string
+	var sendAt, createdAt int64
+	var sentAt sql.NullInt64
+	err := row.Scan(&msg.ID, &msg.ClientID, &msg.Type, &payload, &sendAt, &msg.Timezone, &msg.Status,
+		&msg.MessageID, &msg.Error, &msg.Attempts, &createdAt, &sentAt)
+	if err != nil {
+		return msg, err
+	}
+
+	msg.Payload = json.RawMessage(payload)
+	loc := time.UTC
+	if msg.Timezone != "" {
+		if l, err := time.LoadLocation(msg.Timezone); err == nil {
+			loc = l
+		}
+	}
+	msg.SendAt = time.Unix(sendAt, 0).In(loc)
+	msg.CreatedAt = time.Unix(createdAt, 0).UTC()
+	if sentAt.Valid {
+		t := time.Unix(sentAt.Int64, 0).UTC()
+		msg.SentAt = &t
+	}
+	return msg, nil
+}
+
+// getScheduledMessage loads a single scheduled message owned by clientID
+func (cm *ClientManager) getScheduledMessage(clientID string, scheduledID string) (ScheduledMessageResponse, error) {
+	row := cm.db.QueryRow(`SELECT `+scheduledMessageColumns+` FROM aimeow_scheduled_messages WHERE id=$1 AND client_id=$2`,
+		scheduledID, clientID)
+	return scanScheduledMessage(row)
+}
+
+// runScheduler dispatches due scheduled messages until the process exits
+func (cm *ClientManager) runScheduler() {
+	fmt.Printf("[Scheduler] Started (poll interval: %s)\n", scheduledMessagePollInterval)
+
+	// A message still sending was interrupted by a restart and may have been delivered, so it is
+	// failed rather than sent again
+	if _, err := cm.db.Exec(`UPDATE aimeow_scheduled_messages SET status=$1, error=$2 WHERE status=$3`,
+		scheduledStatusFailed, "interrupted while sending", scheduledStatusSending); err != nil {
+		fmt.Printf("[Scheduler] Failed to fail interrupted messages: %v\n", err)
+	}
+
+	ticker := time.NewTicker(scheduledMessagePollInterval)
+	defer ticker.Stop()
+
+	for {
+		cm.dispatchDueScheduledMessages()
+		<-ticker.C
+	}
+}
+
+// dispatchDueScheduledMessages sends every pending message whose sendAt has passed
+func (cm *ClientManager) dispatchDueScheduledMessages() {
+	rows, err := cm.db.Query(`SELECT `+scheduledMessageColumns+` FROM aimeow_scheduled_messages
+		WHERE status=$1 AND send_at<=$2 ORDER BY send_at`, scheduledStatusPending, time.Now().Unix())
+	if err != nil {
+		fmt.Printf("[Scheduler] Failed to query due messages: %v\n", err)
+		return
+	}
+
+	var due []ScheduledMessageResponse
+	for rows.Next() {
+		msg, err := scanScheduledMessage(rows)
+		if err != nil {
+			fmt.Printf("[Scheduler] Failed to read scheduled message: %v\n", err)
+			continue
+		}
+		due = append(due, msg)
+	}
+	rows.Close()
+
+	for _, msg := range due {
+		if cm.isSkippedClient(msg.ClientID) {
+			continue
+		}
+		cm.dispatchScheduledMessage(msg)
+	}
+}
+
+// dispatchScheduledMessage sends one scheduled message and records the outcome
+func (cm *ClientManager) dispatchScheduledMessage(msg ScheduledMessageResponse) {
+	waClient, err := cm.getClient(msg.ClientID)
+	if err != nil {
+		cm.finishScheduledMessage(msg, scheduledStatusPending, scheduledStatusFailed, "", "client not found")
+		return
+	}
+
+	isConnected := waClient.connected()
+
+	// Leave the message pending until the client is back, e.g. while reconnecting after a restart
+	if !isConnected {
+		if _, err := cm.db.Exec(`UPDATE aimeow_scheduled_messages SET error=$1 WHERE id=$2`,
+			"client is not connected", msg.ID); err != nil {
+			fmt.Printf("[Scheduler] Failed to update scheduled message %s: %v\n", msg.ID, err)
+		}
+		return
+	}
+
+	// Claim the message so a cancel can't land while it is being sent
+	result, err := cm.db.Exec(`UPDATE aimeow_scheduled_messages SET status=$1 WHERE id=$2 AND status=$3`,
+		scheduledStatusSending, msg.ID, scheduledStatusPending)
+	if err != nil {
+		fmt.Printf("[Scheduler] Failed to claim scheduled message %s: %v\n", msg.ID, err)
+		return
+	}
+	if n, err := result.RowsAffected(); err != nil || n != 1 {
+		return // Cancelled since it was read
+	}
+
+	resp, _ := cm.dispatchSend(waClient, msg.Type, msg.Payload)
+	if resp.Success {
+		cm.finishScheduledMessage(msg, scheduledStatusSending, scheduledStatusSent, resp.MessageID, resp.Error)
+	} else {
+		cm.finishScheduledMessage(msg, scheduledStatusSending, scheduledStatusFailed, "", resp.Error)
+	}
+}
+
+// finishScheduledMessage moves a dispatched message from one state to its final state and notifies
+// the backend if it was still in the expected state
+func (cm *ClientManager) finishScheduledMessage(msg ScheduledMessageResponse, from string, status string, messageID string, errMsg string) {
+	now := time.Now()
+	result, err := cm.db.Exec(`UPDATE aimeow_scheduled_messages
+		SET status=$1, message_id=$2, error=$3, attempts=attempts+1, sent_at=$4 WHERE id=$5 AND status=$6`,
+		status, messageID, errMsg, now.Unix(), msg.ID, from)
+	if err != nil {
+		fmt.Printf("[Scheduler] Failed to update scheduled message %s: %v\n", msg.ID, err)
+		return
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		fmt.Printf("[Scheduler] Scheduled message %s is no longer %s, not marking it %s\n", msg.ID, from, status)
+		return
+	}
+
+	fmt.Printf("[Scheduler] Scheduled message %s for client %s: %s %s\n", msg.ID, msg.ClientID, status, errMsg)
+
+	go cm.sendConnectionStatusWebhook(msg.ClientID, "scheduled_"+status, map[string]interface{}{
+		"scheduledId": msg.ID,
+		"type":        msg.Type,
+		"messageId":   messageID,
+		"error":       errMsg,
+		"sendAt":      msg.SendAt.Format(time.RFC3339),
+	})
+}
+
+// @Summary Schedule a message
+// @Description Stores a send payload to be sent at sendAt. The body holds the fields of the send endpoint selected by type (message, image, images, document or document-base64) plus sendAt and an optional IANA timezone.
+// @Tags scheduled
+// @Accept json
+// @Produce json
+// @Param id path string true "Client ID"
+// @Param message body ScheduleMessageRequest true "Send payload with sendAt and timezone"
+// @Param Idempotency-Key header string false "Key that makes retries return the original response"
+// @Success 200 {object} ScheduledMessageResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /clients/{id}/scheduled [post]
+func createScheduledMessage(c *gin.Context) {
+	clientID := c.Param("id")
+
+	if _, err := manager.getClient(clientID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	body, err := c.GetRawData()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var req ScheduleMessageRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := binding.Validator.ValidateStruct(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Type == "" {
+		req.Type = "message"
+	}
+
+	sendAt, err := parseSendAt(req.SendAt, req.Timezone)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Validate the payload now so mistakes surface at scheduling time, not at send time
+	if _, err := decodeSendPayload(req.Type, body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	now := time.Now()
+	scheduledID := uuid.New().String()
+	_, err = manager.db.Exec(`INSERT INTO aimeow_scheduled_messages
+		(id, client_id, type, payload, send_at, timezone, status, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		scheduledID, clientID, req.Type, string(body), sendAt.Unix(), req.Timezone, scheduledStatusPending, now.Unix())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to store scheduled message: %v", err)})
+		return
+	}
+
+	fmt.Printf("[Scheduler] Scheduled %s message %s for client %s at %s\n", req.Type, scheduledID, clientID, sendAt.Format(time.RFC3339))
+
+	msg, err := manager.getScheduledMessage(clientID, scheduledID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, msg)
+}
+
+// @Summary List scheduled messages
+// @Description Returns the scheduled messages of a client, soonest first
+// @Tags scheduled
+// @Accept json
+// @Produce json
+// @Param id path string true "Client ID"
+// @Param status query string false "Filter by status (pending, sending, sent, failed, cancelled)"
+// @Success 200 {array} ScheduledMessageResponse
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /clients/{id}/scheduled [get]
+func listScheduledMessages(c *gin.Context) {
+	clientID := c.Param("id")
+
+	if _, err := manager.getClient(clientID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	query := `SELECT ` + scheduledMessageColumns + ` FROM aimeow_scheduled_messages WHERE client_id=$1`
+	args := []interface{}{clientID}
+	if status := c.Query("status"); status != "" {
+		query += ` AND status=$2`
+		args = append(args, status)
+	}
+	query += ` ORDER BY send_at`
+
+	rows, err := manager.db.Query(query, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	response := make([]ScheduledMessageResponse, 0)
+	for rows.Next() {
+		msg, err := scanScheduledMessage(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		response = append(response, msg)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// @Summary Cancel a scheduled message
+// @Description Cancels a scheduled message that has not been sent yet
+// @Tags scheduled
+// @Accept json
+// @Produce json
+// @Param id path string true "Client ID"
+// @Param scheduled_id path string true "Scheduled message ID"
+// @Success 200 {object} ScheduledMessageResponse
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /clients/{id}/scheduled/{scheduled_id} [delete]
+func cancelScheduledMessage(c *gin.Context) {
+	clientID := c.Param("id")
+	scheduledID := c.Param("scheduled_id")
+
+	msg, err := manager.getScheduledMessage(clientID, scheduledID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "scheduled message not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := manager.db.Exec(`UPDATE aimeow_scheduled_messages SET status=$1 WHERE id=$2 AND status=$3`,
+		scheduledStatusCancelled, scheduledID, scheduledStatusPending)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		// Re-read the state, the scheduler may have claimed the message since it was read
+		if current, err := manager.getScheduledMessage(clientID, scheduledID); err == nil {
+			msg = current
+		}
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("scheduled message is already %s", msg.Status)})
+		return
+	}
+
+	msg.Status = scheduledStatusCancelled
+	c.JSON(http.StatusOK, msg)
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// Page size limits for message search
+const (
+	defaultSearchPageSize = 20
+	maxSearchPageSize     = 200
+)
+
+// Default markers put around matched terms in search snippets
+const (
+	defaultHighlightStart = "<mark>"
+	defaultHighlightEnd   = "</mark>"
+)
+
+// searchSnippetTokens is the number of tokens of context a search snippet shows
+const searchSnippetTokens = 16
+
+// messageSearchTables index the text, caption and file name of stored messages and fill the
+// index with the messages stored before it existed. The index keeps its own copy of the text
+// and is kept in sync by triggers, so messages stored by any code path are searchable.
+// aimeow_messages has no INTEGER PRIMARY KEY and VACUUM may renumber its rowids, so index rows
+// are keyed by aimeow_messages_fts_keys, whose doc_id is stable. They need SQLite with FTS5.
+var messageSearchTables = []string{
+	`CREATE TABLE aimeow_messages_fts_keys (
+		doc_id INTEGER PRIMARY KEY,
+		client_id TEXT NOT NULL,
+		chat_jid TEXT NOT NULL,
+		id TEXT NOT NULL,
+		UNIQUE (client_id, chat_jid, id)
+	)`,
+	`CREATE VIRTUAL TABLE aimeow_messages_fts USING fts5(
+		text, caption, file_name, tokenize='unicode61 remove_diacritics 2'
+	)`,
+	`CREATE TRIGGER aimeow_messages_fts_insert AFTER INSERT ON aimeow_messages BEGIN
+		INSERT INTO aimeow_messages_fts_keys (client_id, chat_jid, id) VALUES (new.client_id, new.chat_jid, new.id);
+		INSERT INTO aimeow_messages_fts (rowid, text, caption, file_name) VALUES (last_insert_rowid(), new.text, new.caption, new.file_name);
+	END`,
+	`CREATE TRIGGER aimeow_messages_fts_delete AFTER DELETE ON aimeow_messages BEGIN
+		DELETE FROM aimeow_messages_fts WHERE rowid = (SELECT doc_id FROM aimeow_messages_fts_keys
+			WHERE client_id = old.client_id AND chat_jid = old.chat_jid AND id = old.id);
+		DELETE FROM aimeow_messages_fts_keys WHERE client_id = old.client_id AND chat_jid = old.chat_jid AND id = old.id;
+	END`,
+	`CREATE TRIGGER aimeow_messages_fts_update AFTER UPDATE OF text, caption, file_name ON aimeow_messages BEGIN
+		UPDATE aimeow_messages_fts SET text = new.text, caption = new.caption, file_name = new.file_name
+			WHERE rowid = (SELECT doc_id FROM aimeow_messages_fts_keys
+				WHERE client_id = new.client_id AND chat_jid = new.chat_jid AND id = new.id);
+	END`,
+	`INSERT INTO aimeow_messages_fts_keys (client_id, chat_jid, id) SELECT client_id, chat_jid, id FROM aimeow_messages`,
+	`INSERT INTO aimeow_messages_fts (rowid, text, caption, file_name)
+		SELECT k.doc_id, m.text, m.caption, m.file_name FROM aimeow_messages_fts_keys k
+		JOIN aimeow_messages m ON m.client_id = k.client_id AND m.chat_jid = k.chat_jid AND m.id = k.id`,
+}
+
+// messageSearchText is the text PostgreSQL indexes and searches for a stored message, with
+// the columns prefixed by prefix
+func messageSearchText(prefix string) string {
+	return prefix + `text || ' ' || ` + prefix + `caption || ' ' || ` + prefix + `file_name`
+}
+
+// postgresSearchTables are the PostgreSQL counterpart of messageSearchTables, an expression
+// index the search query uses directly
+var postgresSearchTables = []string{
+	`CREATE INDEX aimeow_messages_search_idx ON aimeow_messages
+		USING GIN (to_tsvector('simple', ` + messageSearchText("") + `))`,
+}
+
+// sqliteHasFTS5 reports whether SQLite was built with FTS5, which the search index needs
+func sqliteHasFTS5(ctx context.Context, db *sql.DB) bool {
+	var fts5 bool
+	err := db.QueryRowContext(ctx, `SELECT sqlite_compileoption_used('ENABLE_FTS5')`).Scan(&fts5)
+	return err == nil && fts5
+}
+
+// searchMatchQuery turns free text into an FTS5 query, or a tsquery on PostgreSQL, that
+// matches messages containing all the words. Only letters and digits are kept so punctuation
+// can't form query syntax; a trailing * keeps its prefix meaning, so "invo*" matches "invoice".
+func searchMatchQuery(q string) string {
+	words := strings.FieldsFunc(q, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r) && r != '*'
+	})
+	terms := make([]string, 0, len(words))
+	for _, word := range words {
+		prefix := strings.HasSuffix(word, "*")
+		word = strings.ReplaceAll(word, "*", "")
+		if word == "" {
+			continue
+		}
+		if dbDialect == dialectPostgres {
+			term := word
+			if prefix {
+				term += ":*"
+			}
+			terms = append(terms, term)
+			continue
+		}
+		term := `"` + word + `"`
+		if prefix {
+			term += "*"
+		}
+		terms = append(terms, term)
+	}
+	if dbDialect == dialectPostgres {
+		return strings.Join(terms, " & ")
+	}
+	return strings.Join(terms, " ")
+}
+
+// SearchResult is a stored message matching a search, with the matching part highlighted
+type SearchResult struct {
+	StoredMessage
+	Snippet string `json:"snippet"` // Best matching part of the text, caption or file name with the matched terms highlighted
+}
+
+// @Summary Search messages
+// @Description Full-text search over the text, captions and document file names of stored messages. All words must match; a word ending in * matches as a prefix. Results carry the message id and fileUrl of the stored message and a snippet with the matches highlighted. The total number of matching messages is returned in the X-Total-Count header.
+// @Tags chats
+// @Accept json
+// @Produce json
+// @Param id path string true "Client ID"
+// @Param q query string true "Words to search for"
+// @Param chat query string false "Only messages of this chat (group JID, phone number or LID)"
+// @Param sender query string false "Only messages from this sender (phone number, phone JID or LID)"
+// @Param fromMe query bool false "Only messages sent (true) or received (false) by this account"
+// @Param type query string false "Only messages of this type, e.g. text, image or document"
+// @Param before query string false "Only messages before this time (RFC3339 or Unix seconds)"
+// @Param after query string false "Only messages after this time (RFC3339 or Unix seconds)"
+// @Param order query string false "Sort order" Enums(relevance, desc, asc) default(relevance)
+// @Param highlightStart query string false "Marker put before matched terms" default(<mark>)
+// @Param highlightEnd query string false "Marker put after matched terms" default(</mark>)
+// @Param limit query int false "Maximum number of results to return (1-200)" default(20)
+// @Param offset query int false "Number of results to skip" default(0)
+// @Success 200 {array} SearchResult
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /clients/{id}/search [get]
+func searchMessages(c *gin.Context) {
+	clientID := c.Param("id")
+	waClient, err := manager.getClient(clientID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	match := searchMatchQuery(c.Query("q"))
+	if match == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "q must contain at least one word"})
+		return
+	}
+	limit, offset, err := parsePageParams(c, defaultSearchPageSize, maxSearchPageSize)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	search := sqliteMessageSearch
+	if dbDialect == dialectPostgres {
+		search = postgresMessageSearch
+	}
+	orderBy := map[string]string{
+		"relevance": search.rank + ", m.timestamp DESC",
+		"desc":      "m.timestamp DESC, m.id DESC",
+		"asc":       "m.timestamp ASC, m.id ASC",
+	}[strings.ToLower(c.DefaultQuery("order", "relevance"))]
+	if orderBy == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "order must be relevance, desc or asc"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	args := []interface{}{clientID, match}
+	condition := `m.client_id=$1 AND ` + search.match
+
+	if chat := c.Query("chat"); chat != "" {
+		jid, _, err := waClient.parseRecipient(chat)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid chat: %v", err)})
+			return
+		}
+		candidates := manager.chatJIDCandidates(ctx, waClient, jid.ToNonAD())
+		condition += ` AND m.chat_jid IN (` + inPlaceholders(len(args)+1, len(candidates)) + `)`
+		for _, candidate := range candidates {
+			args = append(args, candidate)
+		}
+	}
+	if sender := c.Query("sender"); sender != "" {
+		jid, phone, err := waClient.parseRecipient(sender)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid sender: %v", err)})
+			return
+		}
+		candidates := manager.chatJIDCandidates(ctx, waClient, jid.ToNonAD())
+		senderCondition := `m.sender_jid IN (` + inPlaceholders(len(args)+1, len(candidates)) + `)`
+		for _, candidate := range candidates {
+			args = append(args, candidate)
+		}
+		if jid.Server == types.DefaultUserServer {
+			args = append(args, phone)
+			senderCondition += fmt.Sprintf(` OR m.sender_phone=$%d`, len(args))
+		}
+		condition += ` AND (` + senderCondition + `)`
+	}
+	fromMe, err := parseBoolParam(c, "fromMe")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if fromMe != nil {
+		args = append(args, *fromMe)
+		condition += fmt.Sprintf(` AND m.from_me=$%d`, len(args))
+	}
+	if messageType := c.Query("type"); messageType != "" {
+		args = append(args, messageType)
+		condition += fmt.Sprintf(` AND m.type=$%d`, len(args))
+	}
+	for _, bound := range []struct{ param, condition string }{
+		{"before", " AND m.timestamp < $%d"},
+		{"after", " AND m.timestamp > $%d"},
+	} {
+		t, err := parseTimeParam(c, bound.param)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if t != nil {
+			args = append(args, t.Unix())
+			condition += fmt.Sprintf(bound.condition, len(args))
+		}
+	}
+
+	var total int
+	if err := manager.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM `+search.from+` WHERE `+condition, args...).Scan(&total); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to count search results: %v", err)})
+		return
+	}
+
+	columns := "m." + strings.ReplaceAll(storedMessageColumns, ", ", ", m.")
+	rows, err := manager.db.QueryContext(ctx, fmt.Sprintf(`SELECT %s, %s
+		FROM %s WHERE %s ORDER BY %s LIMIT %d OFFSET %d`,
+		columns, search.snippet, search.from, condition, orderBy, limit, offset), args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to search messages: %v", err)})
+		return
+	}
+	defer rows.Close()
+
+	// The snippet marks matches with control characters, which can't occur in the indexed text
+	highlighter := strings.NewReplacer("\x02", c.DefaultQuery("highlightStart", defaultHighlightStart),
+		"\x03", c.DefaultQuery("highlightEnd", defaultHighlightEnd))
+	results := make([]SearchResult, 0)
+	for rows.Next() {
+		var result SearchResult
+		m, err := scanStoredMessage(snippetScanner{rows, &result.Snippet}, clientID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to read search result: %v", err)})
+			return
+		}
+		result.StoredMessage = m
+		result.Snippet = highlighter.Replace(result.Snippet)
+		results = append(results, result)
+	}
+
+	c.Header("X-Total-Count", strconv.Itoa(total))
+	c.JSON(http.StatusOK, results)
+}
+
+// messageSearchSQL holds the parts of the search query that differ between the SQLite and
+// PostgreSQL full-text indexes. The match query is always $2.
+type messageSearchSQL struct {
+	from    string // Tables searched, with aimeow_messages as m
+	match   string // Condition matching the query
+	rank    string // Expression ordering the best matches first
+	snippet string // Expression for the snippet, marking matches with \x02 and \x03
+}
+
+var sqliteMessageSearch = messageSearchSQL{
+	from: `aimeow_messages_fts JOIN aimeow_messages_fts_keys k ON k.doc_id = aimeow_messages_fts.rowid
+		JOIN aimeow_messages m ON m.client_id = k.client_id AND m.chat_jid = k.chat_jid AND m.id = k.id`,
+	match:   `aimeow_messages_fts MATCH $2`,
+	rank:    `aimeow_messages_fts.rank`,
+	snippet: fmt.Sprintf(`snippet(aimeow_messages_fts, -1, char(2), char(3), '…', %d)`, searchSnippetTokens),
+}
+
+var postgresMessageSearch = messageSearchSQL{
+	from:  `aimeow_messages m`,
+	match: `to_tsvector('simple', ` + messageSearchText("m.") + `) @@ to_tsquery('simple', $2)`,
+	rank:  `ts_rank(to_tsvector('simple', ` + messageSearchText("m.") + `), to_tsquery('simple', $2)) DESC`,
+	snippet: fmt.Sprintf(`ts_headline('simple', `+messageSearchText("m.")+`, to_tsquery('simple', $2),
+		'StartSel=' || chr(2) || ', StopSel=' || chr(3) || ', MaxWords=%d, MinWords=%d')`, searchSnippetTokens, searchSnippetTokens/2),
+}
+
+// snippetScanner reads a stored message row followed by its search snippet
+type snippetScanner struct {
+	rows    *sql.Rows
+	snippet *string
+}
+
+func (s snippetScanner) Scan(dest ...interface{}) error {
+	return s.rows.Scan(append(dest, s.snippet)...)
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// Automatic read receipt modes
+const (
+	autoReadOff       = "off"
+	autoReadImmediate = "immediate"
+	autoReadDelayed   = "delayed"
+)
+
+// Chats the automatic read receipts and typing indicator apply to
+const (
+	chatFilterAll       = "all"
+	chatFilterDMs       = "dms"
+	chatFilterGroups    = "groups"
+	chatFilterAllowlist = "allowlist"
+)
+
+// ClientSettings controls what a client does automatically for inbound messages
+type ClientSettings struct {
+	AutoRead             string   `json:"autoRead"`             // off, immediate or delayed
+	AutoReadDelaySeconds int      `json:"autoReadDelaySeconds"` // Delay before marking read in delayed mode
+	AutoTyping           bool     `json:"autoTyping"`           // Show typing after an inbound message
+	TypingTimeoutSeconds int      `json:"typingTimeoutSeconds"` // Typing is stopped after this long without a reply
+	ChatFilter           string   `json:"chatFilter"`           // all, dms, groups or allowlist
+	Allowlist            []string `json:"allowlist"`            // Phone numbers or JIDs used by the allowlist filter
+	DefaultCountry       string   `json:"defaultCountry"`       // ISO country code used for phone numbers in national format
+	WebhookVersion       int      `json:"webhookVersion"`       // Schema version of the webhooks of this client, 0 follows webhook.payloadVersion
+}
+
+// UpdateClientSettingsRequest changes only the fields that are present
+type UpdateClientSettingsRequest struct {
+	AutoRead             *string   `json:"autoRead,omitempty" binding:"omitempty,oneof=off immediate delayed"`
+	AutoReadDelaySeconds *int      `json:"autoReadDelaySeconds,omitempty" binding:"omitempty,min=0,max=3600"`
+	AutoTyping           *bool     `json:"autoTyping,omitempty"`
+	TypingTimeoutSeconds *int      `json:"typingTimeoutSeconds,omitempty" binding:"omitempty,min=1,max=600"`
+	ChatFilter           *string   `json:"chatFilter,omitempty" binding:"omitempty,oneof=all dms groups allowlist"`
+	Allowlist            *[]string `json:"allowlist,omitempty"`
+	DefaultCountry       *string   `json:"defaultCountry,omitempty"` // Empty restores the server default (clients.defaultCountry)
+	WebhookVersion       *int      `json:"webhookVersion,omitempty" binding:"omitempty,min=0,max=2"`
+}
+
+// defaultClientSettings matches the behaviour clients had before settings existed
+func defaultClientSettings() ClientSettings {
+	return ClientSettings{
+		AutoRead:             autoReadImmediate,
+		AutoReadDelaySeconds: 5,
+		AutoTyping:           true,
+		TypingTimeoutSeconds: int(time.Duration(appConfig().Clients.TypingTimeout) / time.Second),
+		ChatFilter:           chatFilterAll,
+		Allowlist:            []string{},
+		DefaultCountry:       appConfig().Clients.DefaultCountry,
+	}
+}
+
+// resolve merges the request into the settings like apply, then checks the result and normalizes
+// the allowlist when it or the default country changed
+func (req UpdateClientSettingsRequest) resolve(settings ClientSettings) (ClientSettings, error) {
+	settings = req.apply(settings)
+	if settings.ChatFilter == chatFilterAllowlist && len(settings.Allowlist) == 0 {
+		return settings, fmt.Errorf("allowlist filter requires at least one allowlist entry")
+	}
+	if err := validatePhoneCountry(settings.DefaultCountry); err != nil {
+		return settings, err
+	}
+	if req.Allowlist != nil || req.DefaultCountry != nil {
+		allowlist, err := normalizeAllowlist(settings.Allowlist, settings.DefaultCountry)
+		if err != nil {
+			return settings, err
+		}
+		settings.Allowlist = allowlist
+	}
+	return settings, nil
+}
+
+// apply merges the fields present in the request into the settings
+func (req UpdateClientSettingsRequest) apply(settings ClientSettings) ClientSettings {
+	if req.AutoRead != nil {
+		settings.AutoRead = *req.AutoRead
+	}
+	if req.AutoReadDelaySeconds != nil {
+		settings.AutoReadDelaySeconds = *req.AutoReadDelaySeconds
+	}
+	if req.AutoTyping != nil {
+		settings.AutoTyping = *req.AutoTyping
+	}
+	if req.TypingTimeoutSeconds != nil {
+		settings.TypingTimeoutSeconds = *req.TypingTimeoutSeconds
+	}
+	if req.ChatFilter != nil {
+		settings.ChatFilter = *req.ChatFilter
+	}
+	if req.Allowlist != nil {
+		settings.Allowlist = *req.Allowlist
+	}
+	if req.DefaultCountry != nil {
+		settings.DefaultCountry = strings.ToUpper(strings.TrimSpace(*req.DefaultCountry))
+		if settings.DefaultCountry == "" {
+			settings.DefaultCountry = appConfig().Clients.DefaultCountry
+		}
+	}
+	if req.WebhookVersion != nil {
+		settings.WebhookVersion = *req.WebhookVersion
+	}
+	return settings
+}
+
+// normalizeAllowlist converts the phone numbers in an allowlist to E.164, leaving JIDs as they are
+func normalizeAllowlist(entries []string, defaultCountry string) ([]string, error) {
+	result := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if !strings.Contains(entry, "@") {
+			phone, err := normalizePhone(entry, defaultCountry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid allowlist entry: %w", err)
+			}
+			entry = phone
+		}
+		result = append(result, entry)
+	}
+	return result, nil
+}
+
+// appliesTo reports whether automatic read receipts and typing are enabled for a chat
+func (s ClientSettings) appliesTo(info types.MessageInfo) bool {
+	switch s.ChatFilter {
+	case chatFilterDMs:
+		return !info.IsGroup
+	case chatFilterGroups:
+		return info.IsGroup
+	case chatFilterAllowlist:
+		candidates := []string{info.Chat.String(), info.Chat.User, info.Sender.User, info.SenderAlt.User}
+		for _, entry := range s.Allowlist {
+			entry = strings.TrimPrefix(strings.TrimSpace(entry), "+")
+			for _, candidate := range candidates {
+				if candidate != "" && (entry == candidate || strings.TrimSuffix(entry, "@s.whatsapp.net") == candidate) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// loadClientSettings returns the stored settings of a client, or the defaults if there are none
+func (cm *ClientManager) loadClientSettings(clientID string) ClientSettings {
+	settings := defaultClientSettings()
+
+	var data string
+	err := cm.db.QueryRow(`SELECT settings FROM aimeow_client_settings WHERE client_id=$1`, clientID).Scan(&data)
+	if err == sql.ErrNoRows {
+		return settings
+	} else if err != nil {
+		fmt.Printf("Warning: Failed to load settings for client %s: %v\n", clientID, err)
+		return settings
+	}
+
+	if err := json.Unmarshal([]byte(data), &settings); err != nil {
+		fmt.Printf("Warning: Failed to parse settings for client %s: %v\n", clientID, err)
+	}
+	return settings
+}
+
+// saveClientSettings persists the settings of a client
+func (cm *ClientManager) saveClientSettings(clientID string, settings ClientSettings) error {
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return fmt.Errorf("failed to marshal client settings: %w", err)
+	}
+
+	_, err = cm.db.Exec(`INSERT INTO aimeow_client_settings (client_id, settings, updated_at) VALUES ($1, $2, $3)
+		ON CONFLICT (client_id) DO UPDATE SET settings=excluded.settings, updated_at=excluded.updated_at`,
+		clientID, string(data), time.Now().Unix())
+	if err != nil {
+		return fmt.Errorf("failed to save client settings: %w", err)
+	}
+	return nil
+}
+
+// autoReadAndType marks an inbound message as read and starts typing according to the client settings
+func (cm *ClientManager) autoReadAndType(client *WhatsAppClient, settings ClientSettings, info types.MessageInfo) {
+	switch settings.AutoRead {
+	case autoReadDelayed:
+		time.Sleep(time.Duration(settings.AutoReadDelaySeconds) * time.Second)
+		fallthrough
+	case autoReadImmediate:
+		err := client.client.MarkRead(context.Background(), []types.MessageID{info.ID}, info.Timestamp, info.Chat, info.Sender)
+		if err != nil {
+			fmt.Printf("Failed to mark message as read: %v\n", err)
+		} else {
+			fmt.Printf("Marked message as read from %s\n", info.Chat.String())
+			cm.updateChatFlag(client, info.Chat, "unread_count", 0)
+		}
+	}
+
+	if settings.AutoTyping {
+		cm.startTyping(client, info.Chat)
+	}
+}
+
+// @Summary Get client settings
+// @Description Returns the automatic read receipt, typing, phone number and webhook version settings of a client
+// @Tags clients
+// @Accept json
+// @Produce json
+// @Param id path string true "Client ID"
+// @Success 200 {object} ClientSettings
+// @Failure 404 {object} map[string]string
+// @Router /clients/{id}/settings [get]
+func getClientSettings(c *gin.Context) {
+	waClient, err := manager.getClient(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	waClient.mutex.RLock()
+	settings := waClient.settings
+	waClient.mutex.RUnlock()
+
+	c.JSON(http.StatusOK, settings)
+}
+
+// @Summary Update client settings
+// @Description Updates the automatic read receipt, typing, phone number and webhook version settings of a client. Only the fields present are changed.
+// @Tags clients
+// @Accept json
+// @Produce json
+// @Param id path string true "Client ID"
+// @Param settings body UpdateClientSettingsRequest true "Settings to change"
+// @Success 200 {object} ClientSettings
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /clients/{id}/settings [patch]
+func updateClientSettings(c *gin.Context) {
+	clientID := c.Param("id")
+
+	waClient, err := manager.getClient(clientID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	var req UpdateClientSettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	waClient.mutex.Lock()
+	settings, err := req.resolve(waClient.settings)
+	if err != nil {
+		waClient.mutex.Unlock()
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := manager.saveClientSettings(clientID, settings); err != nil {
+		waClient.mutex.Unlock()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	waClient.settings = settings
+	waClient.mutex.Unlock()
+
+	fmt.Printf("Updated settings for client %s: %+v\n", clientID, settings)
+	c.JSON(http.StatusOK, settings)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// ConnectionState is the lifecycle state of a client's WhatsApp connection
+type ConnectionState string
+
+const (
+	StatePairing           ConnectionState = "pairing"            // Not linked yet, waiting for a QR scan or pairing code
+	StateConnecting        ConnectionState = "connecting"         // Linked, connection being established
+	StateConnected         ConnectionState = "connected"          // Connected and able to send
+	StateDisconnected      ConnectionState = "disconnected"       // Not connected and not retrying
+	StateReconnecting      ConnectionState = "reconnecting"       // Connection lost, retrying
+	StateLoggedOut         ConnectionState = "logged_out"         // Unlinked from the phone, must be paired again
+	StateTemporarilyBanned ConnectionState = "temporarily_banned" // Rejected by WhatsApp for a while
+	StateStreamReplaced    ConnectionState = "stream_replaced"    // Another connection with the same session took over
+)
+
+// connectionStates lists every state, in the order they are documented
+var connectionStates = []ConnectionState{
+	StatePairing, StateConnecting, StateConnected, StateDisconnected,
+	StateReconnecting, StateLoggedOut, StateTemporarilyBanned, StateStreamReplaced,
+}
+
+// validConnectionState reports whether s names a connection state
+func validConnectionState(s string) bool {
+	for _, state := range connectionStates {
+		if string(state) == s {
+			return true
+		}
+	}
+	return false
+}
+
+// ConnectionStatus is the current state of a client along with when and why it was entered
+type ConnectionStatus struct {
+	State  ConnectionState `json:"state"`
+	Since  time.Time       `json:"since"`
+	Reason string          `json:"reason,omitempty"`
+}
+
+func newConnectionStatus(state ConnectionState, reason string) ConnectionStatus {
+	return ConnectionStatus{State: state, Since: time.Now(), Reason: reason}
+}
+
+// connected reports whether the client is connected and able to send
+func (c *WhatsAppClient) connected() bool {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.status.State == StateConnected
+}
+
+// connectionStatus returns the current state of the client
+func (c *WhatsAppClient) connectionStatus() ConnectionStatus {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.status
+}
+
+// setStateLocked moves a client to a new state and sends a state_changed webhook. Nothing
+// happens if the client is already in that state. The caller must hold the client's write lock.
+func (cm *ClientManager) setStateLocked(client *WhatsAppClient, state ConnectionState, reason string) {
+	previous := client.status
+	if previous.State == state {
+		return
+	}
+
+	client.status = newConnectionStatus(state, reason)
+	if state == StateConnected {
+		now := client.status.Since
+		client.connectedAt = &now
+	} else {
+		client.connectedAt = nil
+	}
+
+	fmt.Printf("[State] Client %s: %s -> %s (%s)\n", client.id, previous.State, state, reason)
+	if client.id == "" {
+		return
+	}
+	go cm.sendConnectionStatusWebhook(client.id, "state_changed", map[string]interface{}{
+		"state":         state,
+		"previousState": previous.State,
+		"reason":        reason,
+		"since":         client.status.Since.Format(time.RFC3339Nano),
+	})
+}
+
+// setState moves a client to a new state, see setStateLocked
+func (cm *ClientManager) setState(client *WhatsAppClient, state ConnectionState, reason string) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+	cm.setStateLocked(client, state, reason)
+}
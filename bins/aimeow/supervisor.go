@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// Reconnect backoff: the delay doubles from reconnectBaseDelay up to reconnect.maxDelay, giving
+// up after reconnect.maxAttempts (0 = never)
+const reconnectBaseDelay = 2 * time.Second
+
+// How often the watchdog looks for clients whose connection died without an event
+const watchdogInterval = 30 * time.Second
+
+// How long keepalive pings may fail before the connection is considered dead
+const keepAliveMaxFailTime = 3 * time.Minute
+
+// ReconnectStats describes the automatic reconnects of a client
+type ReconnectStats struct {
+	Attempts        int        `json:"attempts"`        // Failed attempts since the connection was lost
+	TotalReconnects int        `json:"totalReconnects"` // Connections restored automatically
+	TotalFailures   int        `json:"totalFailures"`   // Reconnect attempts that failed
+	GiveUps         int        `json:"giveUps"`         // Times the supervisor stopped retrying
+	LastError       string     `json:"lastError,omitempty"`
+	LastAttemptAt   *time.Time `json:"lastAttemptAt,omitempty"`
+	NextAttemptAt   *time.Time `json:"nextAttemptAt,omitempty"`
+}
+
+// reconnectDelay returns the backoff before the given attempt, starting at 0
+func reconnectDelay(attempt int) time.Duration {
+	maxDelay := time.Duration(appConfig().Reconnect.MaxDelay)
+	delay := reconnectBaseDelay
+	for i := 0; i < attempt && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+	return delay
+}
+
+// connectionLostLocked handles a dropped or dead connection by scheduling a reconnect. The
+// caller must hold the client's write lock.
+func (cm *ClientManager) connectionLostLocked(client *WhatsAppClient, reason string) {
+	if client.reconnect.Attempts > 0 {
+		// An attempt got through Connect but the connection failed afterwards
+		client.reconnect.TotalFailures++
+		client.reconnect.LastError = reason
+	}
+	cm.scheduleReconnectLocked(client, reason)
+}
+
+// scheduleReconnectLocked starts the backoff timer for the next reconnect attempt, or gives up
+// once the attempts are used up. Unpaired, logged out, banned and replaced sessions are not
+// retried. The caller must hold the client's write lock.
+func (cm *ClientManager) scheduleReconnectLocked(client *WhatsAppClient, reason string) {
+	switch client.status.State {
+	case StateLoggedOut, StateTemporarilyBanned, StateStreamReplaced:
+		return
+	}
+	if client.deviceStore.ID == nil {
+		cm.setStateLocked(client, StateDisconnected, reason)
+		return
+	}
+	if client.reconnectTimer != nil {
+		return
+	}
+
+	if maxAttempts := appConfig().Reconnect.MaxAttempts; maxAttempts > 0 && client.reconnect.Attempts >= maxAttempts {
+		client.reconnect.GiveUps++
+		client.reconnect.NextAttemptAt = nil
+		attempts := client.reconnect.Attempts
+		client.reconnect.Attempts = 0
+		cm.setStateLocked(client, StateDisconnected, fmt.Sprintf("gave up after %d reconnect attempts", attempts))
+
+		fmt.Printf("[Supervisor] Giving up on client %s after %d attempts: %s\n", client.id, attempts, client.reconnect.LastError)
+		go cm.sendConnectionStatusWebhook(client.id, "reconnect_gave_up", map[string]interface{}{
+			"attempts":  attempts,
+			"lastError": client.reconnect.LastError,
+		})
+		return
+	}
+
+	delay := reconnectDelay(client.reconnect.Attempts)
+	next := time.Now().Add(delay)
+	client.reconnect.NextAttemptAt = &next
+	client.reconnectTimer = time.AfterFunc(delay, func() { cm.attemptReconnect(client) })
+	cm.setStateLocked(client, StateReconnecting, reason)
+
+	fmt.Printf("[Supervisor] Reconnecting client %s in %s (attempt %d): %s\n", client.id, delay, client.reconnect.Attempts+1, reason)
+}
+
+// attemptReconnect runs one reconnect attempt. Success is only known once the Connected event
+// arrives; failures reported later by events schedule the next attempt.
+func (cm *ClientManager) attemptReconnect(client *WhatsAppClient) {
+	client.mutex.Lock()
+	client.reconnectTimer = nil
+	client.reconnect.NextAttemptAt = nil
+	if client.status.State != StateReconnecting {
+		// Disconnected, logged out or reconnected manually while waiting
+		client.mutex.Unlock()
+		return
+	}
+	client.reconnect.Attempts++
+	now := time.Now()
+	client.reconnect.LastAttemptAt = &now
+	attempt := client.reconnect.Attempts
+	client.mutex.Unlock()
+
+	// Drop a half-dead socket so Connect starts from a clean state
+	client.client.Disconnect()
+	err := client.client.Connect()
+	if err == nil {
+		fmt.Printf("[Supervisor] Reconnect attempt %d started for client %s\n", attempt, client.id)
+		return
+	}
+
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+	client.reconnect.TotalFailures++
+	client.reconnect.LastError = err.Error()
+	cm.scheduleReconnectLocked(client, fmt.Sprintf("reconnect attempt %d failed: %v", attempt, err))
+}
+
+// reconnectSucceededLocked resets the backoff once a client is connected again. The caller must
+// hold the client's write lock and call it before moving the client to the connected state.
+func (cm *ClientManager) reconnectSucceededLocked(client *WhatsAppClient) {
+	if client.status.State == StateReconnecting {
+		client.reconnect.TotalReconnects++
+		fmt.Printf("[Supervisor] Client %s reconnected after %d failed attempt(s)\n", client.id, client.reconnect.Attempts)
+		go cm.sendConnectionStatusWebhook(client.id, "reconnected", map[string]interface{}{
+			"failedAttempts": client.reconnect.Attempts,
+		})
+	}
+	cm.cancelReconnectLocked(client)
+	client.reconnect.LastError = ""
+}
+
+// cancelReconnectLocked stops a pending reconnect and resets the backoff, e.g. after a manual
+// disconnect. The caller must hold the client's write lock.
+func (cm *ClientManager) cancelReconnectLocked(client *WhatsAppClient) {
+	if client.reconnectTimer != nil {
+		client.reconnectTimer.Stop()
+		client.reconnectTimer = nil
+	}
+	client.reconnect.Attempts = 0
+	client.reconnect.NextAttemptAt = nil
+}
+
+// runWatchdog periodically looks for paired clients that are marked connected but whose socket
+// is gone, and for reconnects that never finished, and hands them to the supervisor
+func (cm *ClientManager) runWatchdog() {
+	fmt.Printf("[Watchdog] Started, checking connections every %s\n", watchdogInterval)
+
+	ticker := time.NewTicker(watchdogInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		for _, client := range cm.getAllClients() {
+			client.mutex.Lock()
+			if client.deviceStore.ID != nil && client.reconnectTimer == nil {
+				switch client.status.State {
+				case StateConnected:
+					if !client.client.IsConnected() {
+						cm.connectionLostLocked(client, "watchdog: connection is gone")
+					}
+				case StateReconnecting:
+					last := client.reconnect.LastAttemptAt
+					if last == nil || time.Since(*last) > watchdogInterval {
+						cm.connectionLostLocked(client, "watchdog: reconnect attempt did not finish")
+					}
+				}
+			}
+			client.mutex.Unlock()
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/proto/waWeb"
+	"go.mau.fi/whatsmeow/store"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	waLog "go.mau.fi/whatsmeow/util/log"
+)
+
+// whatsAppTransport is the part of the whatsmeow client that aimeow uses. It is a
+// *whatsmeow.Client, or a sandboxTransport when aimeow runs in sandbox mode.
+type whatsAppTransport interface {
+	Connect() error
+	Disconnect()
+	IsConnected() bool
+	Logout(ctx context.Context) error
+	AddEventHandler(handler whatsmeow.EventHandler) uint32
+
+	GetQRChannel(ctx context.Context) (<-chan whatsmeow.QRChannelItem, error)
+	PairPhone(ctx context.Context, phone string, showPushNotification bool, clientType whatsmeow.PairClientType, clientDisplayName string) (string, error)
+
+	SendMessage(ctx context.Context, to types.JID, message *waE2E.Message, extra ...whatsmeow.SendRequestExtra) (whatsmeow.SendResponse, error)
+	BuildRevoke(chat, sender types.JID, id types.MessageID) *waE2E.Message
+	SendChatPresence(ctx context.Context, jid types.JID, state types.ChatPresence, media types.ChatPresenceMedia) error
+	MarkRead(ctx context.Context, ids []types.MessageID, timestamp time.Time, chat, sender types.JID, receiptTypeExtra ...types.ReceiptType) error
+	Upload(ctx context.Context, plaintext []byte, appInfo whatsmeow.MediaType) (whatsmeow.UploadResponse, error)
+	Download(ctx context.Context, msg whatsmeow.DownloadableMessage) ([]byte, error)
+
+	IsOnWhatsApp(ctx context.Context, phones []string) ([]types.IsOnWhatsAppResponse, error)
+	GetUserInfo(ctx context.Context, jids []types.JID) (map[types.JID]types.UserInfo, error)
+	GetBusinessProfile(ctx context.Context, jid types.JID) (*types.BusinessProfile, error)
+	GetProfilePictureInfo(ctx context.Context, jid types.JID, params *whatsmeow.GetProfilePictureParams) (*types.ProfilePictureInfo, error)
+	ParseWebMessage(chatJID types.JID, webMsg *waWeb.WebMessageInfo) (*events.Message, error)
+	StoreLIDPNMapping(ctx context.Context, first, second types.JID)
+}
+
+var _ whatsAppTransport = (*whatsmeow.Client)(nil)
+
+// newTransport returns the connection of a client to WhatsApp, or a simulated one in sandbox
+// mode. The caller registers its event handler.
+func (cm *ClientManager) newTransport(deviceStore *store.Device, device DeviceIdentity) whatsAppTransport {
+	if appConfig().Sandbox.Enabled {
+		return newSandboxTransport(deviceStore)
+	}
+
+	clientLog := waLog.Stdout("Client", appConfig().Logging.Level, true)
+	client := whatsmeow.NewClient(deviceStore, clientLog)
+	client.EnableAutoReconnect = false // Reconnects are handled by the supervisor
+	applyDeviceIdentity(client, device)
+	return client
+}
+
+// isSandboxDevice reports whether a stored session was paired in sandbox mode. Such sessions
+// have no keys registered with WhatsApp and can't connect for real.
+func isSandboxDevice(deviceStore *store.Device) bool {
+	return deviceStore.Platform == sandboxPlatform
+}
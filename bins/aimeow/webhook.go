@@ -0,0 +1,332 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Headers of signed webhook requests. The signature is "sha256=" followed by the hex HMAC-SHA256
+// of "<timestamp>.<body>" keyed with webhook.secret, so receivers can check that a request came
+// from aimeow and reject replays of old ones.
+const (
+	webhookTimestampHeader = "X-Aimeow-Timestamp"
+	webhookSignatureHeader = "X-Aimeow-Signature"
+)
+
+// signWebhook returns the signature header value of a webhook body sent at a unix timestamp
+func signWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// postWebhook posts a JSON webhook body, signed when webhook.secret is set
+func postWebhook(url string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if secret := appConfig().Webhook.Secret; secret != "" {
+		timestamp := time.Now().Unix()
+		req.Header.Set(webhookTimestampHeader, strconv.FormatInt(timestamp, 10))
+		req.Header.Set(webhookSignatureHeader, signWebhook(secret, timestamp, body))
+	}
+	return webhookHTTPClient().Do(req)
+}
+
+// Webhook payload schema versions. Version 1 is the original format: bodies without event and
+// schemaVersion, the message time as RFC3339 but the send time as unix seconds, and fields left
+// out when they don't apply. Version 2 names the event and version in every body, uses RFC3339
+// times throughout and always sends every field, with null for what doesn't apply. The version
+// is chosen with webhook.payloadVersion and the webhookVersion client setting; the JSON Schema
+// of each is served at /api/v1/webhooks/schema.
+const (
+	webhookSchemaV1            = 1
+	webhookSchemaV2            = 2
+	latestWebhookSchemaVersion = webhookSchemaV2
+)
+
+// webhookEventMessage is the event of message webhooks in version 2
+const webhookEventMessage = "message"
+
+// MessageWebhookV1 is the version 1 body of message webhooks
+type MessageWebhookV1 struct {
+	ClientID  string           `json:"clientId"`
+	Message   WebhookMessageV1 `json:"message"`
+	Timestamp int64            `json:"timestamp"` // Unix seconds the webhook was sent at
+}
+
+// WebhookMessageV1 is a message in version 1. Type specific fields are only present for their
+// types: caption for media and locations, mimeType for images and videos, width and height for
+// images, latitude and longitude for locations, and so on.
+type WebhookMessageV1 struct {
+	ID           string    `json:"id"`
+	From         string    `json:"from"`
+	Timestamp    time.Time `json:"timestamp"`
+	PushName     string    `json:"pushName"`
+	FromMe       bool      `json:"fromMe"`
+	RawChat      string    `json:"rawChat"`
+	RawSender    string    `json:"rawSender"`
+	RawSenderAlt string    `json:"rawSenderAlt,omitempty"`
+	IsLID        bool      `json:"isLID,omitempty"`
+	Type         string    `json:"type"` // text, image, video, live_location, location or other
+	Text         *string   `json:"text,omitempty"`
+	Caption      *string   `json:"caption,omitempty"`
+	MimeType     *string   `json:"mimeType,omitempty"`
+	Width        *uint32   `json:"width,omitempty"`
+	Height       *uint32   `json:"height,omitempty"`
+	FileSize     uint64    `json:"fileSize,omitempty"`
+	Latitude     *float64  `json:"latitude,omitempty"`
+	Longitude    *float64  `json:"longitude,omitempty"`
+	Accuracy     *uint32   `json:"accuracy,omitempty"`
+	Speed        *float32  `json:"speed,omitempty"`
+	Bearing      *uint32   `json:"bearing,omitempty"`
+	Name         *string   `json:"name,omitempty"`
+	Address      *string   `json:"address,omitempty"`
+	URL          string    `json:"url,omitempty"`
+	Mentions     []string  `json:"mentions,omitempty"`
+	IsGroup      bool      `json:"isGroup"`
+	MyPhone      string    `json:"myPhone,omitempty"`
+	FileURL      string    `json:"fileUrl,omitempty"`
+}
+
+// StatusWebhookV1 is the version 1 body of status webhooks
+type StatusWebhookV1 struct {
+	ClientID  string                 `json:"clientId"`
+	Event     string                 `json:"event"`
+	Data      map[string]interface{} `json:"data"`
+	Timestamp int64                  `json:"timestamp"` // Unix seconds the webhook was sent at
+}
+
+// MessageWebhookV2 is the version 2 body of message webhooks
+type MessageWebhookV2 struct {
+	SchemaVersion int              `json:"schemaVersion"` // 2
+	Event         string           `json:"event"`         // message
+	ClientID      string           `json:"clientId"`
+	Timestamp     time.Time        `json:"timestamp"` // When the webhook was sent
+	Message       WebhookMessageV2 `json:"message"`
+}
+
+// WebhookMessageV2 is a message in version 2
+type WebhookMessageV2 struct {
+	ID        string             `json:"id"`
+	Type      string             `json:"type"` // text, image, video, audio, document, location, live_location or other
+	Timestamp time.Time          `json:"timestamp"`
+	Chat      string             `json:"chat"`      // Chat JID, the reply target of individual chats
+	Sender    string             `json:"sender"`    // Sender JID, the reply target in groups
+	SenderAlt string             `json:"senderAlt"` // Alternate sender JID (phone number or LID), empty if unknown
+	From      string             `json:"from"`      // Sender phone number, or the LID user when fromLid is set
+	FromLID   bool               `json:"fromLid"`   // The sender's phone number is not known yet
+	PushName  string             `json:"pushName"`
+	FromMe    bool               `json:"fromMe"`
+	IsGroup   bool               `json:"isGroup"`
+	MyPhone   string             `json:"myPhone"` // Phone number of the receiving account
+	Text      string             `json:"text"`
+	Caption   string             `json:"caption"`
+	Mentions  []string           `json:"mentions"`
+	Media     *WebhookMediaV2    `json:"media"`    // Set for image, video, audio and document
+	Location  *WebhookLocationV2 `json:"location"` // Set for location and live_location
+}
+
+// WebhookMediaV2 is the attachment of a media message in version 2
+type WebhookMediaV2 struct {
+	MimeType string  `json:"mimeType"`
+	FileSize *uint64 `json:"fileSize"` // Bytes, null if unknown
+	Width    *uint32 `json:"width"`    // Pixels of images and videos, null if unknown
+	Height   *uint32 `json:"height"`
+	FileName string  `json:"fileName"` // Name of a document
+	FileURL  *string `json:"fileUrl"`  // Where aimeow serves the file, null if it couldn't be downloaded
+}
+
+// WebhookLocationV2 is the location of a location message in version 2
+type WebhookLocationV2 struct {
+	Latitude  float64  `json:"latitude"`
+	Longitude float64  `json:"longitude"`
+	Name      string   `json:"name"`
+	Address   string   `json:"address"`
+	URL       string   `json:"url"`
+	Accuracy  *uint32  `json:"accuracy"` // Meters, live locations only
+	Speed     *float32 `json:"speed"`    // Meters per second, live locations only
+	Bearing   *uint32  `json:"bearing"`  // Degrees clockwise from magnetic north, live locations only
+}
+
+// StatusWebhookV2 is the version 2 body of status webhooks
+type StatusWebhookV2 struct {
+	SchemaVersion int                    `json:"schemaVersion"` // 2
+	Event         string                 `json:"event"`
+	ClientID      string                 `json:"clientId"`
+	Timestamp     time.Time              `json:"timestamp"` // When the webhook was sent
+	Data          map[string]interface{} `json:"data"`
+}
+
+// newWebhookMedia returns the media of a message, leaving unknown sizes null
+func newWebhookMedia(mimeType string, fileSize uint64, width uint32, height uint32, fileName string) *WebhookMediaV2 {
+	media := &WebhookMediaV2{MimeType: mimeType, FileName: fileName}
+	if fileSize > 0 {
+		media.FileSize = &fileSize
+	}
+	if width > 0 && height > 0 {
+		media.Width = &width
+		media.Height = &height
+	}
+	return media
+}
+
+// webhookVersion returns the webhook schema version of a client
+func (cm *ClientManager) webhookVersion(client *WhatsAppClient) int {
+	client.mutex.RLock()
+	version := client.settings.WebhookVersion
+	client.mutex.RUnlock()
+	if version == 0 {
+		return appConfig().Webhook.PayloadVersion
+	}
+	return version
+}
+
+// messageWebhookBody returns the body of a message webhook in a schema version
+func messageWebhookBody(version int, clientID string, message WebhookMessageV2, now time.Time) interface{} {
+	if version == webhookSchemaV1 {
+		return MessageWebhookV1{ClientID: clientID, Message: message.v1(), Timestamp: now.Unix()}
+	}
+	message.Timestamp = message.Timestamp.UTC()
+	return MessageWebhookV2{
+		SchemaVersion: webhookSchemaV2,
+		Event:         webhookEventMessage,
+		ClientID:      clientID,
+		Timestamp:     now.UTC(),
+		Message:       message,
+	}
+}
+
+// statusWebhookBody returns the body of a status webhook in a schema version
+func statusWebhookBody(version int, clientID string, event string, data map[string]interface{}, now time.Time) interface{} {
+	if version == webhookSchemaV1 {
+		// Version 1 sent unformatted times in status data, the receipt timestamp, as unix seconds,
+		// and missing data as null
+		var legacy map[string]interface{}
+		if data != nil {
+			legacy = make(map[string]interface{}, len(data))
+		}
+		for k, v := range data {
+			if t, ok := v.(time.Time); ok {
+				v = t.Unix()
+			}
+			legacy[k] = v
+		}
+		return StatusWebhookV1{ClientID: clientID, Event: event, Data: legacy, Timestamp: now.Unix()}
+	}
+	if data == nil {
+		data = map[string]interface{}{}
+	}
+	return StatusWebhookV2{
+		SchemaVersion: webhookSchemaV2,
+		Event:         event,
+		ClientID:      clientID,
+		Timestamp:     now.UTC(),
+		Data:          data,
+	}
+}
+
+// v1 converts a message to version 1, which knew fewer types and left out fields that don't
+// apply to a type
+func (m WebhookMessageV2) v1() WebhookMessageV1 {
+	legacy := WebhookMessageV1{
+		ID:           m.ID,
+		From:         m.From,
+		Timestamp:    m.Timestamp,
+		PushName:     m.PushName,
+		FromMe:       m.FromMe,
+		RawChat:      m.Chat,
+		RawSender:    m.Sender,
+		RawSenderAlt: m.SenderAlt,
+		IsLID:        m.FromLID,
+		Type:         m.Type,
+		Mentions:     m.Mentions,
+		IsGroup:      m.IsGroup,
+		MyPhone:      m.MyPhone,
+	}
+	if len(legacy.Mentions) == 0 {
+		legacy.Mentions = nil
+	}
+	if m.Media != nil {
+		if m.Media.FileURL != nil {
+			legacy.FileURL = *m.Media.FileURL
+		}
+		if m.Media.FileSize != nil && (m.Type == "image" || m.Type == "video") {
+			legacy.FileSize = *m.Media.FileSize
+		}
+	}
+
+	switch m.Type {
+	case "text":
+		legacy.Text = &m.Text
+	case "image":
+		legacy.Caption = &m.Caption
+		legacy.MimeType = &m.Media.MimeType
+		var width, height uint32
+		if m.Media.Width != nil {
+			width, height = *m.Media.Width, *m.Media.Height
+		}
+		legacy.Width, legacy.Height = &width, &height
+	case "video":
+		legacy.Caption = &m.Caption
+		legacy.MimeType = &m.Media.MimeType
+	case "live_location":
+		legacy.Caption = &m.Caption
+		legacy.Latitude, legacy.Longitude = &m.Location.Latitude, &m.Location.Longitude
+		legacy.Accuracy, legacy.Speed, legacy.Bearing = m.Location.Accuracy, m.Location.Speed, m.Location.Bearing
+	case "location":
+		legacy.Latitude, legacy.Longitude = &m.Location.Latitude, &m.Location.Longitude
+		legacy.Name, legacy.Address = &m.Location.Name, &m.Location.Address
+		legacy.URL = m.Location.URL
+	default:
+		// Audio and documents were reported as other types, without mentions
+		legacy.Type = "other"
+		legacy.Mentions = nil
+	}
+	return legacy
+}
+
+// webhookSchemas holds the JSON Schema of every webhook payload version
+//
+//go:embed schema/webhook-v*.json
+var webhookSchemas embed.FS
+
+// @Summary Get webhook payload schema
+// @Description Returns the JSON Schema of a webhook payload version, the latest by default. Set the version with webhook.payloadVersion or per client with the webhookVersion setting.
+// @Tags config
+// @Produce json
+// @Param version query int false "Payload version (1 or 2)"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Router /webhooks/schema [get]
+func getWebhookSchema(c *gin.Context) {
+	version := latestWebhookSchemaVersion
+	if v := c.Query("version"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed < webhookSchemaV1 || parsed > latestWebhookSchemaVersion {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("version must be between %d and %d", webhookSchemaV1, latestWebhookSchemaVersion)})
+			return
+		}
+		version = parsed
+	}
+
+	schema, err := webhookSchemas.ReadFile(fmt.Sprintf("schema/webhook-v%d.json", version))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Data(http.StatusOK, "application/schema+json", schema)
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/store"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+// testWebhookNow is when the webhooks of the tests are sent
+var testWebhookNow = time.Unix(1735787045, 0)
+
+type webhookCase struct {
+	name       string
+	chat       string
+	sender     string
+	senderAlt  string
+	isGroup    bool
+	downloaded bool
+	message    *waE2E.Message
+	v1         string // Body the version 1 builder sent before payloads were versioned
+}
+
+var webhookCases = []webhookCase{
+	{
+		name: "text", chat: "6281234567890@s.whatsapp.net", sender: "6281234567890@s.whatsapp.net",
+		message: &waE2E.Message{Conversation: proto.String("halo")},
+		v1:      `{"clientId":"c1","message":{"from":"6281234567890","fromMe":false,"id":"3EB0TEXT","isGroup":false,"myPhone":"6281111111111","pushName":"Budi","rawChat":"6281234567890@s.whatsapp.net","rawSender":"6281234567890@s.whatsapp.net","text":"halo","timestamp":"2025-01-02T03:04:05Z","type":"text"},"timestamp":1735787045}`,
+	},
+	{
+		name: "text with mentions", chat: "120363000000000001@g.us", sender: "6281234567890@s.whatsapp.net", isGroup: true,
+		message: &waE2E.Message{ExtendedTextMessage: &waE2E.ExtendedTextMessage{
+			Text:        proto.String("@6289876543210 cek"),
+			ContextInfo: &waE2E.ContextInfo{MentionedJID: []string{"6289876543210@s.whatsapp.net"}},
+		}},
+		v1: `{"clientId":"c1","message":{"from":"6281234567890","fromMe":false,"id":"3EB0TEXTWITHMENTIONS","isGroup":true,"mentions":["6289876543210@s.whatsapp.net"],"myPhone":"6281111111111","pushName":"Budi","rawChat":"120363000000000001@g.us","rawSender":"6281234567890@s.whatsapp.net","text":"@6289876543210 cek","timestamp":"2025-01-02T03:04:05Z","type":"text"},"timestamp":1735787045}`,
+	},
+	{
+		name: "image", chat: "123456789012345@lid", sender: "123456789012345@lid", senderAlt: "6281234567890@s.whatsapp.net", downloaded: true,
+		message: &waE2E.Message{ImageMessage: &waE2E.ImageMessage{
+			Caption: proto.String("struk"), Mimetype: proto.String("image/jpeg"),
+			Width: proto.Uint32(800), Height: proto.Uint32(600), FileLength: proto.Uint64(52431),
+			ContextInfo: &waE2E.ContextInfo{MentionedJID: []string{"6289876543210@s.whatsapp.net"}},
+		}},
+		v1: `{"clientId":"c1","message":{"caption":"struk","fileSize":52431,"fileUrl":"http://localhost:7030/files/c1/3EB0IMAGE","from":"6281234567890","fromMe":false,"height":600,"id":"3EB0IMAGE","isGroup":false,"mentions":["6289876543210@s.whatsapp.net"],"mimeType":"image/jpeg","myPhone":"6281111111111","pushName":"Budi","rawChat":"123456789012345@lid","rawSender":"123456789012345@lid","rawSenderAlt":"6281234567890@s.whatsapp.net","timestamp":"2025-01-02T03:04:05Z","type":"image","width":800},"timestamp":1735787045}`,
+	},
+	{
+		name: "image without size", chat: "6281234567890@s.whatsapp.net", sender: "6281234567890@s.whatsapp.net",
+		message: &waE2E.Message{ImageMessage: &waE2E.ImageMessage{Mimetype: proto.String("image/png")}},
+		v1:      `{"clientId":"c1","message":{"caption":"","from":"6281234567890","fromMe":false,"height":0,"id":"3EB0IMAGEWITHOUTSIZE","isGroup":false,"mimeType":"image/png","myPhone":"6281111111111","pushName":"Budi","rawChat":"6281234567890@s.whatsapp.net","rawSender":"6281234567890@s.whatsapp.net","timestamp":"2025-01-02T03:04:05Z","type":"image","width":0},"timestamp":1735787045}`,
+	},
+	{
+		name: "video", chat: "6281234567890@s.whatsapp.net", sender: "6281234567890@s.whatsapp.net", downloaded: true,
+		message: &waE2E.Message{VideoMessage: &waE2E.VideoMessage{
+			Caption: proto.String("klip"), Mimetype: proto.String("video/mp4"),
+			Width: proto.Uint32(1280), Height: proto.Uint32(720), FileLength: proto.Uint64(1048576),
+		}},
+		v1: `{"clientId":"c1","message":{"caption":"klip","fileSize":1048576,"fileUrl":"http://localhost:7030/files/c1/3EB0VIDEO","from":"6281234567890","fromMe":false,"id":"3EB0VIDEO","isGroup":false,"mimeType":"video/mp4","myPhone":"6281111111111","pushName":"Budi","rawChat":"6281234567890@s.whatsapp.net","rawSender":"6281234567890@s.whatsapp.net","timestamp":"2025-01-02T03:04:05Z","type":"video"},"timestamp":1735787045}`,
+	},
+	{
+		name: "audio", chat: "6281234567890@s.whatsapp.net", sender: "6281234567890@s.whatsapp.net", downloaded: true,
+		message: &waE2E.Message{AudioMessage: &waE2E.AudioMessage{
+			Mimetype: proto.String("audio/ogg; codecs=opus"), FileLength: proto.Uint64(4096),
+			ContextInfo: &waE2E.ContextInfo{MentionedJID: []string{"6289876543210@s.whatsapp.net"}},
+		}},
+		v1: `{"clientId":"c1","message":{"fileUrl":"http://localhost:7030/files/c1/3EB0AUDIO","from":"6281234567890","fromMe":false,"id":"3EB0AUDIO","isGroup":false,"myPhone":"6281111111111","pushName":"Budi","rawChat":"6281234567890@s.whatsapp.net","rawSender":"6281234567890@s.whatsapp.net","timestamp":"2025-01-02T03:04:05Z","type":"other"},"timestamp":1735787045}`,
+	},
+	{
+		name: "document", chat: "6281234567890@s.whatsapp.net", sender: "6281234567890@s.whatsapp.net",
+		message: &waE2E.Message{DocumentMessage: &waE2E.DocumentMessage{
+			Caption: proto.String("invoice"), Mimetype: proto.String("application/pdf"),
+			FileName: proto.String("invoice.pdf"), FileLength: proto.Uint64(20480),
+		}},
+		v1: `{"clientId":"c1","message":{"from":"6281234567890","fromMe":false,"id":"3EB0DOCUMENT","isGroup":false,"myPhone":"6281111111111","pushName":"Budi","rawChat":"6281234567890@s.whatsapp.net","rawSender":"6281234567890@s.whatsapp.net","timestamp":"2025-01-02T03:04:05Z","type":"other"},"timestamp":1735787045}`,
+	},
+	{
+		name: "location", chat: "6281234567890@s.whatsapp.net", sender: "6281234567890@s.whatsapp.net",
+		message: &waE2E.Message{LocationMessage: &waE2E.LocationMessage{
+			DegreesLatitude: proto.Float64(-6.2), DegreesLongitude: proto.Float64(106.816666),
+			Name: proto.String("Monas"), Address: proto.String("Gambir, Jakarta"), URL: proto.String("https://maps.example/monas"),
+		}},
+		v1: `{"clientId":"c1","message":{"address":"Gambir, Jakarta","from":"6281234567890","fromMe":false,"id":"3EB0LOCATION","isGroup":false,"latitude":-6.2,"longitude":106.816666,"myPhone":"6281111111111","name":"Monas","pushName":"Budi","rawChat":"6281234567890@s.whatsapp.net","rawSender":"6281234567890@s.whatsapp.net","timestamp":"2025-01-02T03:04:05Z","type":"location","url":"https://maps.example/monas"},"timestamp":1735787045}`,
+	},
+	{
+		name: "location without url", chat: "6281234567890@s.whatsapp.net", sender: "6281234567890@s.whatsapp.net",
+		message: &waE2E.Message{LocationMessage: &waE2E.LocationMessage{
+			DegreesLatitude: proto.Float64(-6.2), DegreesLongitude: proto.Float64(106.816666),
+		}},
+		v1: `{"clientId":"c1","message":{"address":"","from":"6281234567890","fromMe":false,"id":"3EB0LOCATIONWITHOUTURL","isGroup":false,"latitude":-6.2,"longitude":106.816666,"myPhone":"6281111111111","name":"","pushName":"Budi","rawChat":"6281234567890@s.whatsapp.net","rawSender":"6281234567890@s.whatsapp.net","timestamp":"2025-01-02T03:04:05Z","type":"location"},"timestamp":1735787045}`,
+	},
+	{
+		name: "live location", chat: "6281234567890@s.whatsapp.net", sender: "6281234567890@s.whatsapp.net",
+		message: &waE2E.Message{LiveLocationMessage: &waE2E.LiveLocationMessage{
+			DegreesLatitude: proto.Float64(-6.2), DegreesLongitude: proto.Float64(106.816666),
+			AccuracyInMeters: proto.Uint32(12), SpeedInMps: proto.Float32(1.5), DegreesClockwiseFromMagneticNorth: proto.Uint32(90),
+			Caption:     proto.String("otw"),
+			ContextInfo: &waE2E.ContextInfo{MentionedJID: []string{"6289876543210@s.whatsapp.net"}},
+		}},
+		v1: `{"clientId":"c1","message":{"accuracy":12,"bearing":90,"caption":"otw","from":"6281234567890","fromMe":false,"id":"3EB0LIVELOCATION","isGroup":false,"latitude":-6.2,"longitude":106.816666,"mentions":["6289876543210@s.whatsapp.net"],"myPhone":"6281111111111","pushName":"Budi","rawChat":"6281234567890@s.whatsapp.net","rawSender":"6281234567890@s.whatsapp.net","speed":1.5,"timestamp":"2025-01-02T03:04:05Z","type":"live_location"},"timestamp":1735787045}`,
+	},
+}
+
+// testWebhookClient returns a manager and paired client whose messages are built into webhooks
+func testWebhookClient(t *testing.T) (*ClientManager, *WhatsAppClient) {
+	t.Helper()
+	baseURL = "http://localhost:7030"
+	deviceJID := types.NewADJID("6281111111111", 0, 3)
+	cm := &ClientManager{clientIDMap: map[string]string{deviceJID.String(): "c1"}}
+	client := &WhatsAppClient{deviceStore: &store.Device{ID: &deviceJID}, images: make(map[string]string)}
+	return cm, client
+}
+
+// testWebhookEvent returns the incoming message of a case
+func testWebhookEvent(t *testing.T, client *WhatsAppClient, tc webhookCase) *events.Message {
+	t.Helper()
+	id := "3EB0" + strings.ToUpper(strings.ReplaceAll(tc.name, " ", ""))
+	evt := &events.Message{Message: tc.message}
+	evt.Info.ID = id
+	evt.Info.PushName = "Budi"
+	evt.Info.Timestamp = time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	evt.Info.IsGroup = tc.isGroup
+	evt.Info.Chat = parseTestJID(t, tc.chat)
+	evt.Info.Sender = parseTestJID(t, tc.sender)
+	if tc.senderAlt != "" {
+		evt.Info.SenderAlt = parseTestJID(t, tc.senderAlt)
+	}
+	if tc.downloaded {
+		client.images[id] = "/tmp/" + id
+	}
+	return evt
+}
+
+func parseTestJID(t *testing.T, s string) types.JID {
+	t.Helper()
+	jid, err := types.ParseJID(s)
+	if err != nil {
+		t.Fatalf("invalid JID %q: %v", s, err)
+	}
+	return jid
+}
+
+var statusWebhookCases = []struct {
+	name string
+	data map[string]interface{}
+	v1   string
+}{
+	{
+		name: "message_receipt",
+		data: map[string]interface{}{
+			"messageIds": []string{"3EB0TEXT"},
+			"chat":       "6281234567890@s.whatsapp.net",
+			"sender":     "6281234567890@s.whatsapp.net",
+			"receipt":    "read",
+			"timestamp":  time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC),
+		},
+		v1: `{"clientId":"c1","data":{"chat":"6281234567890@s.whatsapp.net","messageIds":["3EB0TEXT"],"receipt":"read","sender":"6281234567890@s.whatsapp.net","timestamp":1735787045},"event":"message_receipt","timestamp":1735787045}`,
+	},
+	{
+		name: "connected",
+		data: map[string]interface{}{"phone": "6281111111111"},
+		v1:   `{"clientId":"c1","data":{"phone":"6281111111111"},"event":"connected","timestamp":1735787045}`,
+	},
+	{
+		name: "logged_out",
+		v1:   `{"clientId":"c1","data":null,"event":"logged_out","timestamp":1735787045}`,
+	},
+}
+
+// assertJSONEqual compares two JSON documents regardless of key order
+func assertJSONEqual(t *testing.T, got []byte, want string) {
+	t.Helper()
+	var gotValue, wantValue interface{}
+	if err := json.Unmarshal(got, &gotValue); err != nil {
+		t.Fatalf("invalid JSON %s: %v", got, err)
+	}
+	if err := json.Unmarshal([]byte(want), &wantValue); err != nil {
+		t.Fatalf("invalid golden JSON %s: %v", want, err)
+	}
+	if !reflect.DeepEqual(gotValue, wantValue) {
+		t.Errorf("JSON mismatch\n got: %s\nwant: %s", got, want)
+	}
+}
+
+func TestMessageWebhookV1MatchesBaseline(t *testing.T) {
+	cm, client := testWebhookClient(t)
+	for _, tc := range webhookCases {
+		t.Run(tc.name, func(t *testing.T) {
+			clientID, message := cm.extractMessageData(client, testWebhookEvent(t, client, tc))
+			body, err := json.Marshal(messageWebhookBody(webhookSchemaV1, clientID, message, testWebhookNow))
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertJSONEqual(t, body, tc.v1)
+		})
+	}
+}
+
+func TestStatusWebhookV1MatchesBaseline(t *testing.T) {
+	for _, tc := range statusWebhookCases {
+		t.Run(tc.name, func(t *testing.T) {
+			body, err := json.Marshal(statusWebhookBody(webhookSchemaV1, "c1", tc.name, tc.data, testWebhookNow))
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertJSONEqual(t, body, tc.v1)
+		})
+	}
+}
+
+// compileWebhookSchema compiles the embedded JSON Schema of a payload version
+func compileWebhookSchema(t *testing.T, version int) *jsonschema.Schema {
+	t.Helper()
+	raw, err := webhookSchemas.ReadFile(fmt.Sprintf("schema/webhook-v%d.json", version))
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := fmt.Sprintf("https://github.com/rizrmd/aimeow/schema/webhook-v%d.json", version)
+	compiler := jsonschema.NewCompiler()
+	compiler.AssertFormat()
+	if err := compiler.AddResource(url, doc); err != nil {
+		t.Fatal(err)
+	}
+	schema, err := compiler.Compile(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return schema
+}
+
+// validateWebhookBody checks a webhook body against a schema
+func validateWebhookBody(t *testing.T, schema *jsonschema.Schema, body interface{}) {
+	t.Helper()
+	raw, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := schema.Validate(doc); err != nil {
+		t.Errorf("%s does not match the schema: %v", raw, err)
+	}
+}
+
+func TestWebhookBodiesMatchSchemas(t *testing.T) {
+	cm, client := testWebhookClient(t)
+	for _, version := range []int{webhookSchemaV1, webhookSchemaV2} {
+		schema := compileWebhookSchema(t, version)
+		for _, tc := range webhookCases {
+			t.Run(fmt.Sprintf("v%d %s", version, tc.name), func(t *testing.T) {
+				clientID, message := cm.extractMessageData(client, testWebhookEvent(t, client, tc))
+				validateWebhookBody(t, schema, messageWebhookBody(version, clientID, message, testWebhookNow))
+			})
+		}
+		for _, tc := range statusWebhookCases {
+			t.Run(fmt.Sprintf("v%d %s", version, tc.name), func(t *testing.T) {
+				validateWebhookBody(t, schema, statusWebhookBody(version, "c1", tc.name, tc.data, testWebhookNow))
+			})
+		}
+	}
+}